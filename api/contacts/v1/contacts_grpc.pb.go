@@ -0,0 +1,368 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: contacts/v1/contacts.proto
+
+// contacts.v1 is the typed RPC api to the contacts store, served alongside the REST api.
+// Errors use the canonical gRPC codes: NOT_FOUND for missing contacts, INVALID_ARGUMENT for
+// invalid ids, page tokens and contacts failing validation, ALREADY_EXISTS for a taken email.
+
+package contactsv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ContactService_Get_FullMethodName    = "/contacts.v1.ContactService/Get"
+	ContactService_List_FullMethodName   = "/contacts.v1.ContactService/List"
+	ContactService_Create_FullMethodName = "/contacts.v1.ContactService/Create"
+	ContactService_Update_FullMethodName = "/contacts.v1.ContactService/Update"
+	ContactService_Delete_FullMethodName = "/contacts.v1.ContactService/Delete"
+	ContactService_Export_FullMethodName = "/contacts.v1.ContactService/Export"
+	ContactService_Import_FullMethodName = "/contacts.v1.ContactService/Import"
+)
+
+// ContactServiceClient is the client API for ContactService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ContactService reads and writes the contacts of the store the REST api uses
+type ContactServiceClient interface {
+	// Get returns the contact with the id
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Contact, error)
+	// List returns a page of the contacts matching the filter ordered by id
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// Create validates and stores a new contact, its id is assigned by the store
+	Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*Contact, error)
+	// Update validates and replaces every field of an existing contact
+	Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*Contact, error)
+	// Delete deletes the contact with the id
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// Export streams every contact matching the filter ordered by id
+	Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Contact], error)
+	// Import validates and stores the streamed contacts, rows failing validation are reported and skipped
+	Import(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ImportRequest, ImportResponse], error)
+}
+
+type contactServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewContactServiceClient(cc grpc.ClientConnInterface) ContactServiceClient {
+	return &contactServiceClient{cc}
+}
+
+func (c *contactServiceClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Contact, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Contact)
+	err := c.cc.Invoke(ctx, ContactService_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *contactServiceClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, ContactService_List_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *contactServiceClient) Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*Contact, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Contact)
+	err := c.cc.Invoke(ctx, ContactService_Create_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *contactServiceClient) Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*Contact, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Contact)
+	err := c.cc.Invoke(ctx, ContactService_Update_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *contactServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, ContactService_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *contactServiceClient) Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Contact], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ContactService_ServiceDesc.Streams[0], ContactService_Export_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportRequest, Contact]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ContactService_ExportClient = grpc.ServerStreamingClient[Contact]
+
+func (c *contactServiceClient) Import(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ImportRequest, ImportResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ContactService_ServiceDesc.Streams[1], ContactService_Import_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ImportRequest, ImportResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ContactService_ImportClient = grpc.ClientStreamingClient[ImportRequest, ImportResponse]
+
+// ContactServiceServer is the server API for ContactService service.
+// All implementations must embed UnimplementedContactServiceServer
+// for forward compatibility.
+//
+// ContactService reads and writes the contacts of the store the REST api uses
+type ContactServiceServer interface {
+	// Get returns the contact with the id
+	Get(context.Context, *GetRequest) (*Contact, error)
+	// List returns a page of the contacts matching the filter ordered by id
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	// Create validates and stores a new contact, its id is assigned by the store
+	Create(context.Context, *CreateRequest) (*Contact, error)
+	// Update validates and replaces every field of an existing contact
+	Update(context.Context, *UpdateRequest) (*Contact, error)
+	// Delete deletes the contact with the id
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// Export streams every contact matching the filter ordered by id
+	Export(*ExportRequest, grpc.ServerStreamingServer[Contact]) error
+	// Import validates and stores the streamed contacts, rows failing validation are reported and skipped
+	Import(grpc.ClientStreamingServer[ImportRequest, ImportResponse]) error
+	mustEmbedUnimplementedContactServiceServer()
+}
+
+// UnimplementedContactServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedContactServiceServer struct{}
+
+func (UnimplementedContactServiceServer) Get(context.Context, *GetRequest) (*Contact, error) {
+	return nil, status.Error(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedContactServiceServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedContactServiceServer) Create(context.Context, *CreateRequest) (*Contact, error) {
+	return nil, status.Error(codes.Unimplemented, "method Create not implemented")
+}
+func (UnimplementedContactServiceServer) Update(context.Context, *UpdateRequest) (*Contact, error) {
+	return nil, status.Error(codes.Unimplemented, "method Update not implemented")
+}
+func (UnimplementedContactServiceServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedContactServiceServer) Export(*ExportRequest, grpc.ServerStreamingServer[Contact]) error {
+	return status.Error(codes.Unimplemented, "method Export not implemented")
+}
+func (UnimplementedContactServiceServer) Import(grpc.ClientStreamingServer[ImportRequest, ImportResponse]) error {
+	return status.Error(codes.Unimplemented, "method Import not implemented")
+}
+func (UnimplementedContactServiceServer) mustEmbedUnimplementedContactServiceServer() {}
+func (UnimplementedContactServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeContactServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ContactServiceServer will
+// result in compilation errors.
+type UnsafeContactServiceServer interface {
+	mustEmbedUnimplementedContactServiceServer()
+}
+
+func RegisterContactServiceServer(s grpc.ServiceRegistrar, srv ContactServiceServer) {
+	// If the following call panics, it indicates UnimplementedContactServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ContactService_ServiceDesc, srv)
+}
+
+func _ContactService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ContactServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ContactService_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ContactServiceServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ContactService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ContactServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ContactService_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ContactServiceServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ContactService_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ContactServiceServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ContactService_Create_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ContactServiceServer).Create(ctx, req.(*CreateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ContactService_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ContactServiceServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ContactService_Update_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ContactServiceServer).Update(ctx, req.(*UpdateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ContactService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ContactServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ContactService_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ContactServiceServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ContactService_Export_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ContactServiceServer).Export(m, &grpc.GenericServerStream[ExportRequest, Contact]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ContactService_ExportServer = grpc.ServerStreamingServer[Contact]
+
+func _ContactService_Import_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ContactServiceServer).Import(&grpc.GenericServerStream[ImportRequest, ImportResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ContactService_ImportServer = grpc.ClientStreamingServer[ImportRequest, ImportResponse]
+
+// ContactService_ServiceDesc is the grpc.ServiceDesc for ContactService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ContactService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "contacts.v1.ContactService",
+	HandlerType: (*ContactServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _ContactService_Get_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _ContactService_List_Handler,
+		},
+		{
+			MethodName: "Create",
+			Handler:    _ContactService_Create_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _ContactService_Update_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _ContactService_Delete_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Export",
+			Handler:       _ContactService_Export_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Import",
+			Handler:       _ContactService_Import_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "contacts/v1/contacts.proto",
+}
@@ -0,0 +1,216 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// option defaults
+const (
+	defaultMaxRetries = 3
+	defaultBackoff    = 100 * time.Millisecond
+	defaultMaxBackoff = 5 * time.Second
+)
+
+// Client calls the contacts api. Every method takes a context cancelling the request along with any wait between
+// retries, failed requests return an *Error holding the problem the server responded with
+type Client interface {
+	// CreateContact creates a contact, returning it with its id
+	CreateContact(ctx context.Context, contact models.ContactV2) (models.ContactV2, error)
+	// GetContact returns the contact with id
+	GetContact(ctx context.Context, id string) (models.ContactV2, error)
+	// UpdateContact replaces the contact with the id of contact, every email, phone and address included
+	UpdateContact(ctx context.Context, contact models.ContactV2) (models.ContactV2, error)
+	// DeleteContact deletes the contact with id
+	DeleteContact(ctx context.Context, id string) error
+	// Contacts iterates every contact ordered by id, reading pageSize contacts at a time
+	Contacts(pageSize int) ContactIterator
+	// ImportContacts uploads a csv, vCard, LDIF, json, ndjson or xlsx file streamed from r, name helps detecting
+	// its type. An import in which every row was rejected fails with the import_rejected problem listing why
+	ImportContacts(ctx context.Context, name string, r io.Reader, opts ImportOptions) (models.ImportReport, error)
+	// ExportContacts streams the contacts as a file, the caller must close it
+	ExportContacts(ctx context.Context, opts ExportOptions) (io.ReadCloser, error)
+}
+
+// Options tune a Client
+type Options struct {
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+	// MaxRetries retries of a request answered 429 or 5xx, defaults to 3 and negative disables retries
+	MaxRetries int
+	// Backoff wait before the first retry, doubled for every other retry and defaults to 100ms. A Retry-After
+	// header of the response overrides it
+	Backoff time.Duration
+	// MaxBackoff longest wait between retries, defaults to 5s
+	MaxBackoff time.Duration
+}
+
+// client is the implementation of the Client interface
+type client struct {
+	base       *url.URL
+	http       *http.Client
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// NewClient creates a Client of the api served at baseURL, such as https://contacts.example.com
+func NewClient(baseURL string, opts Options) (Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	c := &client{
+		base:       base,
+		http:       opts.HTTPClient,
+		maxRetries: opts.MaxRetries,
+		backoff:    opts.Backoff,
+		maxBackoff: opts.MaxBackoff,
+	}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+	switch {
+	case c.maxRetries == 0:
+		c.maxRetries = defaultMaxRetries
+	case c.maxRetries < 0:
+		c.maxRetries = 0
+	}
+	if c.backoff <= 0 {
+		c.backoff = defaultBackoff
+	}
+	if c.maxBackoff <= 0 {
+		c.maxBackoff = defaultMaxBackoff
+	}
+	return c, nil
+}
+
+// request a request that can be sent again, body is nil or the whole body
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        []byte
+	contentType string
+}
+
+// jsonRequest returns a request sending v as json
+func jsonRequest(method, path string, v interface{}) (request, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return request{}, err
+	}
+	return request{method: method, path: path, body: body, contentType: "application/json"}, nil
+}
+
+// do sends req, retrying it while the server answers 429 or 5xx. A POST is only retried on 429 and 503, which
+// tell the request was not handled, as any other error may come after the contact was created. Responses
+// with another status of at least 400 are returned as an *Error
+func (c *client) do(ctx context.Context, req request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		var body io.Reader
+		if req.body != nil {
+			body = bytes.NewReader(req.body)
+		}
+		res, err := c.send(ctx, req.method, c.url(req.path, req.query), body, req.contentType)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode < http.StatusBadRequest {
+			return res, nil
+		}
+		if attempt == c.maxRetries || !retryable(req.method, res.StatusCode) {
+			return nil, decodeError(res)
+		}
+
+		wait := c.wait(attempt, res.Header.Get("Retry-After"))
+		drain(res)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// send sends a single request
+func (c *client) send(ctx context.Context, method, target string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.http.Do(req)
+}
+
+// url returns the absolute url of path, a path holding a query keeps it
+func (c *client) url(path string, query url.Values) string {
+	u := *c.base
+	ref, err := url.Parse(path)
+	if err != nil {
+		ref = &url.URL{Path: path}
+	}
+	u.Path = c.base.Path + ref.Path
+	u.RawQuery = ref.RawQuery
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// wait returns the wait before retry attempt+1, retryAfter is the Retry-After header of the failed response
+func (c *client) wait(attempt int, retryAfter string) time.Duration {
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(retryAfter); err == nil {
+		if wait := time.Until(t); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+	wait := c.backoff << uint(attempt)
+	if wait > c.maxBackoff || wait <= 0 {
+		return c.maxBackoff
+	}
+	return wait
+}
+
+// retryable reports whether a request answered with status may be sent again
+func retryable(method string, status int) bool {
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+		return true
+	case status >= http.StatusInternalServerError:
+		return method != http.MethodPost
+	}
+	return false
+}
+
+// decodeJSON decodes the body of res into v and closes it
+func decodeJSON(res *http.Response, v interface{}) error {
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// drain reads the rest of the body of res so the connection is reused and closes it
+func drain(res *http.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+	res.Body.Close()
+}
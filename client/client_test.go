@@ -0,0 +1,209 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/squanchersquanch/contacts/components/connectors"
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/squanchersquanch/contacts/services/config"
+	"github.com/squanchersquanch/contacts/services/router"
+	"github.com/stretchr/testify/assert"
+)
+
+const configFile = "../development.yaml"
+
+// server the api served with an in memory store
+type server struct {
+	*httptest.Server
+	connector connectors.Connector
+}
+
+// Close stops the server and its workers
+func (s server) Close() {
+	s.Server.Close()
+	s.connector.Close()
+}
+
+// newServer starts the api with an in memory store, wrap lets a test put a handler in front of it
+func newServer(t *testing.T, wrap func(http.Handler) http.Handler) (server, Client) {
+	contacts := store.NewMemoryStore()
+	cfg := config.NewConfig(configFile)
+	connector := connectors.NewConnector(contacts, cfg)
+	connector.Start(context.Background())
+	var handler http.Handler = router.NewRouter(connector, contacts, cfg)
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	s := server{Server: httptest.NewServer(handler), connector: connector}
+	c, err := NewClient(s.URL, Options{Backoff: time.Millisecond})
+	assert.NoError(t, err)
+	return s, c
+}
+
+func TestContacts(t *testing.T) {
+	server, c := newServer(t, nil)
+	defer server.Close()
+	ctx := context.Background()
+
+	created, err := c.CreateContact(ctx, models.ContactV2{
+		FirstName: "tom",
+		Emails:    []models.Email{{Value: "tom@example.com", Type: "work"}, {Value: "tom@home.example.com"}},
+		Phones:    []models.Phone{{Value: "(555) 555-5555"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", created.ID)
+	assert.Equal(t, "+15555555555", created.Phones[0].Value)
+
+	created.LastName = "dob"
+	created.Emails = created.Emails[:1]
+	updated, err := c.UpdateContact(ctx, created)
+	assert.NoError(t, err)
+	assert.Equal(t, "dob", updated.LastName)
+
+	contact, err := c.GetContact(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, updated, contact)
+
+	_, err = c.CreateContact(ctx, models.ContactV2{FirstName: "ann", Emails: []models.Email{{Value: "ann"}}})
+	e, ok := err.(*Error)
+	if assert.True(t, ok, "%v", err) {
+		assert.Equal(t, http.StatusUnprocessableEntity, e.StatusCode)
+		assert.Equal(t, models.CodeValidationFailed, e.Problem.Code)
+		assert.Equal(t, []models.FieldError{{Field: "emails[0].value", Message: "must be a valid email address"}}, e.Problem.Errors)
+	}
+	_, err = c.CreateContact(ctx, models.ContactV2{FirstName: "tom", Emails: []models.Email{{Value: "tom@example.com"}}})
+	assert.True(t, HasCode(err, models.CodeDuplicateEmail))
+
+	assert.NoError(t, c.DeleteContact(ctx, "1"))
+	_, err = c.GetContact(ctx, "1")
+	assert.True(t, HasCode(err, models.CodeNotFound))
+	assert.EqualError(t, c.DeleteContact(ctx, "1"), "contacts: 404 not_found: contact not found")
+}
+
+func TestContactIterator(t *testing.T) {
+	pages := int32(0)
+	server, c := newServer(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && r.URL.Path == contactsPath {
+				atomic.AddInt32(&pages, 1)
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+	defer server.Close()
+	ctx := context.Background()
+
+	for _, name := range []string{"ann", "bob", "cat", "dan", "eve"} {
+		_, err := c.CreateContact(ctx, models.ContactV2{FirstName: name, Emails: []models.Email{{Value: name + "@example.com"}}})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, c.DeleteContact(ctx, "2"))
+
+	names := []string{}
+	it := c.Contacts(2)
+	for it.Next(ctx) {
+		names = append(names, it.Contact().FirstName)
+	}
+	assert.NoError(t, it.Err())
+	assert.Equal(t, []string{"ann", "cat", "dan", "eve"}, names)
+	assert.Equal(t, int32(2), pages)
+	assert.False(t, it.Next(ctx))
+
+	it = c.Contacts(5000)
+	assert.False(t, it.Next(ctx))
+	assert.True(t, HasCode(it.Err(), models.CodeInvalidParameter))
+}
+
+func TestImportExport(t *testing.T) {
+	server, c := newServer(t, nil)
+	defer server.Close()
+	ctx := context.Background()
+
+	report, err := c.ImportContacts(ctx, "contacts.csv", strings.NewReader("first_name;email\nann;ann@example.com\nbob;bob\n"),
+		ImportOptions{Match: "email", CSV: CSVOptions{Delimiter: "semicolon"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Total)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, []models.FieldError{{Field: "rows[1].email", Message: "must be a valid email address"}}, report.Errors)
+
+	_, err = c.ImportContacts(ctx, "contacts.csv", strings.NewReader("first_name,email\nbob,bob\n"), ImportOptions{})
+	assert.True(t, HasCode(err, models.CodeImportRejected))
+
+	file, err := c.ExportContacts(ctx, ExportOptions{Format: "ndjson", Filter: models.ContactFilter{Query: "ann"}})
+	if assert.NoError(t, err) {
+		data, err := ioutil.ReadAll(file)
+		file.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, `{"id":"1","first_name":"ann","last_name":"","emails":[{"value":"ann@example.com"}],"phones":[],"addresses":[]}`+"\n", string(data))
+	}
+	_, err = c.ExportContacts(ctx, ExportOptions{Format: "pdf"})
+	assert.True(t, HasCode(err, models.CodeInvalidParameter))
+}
+
+func TestRetry(t *testing.T) {
+	failures := int32(0)
+	status := http.StatusServiceUnavailable
+	retryAfter := "0"
+	server, c := newServer(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&failures, -1) >= 0 {
+				if retryAfter != "" {
+					w.Header().Set("Retry-After", retryAfter)
+				}
+				w.WriteHeader(status)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	})
+	defer server.Close()
+	ctx := context.Background()
+	contact := models.ContactV2{FirstName: "tom", Emails: []models.Email{{Value: "tom@example.com"}}}
+
+	atomic.StoreInt32(&failures, 2)
+	_, err := c.CreateContact(ctx, contact)
+	assert.NoError(t, err, "503 is retried")
+
+	atomic.StoreInt32(&failures, 4)
+	_, err = c.GetContact(ctx, "1")
+	e, ok := err.(*Error)
+	if assert.True(t, ok, "%v", err) {
+		assert.Equal(t, http.StatusServiceUnavailable, e.StatusCode)
+		assert.Empty(t, e.Problem.Code)
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&failures), "the request is sent once and retried 3 times")
+
+	status = http.StatusInternalServerError
+	atomic.StoreInt32(&failures, 1)
+	_, err = c.CreateContact(ctx, contact)
+	assert.EqualError(t, err, "contacts: 500 Internal Server Error", "a failed POST is not retried")
+	atomic.StoreInt32(&failures, 1)
+	_, err = c.GetContact(ctx, "1")
+	assert.NoError(t, err)
+
+	c, _ = NewClient(server.URL, Options{Backoff: time.Hour})
+	status = http.StatusTooManyRequests
+	retryAfter = ""
+	atomic.StoreInt32(&failures, 1)
+	cancelled, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = c.GetContact(cancelled, "1")
+	assert.Equal(t, context.DeadlineExceeded, err, "the wait between retries ends with the context")
+}
+
+func TestWait(t *testing.T) {
+	c := &client{backoff: 100 * time.Millisecond, maxBackoff: time.Second}
+	assert.Equal(t, 100*time.Millisecond, c.wait(0, ""))
+	assert.Equal(t, 400*time.Millisecond, c.wait(2, ""))
+	assert.Equal(t, time.Second, c.wait(10, ""))
+	assert.Equal(t, 3*time.Second, c.wait(0, "3"))
+	assert.Equal(t, time.Duration(0), c.wait(0, "Mon, 02 Jan 2006 15:04:05 GMT"))
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// contacts paths
+const (
+	contactsPath = "/api/v2/contacts"
+	contactPath  = "/api/v2/contacts/"
+)
+
+// nextLink matches the url of the next page in a Link header
+var nextLink = regexp.MustCompile(`<([^>]*)>\s*;\s*rel="?next"?`)
+
+// CreateContact creates a contact, returning it with its id
+func (c *client) CreateContact(ctx context.Context, contact models.ContactV2) (models.ContactV2, error) {
+	return c.writeContact(ctx, http.MethodPost, contactsPath, contact)
+}
+
+// GetContact returns the contact with id
+func (c *client) GetContact(ctx context.Context, id string) (models.ContactV2, error) {
+	res, err := c.do(ctx, request{method: http.MethodGet, path: contactPath + url.PathEscape(id)})
+	if err != nil {
+		return models.ContactV2{}, err
+	}
+	contact := models.ContactV2{}
+	return contact, decodeJSON(res, &contact)
+}
+
+// UpdateContact replaces the contact with the id of contact
+func (c *client) UpdateContact(ctx context.Context, contact models.ContactV2) (models.ContactV2, error) {
+	return c.writeContact(ctx, http.MethodPut, contactPath+url.PathEscape(contact.ID), contact)
+}
+
+// DeleteContact deletes the contact with id
+func (c *client) DeleteContact(ctx context.Context, id string) error {
+	res, err := c.do(ctx, request{method: http.MethodDelete, path: contactPath + url.PathEscape(id)})
+	if err != nil {
+		return err
+	}
+	drain(res)
+	return nil
+}
+
+// writeContact sends contact and returns the contact of the response
+func (c *client) writeContact(ctx context.Context, method, path string, contact models.ContactV2) (models.ContactV2, error) {
+	req, err := jsonRequest(method, path, contact)
+	if err != nil {
+		return models.ContactV2{}, err
+	}
+	res, err := c.do(ctx, req)
+	if err != nil {
+		return models.ContactV2{}, err
+	}
+	written := models.ContactV2{}
+	return written, decodeJSON(res, &written)
+}
+
+// ContactIterator iterates contacts a page at a time:
+//
+//	it := c.Contacts(100)
+//	for it.Next(ctx) {
+//		contact := it.Contact()
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type ContactIterator interface {
+	// Next advances to the next contact, reading the next page when the current one is done. It reports
+	// false after the last contact or when reading a page failed
+	Next(ctx context.Context) bool
+	// Contact returns the current contact
+	Contact() models.ContactV2
+	// Err returns the error that stopped the iteration, nil once every contact was read
+	Err() error
+}
+
+// contactIterator is the implementation of the ContactIterator interface
+type contactIterator struct {
+	client *client
+	next   string
+	page   []models.ContactV2
+	index  int
+	err    error
+}
+
+// Contacts iterates every contact ordered by id, reading pageSize contacts at a time
+func (c *client) Contacts(pageSize int) ContactIterator {
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	return &contactIterator{
+		client: c,
+		next:   contactsPath + "?limit=" + strconv.Itoa(pageSize),
+		index:  -1,
+	}
+}
+
+// Next advances to the next contact
+func (it *contactIterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	it.index++
+	for it.index >= len(it.page) {
+		if it.next == "" {
+			return false
+		}
+		if it.err = it.readPage(ctx); it.err != nil {
+			return false
+		}
+		it.index = 0
+	}
+	return true
+}
+
+// readPage reads the page of the next link
+func (it *contactIterator) readPage(ctx context.Context) error {
+	res, err := it.client.do(ctx, request{method: http.MethodGet, path: it.next})
+	if err != nil {
+		return err
+	}
+	it.next = ""
+	for _, link := range res.Header["Link"] {
+		if match := nextLink.FindStringSubmatch(link); match != nil {
+			it.next = match[1]
+		}
+	}
+	it.page = nil
+	return decodeJSON(res, &it.page)
+}
+
+// Contact returns the current contact
+func (it *contactIterator) Contact() models.ContactV2 {
+	if it.index < 0 || it.index >= len(it.page) {
+		return models.ContactV2{}
+	}
+	return it.page[it.index]
+}
+
+// Err returns the error that stopped the iteration
+func (it *contactIterator) Err() error {
+	return it.err
+}
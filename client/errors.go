@@ -0,0 +1,52 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// maxErrorBody most bytes of a failed response read to decode its problem
+const maxErrorBody = 1 << 20
+
+// Error a request the server answered with an error status
+type Error struct {
+	// StatusCode status of the response
+	StatusCode int
+	// Problem the problem document of the response, its code is empty when the response held none
+	Problem models.Problem
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	if e.Problem.Code == "" {
+		return fmt.Sprintf("contacts: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("contacts: %d %s", e.StatusCode, e.Problem.Error())
+}
+
+// HasCode reports whether err is an *Error whose problem has code, such as models.CodeNotFound
+func HasCode(err error, code string) bool {
+	e, ok := err.(*Error)
+	return ok && e.Problem.Code == code
+}
+
+// decodeError returns the *Error of a failed response and closes its body
+func decodeError(res *http.Response) error {
+	defer res.Body.Close()
+	e := &Error{StatusCode: res.StatusCode}
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	if err != nil {
+		return e
+	}
+	if t, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); t == "application/problem+json" || t == "application/json" {
+		// a body that is not a problem leaves the problem empty
+		json.Unmarshal(data, &e.Problem)
+	}
+	return e
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// file paths
+const (
+	importPath = "/api/entry/import"
+	exportPath = "/api/entry/export"
+)
+
+// CSVOptions layout of csv and xlsx files, empty options are left to the server
+type CSVOptions struct {
+	// Profile column layout: default, outlook, google or custom
+	Profile string
+	// Mapping json object of headers to contact fields for the custom profile
+	Mapping string
+	// Delimiter a single character or comma, semicolon, tab or pipe
+	Delimiter string
+	// Quote a single character
+	Quote string
+	// Charset character set of the file, utf-8 by default
+	Charset string
+}
+
+// ImportOptions tune how a file is read and matched to existing contacts
+type ImportOptions struct {
+	// Match field rows are matched to existing contacts by, id by default or email
+	Match string
+	// Sheet sheet of an xlsx workbook, the first one by default
+	Sheet string
+	CSV   CSVOptions
+}
+
+// ExportOptions pick the format, layout and contacts of an export
+type ExportOptions struct {
+	// Format csv by default, vcf, ldif, xlsx, json or ndjson
+	Format string
+	// Version vCard version, 3.0 or 4.0
+	Version string
+	// BaseDN entry the LDIF entries are named below
+	BaseDN string
+	// BOM writes a byte order mark for the utf charsets
+	BOM    bool
+	CSV    CSVOptions
+	Filter models.ContactFilter
+}
+
+// ImportContacts streams the file read from r to the server. The body is sent as it is read so the request is
+// never retried
+func (c *client) ImportContacts(ctx context.Context, name string, r io.Reader, opts ImportOptions) (models.ImportReport, error) {
+	query := url.Values{}
+	set(query, "match", opts.Match)
+	set(query, "sheet", opts.Sheet)
+	opts.CSV.set(query)
+
+	body, w := io.Pipe()
+	form := multipart.NewWriter(w)
+	go func() {
+		part, err := form.CreateFormFile("file", name)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		w.CloseWithError(err)
+	}()
+
+	res, err := c.send(ctx, http.MethodPost, c.url(importPath, query), body, form.FormDataContentType())
+	// the writer stops once the request is done with the body
+	body.Close()
+	if err != nil {
+		return models.ImportReport{}, err
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		return models.ImportReport{}, decodeError(res)
+	}
+	report := models.ImportReport{}
+	return report, decodeJSON(res, &report)
+}
+
+// ExportContacts streams the contacts as a file
+func (c *client) ExportContacts(ctx context.Context, opts ExportOptions) (io.ReadCloser, error) {
+	query := url.Values{}
+	set(query, "format", opts.Format)
+	set(query, "version", opts.Version)
+	set(query, "base_dn", opts.BaseDN)
+	if opts.BOM {
+		query.Set("bom", strconv.FormatBool(opts.BOM))
+	}
+	set(query, "q", opts.Filter.Query)
+	set(query, "organization", opts.Filter.Organization)
+	set(query, "city", opts.Filter.City)
+	set(query, "region", opts.Filter.Region)
+	set(query, "country", opts.Filter.Country)
+	opts.CSV.set(query)
+
+	res, err := c.do(ctx, request{method: http.MethodGet, path: exportPath, query: query})
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// set adds the query parameters of the options
+func (o CSVOptions) set(query url.Values) {
+	set(query, "profile", o.Profile)
+	set(query, "mapping", o.Mapping)
+	set(query, "delimiter", o.Delimiter)
+	set(query, "quote", o.Quote)
+	set(query, "charset", o.Charset)
+}
+
+// set adds a query parameter when value is not empty
+func set(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
@@ -1,345 +1,384 @@
 package actions
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"time"
 
-	"github.com/gocarina/gocsv"
+	"github.com/squanchersquanch/contacts/components/duplicates"
+	"github.com/squanchersquanch/contacts/components/exports"
+	"github.com/squanchersquanch/contacts/components/imports"
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/validation"
 	"github.com/squanchersquanch/contacts/models"
 	"github.com/squanchersquanch/contacts/services/config"
 )
 
-// sql constants
-const (
-	selectFrom      = "SELECT * FROM %s;"
-	selectFromWhere = "SELECT * FROM %s WHERE id='%s';"
-	deleteFrom      = "DELETE FROM %s WHERE id=$1;"
-	update          = `UPDATE %s SET firstName='%s', lastName='%s', email='%s', phone='%s' WHERE id='%s';`
-
-	insertInto = `INSERT INTO %s (firstName, lastName, email, phone)
-					VALUES ($1, $2, $3, $4)
-					RETURNING id;`
-
-	commandQuery    = "Query"
-	commandQueryRow = "QueryRow"
-)
-
 // messaging constants
 const (
-	numberOfEntries = "%d entries found"
-	duplicateEntry  = `pq: duplicate key value violates unique constraint "entries_email_key"`
-	invalidID       = "invalid id provided"
-	invalidFileType = "invalid files type"
-	notFound        = "not found"
+	invalidID         = "invalid id provided"
+	invalidFileType   = "unsupported file type, upload a csv, vcf, ldif, json, ndjson or xlsx file"
+	invalidBinaryFile = "binary files can not be imported, upload a csv, vcf, ldif, json, ndjson or xlsx file"
+	invalidMatch      = "invalid match provided, expected id or email"
+	invalidFormat     = "invalid format provided, expected csv, vcf, ldif, xlsx, json or ndjson"
+	invalidVersion    = "invalid version provided, expected 3.0 or 4.0"
+	invalidScore      = "invalid threshold provided, expected a number between 0 and 1"
+	invalidQRFormat   = "invalid format provided, expected vcard or mecard"
+	invalidQRSize     = "invalid size provided, expected a number of pixels between 64 and 2048"
+	invalidQRLevel    = "invalid ecc provided, expected L, M, Q or H"
+	qrTooLong         = "contact does not fit in a qr code, try a lower ecc level or the mecard format"
+	invalidEntries    = "some entries are invalid or duplicates"
+	invalidContact    = "invalid contact provided"
+	invalidMerge      = "at least two contact ids are required to merge"
+	invalidMergeBody  = "request body must be a json merge request"
+	fileTooLarge      = "file too large, background imports accept files up to 100 MB"
+	invalidSignature  = "invalid download link"
+	linkExpired       = "the download link expired, get the export for a new link"
+	exportExpired     = "the exported file expired, export the contacts again"
+	notFound          = "not found"
 )
 
 // header constants
 const (
 	contentTypeHeader        = "Content-Type"
 	contentDispositionHeader = "Content-Disposition"
+	locationHeader           = "Location"
+	linkHeader               = "Link"
 
-	csvContentType        = "text/csv"
+	jsonContentType       = "application/json"
+	problemContentType    = "application/problem+json"
+	csvExportContentType  = "text/csv; charset=%s"
 	csvContentDisposition = "attachment; filename=contacts.csv"
+
+	vcardExportContentType  = "text/vcard; charset=utf-8"
+	vcardContentDisposition = "attachment; filename=contacts.vcf"
+	pngContentType          = "image/png"
+
+	ldifContentType        = "text/x-ldif; charset=utf-8"
+	ldifContentDisposition = "attachment; filename=contacts.ldif"
+
+	xlsxContentType        = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	xlsxContentDisposition = "attachment; filename=contacts.xlsx"
+
+	jsonContentDisposition   = "attachment; filename=contacts.json"
+	ndjsonContentType        = "application/x-ndjson"
+	ndjsonContentDisposition = "attachment; filename=contacts.ndjson"
+
+	contactVCardDisposition = "attachment; filename=contact-%s.vcf"
+	contactQRDisposition    = "inline; filename=contact-%s.png"
+
+	contactLocation = "/api/v1/contacts/"
+	importLocation  = "/api/v1/imports/"
+	exportLocation  = "/api/v1/exports/"
+
+	exportDownloadLocation = "/api/v1/exports/%s/download?expires=%d&signature=%s"
 )
 
 // Actions manages http requests from the connector
 // in return providing a response along with interacting with the database for the app
 type Actions interface {
-	NotFound(w http.ResponseWriter)
+	NotFound(w http.ResponseWriter, r *http.Request)
 	CreateRow(w http.ResponseWriter, r *http.Request)
-	ReadRows(w http.ResponseWriter, id ...string)
-	UpdateRow(w http.ResponseWriter, r *http.Request)
-	DeleteRow(w http.ResponseWriter, urlQuearies string)
-	GenerateContactsCSV(w http.ResponseWriter, r *http.Request)
-	ImportContactsCSV(w http.ResponseWriter, r *http.Request)
+	ReadRows(w http.ResponseWriter, r *http.Request, id ...string)
+	UpdateRow(w http.ResponseWriter, r *http.Request, id string)
+	UpsertRowByEmail(w http.ResponseWriter, r *http.Request, email string)
+	DeleteRow(w http.ResponseWriter, r *http.Request, id string)
+	GenerateContactsCSV(w http.ResponseWriter, r *http.Request, opts ExportOptions)
+	GenerateContactVCard(w http.ResponseWriter, r *http.Request, id string, version string)
+	GenerateContactQRCode(w http.ResponseWriter, r *http.Request, id string, opts QROptions)
+	ImportContactsCSV(w http.ResponseWriter, r *http.Request, opts ImportOptions)
+	SubmitImport(w http.ResponseWriter, r *http.Request, opts ImportOptions)
+	GetImport(w http.ResponseWriter, r *http.Request, id string)
+	CancelImport(w http.ResponseWriter, r *http.Request, id string)
+	SubmitExport(w http.ResponseWriter, r *http.Request, opts ExportOptions)
+	GetExport(w http.ResponseWriter, r *http.Request, id string)
+	DownloadExport(w http.ResponseWriter, r *http.Request, id string, expires string, signature string)
+	FindDuplicates(w http.ResponseWriter, r *http.Request, threshold string)
+	MergeContacts(w http.ResponseWriter, r *http.Request)
+	CreateContactV2(w http.ResponseWriter, r *http.Request)
+	ListContactsV2(w http.ResponseWriter, r *http.Request, limit string, after string)
+	GetContactV2(w http.ResponseWriter, r *http.Request, id string)
+	UpdateContactV2(w http.ResponseWriter, r *http.Request, id string)
+	// Start starts the import and export workers, which run until ctx is done or Close is called
+	Start(ctx context.Context)
+	// Close stops the workers, waiting for the imports and exports they run to finish
+	Close()
 }
 
 // actions is the implementation of the Actions interface
 type actions struct {
-	db     *sql.DB
-	config *config.Config
+	store     store.Store
+	config    *config.Config
+	validator validation.Validator
+	imports   imports.Queue
+	exports   exports.Queue
+	secret    []byte
+	linkTTL   time.Duration
 }
 
-// NewActions creates a new action interface
+// NewActions creates a new action interface, it panics when exports.secret is not configured
 func NewActions(
-	db *sql.DB,
+	store store.Store,
 	config *config.Config,
 ) Actions {
-	return &actions{
-		db:     db,
-		config: config,
+	workers := 0
+	if config.Imports != nil {
+		workers = config.Imports.Workers
+	}
+	exportOpts := exports.Options{}
+	a := &actions{
+		store:     store,
+		config:    config,
+		validator: validation.NewValidator(config),
+		imports:   imports.NewQueue(store, workers),
 	}
+	if config.Exports != nil {
+		exportOpts = exports.Options{Dir: config.Exports.Dir, Workers: config.Exports.Workers, TTL: config.Exports.TTL}
+		a.secret = []byte(config.Exports.Secret)
+		a.linkTTL = config.Exports.LinkTTL
+	}
+	a.exports = exports.NewQueue(store, exportOpts)
+	if len(a.secret) == 0 {
+		// a secret made up here would differ between instances and restarts, breaking the links already given out
+		panic("missing exports.secret, it is required to sign export download links")
+	}
+	if a.linkTTL <= 0 {
+		a.linkTTL = defaultLinkTTL
+	}
+	return a
+}
+
+// Start starts the import and export workers
+func (a *actions) Start(ctx context.Context) {
+	a.imports.Start(ctx, a.processImport)
+	a.exports.Start(ctx, a.processExport)
+}
+
+// Close stops the import and export workers
+func (a *actions) Close() {
+	a.imports.Close()
+	a.exports.Close()
 }
 
 // NotFound action that returns a StatusNotFound
-func (a *actions) NotFound(w http.ResponseWriter) {
-	a.handleError(w, errors.New(notFound), http.StatusNotFound)
+func (a *actions) NotFound(w http.ResponseWriter, r *http.Request) {
+	newResponse(w).problem(newProblem(http.StatusNotFound, models.CodeNotFound, notFound))
 }
 
-// CreateRow action creates a row in the entries database for new contacts
+// CreateRow action creates a row in the entries database for new contacts,
+// responding 201 with the contact and its location
 func (a *actions) CreateRow(w http.ResponseWriter, r *http.Request) {
+	res := newResponse(w)
 	contact, err := a.getContactFromRequest(r)
 	if err != nil {
-		a.handleError(w, err, http.StatusInternalServerError)
+		res.problem(err)
+		return
+	}
+	if errs := a.validator.Validate(&contact); errs != nil {
+		res.problem(newValidationProblem(invalidContact, errs))
 		return
 	}
-	sqlStatement := fmt.Sprintf(insertInto, a.config.Service.DB)
-	id, err := a.doCreateEntry(sqlStatement, contact)
+	contact, err = a.store.Create(r.Context(), contact)
 	if err != nil {
-		a.handleError(w, err, http.StatusInternalServerError)
+		res.problem(err)
 		return
 	}
-	a.ReadRows(w, *id)
+	w.Header().Set(locationHeader, contactLocation+contact.ID)
+	res.json(http.StatusCreated, contact)
 }
 
-// ReadRows action retreives contact(s) information depending if an id from the entries database
-func (a *actions) ReadRows(w http.ResponseWriter, urlQuearies ...string) {
-	entries := models.Entries{}
-	if len(urlQuearies) == 0 || urlQuearies == nil {
-		sqlStatement := fmt.Sprintf(selectFrom, a.config.Service.DB)
-		entries = a.doGetEntries(w, sqlStatement, commandQuery)
-	} else {
-		// TODO: validate id (this could be set to a helper method)
-		_, err := strconv.Atoi(urlQuearies[0])
+// ReadRows action retreives every contact as a list, or a single contact when an id is given
+func (a *actions) ReadRows(w http.ResponseWriter, r *http.Request, urlQuearies ...string) {
+	res := newResponse(w)
+	if len(urlQuearies) == 0 {
+		contacts, err := a.store.List(r.Context())
 		if err != nil {
-			a.handleError(w, errors.New(invalidID), http.StatusBadRequest)
+			res.problem(err)
 			return
 		}
-
-		sqlStatement := fmt.Sprintf(selectFromWhere, a.config.Service.DB, urlQuearies[0])
-		entries = a.doGetEntries(w, sqlStatement, commandQueryRow)
-	}
-
-	if len(entries.Contacts) > 0 {
-		a.encodeJSON(w, entries.Contacts)
+		res.json(http.StatusOK, contacts)
 		return
 	}
-	a.encodeJSON(w, fmt.Sprintf(numberOfEntries, len(entries.Contacts)))
-}
 
-// UpdateRow action updates a contact in entries database
-func (a *actions) UpdateRow(w http.ResponseWriter, r *http.Request) {
-	contact, err := a.getContactFromRequest(r)
-	if err != nil {
-		a.handleError(w, err, http.StatusInternalServerError)
+	if !isID(urlQuearies[0]) {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidID, invalidID))
 		return
 	}
-	sqlStatement := fmt.Sprintf(update, a.config.Service.DB, contact.FirstName, contact.LastName, contact.Email, contact.Phone, contact.ID)
-
-	err = a.doUpdateEntry(sqlStatement)
+	contact, err := a.store.Get(r.Context(), urlQuearies[0])
 	if err != nil {
-		a.handleError(w, err, http.StatusInternalServerError)
+		res.problem(err)
 		return
 	}
-	a.ReadRows(w, contact.ID)
+	res.json(http.StatusOK, contact)
 }
 
-// DeleteRow action deletes a contact from the entries database
-func (a *actions) DeleteRow(w http.ResponseWriter, urlQuearies string) {
-	sqlStatement := fmt.Sprintf(deleteFrom, a.config.Service.DB)
-	row, err := a.db.Exec(sqlStatement, urlQuearies)
+// UpdateRow action updates a contact in entries database, a non empty id replaces the id of the body.
+// The optional fields the body omits keep their stored value, v1 clients predating them never send them
+func (a *actions) UpdateRow(w http.ResponseWriter, r *http.Request, id string) {
+	res := newResponse(w)
+	body, err := readBody(r)
 	if err != nil {
-		a.handleError(w, err, http.StatusInternalServerError)
+		res.problem(err)
 		return
 	}
-	json.NewEncoder(w).Encode(row)
-}
-
-// GenerateContactsCSV action adapts contacts from entries database to a http response
-func (a *actions) GenerateContactsCSV(w http.ResponseWriter, r *http.Request) {
-	res, err := a.doExportContacts(w)
-	if err != nil {
-		a.handleError(w, err, http.StatusInternalServerError)
+	contact := models.Contact{}
+	if err := json.Unmarshal(body, &contact); err != nil {
+		res.problem(err)
 		return
 	}
-	defer func() {
-		res.Close()
-		os.Remove(res.Name())
-	}()
-
-	w.Header().Set(contentDispositionHeader, csvContentDisposition)
-	w.Header().Set(contentTypeHeader, csvContentType)
-	w.WriteHeader(http.StatusOK)
-	res.Seek(0, 0)
-	io.Copy(w, res)
-}
-
-// ImportContactsCSV action adapts a csv file from http request and adds the contacts to entries database
-func (a *actions) ImportContactsCSV(w http.ResponseWriter, r *http.Request) {
-	file, handle, err := r.FormFile("file")
+	if id != "" {
+		contact.ID = id
+	}
+	if !isID(contact.ID) {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidID, invalidID))
+		return
+	}
+	existing, err := a.store.Get(r.Context(), contact.ID)
 	if err != nil {
-		a.handleError(w, err, http.StatusBadRequest)
+		res.problem(err)
 		return
 	}
-	defer file.Close()
-
-	mimeType := handle.Header.Get(contentTypeHeader)
-	if mimeType != csvContentType {
-		a.handleError(w, errors.New(invalidFileType), http.StatusBadRequest)
+	id = contact.ID
+	contact = optionalFields(existing)
+	if err := json.Unmarshal(body, &contact); err != nil {
+		res.problem(err)
 		return
 	}
-	tempFile, err := ioutil.TempFile(os.TempDir(), "tmp.*.csv")
-	if err != nil {
-		a.handleError(w, err, http.StatusInternalServerError)
+	contact.ID = id
+	if errs := a.validator.Validate(&contact); errs != nil {
+		res.problem(newValidationProblem(invalidContact, errs))
 		return
 	}
-	defer os.Remove(tempFile.Name())
-	_, err = io.Copy(tempFile, file)
-	res, err := a.doImportContacts(tempFile)
+	contact, err = a.store.Update(r.Context(), contact)
 	if err != nil {
-		switch err {
-		case errors.New(duplicateEntry):
-			errRes := &struct {
-				Err            string
-				InvalidEntries []*models.Contact
-			}{
-				Err:            err.Error(),
-				InvalidEntries: res,
-			}
-			a.encodeJSON(w, errRes)
-			return
-		default:
-			a.handleError(w, err, http.StatusInternalServerError)
-		}
+		res.problem(err)
+		return
 	}
-	w.WriteHeader(http.StatusAccepted)
+	res.json(http.StatusOK, contact)
 }
 
-// doImportContacts is a helper function that adapts the csv to contacts
-func (a *actions) doImportContacts(file *os.File) ([]*models.Contact, error) {
-	contacts := []*models.Contact{}
-	invalidEntries := []*models.Contact{}
-	entryFile, err := os.Open(file.Name())
+// UpsertRowByEmail action inserts a contact or updates the existing contact sharing the same email,
+// responding 201 when a contact was created and 200 when it was updated, the optional fields left empty keep
+// their stored value
+func (a *actions) UpsertRowByEmail(w http.ResponseWriter, r *http.Request, email string) {
+	res := newResponse(w)
+	contact, err := a.getContactFromRequest(r)
 	if err != nil {
-		return nil, err
+		res.problem(err)
+		return
+	}
+	// the email in the url is the natural key and always wins over the body
+	contact.Email = email
+	if errs := a.validator.Validate(&contact); errs != nil {
+		res.problem(newValidationProblem(invalidContact, errs))
+		return
 	}
-	defer func() {
-		entryFile.Close()
-		os.Remove(file.Name())
-	}()
 
-	err = gocsv.UnmarshalFile(entryFile, &contacts)
+	contact, created, err := a.store.UpsertByEmail(r.Context(), contact)
 	if err != nil {
-		return nil, err
+		res.problem(err)
+		return
 	}
-	for _, contact := range contacts {
-		if contact.ID != "" {
-			sqlStatement := fmt.Sprintf(update, a.config.Service.DB, contact.FirstName, contact.LastName, contact.Email, contact.Phone, contact.ID)
-			err = a.doUpdateEntry(sqlStatement)
-			if err != nil {
-				switch err {
-				case errors.New(duplicateEntry):
-					invalidEntries = append(invalidEntries, contact)
-				default:
-					return invalidEntries, err
-				}
-
-			}
-		} else {
-			sqlStatement := fmt.Sprintf(insertInto, a.config.Service.DB)
-			_, err = a.doCreateEntry(sqlStatement, *contact)
-			if err != nil {
-				switch err {
-				case errors.New(duplicateEntry):
-					invalidEntries = append(invalidEntries, contact)
-				default:
-					return invalidEntries, err
-				}
-			}
-		}
+	if created {
+		w.Header().Set(locationHeader, contactLocation+contact.ID)
+		res.json(http.StatusCreated, contact)
+		return
 	}
+	res.json(http.StatusOK, contact)
+}
 
-	if len(invalidEntries) > 0 {
-		err = errors.New(duplicateEntry)
+// DeleteRow action deletes a contact from the entries database responding 204
+func (a *actions) DeleteRow(w http.ResponseWriter, r *http.Request, id string) {
+	res := newResponse(w)
+	if !isID(id) {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidID, invalidID))
+		return
 	}
-
-	return invalidEntries, err
+	if err := a.store.Delete(r.Context(), id); err != nil {
+		res.problem(err)
+		return
+	}
+	res.noContent()
 }
 
-// doExportContacts is a helper function that adapts contacts to a csv file
-func (a *actions) doExportContacts(w http.ResponseWriter) (*os.File, error) {
-	sqlStatement := fmt.Sprintf(selectFrom, a.config.Service.DB)
-	entries := a.doGetEntries(w, sqlStatement, commandQuery)
-
-	contactsFile, err := ioutil.TempFile(os.TempDir(), "tmp.*.csv")
-	if err != nil {
-		return nil, err
+// FindDuplicates action lists clusters of contacts that likely describe the same person
+func (a *actions) FindDuplicates(w http.ResponseWriter, r *http.Request, threshold string) {
+	res := newResponse(w)
+	score := duplicates.DefaultThreshold
+	if threshold != "" {
+		var err error
+		score, err = strconv.ParseFloat(threshold, 64)
+		if err != nil || score < 0 || score > 1 {
+			res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidParameter, invalidScore))
+			return
+		}
 	}
-	err = gocsv.MarshalFile(&entries.Contacts, contactsFile)
+
+	contacts, err := a.store.List(r.Context())
 	if err != nil {
-		return nil, err
+		res.problem(err)
+		return
 	}
-
-	return contactsFile, nil
+	res.json(http.StatusOK, duplicates.NewFinder(score).Find(contacts))
 }
 
-// doGetEntries is a helper function for ReadRows action
-func (a *actions) doGetEntries(w http.ResponseWriter, sqlStatement, command string) models.Entries {
-	entries := models.Entries{}
-	var contact models.Contact
-	switch command {
-	case "Query":
-		rows, err := a.db.Query(sqlStatement)
-		if err != nil {
-			a.handleError(w, err, http.StatusInternalServerError)
-			break
+// MergeContacts action merges several contacts into one and records the merge in history
+func (a *actions) MergeContacts(w http.ResponseWriter, r *http.Request) {
+	res := newResponse(w)
+	req := models.MergeRequest{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1048576)).Decode(&req); err != nil {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidBody, invalidMergeBody))
+		return
+	}
+	if len(req.IDs) < 2 {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidMerge, invalidMerge))
+		return
+	}
+	seen := map[string]bool{}
+	for _, id := range req.IDs {
+		if !isID(id) || seen[id] {
+			res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidID, invalidID))
+			return
 		}
+		seen[id] = true
+	}
+	if req.TargetID == "" {
+		req.TargetID = req.IDs[0]
+	}
 
-		for rows.Next() {
-			err := rows.Scan(&contact.ID, &contact.FirstName, &contact.LastName, &contact.Email, &contact.Phone)
-			if err != nil {
-				a.handleError(w, err, http.StatusInternalServerError)
-				break
-			}
-			entries.Contacts = append(entries.Contacts, contact)
-		}
-		break
-	case "QueryRow":
-		err := a.db.QueryRow(sqlStatement).Scan(&contact.ID, &contact.FirstName, &contact.LastName, &contact.Email, &contact.Phone)
+	merged, err := a.store.Merge(r.Context(), req, func(contacts []models.Contact) (models.Contact, error) {
+		merged, err := duplicates.Merge(contacts, req.TargetID, req.Rules)
 		if err != nil {
-			a.handleError(w, err, http.StatusBadRequest)
-			break
+			return merged, newProblem(http.StatusBadRequest, models.CodeInvalidMerge, err.Error())
 		}
-		entries.Contacts = append(entries.Contacts, contact)
-		break
-	}
-	return entries
-}
-
-func (a *actions) doUpdateEntry(sqlStatement string) error {
-	_, err := a.db.Exec(sqlStatement)
+		if errs := a.validator.Validate(&merged); errs != nil {
+			return merged, newValidationProblem(invalidContact, errs)
+		}
+		return merged, nil
+	})
 	if err != nil {
-		return err
+		res.problem(err)
+		return
 	}
-	return nil
+	res.json(http.StatusOK, merged)
 }
 
-func (a *actions) doCreateEntry(sqlStatement string, contact models.Contact) (*string, error) {
-	var id string
-	err := a.db.QueryRow(sqlStatement, contact.FirstName, contact.LastName, contact.Email, contact.Phone).Scan(&id)
-	if err != nil {
-		return nil, err
+// getContact returns the stored contact with id after checking the id
+func (a *actions) getContact(r *http.Request, id string) (models.Contact, error) {
+	if !isID(id) {
+		return models.Contact{}, newProblem(http.StatusBadRequest, models.CodeInvalidID, invalidID)
 	}
-	return &id, nil
+	return a.store.Get(r.Context(), id)
 }
 
 // getContactFromRequest tries to unmarshal json request into a contact
 func (a *actions) getContactFromRequest(r *http.Request) (models.Contact, error) {
 	var contact models.Contact
-	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
-	if err != nil {
-		return contact, err
-	}
-
-	err = r.Body.Close()
+	body, err := readBody(r)
 	if err != nil {
 		return contact, err
 	}
@@ -350,14 +389,31 @@ func (a *actions) getContactFromRequest(r *http.Request) (models.Contact, error)
 	return contact, nil
 }
 
-// encodeJSON is a helper function that encodes data into json for response
-func (a *actions) encodeJSON(w http.ResponseWriter, data interface{}) error {
-	return json.NewEncoder(w).Encode(data)
+// readBody reads and closes the body of a json request
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		return nil, err
+	}
+	return body, r.Body.Close()
+}
+
+// optionalFields returns a contact holding only the optional fields of contact, the fields a v1 body may omit
+func optionalFields(contact models.Contact) models.Contact {
+	return models.Contact{
+		Organization: contact.Organization,
+		Note:         contact.Note,
+		UID:          contact.UID,
+		Street:       contact.Street,
+		City:         contact.City,
+		Region:       contact.Region,
+		PostalCode:   contact.PostalCode,
+		Country:      contact.Country,
+	}
 }
 
-// handleError is a helper function that handles errors for http response
-func (a *actions) handleError(w http.ResponseWriter, err error, code int) {
-	log.Printf("http error: %s (code=%d)", err, code)
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(&models.HTTPErrorResponse{Error: err.Error()})
+// isID reports whether id is a valid contact id, ids are stored as 32 bit integers
+func isID(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 32)
+	return err == nil
 }
@@ -0,0 +1,18 @@
+package actions
+
+import (
+	"testing"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/services/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewActionsSecret(t *testing.T) {
+	assert.PanicsWithValue(t, "missing exports.secret, it is required to sign export download links", func() {
+		NewActions(store.NewMemoryStore(), &config.Config{Exports: &config.ExportsConfig{Workers: 1}})
+	})
+	assert.NotPanics(t, func() {
+		NewActions(store.NewMemoryStore(), &config.Config{Exports: &config.ExportsConfig{Secret: "secret"}})
+	})
+}
@@ -0,0 +1,165 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// v2 api constants
+const (
+	// contactV2Location url of a contact in the v2 api
+	contactV2Location = "/api/v2/contacts/"
+	// nextPageLink link to the next page of contacts
+	nextPageLink = `</api/v2/contacts?limit=%d&after=%s>; rel="next"`
+	// maxPageSize most contacts listed in a page
+	maxPageSize = 1000
+
+	invalidLimit = "invalid limit provided, expected a number between 1 and 1000"
+)
+
+// v2Fields json names of the flat contact fields in the v2 shape, used to name validation errors
+var v2Fields = map[string]string{
+	"email":       "emails[0].value",
+	"phone":       "phones[0].value",
+	"street":      "addresses[0].street",
+	"city":        "addresses[0].city",
+	"region":      "addresses[0].region",
+	"postal_code": "addresses[0].postal_code",
+	"country":     "addresses[0].country",
+}
+
+// CreateContactV2 action creates a contact from the v2 shape, responding 201 with the contact and its location
+func (a *actions) CreateContactV2(w http.ResponseWriter, r *http.Request) {
+	res := newResponse(w)
+	contact, err := a.getContactV2FromRequest(r)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	contact.ID = ""
+	if err := a.validateV2(&contact); err != nil {
+		res.problem(err)
+		return
+	}
+	contact, err = a.store.Create(r.Context(), contact)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	w.Header().Set(locationHeader, contactV2Location+contact.ID)
+	res.json(http.StatusCreated, contact.V2())
+}
+
+// ListContactsV2 action lists contacts in the v2 shape ordered by id, every contact without a limit. With a limit
+// the contacts after the id after are listed a page at a time, a Link header points to the next page
+func (a *actions) ListContactsV2(w http.ResponseWriter, r *http.Request, limit string, after string) {
+	res := newResponse(w)
+	size := 0
+	if limit != "" {
+		var err error
+		size, err = strconv.Atoi(limit)
+		if err != nil || size < 1 || size > maxPageSize {
+			res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidParameter, invalidLimit))
+			return
+		}
+	}
+	if after != "" && !isID(after) {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidID, invalidID))
+		return
+	}
+
+	// one contact past the page tells whether there is a next page
+	fetch := size
+	if size > 0 {
+		fetch = size + 1
+	}
+	contacts, err := a.store.Page(r.Context(), models.ContactFilter{}, after, fetch)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	if size > 0 && len(contacts) > size {
+		contacts = contacts[:size]
+		w.Header().Set(linkHeader, fmt.Sprintf(nextPageLink, size, contacts[size-1].ID))
+	}
+	list := make([]models.ContactV2, len(contacts))
+	for i, contact := range contacts {
+		list[i] = contact.V2()
+	}
+	res.json(http.StatusOK, list)
+}
+
+// GetContactV2 action returns the contact with id in the v2 shape
+func (a *actions) GetContactV2(w http.ResponseWriter, r *http.Request, id string) {
+	res := newResponse(w)
+	contact, err := a.getContact(r, id)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	res.json(http.StatusOK, contact.V2())
+}
+
+// UpdateContactV2 action replaces the contact with id by the v2 shape of the body, every email, phone and
+// address included
+func (a *actions) UpdateContactV2(w http.ResponseWriter, r *http.Request, id string) {
+	res := newResponse(w)
+	if !isID(id) {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidID, invalidID))
+		return
+	}
+	contact, err := a.getContactV2FromRequest(r)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	// the id in the url always wins over the body
+	contact.ID = id
+	if err := a.validateV2(&contact); err != nil {
+		res.problem(err)
+		return
+	}
+	contact, err = a.store.Update(r.Context(), contact)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	res.json(http.StatusOK, contact.V2())
+}
+
+// getContactV2FromRequest unmarshals a v2 contact from the request body into the flat shape with details
+func (a *actions) getContactV2FromRequest(r *http.Request) (models.Contact, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		return models.Contact{}, err
+	}
+	if err := r.Body.Close(); err != nil {
+		return models.Contact{}, err
+	}
+
+	var contact models.ContactV2
+	if err := json.Unmarshal(body, &contact); err != nil {
+		return models.Contact{}, err
+	}
+	return contact.Contact(), nil
+}
+
+// validateV2 validates a contact written through the v2 api, naming the flat fields of the errors after the v2 shape
+func (a *actions) validateV2(contact *models.Contact) error {
+	errs := a.validator.Validate(contact)
+	if errs == nil {
+		return nil
+	}
+	for i, e := range errs {
+		if name, ok := v2Fields[e.Field]; ok {
+			errs[i].Field = name
+		}
+	}
+	return newValidationProblem(invalidContact, errs)
+}
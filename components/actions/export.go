@@ -0,0 +1,285 @@
+package actions
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/squanchersquanch/contacts/components/csvfile"
+	"github.com/squanchersquanch/contacts/components/qrcode"
+	"github.com/squanchersquanch/contacts/components/vcard"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// export format constants
+const (
+	// FormatCSV exports contacts as a csv file
+	FormatCSV = "csv"
+	// FormatVCard exports contacts as a vCard file
+	FormatVCard = "vcf"
+	// FormatLDIF exports contacts as LDIF inetOrgPerson entries
+	FormatLDIF = "ldif"
+	// FormatXLSX exports contacts as an Excel workbook
+	FormatXLSX = "xlsx"
+	// FormatJSON exports contacts as a json array
+	FormatJSON = "json"
+	// FormatNDJSON exports contacts as newline delimited json, one contact per line
+	FormatNDJSON = "ndjson"
+)
+
+// flushEvery number of rows streamed to the client between flushes
+const flushEvery = 100
+
+// xlsxSheetName name of the sheet holding exported contacts
+const xlsxSheetName = "Contacts"
+
+// qr code constants
+const (
+	// QRFormatVCard encodes the contact in the qr code as a vCard 3.0
+	QRFormatVCard = "vcard"
+	// QRFormatMeCard encodes the contact in the qr code as a MECARD
+	QRFormatMeCard = "mecard"
+
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 2048
+)
+
+// CSVOptions describe the columns, layout and encoding of a csv file, empty values use the defaults
+type CSVOptions struct {
+	// Profile default, outlook, google or custom
+	Profile string `json:"profile,omitempty"`
+	// Mapping json object of headers to contact fields used by the custom profile
+	Mapping string `json:"mapping,omitempty"`
+	// Delimiter a single character or one of comma, semicolon, tab or pipe
+	Delimiter string `json:"delimiter,omitempty"`
+	// Quote a single character
+	Quote string `json:"quote,omitempty"`
+	// BOM true to write a byte order mark
+	BOM string `json:"bom,omitempty"`
+	// Charset utf-8, utf-16, utf-16le, utf-16be or windows-1252
+	Charset string `json:"charset,omitempty"`
+}
+
+// ExportOptions describe the file produced by an export
+type ExportOptions struct {
+	// Format FormatCSV, FormatVCard, FormatLDIF, FormatXLSX, FormatJSON or FormatNDJSON, defaults to FormatCSV
+	Format string `json:"format"`
+	// Version vCard version of a FormatVCard export, 3.0 or 4.0, defaults to 3.0
+	Version string `json:"version,omitempty"`
+	// BaseDN entry the dn of every contact of a FormatLDIF export is placed below, defaults to none
+	BaseDN string `json:"base_dn,omitempty"`
+	// CSV layout of a FormatCSV export, the profile and mapping also pick the columns of a FormatXLSX export
+	CSV CSVOptions `json:"csv"`
+	// Filter contacts to export, defaults to every contact
+	Filter models.ContactFilter `json:"filter"`
+}
+
+// exportFile how the file of an export is written and served
+type exportFile struct {
+	contentType string
+	disposition string
+	exporter    exporter
+}
+
+// QROptions describe the qr code rendered for a contact, empty values use the defaults
+type QROptions struct {
+	// Format QRFormatVCard or QRFormatMeCard, defaults to QRFormatVCard
+	Format string
+	// Size width of the image in pixels, defaults to 256
+	Size string
+	// Level error correction level L, M, Q or H, defaults to M
+	Level string
+}
+
+// GenerateContactsCSV action streams contacts from entries database to a downloadable csv, vCard, LDIF, xlsx, json or ndjson file
+func (a *actions) GenerateContactsCSV(w http.ResponseWriter, r *http.Request, opts ExportOptions) {
+	res := newResponse(w)
+	file, err := newExportFile(opts)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	a.export(res, r, opts.Filter, file)
+}
+
+// newExportFile validates the options of an export returning how its file is written
+func newExportFile(opts ExportOptions) (exportFile, error) {
+	switch opts.Format {
+	case "", FormatCSV:
+		profile, dialect, err := parseCSVOptions(opts.CSV)
+		if err != nil {
+			return exportFile{}, err
+		}
+		return exportFile{fmt.Sprintf(csvExportContentType, dialect.Charset), csvContentDisposition,
+			&csvExporter{profile: profile, dialect: dialect}}, nil
+	case FormatVCard:
+		version := opts.Version
+		if version == "" {
+			version = vcard.Version30
+		}
+		if version != vcard.Version30 && version != vcard.Version40 {
+			return exportFile{}, newProblem(http.StatusBadRequest, models.CodeInvalidParameter, invalidVersion)
+		}
+		return exportFile{vcardExportContentType, vcardContentDisposition, &vcardExporter{version: version}}, nil
+	case FormatLDIF:
+		return exportFile{ldifContentType, ldifContentDisposition, &ldifExporter{baseDN: opts.BaseDN}}, nil
+	case FormatXLSX:
+		profile, _, err := parseCSVOptions(opts.CSV)
+		if err != nil {
+			return exportFile{}, err
+		}
+		return exportFile{xlsxContentType, xlsxContentDisposition, &xlsxExporter{profile: profile}}, nil
+	case FormatJSON:
+		return exportFile{jsonContentType, jsonContentDisposition, &jsonExporter{}}, nil
+	case FormatNDJSON:
+		return exportFile{ndjsonContentType, ndjsonContentDisposition, &jsonExporter{ndjson: true}}, nil
+	}
+	return exportFile{}, newProblem(http.StatusBadRequest, models.CodeInvalidParameter, invalidFormat)
+}
+
+// export streams every contact matching filter from the store through the exporter of file into the response, flushing every flushEvery rows.
+// The response only starts with the first contact so a failing query is still answered with a problem,
+// a failure after that aborts the connection so clients never mistake a truncated file for a complete one.
+// The query is cancelled when the client disconnects
+func (a *actions) export(res *response, r *http.Request, filter models.ContactFilter, file exportFile) {
+	e := file.exporter
+	var w *streamWriter
+	start := func() error {
+		w = res.stream(file.contentType, file.disposition)
+		return e.begin(w)
+	}
+
+	rows := 0
+	err := a.store.Each(r.Context(), filter, func(contact models.Contact) error {
+		if w == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := e.write(contact); err != nil {
+			return err
+		}
+		if rows++; rows%flushEvery == 0 {
+			if err := e.flush(); err != nil {
+				return err
+			}
+			w.Flush()
+		}
+		return nil
+	})
+	if err == nil && w == nil {
+		err = start()
+	}
+	if err == nil {
+		err = e.end()
+	}
+
+	if err != nil && w == nil {
+		res.problem(err)
+		return
+	}
+	if err != nil {
+		log.Printf("http error: export stopped after %d contacts: %s", rows, err)
+		panic(http.ErrAbortHandler)
+	}
+	w.Flush()
+}
+
+// GenerateContactVCard action downloads a single contact as a vCard of the given version
+func (a *actions) GenerateContactVCard(w http.ResponseWriter, r *http.Request, id string, version string) {
+	res := newResponse(w)
+	if version == "" {
+		version = vcard.Version30
+	}
+	if version != vcard.Version30 && version != vcard.Version40 {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidParameter, invalidVersion))
+		return
+	}
+	contact, err := a.getContact(r, id)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+
+	body := new(bytes.Buffer)
+	if err := vcard.Encode(body, []models.Contact{contact}, version); err != nil {
+		res.problem(err)
+		return
+	}
+	res.file(vcardExportContentType, fmt.Sprintf(contactVCardDisposition, contact.ID), body)
+}
+
+// GenerateContactQRCode action renders a png qr code holding a contact as a vCard or MECARD
+// so it can be scanned straight into a phone
+func (a *actions) GenerateContactQRCode(w http.ResponseWriter, r *http.Request, id string, opts QROptions) {
+	res := newResponse(w)
+	if opts.Format == "" {
+		opts.Format = QRFormatVCard
+	}
+	if opts.Format != QRFormatVCard && opts.Format != QRFormatMeCard {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidParameter, invalidQRFormat))
+		return
+	}
+	size := defaultQRSize
+	if opts.Size != "" {
+		var err error
+		size, err = strconv.Atoi(opts.Size)
+		if err != nil || size < minQRSize || size > maxQRSize {
+			res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidParameter, invalidQRSize))
+			return
+		}
+	}
+	if opts.Level == "" {
+		opts.Level = "M"
+	}
+	level, ok := qrcode.ParseLevel(opts.Level)
+	if !ok {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidParameter, invalidQRLevel))
+		return
+	}
+	contact, err := a.getContact(r, id)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+
+	data := new(bytes.Buffer)
+	if opts.Format == QRFormatMeCard {
+		data.WriteString(vcard.EncodeMeCard(contact))
+	} else if err := vcard.Encode(data, []models.Contact{contact}, vcard.Version30); err != nil {
+		res.problem(err)
+		return
+	}
+	code, err := qrcode.Encode(data.Bytes(), level)
+	if err == qrcode.ErrTooLong {
+		res.problem(newProblem(http.StatusUnprocessableEntity, models.CodeInvalidParameter, qrTooLong))
+		return
+	}
+	if err != nil {
+		res.problem(err)
+		return
+	}
+
+	body := new(bytes.Buffer)
+	if err := code.WritePNG(body, size); err != nil {
+		res.problem(err)
+		return
+	}
+	res.file(pngContentType, fmt.Sprintf(contactQRDisposition, contact.ID), body)
+}
+
+// parseCSVOptions validates the csv options of a request
+func parseCSVOptions(opts CSVOptions) (*csvfile.Profile, csvfile.Dialect, error) {
+	profile, err := csvfile.ParseProfile(opts.Profile, opts.Mapping)
+	if err != nil {
+		return nil, csvfile.Dialect{}, newProblem(http.StatusBadRequest, models.CodeInvalidParameter, err.Error())
+	}
+	dialect, err := csvfile.ParseDialect(opts.Delimiter, opts.Quote, opts.BOM, opts.Charset)
+	if err != nil {
+		return nil, csvfile.Dialect{}, newProblem(http.StatusBadRequest, models.CodeInvalidParameter, err.Error())
+	}
+	return profile, dialect, nil
+}
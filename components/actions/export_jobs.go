@@ -0,0 +1,142 @@
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/squanchersquanch/contacts/components/exports"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// defaultLinkTTL time a download link works when none is configured
+const defaultLinkTTL = 15 * time.Minute
+
+// SubmitExport action queues an export of the contacts matching the filter of opts to be written in the background,
+// responding 202 with the job and its location. The options are checked before the job is queued
+func (a *actions) SubmitExport(w http.ResponseWriter, r *http.Request, opts ExportOptions) {
+	res := newResponse(w)
+	if opts.Format == "" {
+		opts.Format = FormatCSV
+	}
+	if _, err := newExportFile(opts); err != nil {
+		res.problem(err)
+		return
+	}
+	options, err := json.Marshal(opts)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	job, err := a.exports.Submit(r.Context(), models.ExportJob{Format: opts.Format, Options: options})
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	w.Header().Set(locationHeader, exportLocation+job.ID)
+	res.json(http.StatusAccepted, job)
+}
+
+// GetExport action reports the status and progress of a background export,
+// a succeeded export gets a new time limited download url
+func (a *actions) GetExport(w http.ResponseWriter, r *http.Request, id string) {
+	res := newResponse(w)
+	if !isID(id) {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidID, invalidID))
+		return
+	}
+	job, err := a.store.GetExportJob(r.Context(), id)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	if job.Status == models.ExportSucceeded {
+		a.signDownload(&job)
+	}
+	res.json(http.StatusOK, job)
+}
+
+// DownloadExport action downloads the file of a background export through a signed download url
+func (a *actions) DownloadExport(w http.ResponseWriter, r *http.Request, id string, expires string, signature string) {
+	res := newResponse(w)
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !exports.Verify(a.secret, id, unix, signature) {
+		res.problem(newProblem(http.StatusForbidden, models.CodeInvalidSignature, invalidSignature))
+		return
+	}
+	if time.Now().Unix() > unix {
+		res.problem(newProblem(http.StatusGone, models.CodeExportExpired, linkExpired))
+		return
+	}
+	job, err := a.store.GetExportJob(r.Context(), id)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	if job.Status == models.ExportExpired {
+		res.problem(newProblem(http.StatusGone, models.CodeExportExpired, exportExpired))
+		return
+	}
+	opts := ExportOptions{}
+	if err := json.Unmarshal(job.Options, &opts); err != nil {
+		res.problem(err)
+		return
+	}
+	file, err := newExportFile(opts)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	f, err := a.exports.Open(job)
+	if err != nil {
+		res.problem(newProblem(http.StatusGone, models.CodeExportExpired, exportExpired))
+		return
+	}
+	defer f.Close()
+	res.file(file.contentType, file.disposition, f)
+}
+
+// processExport writes the file of a background export job the same way GenerateContactsCSV streams a download
+func (a *actions) processExport(ctx context.Context, job models.ExportJob, w io.Writer, progress func(rows int)) *models.Problem {
+	opts := ExportOptions{}
+	if err := json.Unmarshal(job.Options, &opts); err != nil {
+		return jobProblem("export", job.ID, err)
+	}
+	file, err := newExportFile(opts)
+	if err != nil {
+		return jobProblem("export", job.ID, err)
+	}
+	e := file.exporter
+	if err := e.begin(w); err != nil {
+		return jobProblem("export", job.ID, err)
+	}
+	rows := 0
+	err = a.store.Each(ctx, opts.Filter, func(contact models.Contact) error {
+		rows++
+		progress(rows)
+		return e.write(contact)
+	})
+	if err == nil {
+		err = e.end()
+	}
+	if err != nil {
+		return jobProblem("export", job.ID, err)
+	}
+	return nil
+}
+
+// signDownload sets the download url of a succeeded export job, the url works for the configured
+// link ttl but never past the expiry of the file
+func (a *actions) signDownload(job *models.ExportJob) {
+	expires := time.Now().Add(a.linkTTL)
+	if job.ExpiresAt != nil && job.ExpiresAt.Before(expires) {
+		expires = *job.ExpiresAt
+	}
+	expires = time.Unix(expires.Unix(), 0).UTC()
+	job.DownloadURL = fmt.Sprintf(exportDownloadLocation, job.ID, expires.Unix(), exports.Sign(a.secret, job.ID, expires.Unix()))
+	job.DownloadExpiresAt = &expires
+}
@@ -0,0 +1,173 @@
+package actions
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/squanchersquanch/contacts/components/csvfile"
+	"github.com/squanchersquanch/contacts/components/ldif"
+	"github.com/squanchersquanch/contacts/components/vcard"
+	"github.com/squanchersquanch/contacts/components/xlsx"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// exporter writes contacts to an export file one at a time
+type exporter interface {
+	// begin writes anything preceding the first contact to w
+	begin(w io.Writer) error
+	// write writes a contact
+	write(contact models.Contact) error
+	// flush passes buffered contacts on to w
+	flush() error
+	// end writes anything following the last contact and flushes
+	end() error
+}
+
+// csvExporter writes a header row and a row per contact in the columns of a profile
+type csvExporter struct {
+	profile *csvfile.Profile
+	dialect csvfile.Dialect
+	writer  *csvfile.Writer
+}
+
+func (e *csvExporter) begin(w io.Writer) error {
+	writer, err := csvfile.NewWriter(w, e.dialect)
+	if err != nil {
+		return err
+	}
+	e.writer = writer
+	return e.writer.Write(e.profile.Header())
+}
+
+func (e *csvExporter) write(contact models.Contact) error {
+	return e.writer.Write(e.profile.Record(contact))
+}
+
+func (e *csvExporter) flush() error {
+	return e.writer.Flush()
+}
+
+func (e *csvExporter) end() error {
+	return e.writer.Flush()
+}
+
+// vcardExporter writes a vCard per contact
+type vcardExporter struct {
+	version string
+	w       *bufio.Writer
+}
+
+func (e *vcardExporter) begin(w io.Writer) error {
+	e.w = bufio.NewWriter(w)
+	return nil
+}
+
+func (e *vcardExporter) write(contact models.Contact) error {
+	return vcard.Encode(e.w, []models.Contact{contact}, e.version)
+}
+
+func (e *vcardExporter) flush() error {
+	return e.w.Flush()
+}
+
+func (e *vcardExporter) end() error {
+	return e.w.Flush()
+}
+
+// ldifExporter writes an inetOrgPerson entry per contact after the version line
+type ldifExporter struct {
+	baseDN string
+	w      *bufio.Writer
+}
+
+func (e *ldifExporter) begin(w io.Writer) error {
+	e.w = bufio.NewWriter(w)
+	_, err := e.w.WriteString(ldif.Header())
+	return err
+}
+
+func (e *ldifExporter) write(contact models.Contact) error {
+	return ldif.Encode(e.w, []models.Contact{contact}, e.baseDN)
+}
+
+func (e *ldifExporter) flush() error {
+	return e.w.Flush()
+}
+
+func (e *ldifExporter) end() error {
+	return e.w.Flush()
+}
+
+// xlsxExporter writes a workbook with a row per contact in the columns of a profile
+type xlsxExporter struct {
+	profile *csvfile.Profile
+	writer  *xlsx.Writer
+}
+
+func (e *xlsxExporter) begin(w io.Writer) error {
+	columns := make([]xlsx.Column, len(e.profile.Columns))
+	for i, column := range e.profile.Columns {
+		columns[i] = xlsx.Column{Header: column.Headers[0]}
+		if column.Field == "id" {
+			columns[i].Type = xlsx.Number
+		}
+	}
+	writer, err := xlsx.NewWriter(w, xlsxSheetName, columns)
+	e.writer = writer
+	return err
+}
+
+func (e *xlsxExporter) write(contact models.Contact) error {
+	return e.writer.Write(e.profile.Record(contact))
+}
+
+func (e *xlsxExporter) flush() error {
+	return nil
+}
+
+func (e *xlsxExporter) end() error {
+	return e.writer.Close()
+}
+
+// jsonExporter writes contacts in the v2 shape, so every email, phone and address is kept, as a json array
+// or as a json document per line when ndjson is set
+type jsonExporter struct {
+	ndjson  bool
+	w       *bufio.Writer
+	encoder *json.Encoder
+	written bool
+}
+
+func (e *jsonExporter) begin(w io.Writer) error {
+	e.w = bufio.NewWriter(w)
+	e.encoder = json.NewEncoder(e.w)
+	if !e.ndjson {
+		_, err := e.w.WriteString("[")
+		return err
+	}
+	return nil
+}
+
+func (e *jsonExporter) write(contact models.Contact) error {
+	if !e.ndjson && e.written {
+		if _, err := e.w.WriteString(","); err != nil {
+			return err
+		}
+	}
+	e.written = true
+	return e.encoder.Encode(contact.V2())
+}
+
+func (e *jsonExporter) flush() error {
+	return e.w.Flush()
+}
+
+func (e *jsonExporter) end() error {
+	if !e.ndjson {
+		if _, err := e.w.WriteString("]\n"); err != nil {
+			return err
+		}
+	}
+	return e.w.Flush()
+}
@@ -0,0 +1,421 @@
+package actions
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/squanchersquanch/contacts/components/csvfile"
+	"github.com/squanchersquanch/contacts/components/filetype"
+	"github.com/squanchersquanch/contacts/components/ldif"
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/vcard"
+	"github.com/squanchersquanch/contacts/components/xlsx"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// import matching constants
+const (
+	// MatchByID matches imported rows to existing contacts by their ID column
+	MatchByID = "id"
+	// MatchByEmail matches imported rows to existing contacts by email
+	MatchByEmail = "email"
+)
+
+// import limits
+const (
+	// maxHeaderRows number of leading rows of a sheet searched for the header
+	maxHeaderRows = 10
+	// maxNDJSONLine longest line of an ndjson file in bytes
+	maxNDJSONLine = 1 << 20
+)
+
+// ImportOptions describe how an uploaded file is read and matched to existing contacts
+type ImportOptions struct {
+	// MatchBy MatchByID or MatchByEmail
+	MatchBy string `json:"match"`
+	// CSV layout of an uploaded csv file, the profile and mapping also read the columns of an xlsx file
+	CSV CSVOptions `json:"csv"`
+	// Sheet name of the xlsx sheet to import, defaults to the first sheet
+	Sheet string `json:"sheet,omitempty"`
+}
+
+// importRow a contact read from an uploaded file along with its position in the file
+type importRow struct {
+	index   int
+	contact *models.Contact
+}
+
+// ImportContactsCSV action adapts an uploaded csv, vCard, json, ndjson or xlsx file from http request and adds the contacts
+// to entries database. The type is detected from the content, extension and declared content type of the file.
+// Rows are matched to existing contacts by ID unless MatchBy is MatchByEmail.
+// The response reports every rejected row or card, when none could be imported the import is rejected with a 422
+func (a *actions) ImportContactsCSV(w http.ResponseWriter, r *http.Request, opts ImportOptions) {
+	res := newResponse(w)
+	if _, _, err := parseImportOptions(opts); err != nil {
+		res.problem(err)
+		return
+	}
+
+	file, handle, err := r.FormFile("file")
+	if err != nil {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidFile, err.Error()))
+		return
+	}
+	defer file.Close()
+
+	fileType, content, err := filetype.Detect(file, handle.Filename, handle.Header.Get(contentTypeHeader))
+	if err != nil {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidFile, err.Error()))
+		return
+	}
+	if err := checkFileType(fileType); err != nil {
+		res.problem(err)
+		return
+	}
+
+	report := models.NewImportReport()
+	if err := a.importFile(r.Context(), content, fileType, opts, report, func(int) {}); err != nil {
+		res.problem(err)
+		return
+	}
+	if problem := rejectedProblem(report); problem != nil {
+		res.problem(problem)
+		return
+	}
+	res.json(http.StatusOK, report)
+}
+
+// parseImportOptions validates the import options of a request
+func parseImportOptions(opts ImportOptions) (*csvfile.Profile, csvfile.Dialect, error) {
+	if opts.MatchBy != MatchByID && opts.MatchBy != MatchByEmail {
+		return nil, csvfile.Dialect{}, newProblem(http.StatusBadRequest, models.CodeInvalidParameter, invalidMatch)
+	}
+	return parseCSVOptions(opts.CSV)
+}
+
+// checkFileType rejects uploaded files of a type that can not be imported
+func checkFileType(fileType filetype.Type) error {
+	switch fileType {
+	case filetype.CSV, filetype.VCard, filetype.LDIF, filetype.JSON, filetype.NDJSON, filetype.XLSX:
+		return nil
+	case filetype.Binary:
+		return newProblem(http.StatusUnsupportedMediaType, models.CodeUnsupportedFileType, invalidBinaryFile)
+	}
+	return newProblem(http.StatusUnsupportedMediaType, models.CodeUnsupportedFileType, invalidFileType)
+}
+
+// rejectedProblem returns the problem rejecting an import in which every row was rejected, or nil
+func rejectedProblem(report *models.ImportReport) *models.Problem {
+	if report.Total == 0 || report.Rejected < report.Total {
+		return nil
+	}
+	problem := newProblem(http.StatusUnprocessableEntity, models.CodeImportRejected, invalidEntries)
+	problem.Errors = report.Errors
+	return problem
+}
+
+// importFile is a helper function that imports a file of the given type into report,
+// calling progress with the number of rows read so far. It stops early when ctx is done
+func (a *actions) importFile(ctx context.Context, file io.Reader, fileType filetype.Type, opts ImportOptions, report *models.ImportReport, progress func(rows int)) error {
+	profile, dialect, err := parseImportOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	// the errors of rows the store rejects come after the errors of invalid rows
+	defer report.SortErrors()
+
+	var rows []importRow
+	switch fileType {
+	case filetype.CSV:
+		return a.importCSV(ctx, file, profile, dialect, opts.MatchBy, report, progress)
+	case filetype.NDJSON:
+		return a.importNDJSON(ctx, file, opts.MatchBy, report, progress)
+	case filetype.VCard:
+		rows, err = a.readVCardRows(file, report)
+	case filetype.LDIF:
+		rows, err = a.readLDIFRows(file, report)
+	case filetype.JSON:
+		rows, err = a.readJSONRows(file)
+	case filetype.XLSX:
+		rows, err = a.readXLSXRows(file, profile, opts.Sheet)
+	default:
+		err = checkFileType(fileType)
+	}
+	if err != nil {
+		return err
+	}
+	return a.doImportContacts(ctx, rows, opts.MatchBy, report, progress)
+}
+
+// importCSV is a helper function that bulk imports the csv, the first record is the header that is matched
+// to the columns of profile. Records are validated as they are read and streamed into the store in one go
+func (a *actions) importCSV(ctx context.Context, file io.Reader, profile *csvfile.Profile, dialect csvfile.Dialect, matchBy string, report *models.ImportReport, progress func(rows int)) error {
+	reader, err := csvfile.NewReader(file, dialect)
+	if err != nil {
+		return err
+	}
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return newProblem(http.StatusBadRequest, models.CodeInvalidFile, err.Error())
+	}
+	mapper, err := profile.NewMapper(header)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, models.CodeInvalidFile, err.Error())
+	}
+
+	index := -1
+	next := func() (store.BulkRow, error) {
+		for {
+			if err := ctx.Err(); err != nil {
+				return store.BulkRow{}, err
+			}
+			record, err := reader.Read()
+			if err == io.EOF {
+				return store.BulkRow{}, err
+			}
+			if err != nil {
+				return store.BulkRow{}, newProblem(http.StatusBadRequest, models.CodeInvalidFile, err.Error())
+			}
+			index++
+			report.Total++
+			progress(report.Total)
+			contact := mapper.Contact(record)
+			if errs := a.validator.Validate(&contact); errs != nil {
+				report.Reject(index, errs...)
+				continue
+			}
+			return store.BulkRow{Index: index, Contact: contact}, nil
+		}
+	}
+
+	result, err := a.store.BulkImport(ctx, matchBy == MatchByEmail, next)
+	if err != nil {
+		return err
+	}
+	report.Created += result.Created
+	report.Updated += result.Updated
+	for _, conflict := range result.Conflicts {
+		report.Reject(conflict.Index, models.FieldError{Field: conflict.Field, Message: conflict.Message})
+	}
+	return nil
+}
+
+// readXLSXRows is a helper function that adapts a sheet of a workbook to contacts. The header is the first
+// of the leading rows matching the columns of profile so title rows above it are skipped
+func (a *actions) readXLSXRows(file io.Reader, profile *csvfile.Profile, sheet string) ([]importRow, error) {
+	body, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	records, err := xlsx.Read(bytes.NewReader(body), int64(len(body)), sheet)
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, models.CodeInvalidFile, err.Error())
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	var mapper *csvfile.Mapper
+	for i := 0; i < len(records) && i < maxHeaderRows; i++ {
+		if mapper, err = profile.NewMapper(records[i]); err == nil {
+			records = records[i+1:]
+			break
+		}
+	}
+	if mapper == nil {
+		return nil, newProblem(http.StatusBadRequest, models.CodeInvalidFile, err.Error())
+	}
+
+	rows := make([]importRow, len(records))
+	for i, record := range records {
+		contact := mapper.Contact(record)
+		rows[i] = importRow{index: i, contact: &contact}
+	}
+	return rows, nil
+}
+
+// importNDJSON is a helper function that imports newline delimited json one line at a time so large files
+// are never held in memory. Rows are numbered by line from 0 and blank lines are skipped, a line that is
+// not a json contact is rejected under the field line as is a line too long to read, which ends the import
+func (a *actions) importNDJSON(ctx context.Context, file io.Reader, matchBy string, report *models.ImportReport, progress func(rows int)) error {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLine)
+	index := 0
+	for ; scanner.Scan(); index++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		progress(report.Total)
+		line := bytes.TrimSpace(scanner.Bytes())
+		if index == 0 {
+			line = bytes.TrimPrefix(line, []byte("\xEF\xBB\xBF"))
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		contact, err := decodeContact(line)
+		if err != nil {
+			report.Total++
+			report.Reject(index, models.FieldError{Field: "line", Message: "invalid json: " + err.Error()})
+			continue
+		}
+		if err := a.importContact(ctx, importRow{index: index, contact: &contact}, matchBy, report); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		// the lines before are already imported, report where reading stopped
+		report.Total++
+		report.Reject(index, models.FieldError{Field: "line", Message: err.Error()})
+	}
+	return nil
+}
+
+// readJSONRows is a helper function that adapts a json array of contacts, or a single contact, to rows
+func (a *actions) readJSONRows(file io.Reader) ([]importRow, error) {
+	body, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	body = bytes.TrimSpace(bytes.TrimPrefix(body, []byte("\xEF\xBB\xBF")))
+
+	items := []json.RawMessage{}
+	if bytes.HasPrefix(body, []byte("{")) {
+		items = append(items, body)
+	} else {
+		err = json.Unmarshal(body, &items)
+	}
+	contacts := make([]models.Contact, len(items))
+	for i := 0; err == nil && i < len(items); i++ {
+		contacts[i], err = decodeContact(items[i])
+	}
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, models.CodeInvalidFile, "invalid json: "+err.Error())
+	}
+
+	rows := make([]importRow, len(contacts))
+	for i := range contacts {
+		rows[i] = importRow{index: i, contact: &contacts[i]}
+	}
+	return rows, nil
+}
+
+// decodeContact decodes a contact of a json or ndjson file. Contacts with emails, phones or addresses are in the
+// v2 shape the json exports write, any other contact is in the v1 shape of the create call
+func decodeContact(data []byte) (models.Contact, error) {
+	shape := struct {
+		Emails    json.RawMessage `json:"emails"`
+		Phones    json.RawMessage `json:"phones"`
+		Addresses json.RawMessage `json:"addresses"`
+	}{}
+	if err := json.Unmarshal(data, &shape); err != nil {
+		return models.Contact{}, err
+	}
+	if shape.Emails == nil && shape.Phones == nil && shape.Addresses == nil {
+		contact := models.Contact{}
+		err := json.Unmarshal(data, &contact)
+		return contact, err
+	}
+	contact := models.ContactV2{}
+	if err := json.Unmarshal(data, &contact); err != nil {
+		return models.Contact{}, err
+	}
+	return contact.Contact(), nil
+}
+
+// readVCardRows is a helper function that adapts the cards of a vCard file to contacts,
+// cards that can not be parsed are rejected in report under their index
+func (a *actions) readVCardRows(file io.Reader, report *models.ImportReport) ([]importRow, error) {
+	cards, errs, err := vcard.Decode(file)
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, models.CodeInvalidFile, err.Error())
+	}
+	report.Total += len(errs)
+	for _, e := range errs {
+		report.Reject(e.Index, models.FieldError{Field: "card", Message: e.Error()})
+	}
+
+	rows := make([]importRow, 0, len(cards))
+	for _, card := range cards {
+		contact := vcard.ToContact(card)
+		rows = append(rows, importRow{index: card.Index, contact: &contact})
+	}
+	return rows, nil
+}
+
+// readLDIFRows is a helper function that adapts the entries of an LDIF file to contacts,
+// entries that can not be parsed are rejected in report under their index
+func (a *actions) readLDIFRows(file io.Reader, report *models.ImportReport) ([]importRow, error) {
+	entries, errs, err := ldif.Decode(file)
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, models.CodeInvalidFile, err.Error())
+	}
+	report.Total += len(errs)
+	for _, e := range errs {
+		report.Reject(e.Index, models.FieldError{Field: "entry", Message: e.Error()})
+	}
+
+	rows := make([]importRow, 0, len(entries))
+	for _, entry := range entries {
+		contact := ldif.ToContact(entry)
+		rows = append(rows, importRow{index: entry.Index, contact: &contact})
+	}
+	return rows, nil
+}
+
+// doImportContacts is a helper function that stores the imported rows.
+// Rows that are invalid or reuse another contact's email are skipped and reported as field errors
+func (a *actions) doImportContacts(ctx context.Context, rows []importRow, matchBy string, report *models.ImportReport, progress func(rows int)) error {
+	for _, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := a.importContact(ctx, row, matchBy, report); err != nil {
+			return err
+		}
+		progress(report.Total)
+	}
+	return nil
+}
+
+// importContact is a helper function that stores a single imported row, counting it in report
+func (a *actions) importContact(ctx context.Context, row importRow, matchBy string, report *models.ImportReport) error {
+	report.Total++
+	contact := row.contact
+	if errs := a.validator.Validate(contact); errs != nil {
+		report.Reject(row.index, errs...)
+		return nil
+	}
+
+	var err error
+	created := false
+	if matchBy == MatchByEmail {
+		_, created, err = a.store.UpsertByEmail(ctx, *contact)
+	} else if contact.ID != "" {
+		_, err = a.store.Update(ctx, *contact)
+	} else {
+		_, err = a.store.Create(ctx, *contact)
+		created = true
+	}
+	switch err {
+	case nil:
+		report.Accept(created)
+	case store.ErrDuplicateEmail:
+		report.Reject(row.index, models.FieldError{Field: "email", Message: err.Error()})
+	case store.ErrNotFound:
+		report.Reject(row.index, models.FieldError{Field: "id", Message: err.Error()})
+	default:
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/squanchersquanch/contacts/components/filetype"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// maxJobFileSize largest file accepted by a background import, the file is kept in the database until it is imported
+const maxJobFileSize = 100 << 20
+
+// SubmitImport action queues an uploaded csv, vCard, json, ndjson or xlsx file to be imported in the background,
+// responding 202 with the job and its location. The options and file type are checked before the job is queued
+func (a *actions) SubmitImport(w http.ResponseWriter, r *http.Request, opts ImportOptions) {
+	res := newResponse(w)
+	if _, _, err := parseImportOptions(opts); err != nil {
+		res.problem(err)
+		return
+	}
+
+	file, handle, err := r.FormFile("file")
+	if err != nil {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidFile, err.Error()))
+		return
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(file, maxJobFileSize+1))
+	if err != nil {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidFile, err.Error()))
+		return
+	}
+	if len(data) > maxJobFileSize {
+		res.problem(newProblem(http.StatusRequestEntityTooLarge, models.CodeInvalidFile, fileTooLarge))
+		return
+	}
+	contentType := handle.Header.Get(contentTypeHeader)
+	fileType, _, err := filetype.Detect(bytes.NewReader(data), handle.Filename, contentType)
+	if err != nil {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidFile, err.Error()))
+		return
+	}
+	if err := checkFileType(fileType); err != nil {
+		res.problem(err)
+		return
+	}
+
+	options, err := json.Marshal(opts)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	job, err := a.imports.Submit(r.Context(), models.ImportJob{
+		Filename:    handle.Filename,
+		ContentType: contentType,
+		Options:     options,
+	}, data)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	w.Header().Set(locationHeader, importLocation+job.ID)
+	res.json(http.StatusAccepted, job)
+}
+
+// GetImport action reports the status, progress and outcome of a background import
+func (a *actions) GetImport(w http.ResponseWriter, r *http.Request, id string) {
+	res := newResponse(w)
+	if !isID(id) {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidID, invalidID))
+		return
+	}
+	job, err := a.store.GetJob(r.Context(), id)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	res.json(http.StatusOK, job)
+}
+
+// CancelImport action cancels a queued or running background import, rows a running import
+// already stored are kept unless the file is a csv, which is imported all at once
+func (a *actions) CancelImport(w http.ResponseWriter, r *http.Request, id string) {
+	res := newResponse(w)
+	if !isID(id) {
+		res.problem(newProblem(http.StatusBadRequest, models.CodeInvalidID, invalidID))
+		return
+	}
+	job, err := a.imports.Cancel(r.Context(), id)
+	if err != nil {
+		res.problem(err)
+		return
+	}
+	res.json(http.StatusOK, job)
+}
+
+// processImport imports the file of a background import job the same way ImportContactsCSV imports an upload
+func (a *actions) processImport(ctx context.Context, job models.ImportJob, data []byte, report *models.ImportReport, progress func(rows int)) *models.Problem {
+	opts := ImportOptions{}
+	if err := json.Unmarshal(job.Options, &opts); err != nil {
+		return jobProblem("import", job.ID, err)
+	}
+	fileType, content, err := filetype.Detect(bytes.NewReader(data), job.Filename, job.ContentType)
+	if err != nil {
+		return jobProblem("import", job.ID, newProblem(http.StatusBadRequest, models.CodeInvalidFile, err.Error()))
+	}
+	if err := a.importFile(ctx, content, fileType, opts, report, progress); err != nil {
+		return jobProblem("import", job.ID, err)
+	}
+	return rejectedProblem(report)
+}
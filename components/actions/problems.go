@@ -0,0 +1,63 @@
+package actions
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// problem details that are shared between actions
+const (
+	invalidBody     = "request body must be a json contact"
+	unexpectedError = "an unexpected error occurred"
+)
+
+// newProblem creates a problem titled after its http status
+func newProblem(status int, code, detail string) *models.Problem {
+	return &models.Problem{
+		Type:   models.ProblemTypePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// newValidationProblem creates a problem listing the field errors of an invalid request
+func newValidationProblem(detail string, errs []models.FieldError) *models.Problem {
+	problem := newProblem(http.StatusUnprocessableEntity, models.CodeValidationFailed, detail)
+	problem.Errors = errs
+	return problem
+}
+
+// toProblem maps an error to the problem returned to clients. Errors that are not
+// problems already only surface a generic detail so driver messages never leak
+func toProblem(err error) *models.Problem {
+	switch e := err.(type) {
+	case *models.Problem:
+		return e
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return newProblem(http.StatusBadRequest, models.CodeInvalidBody, invalidBody)
+	}
+	switch err {
+	case store.ErrNotFound:
+		return newProblem(http.StatusNotFound, models.CodeNotFound, err.Error())
+	case store.ErrDuplicateEmail:
+		return newProblem(http.StatusConflict, models.CodeDuplicateEmail, err.Error())
+	case store.ErrJobNotFound, store.ErrExportNotFound:
+		return newProblem(http.StatusNotFound, models.CodeNotFound, err.Error())
+	case store.ErrJobFinished:
+		return newProblem(http.StatusConflict, models.CodeImportFinished, err.Error())
+	}
+	return newProblem(http.StatusInternalServerError, models.CodeInternal, unexpectedError)
+}
+
+// jobProblem logs why a background job failed and maps err to the problem stored with the job
+func jobProblem(kind, id string, err error) *models.Problem {
+	problem := toProblem(err)
+	log.Printf("%s error: job %s: %s (code=%d)", kind, id, err, problem.Status)
+	return problem
+}
@@ -0,0 +1,73 @@
+package actions
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/squanchersquanch/contacts/services/requestid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToProblem(t *testing.T) {
+	problem := toProblem(store.ErrDuplicateEmail)
+	assert.Equal(t, http.StatusConflict, problem.Status)
+	assert.Equal(t, models.CodeDuplicateEmail, problem.Code)
+
+	problem = toProblem(store.ErrNotFound)
+	assert.Equal(t, http.StatusNotFound, problem.Status)
+	assert.Equal(t, models.CodeNotFound, problem.Code)
+
+	problem = toProblem(store.ErrJobFinished)
+	assert.Equal(t, http.StatusConflict, problem.Status)
+	assert.Equal(t, models.CodeImportFinished, problem.Code)
+
+	problem = toProblem(errors.New(`pq: duplicate key value violates unique constraint "entries_email_key"`))
+	assert.Equal(t, http.StatusInternalServerError, problem.Status)
+	assert.Equal(t, models.CodeInternal, problem.Code)
+	assert.Equal(t, unexpectedError, problem.Detail)
+
+	err := json.Unmarshal([]byte(`{"email": 4}`), &models.Contact{})
+	problem = toProblem(err)
+	assert.Equal(t, http.StatusBadRequest, problem.Status)
+	assert.Equal(t, models.CodeInvalidBody, problem.Code)
+}
+
+func TestResponseProblem(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rr.Header().Set(requestid.Header, "abc123")
+
+	newResponse(rr).problem(newValidationProblem(invalidContact, []models.FieldError{{Field: "email", Message: "is required"}}))
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Equal(t, problemContentType, rr.Header().Get(contentTypeHeader))
+
+	problem := models.Problem{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+	assert.Equal(t, models.Problem{
+		Type:     models.ProblemTypePrefix + models.CodeValidationFailed,
+		Title:    "Unprocessable Entity",
+		Status:   http.StatusUnprocessableEntity,
+		Code:     models.CodeValidationFailed,
+		Detail:   invalidContact,
+		Instance: "abc123",
+		Errors:   []models.FieldError{{Field: "email", Message: "is required"}},
+	}, problem)
+}
+
+func TestResponseWritesOnce(t *testing.T) {
+	rr := httptest.NewRecorder()
+	res := newResponse(rr)
+
+	res.problem(store.ErrNotFound)
+	res.json(http.StatusOK, []models.Contact{})
+	res.noContent()
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	problem := models.Problem{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+	assert.Equal(t, models.CodeNotFound, problem.Code)
+}
@@ -0,0 +1,107 @@
+package actions
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+
+	"github.com/squanchersquanch/contacts/services/requestid"
+)
+
+// response writes exactly one http response for an action, anything written
+// after the first response is dropped and logged rather than corrupting the body
+type response struct {
+	w       http.ResponseWriter
+	written bool
+}
+
+// newResponse creates a response for w
+func newResponse(w http.ResponseWriter) *response {
+	return &response{w: w}
+}
+
+// json writes data encoded as json with status
+func (res *response) json(status int, data interface{}) {
+	if !res.begin(status) {
+		return
+	}
+	res.w.Header().Set(contentTypeHeader, jsonContentType)
+	res.w.WriteHeader(status)
+	json.NewEncoder(res.w).Encode(data)
+}
+
+// noContent writes an empty 204 response
+func (res *response) noContent() {
+	if !res.begin(http.StatusNoContent) {
+		return
+	}
+	res.w.WriteHeader(http.StatusNoContent)
+}
+
+// file writes body as a downloadable attachment
+func (res *response) file(contentType, disposition string, body io.Reader) {
+	if !res.begin(http.StatusOK) {
+		return
+	}
+	res.w.Header().Set(contentTypeHeader, contentType)
+	res.w.Header().Set(contentDispositionHeader, disposition)
+	res.w.WriteHeader(http.StatusOK)
+	io.Copy(res.w, body)
+}
+
+// stream starts a downloadable attachment whose body is written as it is produced,
+// errors after this point can only be logged since the status is already sent
+func (res *response) stream(contentType, disposition string) *streamWriter {
+	if !res.begin(http.StatusOK) {
+		return &streamWriter{w: ioutil.Discard}
+	}
+	res.w.Header().Set(contentTypeHeader, contentType)
+	res.w.Header().Set(contentDispositionHeader, disposition)
+	res.w.WriteHeader(http.StatusOK)
+	flusher, _ := res.w.(http.Flusher)
+	return &streamWriter{w: res.w, flusher: flusher}
+}
+
+// streamWriter writes the body of a streamed response
+type streamWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+// Write implements the io.Writer interface
+func (s *streamWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+// Flush sends what has been written so far to the client
+func (s *streamWriter) Flush() {
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+// problem writes err as a problem+json document
+func (res *response) problem(err error) {
+	problem := *toProblem(err)
+	problem.Instance = res.w.Header().Get(requestid.Header)
+	log.Printf("http error: %s (code=%d, instance=%s)", err, problem.Status, problem.Instance)
+
+	if !res.begin(problem.Status) {
+		return
+	}
+	res.w.Header().Set(contentTypeHeader, problemContentType)
+	res.w.WriteHeader(problem.Status)
+	json.NewEncoder(res.w).Encode(&problem)
+}
+
+// begin marks the response as written, reporting false when it already was
+func (res *response) begin(status int) bool {
+	if res.written {
+		log.Printf("http error: response already written, dropping %d response", status)
+		return false
+	}
+	res.written = true
+	return true
+}
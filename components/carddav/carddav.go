@@ -0,0 +1,416 @@
+package carddav
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/validation"
+	"github.com/squanchersquanch/contacts/components/vcard"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// paths served, every contact is a card of the single address book
+const (
+	// Root path the server is mounted on
+	Root = "/carddav/"
+	// WellKnown path clients look the server up at, RFC 6764
+	WellKnown = "/.well-known/carddav"
+
+	principalPath   = Root + "principal/"
+	homePath        = Root + "addressbooks/"
+	addressBookPath = homePath + "contacts/"
+	cardSuffix      = ".vcf"
+)
+
+// server constants
+const (
+	// davHeader compliance classes announced by OPTIONS
+	davHeader = "1, 3, addressbook"
+	// allowHeader methods the server implements
+	allowHeader = "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT"
+	// vcardContentType content type of cards, vCard 3.0 is read by every client
+	vcardContentType = "text/vcard; charset=utf-8"
+	// maxResourceSize largest card accepted by PUT
+	maxResourceSize = 100 * 1024
+	// maxBodySize largest PROPFIND or REPORT body read
+	maxBodySize = 1 << 20
+	// syncTokenPrefix followed by the token of the change log is the sync token handed to clients
+	syncTokenPrefix = "urn:contacts:sync:"
+	displayName     = "Contacts"
+	// authenticateHeader challenge of requests without valid credentials
+	authenticateHeader = `Basic realm="Contacts", charset="UTF-8"`
+)
+
+// errPreconditionFailed aborts a write whose If-Match or If-None-Match fails against the stored card
+var errPreconditionFailed = errors.New("precondition failed")
+
+// resource kinds
+const (
+	kindRoot = iota
+	kindPrincipal
+	kindHome
+	kindAddressBook
+	kindCard
+)
+
+// target the resource a request path names, name is the card name for kindCard
+type target struct {
+	kind int
+	name string
+}
+
+// handler is the CardDAV http.Handler
+type handler struct {
+	store     store.Store
+	validator validation.Validator
+	username  string
+	password  string
+}
+
+// NewHandler creates an http.Handler serving the contacts of store as a CardDAV address book (RFC 6352)
+// below Root, including sync-collection reports (RFC 6578) backed by the change log of store.
+// Cards written by clients are checked by validator like contacts created through the api. Requests need
+// basic authentication with username and password when a password is given
+func NewHandler(store store.Store, validator validation.Validator, username, password string) http.Handler {
+	return &handler{
+		store:     store,
+		validator: validator,
+		username:  username,
+		password:  password,
+	}
+}
+
+// ServeHTTP dispatches a request by method
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == WellKnown {
+		http.Redirect(w, r, Root, http.StatusMovedPermanently)
+		return
+	}
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", authenticateHeader)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	t, ok := parsePath(r.URL.EscapedPath())
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("DAV", davHeader)
+
+	switch {
+	case r.Method == http.MethodOptions:
+		w.Header().Set("Allow", allowHeader)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == "PROPFIND":
+		h.propfind(w, r, t)
+	case r.Method == "REPORT":
+		h.report(w, r, t)
+	case t.kind == kindCard && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		h.get(w, r, t)
+	case t.kind == kindCard && r.Method == http.MethodPut:
+		h.put(w, r, t)
+	case t.kind == kindCard && r.Method == http.MethodDelete:
+		h.delete(w, r, t)
+	default:
+		w.Header().Set("Allow", allowHeader)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// authorized reports whether r carries the configured credentials, every request is when there is no password
+func (h *handler) authorized(r *http.Request) bool {
+	if h.password == "" {
+		return true
+	}
+	username, password, ok := r.BasicAuth()
+	return ok && subtle.ConstantTimeCompare([]byte(username), []byte(h.username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(h.password)) == 1
+}
+
+// parsePath returns the target of an escaped request path
+func parsePath(path string) (target, bool) {
+	switch path {
+	case strings.TrimSuffix(Root, "/"), Root:
+		return target{kind: kindRoot}, true
+	case principalPath:
+		return target{kind: kindPrincipal}, true
+	case homePath:
+		return target{kind: kindHome}, true
+	case addressBookPath, strings.TrimSuffix(addressBookPath, "/"):
+		return target{kind: kindAddressBook}, true
+	}
+	file := strings.TrimPrefix(path, addressBookPath)
+	if file == path || strings.Contains(file, "/") || !strings.HasSuffix(file, cardSuffix) {
+		return target{}, false
+	}
+	name, err := url.PathUnescape(strings.TrimSuffix(file, cardSuffix))
+	if err != nil || name == "" {
+		return target{}, false
+	}
+	return target{kind: kindCard, name: name}, true
+}
+
+// cardName returns the name of the card of a contact, which is the UID of its vCard
+func cardName(id, uid string) string {
+	return vcard.UID(models.Contact{ID: id, UID: uid})
+}
+
+// cardHref returns the path of the card named name
+func cardHref(name string) string {
+	return addressBookPath + url.PathEscape(name) + cardSuffix
+}
+
+// lookup returns the contact of the card named name. Contacts stored without a UID are named by the
+// UID their vCard is written with, vcard.UIDPrefix followed by the id
+func (h *handler) lookup(ctx context.Context, name string) (models.Contact, error) {
+	contact, err := h.store.GetByUID(ctx, name)
+	if err != store.ErrNotFound || !strings.HasPrefix(name, vcard.UIDPrefix) {
+		return contact, err
+	}
+	id := strings.TrimPrefix(name, vcard.UIDPrefix)
+	if _, err := strconv.Atoi(id); err != nil {
+		return models.Contact{}, store.ErrNotFound
+	}
+	contact, err = h.store.Get(ctx, id)
+	if err == nil && contact.UID != "" {
+		return models.Contact{}, store.ErrNotFound
+	}
+	return contact, err
+}
+
+// card the vCard of a contact along with its entity tag
+type card struct {
+	contact models.Contact
+	data    []byte
+	etag    string
+}
+
+// newCard encodes the vCard of contact, the entity tag is a hash of the vCard so it changes with any field
+func newCard(contact models.Contact) (*card, error) {
+	data := new(bytes.Buffer)
+	if err := vcard.Encode(data, []models.Contact{contact}, vcard.Version30); err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum(data.Bytes())
+	return &card{
+		contact: contact,
+		data:    data.Bytes(),
+		etag:    `"` + hex.EncodeToString(sum[:]) + `"`,
+	}, nil
+}
+
+// href returns the path of the card
+func (c *card) href() string {
+	return cardHref(cardName(c.contact.ID, c.contact.UID))
+}
+
+// get serves a card
+func (h *handler) get(w http.ResponseWriter, r *http.Request, t target) {
+	c, ok := h.loadCard(w, r, t)
+	if !ok {
+		return
+	}
+	w.Header().Set("ETag", c.etag)
+	if r.Header.Get("If-None-Match") != "" && matchETag(r.Header.Get("If-None-Match"), c.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", vcardContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(c.data)))
+	w.Write(c.data)
+}
+
+// put creates or replaces a card. Cards created by clients keep the name they were put at as their UID,
+// the UID of an existing card can not be changed. The preconditions are checked again by the store against
+// the card being replaced, so a card changed meanwhile is not overwritten. No ETag is returned since the
+// stored card is normalized and differs from the one sent, clients get it again
+func (h *handler) put(w http.ResponseWriter, r *http.Request, t target) {
+	ctx := r.Context()
+	existing, err := h.lookup(ctx, t.name)
+	if err != nil && err != store.ErrNotFound {
+		internalError(w, err)
+		return
+	}
+	found := err == nil
+	etag := ""
+	if found {
+		c, err := newCard(existing)
+		if err != nil {
+			internalError(w, err)
+			return
+		}
+		etag = c.etag
+	}
+	if !checkPreconditions(w, r, found, etag) {
+		return
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "" &&
+		mediaType != "text/vcard" && mediaType != "text/x-vcard" {
+		writeError(w, http.StatusUnsupportedMediaType, nsCardDAV, "supported-address-data")
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxResourceSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxResourceSize {
+		writeError(w, http.StatusForbidden, nsCardDAV, "max-resource-size")
+		return
+	}
+	cards, errs, err := vcard.Decode(bytes.NewReader(data))
+	if err != nil || len(errs) > 0 || len(cards) != 1 {
+		writeError(w, http.StatusForbidden, nsCardDAV, "valid-address-data")
+		return
+	}
+
+	contact := vcard.ToContact(cards[0])
+	if found {
+		if contact.UID != "" && contact.UID != vcard.UID(existing) {
+			writeError(w, http.StatusForbidden, nsCardDAV, "no-uid-conflict")
+			return
+		}
+		contact.ID = existing.ID
+		contact.UID = existing.UID
+	} else {
+		if strings.HasPrefix(t.name, vcard.UIDPrefix) {
+			// names of contacts without a UID are not handed out to new cards
+			writeError(w, http.StatusForbidden, nsCardDAV, "no-uid-conflict")
+			return
+		}
+		contact.UID = t.name
+	}
+	if errs := h.validator.Validate(&contact); errs != nil {
+		writeError(w, http.StatusForbidden, nsCardDAV, "valid-address-data")
+		return
+	}
+
+	if found {
+		_, err = h.store.UpdateIf(ctx, contact, checkStored(r))
+	} else {
+		_, err = h.store.Create(ctx, contact)
+	}
+	switch err {
+	case nil:
+	case store.ErrDuplicateEmail:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errPreconditionFailed:
+		http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+		return
+	case store.ErrNotFound:
+		http.NotFound(w, r)
+		return
+	default:
+		internalError(w, err)
+		return
+	}
+	if found {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// delete removes a card, the preconditions are checked again by the store like for put
+func (h *handler) delete(w http.ResponseWriter, r *http.Request, t target) {
+	c, ok := h.loadCard(w, r, t)
+	if !ok || !checkPreconditions(w, r, true, c.etag) {
+		return
+	}
+	switch err := h.store.DeleteIf(r.Context(), c.contact.ID, checkStored(r)); err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errPreconditionFailed:
+		http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+	case store.ErrNotFound:
+		http.NotFound(w, r)
+	default:
+		internalError(w, err)
+	}
+}
+
+// loadCard returns the card t names, responding 404 when there is none
+func (h *handler) loadCard(w http.ResponseWriter, r *http.Request, t target) (*card, bool) {
+	contact, err := h.lookup(r.Context(), t.name)
+	if err == store.ErrNotFound {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	var c *card
+	if err == nil {
+		c, err = newCard(contact)
+	}
+	if err != nil {
+		internalError(w, err)
+		return nil, false
+	}
+	return c, true
+}
+
+// checkPreconditions evaluates If-Match and If-None-Match for a write to a card, responding 412
+// when they fail. found reports whether the card exists and etag is its entity tag
+func checkPreconditions(w http.ResponseWriter, r *http.Request, found bool, etag string) bool {
+	if !preconditionsHold(r, found, etag) {
+		http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// preconditionsHold reports whether If-Match and If-None-Match allow a write to a card
+func preconditionsHold(r *http.Request, found bool, etag string) bool {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && (!found || !matchETag(ifMatch, etag)) {
+		return false
+	}
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && found && matchETag(ifNoneMatch, etag) {
+		return false
+	}
+	return true
+}
+
+// checkStored returns the check of the preconditions of r the store runs against the card being written
+func checkStored(r *http.Request) store.CheckFunc {
+	return func(contact models.Contact) error {
+		c, err := newCard(contact)
+		if err != nil {
+			return err
+		}
+		if !preconditionsHold(r, true, c.etag) {
+			return errPreconditionFailed
+		}
+		return nil
+	}
+}
+
+// matchETag reports whether a If-Match or If-None-Match header lists etag or is *
+func matchETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// internalError logs err and responds 500
+func internalError(w http.ResponseWriter, err error) {
+	log.Printf("carddav error: %s", err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
@@ -0,0 +1,291 @@
+package carddav
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/validation"
+	"github.com/squanchersquanch/contacts/components/vcard"
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/squanchersquanch/contacts/services/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const tomCard = "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:tom-1\r\nN:Dob;Tom;;;\r\nFN:Tom Dob\r\n" +
+	"EMAIL;TYPE=INTERNET:tom.dobs@gmail.com\r\nTEL;TYPE=CELL:5555555555\r\nEND:VCARD\r\n"
+
+// testMultistatus the parts of a multistatus the tests look at
+type testMultistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Status    string `xml:"DAV: status"`
+		Propstats []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ETag        string `xml:"DAV: getetag"`
+				AddressData string `xml:"urn:ietf:params:xml:ns:carddav address-data"`
+				Inner       string `xml:",innerxml"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+	SyncToken string `xml:"DAV: sync-token"`
+}
+
+// serve runs a request against h with the given headers as name, value pairs
+func serve(h http.Handler, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// multistatusOf decodes the 207 response rr
+func multistatusOf(t *testing.T, rr *httptest.ResponseRecorder) testMultistatus {
+	assert.Equal(t, http.StatusMultiStatus, rr.Code, rr.Body.String())
+	ms := testMultistatus{}
+	assert.NoError(t, xml.Unmarshal(rr.Body.Bytes(), &ms))
+	return ms
+}
+
+func newTestHandler() (http.Handler, store.Store) {
+	s := store.NewMemoryStore()
+	return NewHandler(s, validation.NewValidator(&config.Config{}), "", ""), s
+}
+
+// staleStore hands out the contacts as they were when it was created, like a store read before a concurrent write
+type staleStore struct {
+	store.Store
+	stale map[string]models.Contact
+}
+
+// GetByUID returns the contact as it was
+func (s *staleStore) GetByUID(ctx context.Context, uid string) (models.Contact, error) {
+	contact, ok := s.stale[uid]
+	if !ok {
+		return models.Contact{}, store.ErrNotFound
+	}
+	return contact, nil
+}
+
+func TestAuthentication(t *testing.T) {
+	h := NewHandler(store.NewMemoryStore(), validation.NewValidator(&config.Config{}), "sync", "secret")
+
+	rr := serve(h, "PROPFIND", addressBookPath, "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, authenticateHeader, rr.Header().Get("WWW-Authenticate"))
+	req := httptest.NewRequest("PROPFIND", addressBookPath, nil)
+	req.SetBasicAuth("sync", "wrong")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	req = httptest.NewRequest("PROPFIND", addressBookPath, nil)
+	req.SetBasicAuth("sync", "secret")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusMultiStatus, rr.Code)
+	assert.Equal(t, http.StatusMovedPermanently, serve(h, "GET", WellKnown, "").Code)
+}
+
+func TestConcurrentWrite(t *testing.T) {
+	s := store.NewMemoryStore()
+	tom, err := s.Create(context.Background(), models.Contact{UID: "tom-1", FirstName: "Tom", Email: "tom.dobs@gmail.com"})
+	assert.NoError(t, err)
+	h := NewHandler(&staleStore{Store: s, stale: map[string]models.Contact{"tom-1": tom}}, validation.NewValidator(&config.Config{}), "", "")
+	c, err := newCard(tom)
+	assert.NoError(t, err)
+
+	// the card changes after the handler read it, the write checks the preconditions against the stored card
+	tom.FirstName = "Thomas"
+	_, err = s.Update(context.Background(), tom)
+	assert.NoError(t, err)
+	href := addressBookPath + "tom-1.vcf"
+	assert.Equal(t, http.StatusPreconditionFailed, serve(h, "PUT", href, tomCard, "If-Match", c.etag).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, serve(h, "DELETE", href, "", "If-Match", c.etag).Code)
+	contact, err := s.Get(context.Background(), tom.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Thomas", contact.FirstName)
+}
+
+func TestDiscovery(t *testing.T) {
+	h, _ := newTestHandler()
+
+	rr := serve(h, "GET", WellKnown, "")
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.Equal(t, Root, rr.Header().Get("Location"))
+
+	rr = serve(h, "OPTIONS", addressBookPath, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("DAV"), "addressbook")
+	assert.Contains(t, rr.Header().Get("Allow"), "REPORT")
+
+	ms := multistatusOf(t, serve(h, "PROPFIND", "/carddav", `<?xml version="1.0"?>
+		<d:propfind xmlns:d="DAV:"><d:prop><d:current-user-principal/><d:getlastmodified/></d:prop></d:propfind>`,
+		"Depth", "0"))
+	assert.Len(t, ms.Responses, 1)
+	assert.Equal(t, "HTTP/1.1 200 OK", ms.Responses[0].Propstats[0].Status)
+	assert.Contains(t, ms.Responses[0].Propstats[0].Prop.Inner, principalPath+"</href>")
+	assert.Equal(t, "HTTP/1.1 404 Not Found", ms.Responses[0].Propstats[1].Status)
+
+	ms = multistatusOf(t, serve(h, "PROPFIND", principalPath, `<propfind xmlns="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">
+		<prop><C:addressbook-home-set/></prop></propfind>`, "Depth", "0"))
+	assert.Contains(t, ms.Responses[0].Propstats[0].Prop.Inner, homePath)
+
+	ms = multistatusOf(t, serve(h, "PROPFIND", homePath, "", "Depth", "1"))
+	assert.Len(t, ms.Responses, 2)
+	assert.Equal(t, addressBookPath, ms.Responses[1].Href)
+	assert.Contains(t, ms.Responses[1].Propstats[0].Prop.Inner, `<addressbook xmlns="urn:ietf:params:xml:ns:carddav">`)
+	assert.Contains(t, ms.Responses[1].Propstats[0].Prop.Inner, "sync-collection")
+
+	assert.Equal(t, http.StatusNotFound, serve(h, "PROPFIND", Root+"other/", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(h, "DELETE", addressBookPath, "").Code)
+}
+
+func TestCards(t *testing.T) {
+	h, s := newTestHandler()
+	href := addressBookPath + "tom-1.vcf"
+
+	assert.Equal(t, http.StatusCreated, serve(h, "PUT", href, tomCard, "If-None-Match", "*", "Content-Type", "text/vcard").Code)
+	assert.Equal(t, http.StatusPreconditionFailed, serve(h, "PUT", href, tomCard, "If-None-Match", "*").Code)
+
+	rr := serve(h, "GET", href, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, vcardContentType, rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), "UID:tom-1\r\n")
+	assert.Contains(t, rr.Body.String(), "TEL;TYPE=VOICE:+15555555555\r\n")
+	etag := rr.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, http.StatusNotModified, serve(h, "GET", href, "", "If-None-Match", etag).Code)
+
+	changed := strings.Replace(tomCard, "FN:Tom Dob", "FN:Thomas Dob", 1)
+	changed = strings.Replace(changed, "N:Dob;Tom", "N:Dob;Thomas", 1)
+	assert.Equal(t, http.StatusPreconditionFailed, serve(h, "PUT", href, changed, "If-Match", `"stale"`).Code)
+	assert.Equal(t, http.StatusNoContent, serve(h, "PUT", href, changed, "If-Match", etag).Code)
+	contact, err := s.GetByUID(context.Background(), "tom-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Thomas", contact.FirstName)
+	assert.NotEqual(t, etag, serve(h, "GET", href, "").Header().Get("ETag"))
+
+	rr = serve(h, "PUT", href, strings.Replace(changed, "UID:tom-1", "UID:other", 1))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "no-uid-conflict")
+	rr = serve(h, "PUT", addressBookPath+"ann.vcf", "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Ann\r\nEND:VCARD\r\n")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "valid-address-data")
+	assert.Equal(t, http.StatusConflict, serve(h, "PUT", addressBookPath+"copy.vcf", tomCard).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, serve(h, "PUT", addressBookPath+"ann.vcf", "{}", "Content-Type", "application/json").Code)
+
+	// contacts created through the api are named by the UID of their vCard
+	created, err := s.Create(context.Background(), models.Contact{FirstName: "ann", Email: "ann@example.com"})
+	assert.NoError(t, err)
+	annHref := addressBookPath + vcard.UIDPrefix + created.ID + ".vcf"
+	assert.Equal(t, http.StatusOK, serve(h, "GET", annHref, "").Code)
+	assert.Equal(t, http.StatusNoContent, serve(h, "PUT", annHref, "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:"+vcard.UIDPrefix+created.ID+
+		"\r\nN:;Ann;;;\r\nEMAIL:ann@example.com\r\nEND:VCARD\r\n").Code)
+	contact, err = s.Get(context.Background(), created.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "", contact.UID)
+	assert.Equal(t, http.StatusForbidden, serve(h, "PUT", addressBookPath+vcard.UIDPrefix+"99.vcf", tomCard).Code)
+
+	assert.Equal(t, http.StatusPreconditionFailed, serve(h, "DELETE", href, "", "If-Match", etag).Code)
+	assert.Equal(t, http.StatusNoContent, serve(h, "DELETE", href, "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(h, "GET", href, "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(h, "DELETE", href, "").Code)
+}
+
+func TestReports(t *testing.T) {
+	h, s := newTestHandler()
+	ctx := context.Background()
+	tom, _ := s.Create(ctx, models.Contact{FirstName: "tom", LastName: "dob", Email: "tom.dobs@gmail.com", UID: "tom-1"})
+	ann, _ := s.Create(ctx, models.Contact{FirstName: "ann", Email: "ann@example.com"})
+	annHref := cardHref(cardName(ann.ID, ann.UID))
+
+	ms := multistatusOf(t, serve(h, "PROPFIND", addressBookPath, `<propfind xmlns="DAV:"><prop><getetag/></prop></propfind>`, "Depth", "1"))
+	assert.Len(t, ms.Responses, 3)
+	assert.Equal(t, addressBookPath+"tom-1.vcf", ms.Responses[1].Href)
+	assert.NotEmpty(t, ms.Responses[1].Propstats[0].Prop.ETag)
+
+	ms = multistatusOf(t, serve(h, "REPORT", addressBookPath, `<C:addressbook-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">
+		<D:prop><D:getetag/><C:address-data/></D:prop>
+		<D:href>http://localhost`+addressBookPath+`tom-1.vcf</D:href>
+		<D:href>`+addressBookPath+`missing.vcf</D:href>
+	</C:addressbook-multiget>`))
+	assert.Len(t, ms.Responses, 2)
+	assert.Contains(t, ms.Responses[0].Propstats[0].Prop.AddressData, "EMAIL;TYPE=INTERNET:tom.dobs@gmail.com\r\n")
+	assert.Equal(t, "HTTP/1.1 404 Not Found", ms.Responses[1].Status)
+
+	query := `<C:addressbook-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:carddav">
+		<D:prop><D:getetag/></D:prop>
+		<C:filter test="anyof"><C:prop-filter name="EMAIL"><C:text-match match-type="ends-with">EXAMPLE.COM</C:text-match></C:prop-filter></C:filter>
+	</C:addressbook-query>`
+	ms = multistatusOf(t, serve(h, "REPORT", addressBookPath, query))
+	assert.Len(t, ms.Responses, 1)
+	assert.Equal(t, annHref, ms.Responses[0].Href)
+	ms = multistatusOf(t, serve(h, "REPORT", addressBookPath, `<C:addressbook-query xmlns:C="urn:ietf:params:xml:ns:carddav">
+		<C:filter/><C:limit><C:nresults>1</C:nresults></C:limit></C:addressbook-query>`))
+	assert.Len(t, ms.Responses, 2)
+	assert.Equal(t, "HTTP/1.1 507 Insufficient Storage", ms.Responses[1].Status)
+	rr := serve(h, "REPORT", addressBookPath, strings.Replace(query, `match-type="ends-with"`, `collation="i;klingon"`, 1))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "supported-collation")
+
+	sync := `<sync-collection xmlns="DAV:"><sync-token>%s</sync-token><sync-level>1</sync-level><prop><getetag/></prop></sync-collection>`
+	ms = multistatusOf(t, serve(h, "REPORT", addressBookPath, strings.Replace(sync, "%s", "", 1)))
+	assert.Len(t, ms.Responses, 2)
+	assert.Equal(t, syncTokenPrefix+"2", ms.SyncToken)
+	token := ms.SyncToken
+
+	ms = multistatusOf(t, serve(h, "REPORT", addressBookPath, strings.Replace(sync, "%s", token, 1)))
+	assert.Empty(t, ms.Responses)
+	assert.Equal(t, token, ms.SyncToken)
+
+	tom.Phone = "+15555555555"
+	_, err := s.Update(ctx, tom)
+	assert.NoError(t, err)
+	assert.NoError(t, s.Delete(ctx, ann.ID))
+	ms = multistatusOf(t, serve(h, "REPORT", addressBookPath, strings.Replace(sync, "%s", token, 1)))
+	assert.Len(t, ms.Responses, 2)
+	assert.Equal(t, addressBookPath+"tom-1.vcf", ms.Responses[0].Href)
+	assert.NotEmpty(t, ms.Responses[0].Propstats[0].Prop.ETag)
+	assert.Equal(t, annHref, ms.Responses[1].Href)
+	assert.Equal(t, "HTTP/1.1 404 Not Found", ms.Responses[1].Status)
+	assert.Equal(t, syncTokenPrefix+"4", ms.SyncToken)
+
+	rr = serve(h, "REPORT", addressBookPath, strings.Replace(sync, "%s", syncTokenPrefix+"99", 1))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "valid-sync-token")
+	assert.Equal(t, http.StatusForbidden, serve(h, "REPORT", addressBookPath, `<expand-property xmlns="DAV:"/>`).Code)
+}
+
+func TestFilter(t *testing.T) {
+	cards, _, err := vcard.Decode(strings.NewReader(tomCard))
+	assert.NoError(t, err)
+	card := cards[0]
+
+	tests := []struct {
+		name     string
+		filter   filter
+		expected bool
+	}{
+		{"empty", filter{}, true},
+		{"defined", filter{PropFilters: []propFilter{{Name: "tel"}}}, true},
+		{"not defined", filter{PropFilters: []propFilter{{Name: "NOTE", IsNotDefined: &struct{}{}}}}, true},
+		{"equals", filter{PropFilters: []propFilter{{Name: "FN", TextMatches: []textMatch{{MatchType: "equals", Text: "tom dob"}}}}}, true},
+		{"octet", filter{PropFilters: []propFilter{{Name: "FN", TextMatches: []textMatch{{Collation: "i;octet", Text: "tom"}}}}}, false},
+		{"negated", filter{PropFilters: []propFilter{{Name: "FN", TextMatches: []textMatch{{Text: "ann", NegateCondition: "yes"}}}}}, true},
+		{"param", filter{PropFilters: []propFilter{{Name: "TEL", ParamFilters: []paramFilter{{Name: "type", TextMatch: &textMatch{MatchType: "equals", Text: "cell"}}}}}}, true},
+		{"anyof", filter{PropFilters: []propFilter{{Name: "NOTE"}, {Name: "EMAIL"}}}, true},
+		{"allof", filter{Test: "allof", PropFilters: []propFilter{{Name: "NOTE"}, {Name: "EMAIL"}}}, false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, test.filter.matches(card), test.name)
+	}
+}
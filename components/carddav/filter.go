@@ -0,0 +1,184 @@
+package carddav
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/squanchersquanch/contacts/components/vcard"
+)
+
+// filter constants, RFC 6352 section 10.5
+const (
+	testAnyOf = "anyof"
+	testAllOf = "allof"
+
+	matchEquals     = "equals"
+	matchContains   = "contains"
+	matchStartsWith = "starts-with"
+	matchEndsWith   = "ends-with"
+
+	collationCaseMap = "i;unicode-casemap"
+	collationASCII   = "i;ascii-casemap"
+	collationOctet   = "i;octet"
+)
+
+// filter errors
+var (
+	errCollation = errors.New("unsupported collation")
+	errMatchType = errors.New("unsupported match type")
+)
+
+// filter selects the cards of an addressbook-query, a filter without prop filters matches every card
+type filter struct {
+	Test        string       `xml:"test,attr"`
+	PropFilters []propFilter `xml:"urn:ietf:params:xml:ns:carddav prop-filter"`
+}
+
+// propFilter matches the properties of a card named Name
+type propFilter struct {
+	Name         string        `xml:"name,attr"`
+	Test         string        `xml:"test,attr"`
+	IsNotDefined *struct{}     `xml:"urn:ietf:params:xml:ns:carddav is-not-defined"`
+	TextMatches  []textMatch   `xml:"urn:ietf:params:xml:ns:carddav text-match"`
+	ParamFilters []paramFilter `xml:"urn:ietf:params:xml:ns:carddav param-filter"`
+}
+
+// paramFilter matches a parameter of a property
+type paramFilter struct {
+	Name         string     `xml:"name,attr"`
+	IsNotDefined *struct{}  `xml:"urn:ietf:params:xml:ns:carddav is-not-defined"`
+	TextMatch    *textMatch `xml:"urn:ietf:params:xml:ns:carddav text-match"`
+}
+
+// textMatch matches a property or parameter value
+type textMatch struct {
+	Collation       string `xml:"collation,attr"`
+	MatchType       string `xml:"match-type,attr"`
+	NegateCondition string `xml:"negate-condition,attr"`
+	Text            string `xml:",chardata"`
+}
+
+// validate returns errCollation or errMatchType for a text match the filter can not evaluate
+func (f filter) validate() error {
+	for _, pf := range f.PropFilters {
+		matches := pf.TextMatches
+		for _, param := range pf.ParamFilters {
+			if param.TextMatch != nil {
+				matches = append(matches, *param.TextMatch)
+			}
+		}
+		for _, tm := range matches {
+			switch tm.Collation {
+			case "", collationCaseMap, collationASCII, collationOctet:
+			default:
+				return errCollation
+			}
+			switch tm.MatchType {
+			case "", matchEquals, matchContains, matchStartsWith, matchEndsWith:
+			default:
+				return errMatchType
+			}
+		}
+	}
+	return nil
+}
+
+// matches reports whether card passes the filter
+func (f filter) matches(card *vcard.Card) bool {
+	results := make([]bool, len(f.PropFilters))
+	for i, pf := range f.PropFilters {
+		results[i] = pf.matches(card)
+	}
+	return combine(f.Test, results)
+}
+
+// matches reports whether the properties of card named pf.Name pass the filter
+func (pf propFilter) matches(card *vcard.Card) bool {
+	props := []*vcard.Property{}
+	for _, p := range card.Properties {
+		if strings.EqualFold(p.Name, pf.Name) {
+			props = append(props, p)
+		}
+	}
+	if pf.IsNotDefined != nil {
+		return len(props) == 0
+	}
+	if len(pf.TextMatches) == 0 && len(pf.ParamFilters) == 0 {
+		return len(props) > 0
+	}
+
+	results := []bool{}
+	for _, tm := range pf.TextMatches {
+		results = append(results, anyProperty(props, func(p *vcard.Property) bool {
+			return tm.matches(p.Text())
+		}))
+	}
+	for _, param := range pf.ParamFilters {
+		results = append(results, anyProperty(props, param.matches))
+	}
+	return combine(pf.Test, results)
+}
+
+// matches reports whether the parameter of p passes the filter
+func (pf paramFilter) matches(p *vcard.Property) bool {
+	values := p.Params[strings.ToUpper(pf.Name)]
+	if pf.IsNotDefined != nil {
+		return len(values) == 0
+	}
+	if pf.TextMatch == nil {
+		return len(values) > 0
+	}
+	for _, value := range values {
+		if pf.TextMatch.matches(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether value passes the text match
+func (tm textMatch) matches(value string) bool {
+	text := tm.Text
+	if tm.Collation != collationOctet {
+		value = strings.ToLower(value)
+		text = strings.ToLower(text)
+	}
+	var ok bool
+	switch tm.MatchType {
+	case matchEquals:
+		ok = value == text
+	case matchStartsWith:
+		ok = strings.HasPrefix(value, text)
+	case matchEndsWith:
+		ok = strings.HasSuffix(value, text)
+	default:
+		ok = strings.Contains(value, text)
+	}
+	return ok != (tm.NegateCondition == "yes")
+}
+
+// anyProperty reports whether match holds for any of props
+func anyProperty(props []*vcard.Property, match func(p *vcard.Property) bool) bool {
+	for _, p := range props {
+		if match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// combine combines the results of the tests of a filter, anyof unless test is allof
+func combine(test string, results []bool) bool {
+	if len(results) == 0 {
+		return true
+	}
+	for _, result := range results {
+		if test == testAllOf && !result {
+			return false
+		}
+		if test != testAllOf && result {
+			return true
+		}
+	}
+	return test == testAllOf
+}
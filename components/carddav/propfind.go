@@ -0,0 +1,240 @@
+package carddav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// property selection modes of a PROPFIND
+const (
+	// modeProp lists the requested properties
+	modeProp = iota
+	// modeAllProp lists every property except address-data
+	modeAllProp
+	// modePropName lists the names of every property
+	modePropName
+)
+
+// resource a resource listed in a multistatus, card is only set for kindCard
+type resource struct {
+	href string
+	kind int
+	card *card
+}
+
+// propfind lists the properties of the target and, unless Depth is 0, of its members
+func (h *handler) propfind(w http.ResponseWriter, r *http.Request, t target) {
+	mode, names, err := readPropfind(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	resources := []resource{}
+	switch t.kind {
+	case kindRoot:
+		resources = append(resources, resource{href: Root, kind: kindRoot})
+	case kindPrincipal:
+		resources = append(resources, resource{href: principalPath, kind: kindPrincipal})
+	case kindHome:
+		resources = append(resources, resource{href: homePath, kind: kindHome})
+		if r.Header.Get("Depth") != "0" {
+			resources = append(resources, resource{href: addressBookPath, kind: kindAddressBook})
+		}
+	case kindAddressBook:
+		resources = append(resources, resource{href: addressBookPath, kind: kindAddressBook})
+		if r.Header.Get("Depth") != "0" {
+			err = h.store.Each(ctx, models.ContactFilter{}, func(contact models.Contact) error {
+				c, err := newCard(contact)
+				if err != nil {
+					return err
+				}
+				resources = append(resources, resource{href: c.href(), kind: kindCard, card: c})
+				return nil
+			})
+		}
+	case kindCard:
+		c, ok := h.loadCard(w, r, t)
+		if !ok {
+			return
+		}
+		resources = append(resources, resource{href: c.href(), kind: kindCard, card: c})
+	}
+
+	var token int64
+	if err == nil && (t.kind == kindHome || t.kind == kindAddressBook) {
+		token, err = h.store.SyncToken(ctx)
+	}
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	ms := multistatus{}
+	for _, res := range resources {
+		ms.Responses = append(ms.Responses, propResponse(res, token, names, mode))
+	}
+	writeMultistatus(w, ms)
+}
+
+// readPropfind returns the selection mode and requested property names of a PROPFIND body
+func readPropfind(body io.Reader) (int, []xml.Name, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(body, maxBodySize))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return modeAllProp, nil, nil
+	}
+	pf := propfind{}
+	if err := xml.Unmarshal(data, &pf); err != nil {
+		return 0, nil, err
+	}
+	switch {
+	case pf.PropName != nil:
+		return modePropName, nil, nil
+	case pf.Prop != nil:
+		return modeProp, pf.Prop.names(), nil
+	}
+	return modeAllProp, nil, nil
+}
+
+// names returns the requested names
+func (p propNames) names() []xml.Name {
+	names := make([]xml.Name, len(p.Names))
+	for i, e := range p.Names {
+		names[i] = e.XMLName
+	}
+	return names
+}
+
+// propResponse returns the response listing the properties of res selected by mode, requested names
+// res does not have are listed with status 404. token is the sync token of the address book
+func propResponse(res resource, token int64, names []xml.Name, mode int) response {
+	props := properties(res, token)
+	found, missing := []property{}, []property{}
+	switch mode {
+	case modeAllProp, modePropName:
+		for _, p := range props {
+			if mode == modeAllProp && p.XMLName.Local == "address-data" {
+				continue
+			}
+			if mode == modePropName {
+				p.Inner = ""
+			}
+			found = append(found, p)
+		}
+	default:
+		for _, name := range names {
+			if p, ok := findProperty(props, name); ok {
+				found = append(found, p)
+			} else {
+				missing = append(missing, property{XMLName: name})
+			}
+		}
+	}
+
+	resp := response{Href: res.href}
+	if len(found) > 0 {
+		resp.Propstats = append(resp.Propstats, propstat{Prop: prop{found}, Status: statusLine(http.StatusOK)})
+	}
+	if len(missing) > 0 {
+		resp.Propstats = append(resp.Propstats, propstat{Prop: prop{missing}, Status: statusLine(http.StatusNotFound)})
+	}
+	return resp
+}
+
+// findProperty returns the property of props named name
+func findProperty(props []property, name xml.Name) (property, bool) {
+	for _, p := range props {
+		if p.XMLName == name {
+			return p, true
+		}
+	}
+	return property{}, false
+}
+
+// properties returns every property of res with its content
+func properties(res resource, token int64) []property {
+	p := func(space, local, inner string) property {
+		return property{XMLName: xml.Name{Space: space, Local: local}, Inner: inner}
+	}
+	text := func(value string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(value))
+		return b.String()
+	}
+
+	if res.kind == kindCard {
+		return []property{
+			p(nsDAV, "resourcetype", ""),
+			p(nsDAV, "getetag", text(res.card.etag)),
+			p(nsDAV, "getcontenttype", vcardContentType),
+			p(nsDAV, "getcontentlength", strconv.Itoa(len(res.card.data))),
+			p(nsCardDAV, "address-data", text(string(res.card.data))),
+		}
+	}
+
+	resourceType := element(nsDAV, "collection", "")
+	switch res.kind {
+	case kindPrincipal:
+		resourceType = element(nsDAV, "principal", "")
+	case kindAddressBook:
+		resourceType += element(nsCardDAV, "addressbook", "")
+	}
+	props := []property{
+		p(nsDAV, "resourcetype", resourceType),
+		p(nsDAV, "current-user-principal", hrefElement(principalPath)),
+		p(nsCardDAV, "addressbook-home-set", hrefElement(homePath)),
+		p(nsDAV, "current-user-privilege-set", privileges()),
+	}
+	switch res.kind {
+	case kindPrincipal:
+		props = append(props,
+			p(nsDAV, "displayname", displayName),
+			p(nsDAV, "principal-URL", hrefElement(principalPath)))
+	case kindHome:
+		props = append(props, p(nsCalendarServer, "getctag", text(formatSyncToken(token))))
+	case kindAddressBook:
+		props = append(props,
+			p(nsDAV, "displayname", displayName),
+			p(nsCardDAV, "addressbook-description", displayName),
+			p(nsCardDAV, "supported-address-data",
+				`<address-data-type xmlns="`+nsCardDAV+`" content-type="text/vcard" version="3.0"/>`),
+			p(nsCardDAV, "max-resource-size", strconv.Itoa(maxResourceSize)),
+			p(nsDAV, "supported-report-set", supportedReports()),
+			p(nsCalendarServer, "getctag", text(formatSyncToken(token))),
+			p(nsDAV, "sync-token", text(formatSyncToken(token))))
+	}
+	return props
+}
+
+// privileges returns the content of current-user-privilege-set, every client may read and write
+func privileges() string {
+	var b strings.Builder
+	for _, privilege := range []string{"read", "write", "write-properties", "write-content", "bind", "unbind"} {
+		b.WriteString(`<privilege xmlns="` + nsDAV + `"><` + privilege + `/></privilege>`)
+	}
+	return b.String()
+}
+
+// supportedReports returns the content of supported-report-set
+func supportedReports() string {
+	var b strings.Builder
+	for _, report := range []xml.Name{
+		{Space: nsCardDAV, Local: "addressbook-multiget"},
+		{Space: nsCardDAV, Local: "addressbook-query"},
+		{Space: nsDAV, Local: "sync-collection"},
+	} {
+		b.WriteString(`<supported-report xmlns="` + nsDAV + `"><report>`)
+		b.WriteString(`<` + report.Local + ` xmlns="` + report.Space + `"/>`)
+		b.WriteString(`</report></supported-report>`)
+	}
+	return b.String()
+}
@@ -0,0 +1,246 @@
+package carddav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/vcard"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// errLimit stops the iteration of an addressbook-query once its limit is reached
+var errLimit = errors.New("limit reached")
+
+// report runs an addressbook-multiget, addressbook-query or sync-collection report on the address book
+func (h *handler) report(w http.ResponseWriter, r *http.Request, t target) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name, err := rootName(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case t.kind != kindAddressBook:
+		writeError(w, http.StatusForbidden, nsDAV, "supported-report")
+	case name == xml.Name{Space: nsCardDAV, Local: "addressbook-multiget"}:
+		h.multiget(w, r, body)
+	case name == xml.Name{Space: nsCardDAV, Local: "addressbook-query"}:
+		h.query(w, r, body)
+	case name == xml.Name{Space: nsDAV, Local: "sync-collection"}:
+		h.syncCollection(w, r, body)
+	default:
+		writeError(w, http.StatusForbidden, nsDAV, "supported-report")
+	}
+}
+
+// rootName returns the name of the root element of an xml document
+func rootName(body []byte) (xml.Name, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.Name{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+// multiget lists the properties of the cards at the requested hrefs, missing cards respond 404
+func (h *handler) multiget(w http.ResponseWriter, r *http.Request, body []byte) {
+	req := addressBookMultiget{}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	names := reportNames(req.Prop)
+	ms := multistatus{}
+	for _, href := range req.Hrefs {
+		c, err := h.cardAt(r, href)
+		switch err {
+		case nil:
+			ms.Responses = append(ms.Responses, propResponse(resource{href: href, kind: kindCard, card: c}, 0, names, modeProp))
+		case store.ErrNotFound:
+			ms.Responses = append(ms.Responses, response{Href: href, Status: statusLine(http.StatusNotFound)})
+		default:
+			internalError(w, err)
+			return
+		}
+	}
+	writeMultistatus(w, ms)
+}
+
+// cardAt returns the card at href, a path or an absolute url, or store.ErrNotFound
+func (h *handler) cardAt(r *http.Request, href string) (*card, error) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return nil, store.ErrNotFound
+	}
+	t, ok := parsePath(u.EscapedPath())
+	if !ok || t.kind != kindCard {
+		return nil, store.ErrNotFound
+	}
+	contact, err := h.lookup(r.Context(), t.name)
+	if err != nil {
+		return nil, err
+	}
+	return newCard(contact)
+}
+
+// query lists the properties of the cards matching the filter, up to the requested limit.
+// A truncated result ends with a 507 response for the address book as RFC 6352 asks
+func (h *handler) query(w http.ResponseWriter, r *http.Request, body []byte) {
+	req := addressBookQuery{}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch req.Filter.validate() {
+	case errCollation:
+		writeError(w, http.StatusForbidden, nsCardDAV, "supported-collation")
+		return
+	case errMatchType:
+		writeError(w, http.StatusForbidden, nsCardDAV, "supported-filter")
+		return
+	}
+	limit := 0
+	if req.Limit != nil {
+		limit = req.Limit.NResults
+	}
+
+	names := reportNames(req.Prop)
+	ms := multistatus{}
+	err := h.store.Each(r.Context(), models.ContactFilter{}, func(contact models.Contact) error {
+		c, err := newCard(contact)
+		if err != nil {
+			return err
+		}
+		cards, _, err := vcard.Decode(bytes.NewReader(c.data))
+		if err != nil || len(cards) == 0 || !req.Filter.matches(cards[0]) {
+			return err
+		}
+		if limit > 0 && len(ms.Responses) == limit {
+			return errLimit
+		}
+		ms.Responses = append(ms.Responses, propResponse(resource{href: c.href(), kind: kindCard, card: c}, 0, names, modeProp))
+		return nil
+	})
+	if err == errLimit {
+		ms.Responses = append(ms.Responses, response{Href: addressBookPath, Status: statusLine(http.StatusInsufficientStorage)})
+	} else if err != nil {
+		internalError(w, err)
+		return
+	}
+	writeMultistatus(w, ms)
+}
+
+// syncCollection lists the cards changed since the sync token of the request, or every card when it has none.
+// Cards deleted since respond 404, the new sync token ends the response
+func (h *handler) syncCollection(w http.ResponseWriter, r *http.Request, body []byte) {
+	req := syncCollection{}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if level := strings.TrimSpace(req.SyncLevel); level != "" && level != "1" && level != "infinite" {
+		http.Error(w, "invalid sync-level", http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	names := reportNames(req.Prop)
+	ms := multistatus{}
+	add := func(contact models.Contact) error {
+		c, err := newCard(contact)
+		if err != nil {
+			return err
+		}
+		ms.Responses = append(ms.Responses, propResponse(resource{href: c.href(), kind: kindCard, card: c}, 0, names, modeProp))
+		return nil
+	}
+
+	if strings.TrimSpace(req.SyncToken) == "" {
+		// the token is read first so changes made while listing are sent again by the next sync
+		token, err := h.store.SyncToken(ctx)
+		if err == nil {
+			err = h.store.Each(ctx, models.ContactFilter{}, add)
+		}
+		if err != nil {
+			internalError(w, err)
+			return
+		}
+		ms.SyncToken = formatSyncToken(token)
+		writeMultistatus(w, ms)
+		return
+	}
+
+	since, ok := parseSyncToken(req.SyncToken)
+	if !ok {
+		writeError(w, http.StatusForbidden, nsDAV, "valid-sync-token")
+		return
+	}
+	changes, token, err := h.store.Changes(ctx, since)
+	if err == store.ErrInvalidSyncToken {
+		writeError(w, http.StatusForbidden, nsDAV, "valid-sync-token")
+		return
+	}
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	for _, change := range changes {
+		name := cardName(change.ContactID, change.UID)
+		contact := models.Contact{}
+		if !change.Deleted {
+			contact, err = h.store.Get(ctx, change.ContactID)
+		}
+		switch {
+		case change.Deleted, err == store.ErrNotFound, err == nil && cardName(contact.ID, contact.UID) != name:
+			ms.Responses = append(ms.Responses, response{Href: cardHref(name), Status: statusLine(http.StatusNotFound)})
+			err = nil
+		case err == nil:
+			err = add(contact)
+		}
+		if err != nil {
+			internalError(w, err)
+			return
+		}
+	}
+	ms.SyncToken = formatSyncToken(token)
+	writeMultistatus(w, ms)
+}
+
+// reportNames returns the properties a report asks for, the entity tag when it names none
+func reportNames(p propNames) []xml.Name {
+	if len(p.Names) == 0 {
+		return []xml.Name{{Space: nsDAV, Local: "getetag"}}
+	}
+	return p.names()
+}
+
+// formatSyncToken returns the sync token handed to clients for a token of the change log
+func formatSyncToken(token int64) string {
+	return syncTokenPrefix + strconv.FormatInt(token, 10)
+}
+
+// parseSyncToken returns the token of the change log of a sync token handed to a client
+func parseSyncToken(syncToken string) (int64, bool) {
+	syncToken = strings.TrimSpace(syncToken)
+	if !strings.HasPrefix(syncToken, syncTokenPrefix) {
+		return 0, false
+	}
+	token, err := strconv.ParseInt(strings.TrimPrefix(syncToken, syncTokenPrefix), 10, 64)
+	return token, err == nil && token >= 0
+}
@@ -0,0 +1,140 @@
+package carddav
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// xml namespaces
+const (
+	nsDAV            = "DAV:"
+	nsCardDAV        = "urn:ietf:params:xml:ns:carddav"
+	nsCalendarServer = "http://calendarserver.org/ns/"
+)
+
+// xmlContentType content type of every xml response
+const xmlContentType = "application/xml; charset=utf-8"
+
+// anyElement an element of which only the name matters
+type anyElement struct {
+	XMLName xml.Name
+}
+
+// propfind body of a PROPFIND request, an empty body asks for every property
+type propfind struct {
+	XMLName  xml.Name   `xml:"DAV: propfind"`
+	AllProp  *struct{}  `xml:"DAV: allprop"`
+	PropName *struct{}  `xml:"DAV: propname"`
+	Prop     *propNames `xml:"DAV: prop"`
+}
+
+// propNames names of the properties a request asks for
+type propNames struct {
+	Names []anyElement `xml:",any"`
+}
+
+// addressBookMultiget body of an addressbook-multiget REPORT, RFC 6352 section 8.7
+type addressBookMultiget struct {
+	XMLName xml.Name  `xml:"urn:ietf:params:xml:ns:carddav addressbook-multiget"`
+	Prop    propNames `xml:"DAV: prop"`
+	Hrefs   []string  `xml:"DAV: href"`
+}
+
+// addressBookQuery body of an addressbook-query REPORT, RFC 6352 section 8.6
+type addressBookQuery struct {
+	XMLName xml.Name  `xml:"urn:ietf:params:xml:ns:carddav addressbook-query"`
+	Prop    propNames `xml:"DAV: prop"`
+	Filter  filter    `xml:"urn:ietf:params:xml:ns:carddav filter"`
+	Limit   *struct {
+		NResults int `xml:"urn:ietf:params:xml:ns:carddav nresults"`
+	} `xml:"urn:ietf:params:xml:ns:carddav limit"`
+}
+
+// syncCollection body of a sync-collection REPORT, RFC 6578 section 3.2
+type syncCollection struct {
+	XMLName   xml.Name  `xml:"DAV: sync-collection"`
+	SyncToken string    `xml:"DAV: sync-token"`
+	SyncLevel string    `xml:"DAV: sync-level"`
+	Prop      propNames `xml:"DAV: prop"`
+}
+
+// property a property of a resource, Inner is its content as escaped xml
+type property struct {
+	XMLName xml.Name
+	Inner   string `xml:",innerxml"`
+}
+
+// prop a set of properties
+type prop struct {
+	Props []property `xml:",any"`
+}
+
+// propstat properties sharing a status
+type propstat struct {
+	Prop   prop   `xml:"prop"`
+	Status string `xml:"status"`
+}
+
+// response describes a single resource of a multistatus
+type response struct {
+	Href      string     `xml:"href"`
+	Propstats []propstat `xml:"propstat,omitempty"`
+	Status    string     `xml:"status,omitempty"`
+}
+
+// multistatus body of a 207 response
+type multistatus struct {
+	XMLName   xml.Name   `xml:"DAV: multistatus"`
+	Responses []response `xml:"response"`
+	SyncToken string     `xml:"sync-token,omitempty"`
+}
+
+// davError body naming the precondition a request failed, RFC 4918 section 16
+type davError struct {
+	XMLName   xml.Name `xml:"DAV: error"`
+	Condition anyElement
+}
+
+// statusLine returns the status element text of code
+func statusLine(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))
+}
+
+// element returns an empty or text element in a namespace as escaped xml
+func element(space, local, text string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<%s xmlns="%s">`, local, space)
+	xml.EscapeText(&b, []byte(text))
+	fmt.Fprintf(&b, "</%s>", local)
+	return b.String()
+}
+
+// hrefElement returns a DAV:href element
+func hrefElement(href string) string {
+	return element(nsDAV, "href", href)
+}
+
+// writeMultistatus writes a 207 multistatus response
+func writeMultistatus(w http.ResponseWriter, ms multistatus) {
+	writeXML(w, http.StatusMultiStatus, ms)
+}
+
+// writeError writes a response with a DAV:error body naming the failed precondition
+func writeError(w http.ResponseWriter, status int, space, condition string) {
+	writeXML(w, status, davError{Condition: anyElement{XMLName: xml.Name{Space: space, Local: condition}}})
+}
+
+// writeXML writes body as the xml response
+func writeXML(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", xmlContentType)
+	w.WriteHeader(status)
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return
+	}
+	if err := xml.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("carddav error: writing the response: %s", err)
+	}
+}
@@ -1,10 +1,13 @@
 package connectors
 
 import (
-	"database/sql"
+	"context"
 	"net/http"
 
+	"github.com/gorilla/mux"
 	a "github.com/squanchersquanch/contacts/components/actions"
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/models"
 	"github.com/squanchersquanch/contacts/services/config"
 )
 
@@ -16,11 +19,32 @@ const (
 type Connector interface {
 	NotFound(w http.ResponseWriter, r *http.Request)
 	CreateContact(w http.ResponseWriter, r *http.Request)
+	ListContacts(w http.ResponseWriter, r *http.Request)
 	GetContacts(w http.ResponseWriter, r *http.Request)
 	UpdateContact(w http.ResponseWriter, r *http.Request)
+	UpsertContactByEmail(w http.ResponseWriter, r *http.Request)
 	DeleteContact(w http.ResponseWriter, r *http.Request)
 	ImportContacts(w http.ResponseWriter, r *http.Request)
+	SubmitImport(w http.ResponseWriter, r *http.Request)
+	GetImport(w http.ResponseWriter, r *http.Request)
+	CancelImport(w http.ResponseWriter, r *http.Request)
+	SubmitExport(w http.ResponseWriter, r *http.Request)
+	GetExport(w http.ResponseWriter, r *http.Request)
+	DownloadExport(w http.ResponseWriter, r *http.Request)
 	ExportContacts(w http.ResponseWriter, r *http.Request)
+	ExportContactVCard(w http.ResponseWriter, r *http.Request)
+	ContactQRCode(w http.ResponseWriter, r *http.Request)
+	FindDuplicates(w http.ResponseWriter, r *http.Request)
+	MergeContacts(w http.ResponseWriter, r *http.Request)
+	CreateContactV2(w http.ResponseWriter, r *http.Request)
+	ListContactsV2(w http.ResponseWriter, r *http.Request)
+	GetContactV2(w http.ResponseWriter, r *http.Request)
+	UpdateContactV2(w http.ResponseWriter, r *http.Request)
+	DeleteContactV2(w http.ResponseWriter, r *http.Request)
+	// Start starts the import and export workers, which run until ctx is done or Close is called
+	Start(ctx context.Context)
+	// Close stops the import and export workers
+	Close()
 }
 
 // connector is an implementation of the Connector interface
@@ -31,18 +55,28 @@ type connector struct {
 
 // NewConnector creates a new instance of Connector
 func NewConnector(
-	db *sql.DB,
+	store store.Store,
 	config *config.Config,
 ) Connector {
-	actions := a.NewActions(db, config)
+	actions := a.NewActions(store, config)
 	return &connector{
 		actions: actions,
 	}
 }
 
+// Start starts the import and export workers
+func (c *connector) Start(ctx context.Context) {
+	c.actions.Start(ctx)
+}
+
+// Close stops the import and export workers
+func (c *connector) Close() {
+	c.actions.Close()
+}
+
 // NotFound calls the NotFound action and returns a StatusNotFound
 func (c *connector) NotFound(w http.ResponseWriter, r *http.Request) {
-	c.actions.NotFound(w)
+	c.actions.NotFound(w, r)
 }
 
 // CreateContact creates a new contact
@@ -50,41 +84,183 @@ func (c *connector) CreateContact(w http.ResponseWriter, r *http.Request) {
 	c.actions.CreateRow(w, r)
 }
 
+// ListContacts retrieves all contacts
+func (c *connector) ListContacts(w http.ResponseWriter, r *http.Request) {
+	c.actions.ReadRows(w, r)
+}
+
 // GetContacts retrieves all contacts or a specifc contact by id
 func (c *connector) GetContacts(w http.ResponseWriter, r *http.Request) {
-	query := c.getURLQuery(r, "id")
-	if query != "" {
-		c.actions.ReadRows(w, query)
+	id := c.getContactID(r)
+	if id != "" {
+		c.actions.ReadRows(w, r, id)
 		return
 	}
 
-	c.actions.ReadRows(w)
+	c.actions.ReadRows(w, r)
 }
 
-// UpdateContact updates an existing contact
+// UpdateContact updates an existing contact, the id of the url wins over the id of the body
 func (c *connector) UpdateContact(w http.ResponseWriter, r *http.Request) {
-	c.actions.UpdateRow(w, r)
+	c.actions.UpdateRow(w, r, c.getURLVar(r, "id"))
+}
+
+// UpsertContactByEmail creates or updates a contact identified by its email
+func (c *connector) UpsertContactByEmail(w http.ResponseWriter, r *http.Request) {
+	c.actions.UpsertRowByEmail(w, r, c.getURLVar(r, "email"))
 }
 
 // DeleteContact deletes an existing contacts
 func (c *connector) DeleteContact(w http.ResponseWriter, r *http.Request) {
-	query := c.getURLQuery(r, "id")
-	if query != "" {
-		c.actions.DeleteRow(w, query)
-	}
+	c.actions.DeleteRow(w, r, c.getContactID(r))
 }
 
-// ExportContacts exports existing contacts via csv file
+// ExportContacts exports existing contacts via csv file, vCard file with ?format=vcf&version=,
+// LDIF with ?format=ldif&base_dn=, workbook with ?format=xlsx or json with ?format=json and ?format=ndjson
 func (c *connector) ExportContacts(w http.ResponseWriter, r *http.Request) {
-	c.actions.GenerateContactsCSV(w, r)
+	c.actions.GenerateContactsCSV(w, r, c.getExportOptions(r))
+}
+
+// SubmitExport queues an export to be written in the background, taking the same queries as ExportContacts
+func (c *connector) SubmitExport(w http.ResponseWriter, r *http.Request) {
+	c.actions.SubmitExport(w, r, c.getExportOptions(r))
 }
 
-// ImportContacts updates an existing contact via csv file
+// GetExport reports the status and progress of a background export along with its download url
+func (c *connector) GetExport(w http.ResponseWriter, r *http.Request) {
+	c.actions.GetExport(w, r, c.getURLVar(r, "id"))
+}
+
+// DownloadExport downloads the file of a background export through a signed url
+func (c *connector) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	c.actions.DownloadExport(w, r, c.getURLVar(r, "id"), c.getURLQuery(r, "expires"), c.getURLQuery(r, "signature"))
+}
+
+// ExportContactVCard downloads a single contact as a vCard, ?version= picks 3.0 or 4.0
+func (c *connector) ExportContactVCard(w http.ResponseWriter, r *http.Request) {
+	c.actions.GenerateContactVCard(w, r, c.getURLVar(r, "id"), c.getURLQuery(r, "version"))
+}
+
+// ContactQRCode renders a qr code of a single contact, ?format=, ?size= and ?ecc= tune the image
+func (c *connector) ContactQRCode(w http.ResponseWriter, r *http.Request) {
+	c.actions.GenerateContactQRCode(w, r, c.getURLVar(r, "id"), a.QROptions{
+		Format: c.getURLQuery(r, "format"),
+		Size:   c.getURLQuery(r, "size"),
+		Level:  c.getURLQuery(r, "ecc"),
+	})
+}
+
+// ImportContacts updates an existing contact via csv, vCard, json, ndjson or xlsx file, matching rows by id unless ?match=email is given
 func (c *connector) ImportContacts(w http.ResponseWriter, r *http.Request) {
-	c.actions.ImportContactsCSV(w, r)
+	c.actions.ImportContactsCSV(w, r, c.getImportOptions(r))
+}
+
+// SubmitImport queues a file to be imported in the background, taking the same queries as ImportContacts
+func (c *connector) SubmitImport(w http.ResponseWriter, r *http.Request) {
+	c.actions.SubmitImport(w, r, c.getImportOptions(r))
+}
+
+// GetImport reports the status and progress of a background import
+func (c *connector) GetImport(w http.ResponseWriter, r *http.Request) {
+	c.actions.GetImport(w, r, c.getURLVar(r, "id"))
+}
+
+// CancelImport cancels a queued or running background import
+func (c *connector) CancelImport(w http.ResponseWriter, r *http.Request) {
+	c.actions.CancelImport(w, r, c.getURLVar(r, "id"))
+}
+
+// FindDuplicates lists clusters of likely duplicate contacts, ?threshold= tunes the minimum score
+func (c *connector) FindDuplicates(w http.ResponseWriter, r *http.Request) {
+	c.actions.FindDuplicates(w, r, c.getURLQuery(r, "threshold"))
+}
+
+// MergeContacts merges duplicate contacts into one
+func (c *connector) MergeContacts(w http.ResponseWriter, r *http.Request) {
+	c.actions.MergeContacts(w, r)
+}
+
+// CreateContactV2 creates a new contact from the v2 shape
+func (c *connector) CreateContactV2(w http.ResponseWriter, r *http.Request) {
+	c.actions.CreateContactV2(w, r)
+}
+
+// ListContactsV2 retrieves contacts in the v2 shape, ?limit= and ?after= list them a page at a time
+func (c *connector) ListContactsV2(w http.ResponseWriter, r *http.Request) {
+	c.actions.ListContactsV2(w, r, c.getURLQuery(r, "limit"), c.getURLQuery(r, "after"))
+}
+
+// GetContactV2 retrieves a contact by id in the v2 shape
+func (c *connector) GetContactV2(w http.ResponseWriter, r *http.Request) {
+	c.actions.GetContactV2(w, r, c.getURLVar(r, "id"))
+}
+
+// UpdateContactV2 replaces a contact by id with the v2 shape
+func (c *connector) UpdateContactV2(w http.ResponseWriter, r *http.Request) {
+	c.actions.UpdateContactV2(w, r, c.getURLVar(r, "id"))
+}
+
+// DeleteContactV2 deletes a contact by id, the same contact the v1 api deletes
+func (c *connector) DeleteContactV2(w http.ResponseWriter, r *http.Request) {
+	c.actions.DeleteRow(w, r, c.getURLVar(r, "id"))
+}
+
+// getExportOptions returns the export options and contact filter given as URL queries
+func (c *connector) getExportOptions(r *http.Request) a.ExportOptions {
+	return a.ExportOptions{
+		Format:  c.getURLQuery(r, "format"),
+		Version: c.getURLQuery(r, "version"),
+		BaseDN:  c.getURLQuery(r, "base_dn"),
+		CSV:     c.getCSVOptions(r),
+		Filter: models.ContactFilter{
+			Query:        c.getURLQuery(r, "q"),
+			Organization: c.getURLQuery(r, "organization"),
+			City:         c.getURLQuery(r, "city"),
+			Region:       c.getURLQuery(r, "region"),
+			Country:      c.getURLQuery(r, "country"),
+		},
+	}
+}
+
+// getImportOptions returns the import options given as URL queries, rows are matched by id unless ?match=email is given
+func (c *connector) getImportOptions(r *http.Request) a.ImportOptions {
+	matchBy := c.getURLQuery(r, "match")
+	if matchBy == "" {
+		matchBy = a.MatchByID
+	}
+	return a.ImportOptions{
+		MatchBy: matchBy,
+		CSV:     c.getCSVOptions(r),
+		Sheet:   c.getURLQuery(r, "sheet"),
+	}
+}
+
+// getCSVOptions returns the csv profile, mapping and dialect given as URL queries
+func (c *connector) getCSVOptions(r *http.Request) a.CSVOptions {
+	return a.CSVOptions{
+		Profile:   c.getURLQuery(r, "profile"),
+		Mapping:   c.getURLQuery(r, "mapping"),
+		Delimiter: c.getURLQuery(r, "delimiter"),
+		Quote:     c.getURLQuery(r, "quote"),
+		BOM:       c.getURLQuery(r, "bom"),
+		Charset:   c.getURLQuery(r, "charset"),
+	}
+}
+
+// getContactID returns the id of the contact route, the /api/entry routes take it as the id query
+func (c *connector) getContactID(r *http.Request) string {
+	if id := c.getURLVar(r, "id"); id != "" {
+		return id
+	}
+	return c.getURLQuery(r, "id")
 }
 
 // getURLQuery returns values of URL query from given key
 func (c *connector) getURLQuery(r *http.Request, key string) string {
 	return r.URL.Query().Get(key)
 }
+
+// getURLVar returns the value of a route variable from given key
+func (c *connector) getURLVar(r *http.Request, key string) string {
+	return mux.Vars(r)[key]
+}
@@ -2,7 +2,9 @@ package connectors
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,10 +13,13 @@ import (
 	"net/http/httptest"
 	"net/textproto"
 	"os"
+	"time"
 
 	"testing"
 
 	"github.com/squanchersquanch/contacts/components/actions"
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/models"
 	"github.com/squanchersquanch/contacts/services/config"
 	"github.com/squanchersquanch/contacts/services/logger"
 	"github.com/squanchersquanch/contacts/services/postgres"
@@ -61,11 +66,12 @@ func (s *connectorSuite) SetupTest() {
 
 	s.db = postgres.NewDataBase(config)
 
-	s.actions = actions.NewActions(s.db)
+	s.actions = actions.NewActions(store.NewPostgresStore(s.db, config.Service.DB), config)
 
 	s.connector = &connector{
 		actions: s.actions,
 	}
+	s.connector.Start(context.Background())
 	s.router = mux.NewRouter().StrictSlash(true)
 	s.routes = []route{
 		route{
@@ -86,6 +92,12 @@ func (s *connectorSuite) SetupTest() {
 			"/api/entry",
 			s.connector.UpdateContact,
 		},
+		route{
+			"UpsertContactByEmail",
+			"PUT",
+			"/api/v1/contacts/by-email/{email}",
+			s.connector.UpsertContactByEmail,
+		},
 		route{
 			"DeleteContact",
 			"DELETE",
@@ -98,12 +110,72 @@ func (s *connectorSuite) SetupTest() {
 			"/api/entry/export",
 			s.connector.ExportContacts,
 		},
+		route{
+			"ExportContactVCard",
+			"GET",
+			"/api/v1/contacts/{id}.vcf",
+			s.connector.ExportContactVCard,
+		},
+		route{
+			"ContactQRCode",
+			"GET",
+			"/api/v1/contacts/{id}/qr.png",
+			s.connector.ContactQRCode,
+		},
 		route{
 			"ImportContacts",
 			"POST",
 			"/api/entry/import",
 			s.connector.ImportContacts,
 		},
+		route{
+			"SubmitImport",
+			"POST",
+			"/api/v1/imports",
+			s.connector.SubmitImport,
+		},
+		route{
+			"GetImport",
+			"GET",
+			"/api/v1/imports/{id}",
+			s.connector.GetImport,
+		},
+		route{
+			"CancelImport",
+			"DELETE",
+			"/api/v1/imports/{id}",
+			s.connector.CancelImport,
+		},
+		route{
+			"SubmitExport",
+			"POST",
+			"/api/v1/exports",
+			s.connector.SubmitExport,
+		},
+		route{
+			"GetExport",
+			"GET",
+			"/api/v1/exports/{id}",
+			s.connector.GetExport,
+		},
+		route{
+			"DownloadExport",
+			"GET",
+			"/api/v1/exports/{id}/download",
+			s.connector.DownloadExport,
+		},
+		route{
+			"FindDuplicates",
+			"GET",
+			"/api/v1/contacts/duplicates",
+			s.connector.FindDuplicates,
+		},
+		route{
+			"MergeContacts",
+			"POST",
+			"/api/v1/contacts/merge",
+			s.connector.MergeContacts,
+		},
 		route{
 			"NotFound",
 			"",
@@ -125,6 +197,10 @@ func (s *connectorSuite) SetupTest() {
 	}
 }
 
+func (s *connectorSuite) TearDownTest() {
+	s.connector.Close()
+}
+
 func (s *connectorSuite) TestNotFound() {
 	req, err := http.NewRequest("GET", "/api/failhard", nil)
 	s.NoError(err)
@@ -144,7 +220,17 @@ func (s *connectorSuite) TestCreateContact() {
 
 	rr := httptest.NewRecorder()
 	s.router.ServeHTTP(rr, req)
-	s.Equal(rr.Code, http.StatusOK)
+	s.Equal(rr.Code, http.StatusCreated)
+}
+
+func (s *connectorSuite) TestCreateContactInvalid() {
+	req, err := http.NewRequest("POST", "/api/entry", bytes.NewBufferString(`{"email": "not-an-email"}`))
+	s.NoError(err)
+	s.NotNil(req)
+
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	s.Equal(rr.Code, http.StatusUnprocessableEntity)
 }
 
 func (s *connectorSuite) TestGetContacts() {
@@ -177,14 +263,61 @@ func (s *connectorSuite) TestUpdateContact() {
 	s.Equal(rr.Code, http.StatusOK)
 }
 
+func (s *connectorSuite) TestUpsertContactByEmail() {
+	data, err := ioutil.ReadFile(newContactFilePath)
+	s.NoError(err)
+	req, err := http.NewRequest("PUT", "/api/v1/contacts/by-email/upsert.contact@gmail.com", bytes.NewBuffer(data))
+	s.NoError(err)
+	s.NotNil(req)
+
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	s.Contains([]int{http.StatusCreated, http.StatusOK}, rr.Code)
+
+	// a second call with the same email updates rather than conflicts
+	req, err = http.NewRequest("PUT", "/api/v1/contacts/by-email/upsert.contact@gmail.com", bytes.NewBuffer(data))
+	s.NoError(err)
+
+	rr = httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	s.Equal(rr.Code, http.StatusOK)
+}
+
 func (s *connectorSuite) TestDeleteContact() {
 	req, err := http.NewRequest("DELETE", "/api/entry?id=2", nil)
 	s.NoError(err)
 	s.NotNil(req)
 
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	s.Equal(rr.Code, http.StatusNoContent)
+}
+
+func (s *connectorSuite) TestFindDuplicates() {
+	req, err := http.NewRequest("GET", "/api/v1/contacts/duplicates?threshold=0.8", nil)
+	s.NoError(err)
+	s.NotNil(req)
+
 	rr := httptest.NewRecorder()
 	s.router.ServeHTTP(rr, req)
 	s.Equal(rr.Code, http.StatusOK)
+
+	req, err = http.NewRequest("GET", "/api/v1/contacts/duplicates?threshold=2", nil)
+	s.NoError(err)
+
+	rr = httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	s.Equal(rr.Code, http.StatusBadRequest)
+}
+
+func (s *connectorSuite) TestMergeContactsInvalid() {
+	req, err := http.NewRequest("POST", "/api/v1/contacts/merge", bytes.NewBufferString(`{"ids": ["1"]}`))
+	s.NoError(err)
+	s.NotNil(req)
+
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	s.Equal(rr.Code, http.StatusBadRequest)
 }
 
 func (s *connectorSuite) TestImportContacts() {
@@ -215,7 +348,32 @@ func (s *connectorSuite) TestExportContacts() {
 
 	rr := httptest.NewRecorder()
 	s.router.ServeHTTP(rr, req)
-	s.Equal(rr.Code, http.StatusAccepted)
+	s.Equal(rr.Code, http.StatusOK)
+}
+
+func (s *connectorSuite) TestImportContactsBulk() {
+	email := fmt.Sprintf("bulk.%d@example.com", time.Now().UnixNano())
+	bodyBuffer := new(bytes.Buffer)
+	bodyWriter := multipart.NewWriter(bodyBuffer)
+	formFile, _ := generateCSVFile(bodyWriter, testImportFile)
+	fmt.Fprintf(formFile, "FirstName,Email\r\nroger,%[1]s\r\nrogers,%[1]s\r\n,%[1]s\r\n", email)
+	bodyWriter.Close()
+
+	req, err := http.NewRequest("POST", "/api/entry/import?match=email", bodyBuffer)
+	s.NoError(err)
+	req.Header.Set("Content-Type", bodyWriter.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	s.Equal(http.StatusOK, rr.Code)
+
+	report := models.ImportReport{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &report))
+	s.Equal(3, report.Total)
+	s.Equal(1, report.Created)
+	s.Equal(2, report.Rejected)
+	// the email conflict of row 1 is found after row 2 failed validation, errors are still in row order
+	s.Equal([]string{"rows[1].email", "rows[2].first_name"}, []string{report.Errors[0].Field, report.Errors[1].Field})
 }
 
 func generateCSVFile(w *multipart.Writer, filename string) (io.Writer, error) {
@@ -0,0 +1,231 @@
+package csvfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// supported charsets
+const (
+	UTF8        = "utf-8"
+	UTF16       = "utf-16"
+	UTF16LE     = "utf-16le"
+	UTF16BE     = "utf-16be"
+	Windows1252 = "windows-1252"
+)
+
+// byte order marks
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// windows1252 code points of the bytes 0x80 to 0x9F, the unassigned bytes map to the C1 controls like ISO-8859-1
+var windows1252 = [32]rune{
+	0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021, 0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F,
+	0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014, 0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178,
+}
+
+// parseCharset normalizes a charset name, an empty name is UTF-8
+func parseCharset(name string) (string, error) {
+	switch strings.ToLower(strings.Replace(strings.TrimSpace(name), "_", "-", -1)) {
+	case "", "utf-8", "utf8":
+		return UTF8, nil
+	case "utf-16", "utf16":
+		return UTF16, nil
+	case "utf-16le", "utf16le":
+		return UTF16LE, nil
+	case "utf-16be", "utf16be":
+		return UTF16BE, nil
+	case "windows-1252", "cp1252", "latin1", "iso-8859-1":
+		return Windows1252, nil
+	}
+	return "", fmt.Errorf("unsupported charset %s, expected utf-8, utf-16, utf-16le, utf-16be or windows-1252", name)
+}
+
+// newDecoder returns a reader converting r from charset to UTF-8. A byte order mark always wins over
+// charset and is dropped, UTF-16 without a byte order mark is read as little endian as written by Excel
+func newDecoder(r io.Reader, charset string) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(3)
+	switch {
+	case bytes.HasPrefix(head, bomUTF8):
+		br.Discard(len(bomUTF8))
+		return br, nil
+	case bytes.HasPrefix(head, bomUTF16LE):
+		br.Discard(len(bomUTF16LE))
+		return &utf16Reader{r: br, order: binary.LittleEndian}, nil
+	case bytes.HasPrefix(head, bomUTF16BE):
+		br.Discard(len(bomUTF16BE))
+		return &utf16Reader{r: br, order: binary.BigEndian}, nil
+	}
+
+	switch charset {
+	case UTF16, UTF16LE:
+		return &utf16Reader{r: br, order: binary.LittleEndian}, nil
+	case UTF16BE:
+		return &utf16Reader{r: br, order: binary.BigEndian}, nil
+	case Windows1252:
+		return &windows1252Reader{r: br}, nil
+	}
+	return br, nil
+}
+
+// utf16Reader converts UTF-16 to UTF-8
+type utf16Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	buf   bytes.Buffer
+	err   error
+}
+
+// Read implements io.Reader
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	for u.buf.Len() < len(p) && u.err == nil {
+		var unit uint16
+		if u.err = binary.Read(u.r, u.order, &unit); u.err != nil {
+			if u.err == io.ErrUnexpectedEOF {
+				u.err = fmt.Errorf("utf-16 input ends in the middle of a character")
+			}
+			break
+		}
+		r := rune(unit)
+		if utf16.IsSurrogate(r) {
+			var low uint16
+			if u.err = binary.Read(u.r, u.order, &low); u.err != nil {
+				if u.err == io.EOF || u.err == io.ErrUnexpectedEOF {
+					u.err = fmt.Errorf("utf-16 input ends in the middle of a character")
+				}
+				break
+			}
+			r = utf16.DecodeRune(r, rune(low))
+		}
+		u.buf.WriteRune(r)
+	}
+	if u.buf.Len() > 0 {
+		return u.buf.Read(p)
+	}
+	return 0, u.err
+}
+
+// windows1252Reader converts Windows-1252 to UTF-8
+type windows1252Reader struct {
+	r   *bufio.Reader
+	buf bytes.Buffer
+	err error
+}
+
+// Read implements io.Reader
+func (w *windows1252Reader) Read(p []byte) (int, error) {
+	for w.buf.Len() < len(p) && w.err == nil {
+		var b byte
+		if b, w.err = w.r.ReadByte(); w.err != nil {
+			break
+		}
+		switch {
+		case b < 0x80:
+			w.buf.WriteByte(b)
+		case b < 0xA0:
+			w.buf.WriteRune(windows1252[b-0x80])
+		default:
+			w.buf.WriteRune(rune(b))
+		}
+	}
+	if w.buf.Len() > 0 {
+		return w.buf.Read(p)
+	}
+	return 0, w.err
+}
+
+// newEncoder returns a writer converting UTF-8 to charset, writing a byte order mark first when bom is set.
+// UTF-16 is written little endian with a byte order mark unless UTF16BE or UTF16LE is requested.
+// Characters Windows-1252 can not represent are written as ?
+func newEncoder(w io.Writer, charset string, bom bool) (io.Writer, error) {
+	e := &encoder{w: w, charset: charset}
+	var mark []byte
+	switch charset {
+	case UTF8:
+		if bom {
+			mark = bomUTF8
+		}
+	case UTF16:
+		e.charset = UTF16LE
+		mark = bomUTF16LE
+	case UTF16LE:
+		if bom {
+			mark = bomUTF16LE
+		}
+	case UTF16BE:
+		if bom {
+			mark = bomUTF16BE
+		}
+	}
+	if mark != nil {
+		if _, err := w.Write(mark); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// encoder converts UTF-8 to another charset, keeping incomplete characters until the next write
+type encoder struct {
+	w       io.Writer
+	charset string
+	pending []byte
+}
+
+// Write implements io.Writer
+func (e *encoder) Write(p []byte) (int, error) {
+	if e.charset == UTF8 {
+		return e.w.Write(p)
+	}
+	data := append(e.pending, p...)
+	out := make([]byte, 0, len(data)*2)
+	i := 0
+	for i < len(data) {
+		if !utf8.FullRune(data[i:]) {
+			break
+		}
+		r, size := utf8.DecodeRune(data[i:])
+		i += size
+		switch e.charset {
+		case UTF16LE, UTF16BE:
+			var order binary.AppendByteOrder = binary.LittleEndian
+			if e.charset == UTF16BE {
+				order = binary.BigEndian
+			}
+			units := utf16.Encode([]rune{r})
+			for _, unit := range units {
+				out = order.AppendUint16(out, unit)
+			}
+		case Windows1252:
+			out = append(out, encodeWindows1252(r))
+		}
+	}
+	e.pending = append([]byte{}, data[i:]...)
+	if _, err := e.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// encodeWindows1252 returns the Windows-1252 byte of r or ? when there is none
+func encodeWindows1252(r rune) byte {
+	if r < 0x80 || (r >= 0xA0 && r <= 0xFF) {
+		return byte(r)
+	}
+	for i, c := range windows1252 {
+		if c == r {
+			return byte(0x80 + i)
+		}
+	}
+	return '?'
+}
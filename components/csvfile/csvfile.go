@@ -0,0 +1,254 @@
+package csvfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Dialect describes how a csv file is laid out and encoded
+type Dialect struct {
+	// Delimiter separates fields, defaults to a comma
+	Delimiter rune
+	// Quote encloses fields holding delimiters, quotes or line breaks, defaults to a double quote
+	Quote rune
+	// BOM writes a byte order mark for the unicode charsets, files are always read with or without one
+	BOM bool
+	// Charset one of UTF8, UTF16, UTF16LE, UTF16BE or Windows1252
+	Charset string
+}
+
+// DefaultDialect comma separated UTF-8 without a byte order mark
+var DefaultDialect = Dialect{Delimiter: ',', Quote: '"', Charset: UTF8}
+
+// delimiterNames names accepted in place of a delimiter character
+var delimiterNames = map[string]rune{
+	"comma":     ',',
+	"semicolon": ';',
+	"tab":       '\t',
+	`\t`:        '\t',
+	"pipe":      '|',
+}
+
+// ParseDialect builds a dialect from request parameters, empty parameters use the defaults.
+// delimiter is a single character or one of comma, semicolon, tab or pipe, bom is a boolean
+func ParseDialect(delimiter, quote, bom, charset string) (Dialect, error) {
+	d := DefaultDialect
+	if delimiter != "" {
+		r, ok := delimiterNames[strings.ToLower(delimiter)]
+		if !ok {
+			var err error
+			if r, err = singleRune(delimiter); err != nil {
+				return d, fmt.Errorf("invalid delimiter: %s", err)
+			}
+		}
+		d.Delimiter = r
+	}
+	if quote != "" {
+		r, err := singleRune(quote)
+		if err != nil {
+			return d, fmt.Errorf("invalid quote: %s", err)
+		}
+		d.Quote = r
+	}
+	if bom != "" {
+		b, err := strconv.ParseBool(bom)
+		if err != nil {
+			return d, fmt.Errorf("invalid bom: expected true or false")
+		}
+		d.BOM = b
+	}
+	c, err := parseCharset(charset)
+	if err != nil {
+		return d, err
+	}
+	d.Charset = c
+
+	if d.Delimiter == d.Quote {
+		return d, fmt.Errorf("delimiter and quote must differ")
+	}
+	return d, nil
+}
+
+// singleRune returns s when it is exactly one character that can separate fields
+func singleRune(s string) (rune, error) {
+	r, size := utf8.DecodeRuneInString(s)
+	if size != len(s) || r == utf8.RuneError {
+		return 0, fmt.Errorf("expected a single character")
+	}
+	if r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("line breaks are not allowed")
+	}
+	return r, nil
+}
+
+// ParseError reports a malformed line
+type ParseError struct {
+	// Line line of the file counting from 1
+	Line int
+	// Message describes what is malformed
+	Message string
+}
+
+// Error implements the error interface
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// Reader reads records from a csv file in a dialect
+type Reader struct {
+	r       *bufio.Reader
+	dialect Dialect
+	line    int
+}
+
+// NewReader creates a Reader decoding r from the dialect's charset
+func NewReader(r io.Reader, dialect Dialect) (*Reader, error) {
+	decoded, err := newDecoder(r, dialect.Charset)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{r: bufio.NewReader(decoded), dialect: dialect, line: 1}, nil
+}
+
+// Line the line the next record starts on
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// Read returns the next record skipping empty lines, io.EOF is returned after the last record.
+// Quotes inside unquoted fields are kept as they are
+func (r *Reader) Read() ([]string, error) {
+	for {
+		record, empty, err := r.readRecord()
+		if err != nil {
+			return nil, err
+		}
+		if !empty {
+			return record, nil
+		}
+	}
+}
+
+// readRecord reads one line, or several when quoted fields hold line breaks
+func (r *Reader) readRecord() (record []string, empty bool, err error) {
+	start := r.line
+	var field strings.Builder
+	quoted, inQuotes, afterQuote, seen := false, false, false, false
+
+	next := func() (rune, error) {
+		c, _, err := r.r.ReadRune()
+		if c == '\n' {
+			r.line++
+		}
+		return c, err
+	}
+	endField := func() {
+		record = append(record, field.String())
+		field.Reset()
+		quoted, afterQuote = false, false
+	}
+
+	for {
+		c, err := next()
+		if err == io.EOF {
+			if inQuotes {
+				return nil, false, &ParseError{Line: start, Message: "quoted field is not closed"}
+			}
+			if !seen {
+				return nil, false, io.EOF
+			}
+			endField()
+			return record, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		switch {
+		case inQuotes && c == r.dialect.Quote:
+			peek, _, perr := r.r.ReadRune()
+			if perr == nil && peek == r.dialect.Quote {
+				field.WriteRune(c)
+				continue
+			}
+			if perr == nil {
+				r.r.UnreadRune()
+			}
+			inQuotes, afterQuote = false, true
+		case inQuotes:
+			field.WriteRune(c)
+		case c == r.dialect.Delimiter:
+			seen = true
+			endField()
+		case c == '\n' || c == '\r':
+			if c == '\r' {
+				// CRLF and a lone CR both end one line
+				r.line++
+				if peek, _, perr := r.r.ReadRune(); perr == nil && peek != '\n' {
+					r.r.UnreadRune()
+				}
+			}
+			if !seen {
+				return nil, true, nil
+			}
+			endField()
+			return record, false, nil
+		case afterQuote:
+			return nil, false, &ParseError{Line: r.line, Message: fmt.Sprintf("unexpected %q after closing quote", c)}
+		case c == r.dialect.Quote && field.Len() == 0 && !quoted:
+			seen, quoted, inQuotes = true, true, true
+		default:
+			seen = true
+			field.WriteRune(c)
+		}
+	}
+}
+
+// Writer writes records to a csv file in a dialect
+type Writer struct {
+	w       *bufio.Writer
+	dialect Dialect
+	special string
+}
+
+// NewWriter creates a Writer encoding to the dialect's charset, writing the byte order mark right away
+func NewWriter(w io.Writer, dialect Dialect) (*Writer, error) {
+	encoded, err := newEncoder(w, dialect.Charset, dialect.BOM)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		w:       bufio.NewWriter(encoded),
+		dialect: dialect,
+		special: string([]rune{dialect.Delimiter, dialect.Quote, '\r', '\n'}),
+	}, nil
+}
+
+// Write writes a record ended by CRLF, fields are quoted when they hold special characters
+// or start with a space
+func (w *Writer) Write(record []string) error {
+	for i, field := range record {
+		if i > 0 {
+			w.w.WriteRune(w.dialect.Delimiter)
+		}
+		if !strings.ContainsAny(field, w.special) && !strings.HasPrefix(field, " ") {
+			w.w.WriteString(field)
+			continue
+		}
+		quote := string(w.dialect.Quote)
+		w.w.WriteString(quote)
+		w.w.WriteString(strings.Replace(field, quote, quote+quote, -1))
+		w.w.WriteString(quote)
+	}
+	_, err := w.w.WriteString("\r\n")
+	return err
+}
+
+// Flush writes any buffered records
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,146 @@
+package csvfile
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// readAll reads every record of data in dialect
+func readAll(t *testing.T, data []byte, dialect Dialect) [][]string {
+	r, err := NewReader(bytes.NewReader(data), dialect)
+	assert.NoError(t, err)
+	records := [][]string{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return records
+		}
+		assert.NoError(t, err)
+		records = append(records, record)
+	}
+}
+
+func TestParseDialect(t *testing.T) {
+	d, err := ParseDialect("", "", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultDialect, d)
+
+	d, err = ParseDialect("semicolon", "'", "true", "Windows-1252")
+	assert.NoError(t, err)
+	assert.Equal(t, Dialect{Delimiter: ';', Quote: '\'', BOM: true, Charset: Windows1252}, d)
+
+	d, err = ParseDialect("tab", "", "", "utf16")
+	assert.NoError(t, err)
+	assert.Equal(t, '\t', d.Delimiter)
+	assert.Equal(t, UTF16, d.Charset)
+
+	_, err = ParseDialect(",,", "", "", "")
+	assert.Error(t, err)
+	_, err = ParseDialect(",", ",", "", "")
+	assert.Error(t, err)
+	_, err = ParseDialect("", "", "maybe", "")
+	assert.Error(t, err)
+	_, err = ParseDialect("", "", "", "ebcdic")
+	assert.Error(t, err)
+}
+
+func TestRead(t *testing.T) {
+	data := "a;'b;c';'say ''hi'''\r\n\r\n'multi\nline';x\"y;\n'';;last"
+	d := Dialect{Delimiter: ';', Quote: '\'', Charset: UTF8}
+	assert.Equal(t, [][]string{
+		{"a", "b;c", "say 'hi'"},
+		{"multi\nline", `x"y`, ""},
+		{"", "", "last"},
+	}, readAll(t, []byte(data), d))
+
+	r, err := NewReader(strings.NewReader("a,b\n\"open,c\n"), DefaultDialect)
+	assert.NoError(t, err)
+	_, err = r.Read()
+	assert.NoError(t, err)
+	_, err = r.Read()
+	assert.Equal(t, &ParseError{Line: 2, Message: "quoted field is not closed"}, err)
+
+	r, _ = NewReader(strings.NewReader("\"a\"b,c"), DefaultDialect)
+	_, err = r.Read()
+	assert.IsType(t, &ParseError{}, err)
+}
+
+func TestCharsets(t *testing.T) {
+	records := [][]string{{"Name", "Note"}, {"Jürgen", "naïve €5 “quoted”"}, {"emoji", "😀"}}
+	for _, charset := range []string{UTF8, UTF16, UTF16LE, UTF16BE, Windows1252} {
+		for _, bom := range []bool{false, true} {
+			d := DefaultDialect
+			d.Charset, d.BOM = charset, bom
+
+			buf := new(bytes.Buffer)
+			w, err := NewWriter(buf, d)
+			assert.NoError(t, err)
+			for _, record := range records {
+				assert.NoError(t, w.Write(record))
+			}
+			assert.NoError(t, w.Flush())
+
+			expected := records
+			if charset == Windows1252 {
+				expected = [][]string{records[0], records[1], {"emoji", "?"}}
+			}
+			// a byte order mark is detected whatever charset the reader expects
+			read := d
+			if bom && charset != Windows1252 {
+				read.Charset = UTF8
+			}
+			assert.Equal(t, expected, readAll(t, buf.Bytes(), read), "%s bom=%v", charset, bom)
+		}
+	}
+
+	assert.Equal(t, [][]string{{"a"}}, readAll(t, []byte("\xEF\xBB\xBFa"), DefaultDialect))
+}
+
+func TestWrite(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, err := NewWriter(buf, Dialect{Delimiter: '\t', Quote: '"', Charset: UTF8})
+	assert.NoError(t, err)
+	w.Write([]string{"plain", "tab\there", `"quoted"`, " padded", "line\nbreak"})
+	w.Flush()
+	assert.Equal(t, "plain\t\"tab\there\"\t\"\"\"quoted\"\"\"\t\" padded\"\t\"line\nbreak\"\r\n", buf.String())
+}
+
+func TestProfiles(t *testing.T) {
+	p, err := ParseProfile("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "FirstName", p.Header()[1])
+
+	p, err = ParseProfile("Outlook", "")
+	assert.NoError(t, err)
+	m, err := p.NewMapper([]string{"First Name", "Last Name", "Business Phone", "Mobile Phone", "E-mail Address", "Unknown"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.Contact{FirstName: "Roger", LastName: "Bob", Phone: "555 2", Email: "roger@bob.com"},
+		m.Contact([]string{"Roger", "Bob", "555 1", "555 2", "roger@bob.com", "ignored"}))
+	assert.Equal(t, "555 1", m.Contact([]string{"Roger", "Bob", "555 1", "", "roger@bob.com"}).Phone)
+
+	p, _ = ParseProfile(ProfileGoogle, "")
+	m, err = p.NewMapper([]string{"Given Name", "E-mail 1 - Value"})
+	assert.NoError(t, err)
+	assert.Equal(t, "a@b.com", m.Contact([]string{"Tom", "a@b.com ::: c@d.com"}).Email)
+
+	_, err = p.NewMapper([]string{"nothing", "known"})
+	assert.Error(t, err)
+
+	p, err = ParseProfile("", `{"Mail": "email", "Vorname": "first_name", "E-Mail": "email"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, ProfileCustom, p.Name)
+	assert.Equal(t, []string{"Vorname", "E-Mail"}, p.Header())
+	assert.Equal(t, []string{"Tom", "tom@dob.com"}, p.Record(models.Contact{FirstName: "Tom", Email: "tom@dob.com"}))
+
+	_, err = ParseProfile(ProfileCustom, `{"Mail": "e-mail"}`)
+	assert.Error(t, err)
+	_, err = ParseProfile(ProfileCustom, ``)
+	assert.Error(t, err)
+	_, err = ParseProfile("yahoo", "")
+	assert.Error(t, err)
+}
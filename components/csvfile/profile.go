@@ -0,0 +1,210 @@
+package csvfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// profile names
+const (
+	// ProfileDefault the layout exported by this service, contact field names or json names as headers
+	ProfileDefault = "default"
+	// ProfileOutlook the layout of Microsoft Outlook contact exports
+	ProfileOutlook = "outlook"
+	// ProfileGoogle the layout of Google Contacts exports
+	ProfileGoogle = "google"
+	// ProfileCustom a layout given as a json object mapping headers to contact json field names
+	ProfileCustom = "custom"
+)
+
+// Column maps a contact field to the headers naming it in a file
+type Column struct {
+	// Field json name of the contact field
+	Field string
+	// Headers the first is written on export, any of them is read on import with earlier headers preferred
+	Headers []string
+}
+
+// Profile header layout of a contacts csv file
+type Profile struct {
+	// Name ...
+	Name string
+	// Columns in export order
+	Columns []Column
+	// separator splits cells holding several values, only the first value is imported
+	separator string
+}
+
+// profiles built in layouts by name
+var profiles = map[string]*Profile{
+	ProfileDefault: {
+		Name: ProfileDefault,
+		Columns: []Column{
+			{"id", []string{"ID", "id"}},
+			{"first_name", []string{"FirstName", "first_name"}},
+			{"last_name", []string{"LastName", "last_name"}},
+			{"email", []string{"Email", "email"}},
+			{"phone", []string{"Phone", "phone"}},
+			{"organization", []string{"Organization", "organization"}},
+			{"note", []string{"Note", "note"}},
+			{"uid", []string{"UID", "uid"}},
+			{"street", []string{"Street", "street"}},
+			{"city", []string{"City", "city"}},
+			{"region", []string{"Region", "region"}},
+			{"postal_code", []string{"PostalCode", "postal_code"}},
+			{"country", []string{"Country", "country"}},
+		},
+	},
+	ProfileOutlook: {
+		Name: ProfileOutlook,
+		Columns: []Column{
+			{"first_name", []string{"First Name"}},
+			{"last_name", []string{"Last Name"}},
+			{"email", []string{"E-mail Address", "E-mail 2 Address", "E-mail 3 Address"}},
+			{"phone", []string{"Mobile Phone", "Primary Phone", "Home Phone", "Business Phone", "Other Phone"}},
+			{"organization", []string{"Company"}},
+			{"street", []string{"Home Street", "Business Street", "Other Street"}},
+			{"city", []string{"Home City", "Business City", "Other City"}},
+			{"region", []string{"Home State", "Business State", "Other State"}},
+			{"postal_code", []string{"Home Postal Code", "Business Postal Code", "Other Postal Code"}},
+			{"country", []string{"Home Country/Region", "Business Country/Region", "Other Country/Region"}},
+			{"note", []string{"Notes"}},
+		},
+	},
+	ProfileGoogle: {
+		Name: ProfileGoogle,
+		Columns: []Column{
+			{"first_name", []string{"First Name", "Given Name"}},
+			{"last_name", []string{"Last Name", "Family Name"}},
+			{"note", []string{"Notes"}},
+			{"email", []string{"E-mail 1 - Value"}},
+			{"phone", []string{"Phone 1 - Value"}},
+			{"street", []string{"Address 1 - Street"}},
+			{"city", []string{"Address 1 - City"}},
+			{"region", []string{"Address 1 - Region"}},
+			{"postal_code", []string{"Address 1 - Postal Code"}},
+			{"country", []string{"Address 1 - Country"}},
+			{"organization", []string{"Organization Name", "Organization 1 - Name"}},
+		},
+		separator: " ::: ",
+	},
+}
+
+// ParseProfile returns the named profile, an empty name is ProfileDefault.
+// ProfileCustom is built from mapping, a json object of headers to contact json field names
+func ParseProfile(name, mapping string) (*Profile, error) {
+	if name == "" && mapping != "" {
+		name = ProfileCustom
+	}
+	if name == "" {
+		name = ProfileDefault
+	}
+	name = strings.ToLower(name)
+	if name != ProfileCustom {
+		profile, ok := profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %s, expected default, outlook, google or custom", name)
+		}
+		return profile, nil
+	}
+
+	headers := map[string]string{}
+	if err := json.Unmarshal([]byte(mapping), &headers); err != nil || len(headers) == 0 {
+		return nil, fmt.Errorf("custom profile requires a mapping of headers to fields such as {\"E-Mail\": \"email\"}")
+	}
+	byField := map[string][]string{}
+	for header, field := range headers {
+		if (&models.Contact{}).Field(field) == nil {
+			return nil, fmt.Errorf("unknown field %s in mapping, expected one of %s", field, strings.Join(models.ContactFields, ", "))
+		}
+		byField[field] = append(byField[field], header)
+	}
+
+	profile := &Profile{Name: ProfileCustom}
+	for _, field := range models.ContactFields {
+		if headers, ok := byField[field]; ok {
+			sort.Strings(headers)
+			profile.Columns = append(profile.Columns, Column{Field: field, Headers: headers})
+		}
+	}
+	return profile, nil
+}
+
+// Header returns the header row written on export
+func (p *Profile) Header() []string {
+	header := make([]string, len(p.Columns))
+	for i, column := range p.Columns {
+		header[i] = column.Headers[0]
+	}
+	return header
+}
+
+// Record returns the fields of contact in header order
+func (p *Profile) Record(contact models.Contact) []string {
+	record := make([]string, len(p.Columns))
+	for i, column := range p.Columns {
+		record[i] = *contact.Field(column.Field)
+	}
+	return record
+}
+
+// mappedColumn the contact field read from a column of a file and how strongly it is preferred
+type mappedColumn struct {
+	field string
+	rank  int
+}
+
+// Mapper reads contacts from the records of a file
+type Mapper struct {
+	profile *Profile
+	columns []*mappedColumn
+}
+
+// NewMapper matches the header row of a file to the profile ignoring case and unknown headers,
+// it fails when no header is known
+func (p *Profile) NewMapper(header []string) (*Mapper, error) {
+	m := &Mapper{profile: p, columns: make([]*mappedColumn, len(header))}
+	matched := false
+	for i, h := range header {
+		h = strings.TrimSpace(h)
+		for _, column := range p.Columns {
+			for rank, name := range column.Headers {
+				if strings.EqualFold(h, name) && (m.columns[i] == nil || rank < m.columns[i].rank) {
+					m.columns[i] = &mappedColumn{field: column.Field, rank: rank}
+					matched = true
+				}
+			}
+		}
+	}
+	if !matched {
+		return nil, fmt.Errorf("no column of the header matches the %s profile", p.Name)
+	}
+	return m, nil
+}
+
+// Contact maps a record to a contact, a field found in several columns takes the
+// first non empty value of its most preferred header
+func (m *Mapper) Contact(record []string) models.Contact {
+	contact := models.Contact{}
+	ranks := map[string]int{}
+	for i, value := range record {
+		if i >= len(m.columns) || m.columns[i] == nil {
+			continue
+		}
+		if m.profile.separator != "" {
+			value = strings.SplitN(value, m.profile.separator, 2)[0]
+		}
+		value = strings.TrimSpace(value)
+		column := m.columns[i]
+		if rank, ok := ranks[column.field]; value == "" || (ok && rank <= column.rank) {
+			continue
+		}
+		ranks[column.field] = column.rank
+		*contact.Field(column.field) = value
+	}
+	return contact
+}
@@ -0,0 +1,308 @@
+package duplicates
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// DefaultThreshold is the minimum score for two contacts to be reported as duplicates
+const DefaultThreshold = 0.75
+
+// maxBlockSize most contacts a block may hold to be compared, a larger block comes from a key too common to tell
+// duplicates apart such as a frequent name prefix and is skipped, its contacts are still compared in their
+// other blocks
+const maxBlockSize = 200
+
+// match reasons
+const (
+	reasonEmail = "email"
+	reasonPhone = "phone"
+	reasonName  = "name"
+)
+
+// Finder scores contacts against each other and groups likely duplicates
+type Finder interface {
+	Score(a, b models.Contact) models.DuplicateMatch
+	Find(contacts []models.Contact) []models.DuplicateCluster
+}
+
+// finder is the implementation of the Finder interface
+type finder struct {
+	threshold float64
+}
+
+// NewFinder creates a new Finder reporting pairs scoring at least threshold
+func NewFinder(threshold float64) Finder {
+	return &finder{
+		threshold: threshold,
+	}
+}
+
+// Score compares two contacts using normalized email, phone digits and name similarity.
+// A normalized email match is near certain, a phone match is strong and a name
+// match on its own is capped so namesakes need a high similarity to be reported
+func (f *finder) Score(a, b models.Contact) models.DuplicateMatch {
+	match := models.DuplicateMatch{A: a.ID, B: b.ID, Reasons: []string{}}
+
+	name := nameSimilarity(a, b)
+	if name >= 0.85 {
+		match.Reasons = append(match.Reasons, reasonName)
+	}
+
+	emailA, emailB := NormalizeEmail(a.Email), NormalizeEmail(b.Email)
+	phoneA, phoneB := NormalizePhone(a.Phone), NormalizePhone(b.Phone)
+
+	switch {
+	case emailA != "" && emailA == emailB:
+		match.Reasons = append(match.Reasons, reasonEmail)
+		match.Score = 0.9 + 0.1*name
+	case len(phoneA) >= 7 && phoneA == phoneB:
+		match.Reasons = append(match.Reasons, reasonPhone)
+		match.Score = 0.6 + 0.4*name
+	default:
+		match.Score = 0.8 * name
+	}
+	return match
+}
+
+// Find returns clusters of contacts connected by matches scoring at least the threshold.
+// Only contacts sharing a blocking key are compared so large books stay tractable, blocks larger than
+// maxBlockSize are skipped
+func (f *finder) Find(contacts []models.Contact) []models.DuplicateCluster {
+	blocks := map[string][]int{}
+	for i, contact := range contacts {
+		for _, key := range blockingKeys(contact) {
+			blocks[key] = append(blocks[key], i)
+		}
+	}
+
+	parent := make([]int, len(contacts))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	compared := map[[2]int]bool{}
+	var pairs [][2]int
+	var found []models.DuplicateMatch
+	for _, members := range blocks {
+		if len(members) > maxBlockSize {
+			continue
+		}
+		for x := 0; x < len(members); x++ {
+			for y := x + 1; y < len(members); y++ {
+				pair := [2]int{members[x], members[y]}
+				if pair[0] > pair[1] {
+					pair[0], pair[1] = pair[1], pair[0]
+				}
+				if pair[0] == pair[1] || compared[pair] {
+					continue
+				}
+				compared[pair] = true
+
+				match := f.Score(contacts[pair[0]], contacts[pair[1]])
+				if match.Score < f.threshold {
+					continue
+				}
+				parent[find(pair[0])] = find(pair[1])
+				pairs = append(pairs, pair)
+				found = append(found, match)
+			}
+		}
+	}
+
+	groups := map[int]*models.DuplicateCluster{}
+	members := map[int][]int{}
+	for i, pair := range pairs {
+		root := find(pair[0])
+		cluster, ok := groups[root]
+		if !ok {
+			cluster = &models.DuplicateCluster{}
+			groups[root] = cluster
+		}
+		members[root] = append(members[root], pair[0], pair[1])
+		cluster.Matches = append(cluster.Matches, found[i])
+		if found[i].Score > cluster.Score {
+			cluster.Score = found[i].Score
+		}
+	}
+
+	clusters := []models.DuplicateCluster{}
+	for root, cluster := range groups {
+		indexes := members[root]
+		sort.Ints(indexes)
+		for i, index := range indexes {
+			if i > 0 && indexes[i-1] == index {
+				continue
+			}
+			cluster.Contacts = append(cluster.Contacts, contacts[index])
+		}
+		sort.Slice(cluster.Matches, func(i, j int) bool {
+			return cluster.Matches[i].Score > cluster.Matches[j].Score
+		})
+		clusters = append(clusters, *cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Score != clusters[j].Score {
+			return clusters[i].Score > clusters[j].Score
+		}
+		return lessID(clusters[i].Contacts[0].ID, clusters[j].Contacts[0].ID)
+	})
+	return clusters
+}
+
+// lessID orders contact ids as numbers, so 9 comes before 10
+func lessID(a, b string) bool {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	if errA != nil || errB != nil {
+		return a < b
+	}
+	return x < y
+}
+
+// NormalizeEmail lower cases an email and drops any +tag from the local part
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+	if plus := strings.Index(local, "+"); plus > 0 {
+		local = local[:plus]
+	}
+	return local + "@" + domain
+}
+
+// NormalizePhone keeps only the digits of a phone dropping a leading north american country code
+func NormalizePhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	if len(digits) == 11 && digits[0] == '1' {
+		digits = digits[1:]
+	}
+	return digits
+}
+
+// normalizeName lower cases a name and strips everything but letters and spaces
+func normalizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsSpace(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// nameSimilarity compares full names allowing for swapped first and last names
+func nameSimilarity(a, b models.Contact) float64 {
+	first := normalizeName(a.FirstName + " " + a.LastName)
+	second := normalizeName(b.FirstName + " " + b.LastName)
+	if first == "" || second == "" {
+		return 0
+	}
+	swapped := normalizeName(b.LastName + " " + b.FirstName)
+	score := jaroWinkler(first, second)
+	if alt := jaroWinkler(first, swapped); alt > score {
+		score = alt
+	}
+	return score
+}
+
+// blockingKeys returns the keys used to bucket contacts that are worth comparing
+func blockingKeys(contact models.Contact) []string {
+	keys := []string{}
+	if email := NormalizeEmail(contact.Email); email != "" {
+		keys = append(keys, "e:"+email)
+		if at := strings.LastIndex(email, "@"); at > 0 {
+			keys = append(keys, "l:"+email[:at])
+		}
+	}
+	if phone := NormalizePhone(contact.Phone); len(phone) >= 7 {
+		keys = append(keys, "p:"+phone[len(phone)-7:])
+	}
+	for _, name := range []string{contact.LastName, contact.FirstName} {
+		if name = normalizeName(name); name != "" {
+			keys = append(keys, "n:"+prefix(name, 3))
+		}
+	}
+	return keys
+}
+
+// prefix returns up to n leading runes of s
+func prefix(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) > n {
+		runes = runes[:n]
+	}
+	return string(runes)
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of two strings between 0 and 1
+func jaroWinkler(s1, s2 string) float64 {
+	a, b := []rune(s1), []rune(s2)
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	window := max(len(a), len(b))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+
+	matchedA := make([]bool, len(a))
+	matchedB := make([]bool, len(b))
+	matches := 0
+	for i := range a {
+		low, high := max(0, i-window), min(len(b), i+window+1)
+		for j := low; j < high; j++ {
+			if matchedB[j] || a[i] != b[j] {
+				continue
+			}
+			matchedA[i], matchedB[j] = true, true
+			matches++
+			break
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := range a {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if a[i] != b[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(a)) + m/float64(len(b)) + (m-float64(transpositions)/2)/m) / 3
+
+	common := 0
+	for common < min(4, len(a), len(b)) && a[common] == b[common] {
+		common++
+	}
+	return jaro + float64(common)*0.1*(1-jaro)
+}
@@ -0,0 +1,104 @@
+package duplicates
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var testContacts = []models.Contact{
+	{ID: "1", FirstName: "Roger", LastName: "Bob", Email: "Roger.Bob@gmail.com", Phone: "(940) 867-5309"},
+	{ID: "2", FirstName: "roger", LastName: "bob", Email: "roger.bob+work@gmail.com", Phone: ""},
+	{ID: "3", FirstName: "Rodger", LastName: "Bob", Email: "rbob@acme.com", Phone: "+1 940 867 5309"},
+	{ID: "4", FirstName: "Tom", LastName: "Dob", Email: "tom.dobs@gmail.com", Phone: "5555555555"},
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	assert.Equal(t, "roger.bob@gmail.com", NormalizeEmail(" Roger.Bob+work@GMAIL.com "))
+	assert.Equal(t, "", NormalizeEmail(""))
+}
+
+func TestNormalizePhone(t *testing.T) {
+	assert.Equal(t, "9408675309", NormalizePhone("+1 (940) 867-5309"))
+	assert.Equal(t, "447911123456", NormalizePhone("+44 7911 123456"))
+}
+
+func TestScore(t *testing.T) {
+	f := NewFinder(DefaultThreshold)
+
+	match := f.Score(testContacts[0], testContacts[1])
+	assert.InDelta(t, 1.0, match.Score, 0.001)
+	assert.Equal(t, []string{reasonName, reasonEmail}, match.Reasons)
+
+	match = f.Score(testContacts[0], testContacts[2])
+	assert.True(t, match.Score >= DefaultThreshold)
+	assert.Contains(t, match.Reasons, reasonPhone)
+
+	match = f.Score(testContacts[0], testContacts[3])
+	assert.True(t, match.Score < DefaultThreshold)
+}
+
+func TestFind(t *testing.T) {
+	clusters := NewFinder(DefaultThreshold).Find(testContacts)
+	assert.Len(t, clusters, 1)
+	assert.Len(t, clusters[0].Contacts, 3)
+	assert.Equal(t, "1", clusters[0].Contacts[0].ID)
+
+	clusters = NewFinder(DefaultThreshold).Find([]models.Contact{testContacts[3]})
+	assert.NotNil(t, clusters)
+	assert.Len(t, clusters, 0)
+
+	clusters = NewFinder(DefaultThreshold).Find([]models.Contact{
+		{ID: "9", FirstName: "Ann", LastName: "Lee", Email: "ann@example.com"},
+		{ID: "10", FirstName: "Tom", LastName: "Dob", Email: "tom@example.com"},
+		{ID: "11", FirstName: "Tom", LastName: "Dob", Email: "tom@example.com"},
+		{ID: "12", FirstName: "Ann", LastName: "Lee", Email: "ann@example.com"},
+	})
+	assert.Len(t, clusters, 2)
+	assert.Equal(t, "9", clusters[0].Contacts[0].ID, "ties are ordered by numeric id")
+}
+
+func TestFindSkipsLargeBlocks(t *testing.T) {
+	contacts := []models.Contact{}
+	for i := 0; i <= maxBlockSize; i++ {
+		contacts = append(contacts, models.Contact{ID: strconv.Itoa(i + 1), FirstName: "Sam", LastName: fmt.Sprintf("Smith %d", i)})
+	}
+	assert.Empty(t, NewFinder(DefaultThreshold).Find(contacts), "names alone are not compared in a block this large")
+
+	contacts[1].Email, contacts[2].Email = "sam@example.com", "sam@example.com"
+	clusters := NewFinder(DefaultThreshold).Find(contacts)
+	assert.Len(t, clusters, 1, "other keys still compare the contacts")
+}
+
+func TestMerge(t *testing.T) {
+	merged, err := Merge(testContacts[:3], "2", map[string]string{
+		"first_name": "1",
+		"email":      "1",
+		"last_name":  RuleTarget,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, models.Contact{ID: "2", FirstName: "Roger", LastName: "bob", Email: "Roger.Bob@gmail.com", Phone: "(940) 867-5309",
+		Details: &models.ContactDetails{Emails: []models.Email{{Value: "rbob@acme.com"}}, Phones: []models.Phone{}},
+	}, merged, "the email of 3 is kept, the emails and phones of 1 and 2 are the same ones")
+
+	merged, err = Merge(testContacts[:3], "1", map[string]string{"phone": RuleLongest})
+	assert.NoError(t, err)
+	assert.Equal(t, "+1 940 867 5309", merged.Phone)
+
+	tagged := []models.Contact{{ID: "1", Tags: []string{"vip", "work"}}, {ID: "2", Tags: []string{"home", "vip"}}, {ID: "3"}}
+	merged, err = Merge(tagged, "2", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"home", "vip", "work"}, merged.Tags)
+
+	_, err = Merge(testContacts[:3], "4", nil)
+	assert.Error(t, err)
+
+	_, err = Merge(testContacts[:3], "1", map[string]string{"nickname": "2"})
+	assert.Error(t, err)
+
+	_, err = Merge(testContacts[:3], "1", map[string]string{"email": "4"})
+	assert.Error(t, err)
+}
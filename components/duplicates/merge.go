@@ -0,0 +1,157 @@
+package duplicates
+
+import (
+	"fmt"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// merge pick rules that can be used in place of a contact id
+const (
+	// RuleTarget keeps the value of the target contact
+	RuleTarget = "target"
+	// RuleLongest keeps the longest value among the merged contacts
+	RuleLongest = "longest"
+)
+
+// mergeFields maps the json name of a mergeable field to its value on a contact
+var mergeFields = map[string]func(c *models.Contact) *string{
+	"first_name":   func(c *models.Contact) *string { return &c.FirstName },
+	"last_name":    func(c *models.Contact) *string { return &c.LastName },
+	"email":        func(c *models.Contact) *string { return &c.Email },
+	"phone":        func(c *models.Contact) *string { return &c.Phone },
+	"organization": func(c *models.Contact) *string { return &c.Organization },
+	"note":         func(c *models.Contact) *string { return &c.Note },
+	"street":       func(c *models.Contact) *string { return &c.Street },
+	"city":         func(c *models.Contact) *string { return &c.City },
+	"region":       func(c *models.Contact) *string { return &c.Region },
+	"postal_code":  func(c *models.Contact) *string { return &c.PostalCode },
+	"country":      func(c *models.Contact) *string { return &c.Country },
+}
+
+// Merge combines contacts into the contact with targetID.
+// Each field is taken from the contact or pick rule named in rules, fields without a
+// rule keep the target value or fall back to the first non empty value of the others.
+// Every other email, phone and address of the contacts is kept in the details of the merged contact.
+// The merged contact has the tags of every contact, those of the target first
+func Merge(contacts []models.Contact, targetID string, rules map[string]string) (models.Contact, error) {
+	byID := map[string]models.Contact{}
+	for _, contact := range contacts {
+		byID[contact.ID] = contact
+	}
+	target, ok := byID[targetID]
+	if !ok {
+		return models.Contact{}, fmt.Errorf("target %s is not one of the merged contacts", targetID)
+	}
+
+	for field, rule := range rules {
+		if _, ok := mergeFields[field]; !ok {
+			return models.Contact{}, fmt.Errorf("unknown merge field %s", field)
+		}
+		if _, ok := byID[rule]; !ok && rule != RuleTarget && rule != RuleLongest {
+			return models.Contact{}, fmt.Errorf("merge rule for %s must be a merged contact id, %s or %s", field, RuleTarget, RuleLongest)
+		}
+	}
+
+	merged := target
+	for field, value := range mergeFields {
+		rule, ok := rules[field]
+		switch {
+		case !ok:
+			if *value(&merged) != "" {
+				continue
+			}
+			for _, contact := range contacts {
+				if v := *value(&contact); v != "" {
+					*value(&merged) = v
+					break
+				}
+			}
+		case rule == RuleTarget:
+		case rule == RuleLongest:
+			for _, contact := range contacts {
+				if v := *value(&contact); len(v) > len(*value(&merged)) {
+					*value(&merged) = v
+				}
+			}
+		default:
+			source := byID[rule]
+			*value(&merged) = *value(&source)
+		}
+	}
+	merged.Details = mergeDetails(merged, contacts)
+	merged.Tags = mergeTags(target, contacts)
+	return merged, nil
+}
+
+// mergeDetails returns the details of merged holding every email, phone and address of contacts that merged
+// does not have yet, in the order of contacts
+func mergeDetails(merged models.Contact, contacts []models.Contact) *models.ContactDetails {
+	all := merged.V2()
+	for _, contact := range contacts {
+		v2 := contact.V2()
+		for _, email := range v2.Emails {
+			if !hasEmail(all.Emails, email.Value) {
+				all.Emails = append(all.Emails, email)
+			}
+		}
+		for _, phone := range v2.Phones {
+			if !hasPhone(all.Phones, phone.Value) {
+				all.Phones = append(all.Phones, phone)
+			}
+		}
+		for _, address := range v2.Addresses {
+			if !hasAddress(all.Addresses, address) {
+				all.Addresses = append(all.Addresses, address)
+			}
+		}
+	}
+	return all.Contact().Details
+}
+
+// hasEmail reports whether emails holds email once normalized
+func hasEmail(emails []models.Email, email string) bool {
+	for _, e := range emails {
+		if NormalizeEmail(e.Value) == NormalizeEmail(email) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPhone reports whether phones holds the digits of phone
+func hasPhone(phones []models.Phone, phone string) bool {
+	for _, p := range phones {
+		if NormalizePhone(p.Value) == NormalizePhone(phone) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAddress reports whether addresses holds address whatever its type
+func hasAddress(addresses []models.Address, address models.Address) bool {
+	address.Type = ""
+	for _, a := range addresses {
+		a.Type = ""
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeTags returns the tags of target followed by the other tags of contacts, nil when there are none
+func mergeTags(target models.Contact, contacts []models.Contact) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, contact := range append([]models.Contact{target}, contacts...) {
+		for _, tag := range contact.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
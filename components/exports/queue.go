@@ -0,0 +1,302 @@
+package exports
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// queue timing constants
+const (
+	// pollInterval how often idle workers look for jobs queued by other instances or abandoned by stopped workers
+	pollInterval = 5 * time.Second
+	// heartbeatInterval how often a running job records its progress
+	heartbeatInterval = 10 * time.Second
+	// staleAfter time without a heartbeat after which a running job is claimed again
+	staleAfter = time.Minute
+	// cleanupInterval how often the files of expired jobs are removed and the directory is swept
+	cleanupInterval = time.Minute
+)
+
+// option defaults
+const (
+	defaultWorkers = 1
+	defaultTTL     = 24 * time.Hour
+)
+
+// writeFailed detail of the problem ending a job whose file could not be written
+const writeFailed = "the export file could not be written"
+
+// Options configure a Queue, empty values use the defaults
+type Options struct {
+	// Dir directory the files are written to, defaults to contacts-exports in the temp directory
+	Dir string
+	// Workers number of exports written at the same time, defaults to 1
+	Workers int
+	// TTL time a file is kept after it was written, defaults to 24 hours
+	TTL time.Duration
+}
+
+// ProcessFunc writes the file of job to w, calling progress with the number of contacts written so far.
+// Returning a problem ends the job as failed
+type ProcessFunc func(ctx context.Context, job models.ExportJob, w io.Writer, progress func(rows int)) *models.Problem
+
+// Queue writes export files in the background on a pool of workers and removes them once they expire
+type Queue interface {
+	// Submit queues an export
+	Submit(ctx context.Context, job models.ExportJob) (models.ExportJob, error)
+	// Open opens the file of a succeeded job
+	Open(job models.ExportJob) (*os.File, error)
+	// Start starts the workers, which write files with process until ctx is done or the queue is closed, and the
+	// cleanup of expired files
+	Start(ctx context.Context, process ProcessFunc)
+	// Close stops the workers and the cleanup, waiting for the files being written to be done
+	Close()
+}
+
+// queue is the implementation of the Queue interface
+type queue struct {
+	jobs    store.ExportJobStore
+	dir     string
+	workers int
+	ttl     time.Duration
+	wake    chan struct{}
+	stop    context.CancelFunc
+	stopped sync.WaitGroup
+}
+
+// NewQueue creates a Queue running the exports of jobs
+func NewQueue(jobs store.ExportJobStore, opts Options) Queue {
+	if opts.Dir == "" {
+		opts.Dir = filepath.Join(os.TempDir(), "contacts-exports")
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = defaultWorkers
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = defaultTTL
+	}
+	return &queue{
+		jobs:    jobs,
+		dir:     opts.Dir,
+		workers: opts.Workers,
+		ttl:     opts.TTL,
+		wake:    make(chan struct{}, opts.Workers),
+		stop:    func() {},
+	}
+}
+
+// Submit queues an export and wakes an idle worker
+func (q *queue) Submit(ctx context.Context, job models.ExportJob) (models.ExportJob, error) {
+	job, err := q.jobs.CreateExportJob(ctx, job)
+	if err != nil {
+		return models.ExportJob{}, err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Open opens the file of a succeeded job
+func (q *queue) Open(job models.ExportJob) (*os.File, error) {
+	return os.Open(q.path(job))
+}
+
+// Start starts the workers and the cleanup
+func (q *queue) Start(ctx context.Context, process ProcessFunc) {
+	ctx, q.stop = context.WithCancel(ctx)
+	q.stopped.Add(q.workers + 1)
+	for i := 0; i < q.workers; i++ {
+		go q.work(ctx, process)
+	}
+	go q.clean(ctx)
+}
+
+// Close stops the workers and the cleanup
+func (q *queue) Close() {
+	q.stop()
+	q.stopped.Wait()
+}
+
+// work claims and runs jobs one at a time, waiting for a submitted job or the next poll when there are none.
+// It returns once ctx is done
+func (q *queue) work(ctx context.Context, process ProcessFunc) {
+	defer q.stopped.Done()
+	timer := time.NewTimer(pollInterval)
+	defer timer.Stop()
+	for ctx.Err() == nil {
+		job, err := q.jobs.ClaimExportJob(ctx, staleAfter)
+		if err == nil {
+			q.run(job, process)
+			continue
+		}
+		if err != store.ErrNoJob && ctx.Err() == nil {
+			log.Printf("export error: claiming a job: %s", err)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(pollInterval)
+		select {
+		case <-ctx.Done():
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// clean removes the files of expired jobs every cleanupInterval until ctx is done
+func (q *queue) clean(ctx context.Context) {
+	defer q.stopped.Done()
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for {
+		q.cleanup()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run writes the file of a claimed job to a temporary file that is only renamed once it is complete,
+// so a download never sees a partial file. A heartbeat records the progress meanwhile
+func (q *queue) run(job models.ExportJob, process ProcessFunc) {
+	var processed int64
+	done := make(chan struct{})
+	go q.heartbeat(job.ID, &processed, done)
+
+	size, problem := q.write(job, process, func(rows int) {
+		atomic.StoreInt64(&processed, int64(rows))
+	})
+	close(done)
+
+	job.Processed = int(atomic.LoadInt64(&processed))
+	if problem != nil {
+		job.Status = models.ExportFailed
+		job.Error = problem
+	} else {
+		expires := time.Now().Add(q.ttl)
+		job.Status = models.ExportSucceeded
+		job.Size = size
+		job.ExpiresAt = &expires
+	}
+	if err := q.jobs.FinishExportJob(context.Background(), job); err != nil {
+		log.Printf("export error: finishing job %s: %s", job.ID, err)
+	}
+}
+
+// write runs process into the file of job returning its size
+func (q *queue) write(job models.ExportJob, process ProcessFunc, progress func(rows int)) (int64, *models.Problem) {
+	if err := os.MkdirAll(q.dir, 0700); err != nil {
+		return 0, writeProblem(job, err)
+	}
+	f, err := ioutil.TempFile(q.dir, "export-*.tmp")
+	if err != nil {
+		return 0, writeProblem(job, err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if problem := process(context.Background(), job, f, progress); problem != nil {
+		return 0, problem
+	}
+	info, err := f.Stat()
+	if err == nil {
+		err = f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), q.path(job))
+	}
+	if err != nil {
+		return 0, writeProblem(job, err)
+	}
+	return info.Size(), nil
+}
+
+// heartbeat records the progress of a running job until done is closed
+func (q *queue) heartbeat(id string, processed *int64, done <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if err := q.jobs.HeartbeatExportJob(context.Background(), id, int(atomic.LoadInt64(processed))); err != nil {
+			log.Printf("export error: heartbeat of job %s: %s", id, err)
+		}
+	}
+}
+
+// cleanup removes the files of expired jobs, then sweeps the directory
+func (q *queue) cleanup() {
+	now := time.Now()
+	expired, err := q.jobs.ExpireExportJobs(context.Background(), now)
+	if err != nil {
+		log.Printf("export error: expiring jobs: %s", err)
+	}
+	for _, job := range expired {
+		if err := os.Remove(q.path(job)); err != nil && !os.IsNotExist(err) {
+			log.Printf("export error: removing the file of job %s: %s", job.ID, err)
+		}
+	}
+	q.sweep(now)
+}
+
+// sweep removes the export files written more than the ttl before now. Jobs are expired by whichever instance
+// cleans up first, so every instance sweeps its own directory to remove the files it wrote itself
+func (q *queue) sweep(now time.Time) {
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("export error: sweeping %s: %s", q.dir, err)
+		}
+		return
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), "export-") || now.Sub(file.ModTime()) <= q.ttl {
+			continue
+		}
+		if err := os.Remove(filepath.Join(q.dir, file.Name())); err != nil && !os.IsNotExist(err) {
+			log.Printf("export error: removing %s: %s", file.Name(), err)
+		}
+	}
+}
+
+// path returns the file of job
+func (q *queue) path(job models.ExportJob) string {
+	return filepath.Join(q.dir, "export-"+job.ID+"."+job.Format)
+}
+
+// writeProblem logs why the file of job could not be written and returns the problem ending the job,
+// the error itself is not surfaced since it names paths on the server
+func writeProblem(job models.ExportJob, err error) *models.Problem {
+	log.Printf("export error: writing the file of job %s: %s", job.ID, err)
+	return &models.Problem{
+		Type:   models.ProblemTypePrefix + models.CodeInternal,
+		Title:  http.StatusText(http.StatusInternalServerError),
+		Status: http.StatusInternalServerError,
+		Code:   models.CodeInternal,
+		Detail: writeFailed,
+	}
+}
@@ -0,0 +1,129 @@
+package exports
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// statusOf waits up to a second for the job with id to reach status
+func statusOf(t *testing.T, jobs store.ExportJobStore, id, status string) models.ExportJob {
+	deadline := time.Now().Add(time.Second)
+	for {
+		job, err := jobs.GetExportJob(context.Background(), id)
+		assert.NoError(t, err)
+		if job.Status == status || time.Now().After(deadline) {
+			assert.Equal(t, status, job.Status, "job %s", id)
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exports")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	jobs := store.NewMemoryStore()
+	q := NewQueue(jobs, Options{Dir: dir, TTL: time.Hour})
+	defer q.Close()
+	q.Start(context.Background(), func(ctx context.Context, job models.ExportJob, w io.Writer, progress func(rows int)) *models.Problem {
+		if job.Format == "fail" {
+			return &models.Problem{Status: http.StatusBadRequest, Code: models.CodeInvalidParameter}
+		}
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, "row %d\n", i)
+			progress(i)
+		}
+		return nil
+	})
+	ctx := context.Background()
+
+	submitted, err := q.Submit(ctx, models.ExportJob{Format: "csv"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.ExportQueued, submitted.Status)
+	job := statusOf(t, jobs, submitted.ID, models.ExportSucceeded)
+	assert.Equal(t, 3, job.Processed)
+	assert.Equal(t, int64(18), job.Size)
+	assert.True(t, job.ExpiresAt.After(time.Now().Add(59*time.Minute)))
+
+	f, err := q.Open(job)
+	assert.NoError(t, err)
+	data, _ := ioutil.ReadAll(f)
+	f.Close()
+	assert.Equal(t, "row 1\nrow 2\nrow 3\n", string(data))
+
+	failed, _ := q.Submit(ctx, models.ExportJob{Format: "fail"})
+	job = statusOf(t, jobs, failed.ID, models.ExportFailed)
+	assert.Equal(t, models.CodeInvalidParameter, job.Error.Code)
+
+	// only the finished file is left behind
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+}
+
+func TestCleanup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exports")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	jobs := store.NewMemoryStore()
+	q := NewQueue(jobs, Options{Dir: dir, TTL: time.Nanosecond}).(*queue)
+	submitted, _ := q.Submit(context.Background(), models.ExportJob{Format: "json"})
+	claimed, err := jobs.ClaimExportJob(context.Background(), staleAfter)
+	assert.NoError(t, err)
+	q.run(claimed, func(ctx context.Context, job models.ExportJob, w io.Writer, progress func(rows int)) *models.Problem {
+		return nil
+	})
+	job := statusOf(t, jobs, submitted.ID, models.ExportSucceeded)
+	_, err = os.Stat(q.path(job))
+	assert.NoError(t, err)
+
+	q.cleanup()
+	statusOf(t, jobs, job.ID, models.ExportExpired)
+	_, err = os.Stat(q.path(job))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSweep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exports")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// files another instance expired the jobs of are still removed once they are older than the ttl
+	q := NewQueue(store.NewMemoryStore(), Options{Dir: dir, TTL: time.Hour}).(*queue)
+	old, recent, other := dir+"/export-1.csv", dir+"/export-2.csv", dir+"/notes.txt"
+	for _, name := range []string{old, recent, other} {
+		assert.NoError(t, ioutil.WriteFile(name, []byte("row\n"), 0600))
+	}
+	assert.NoError(t, os.Chtimes(old, time.Now().Add(-2*time.Hour), time.Now().Add(-2*time.Hour)))
+	assert.NoError(t, os.Chtimes(other, time.Now().Add(-2*time.Hour), time.Now().Add(-2*time.Hour)))
+
+	q.cleanup()
+	_, err = os.Stat(old)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(recent)
+	assert.NoError(t, err)
+	_, err = os.Stat(other)
+	assert.NoError(t, err, "only export files are swept")
+}
+
+func TestSign(t *testing.T) {
+	secret := []byte("secret")
+	signature := Sign(secret, "7", 1556791445)
+	assert.True(t, Verify(secret, "7", 1556791445, signature))
+	assert.False(t, Verify(secret, "8", 1556791445, signature))
+	assert.False(t, Verify(secret, "7", 1556791446, signature))
+	assert.False(t, Verify([]byte("other"), "7", 1556791445, signature))
+	assert.False(t, Verify(secret, "7", 1556791445, ""))
+}
@@ -0,0 +1,20 @@
+package exports
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// Sign returns the signature of a link downloading the file of job id until expires, a unix time
+func Sign(secret []byte, id string, expires int64) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id + ":" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature was made by Sign for job id and expires with the same secret
+func Verify(secret []byte, id string, expires int64, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, id, expires)), []byte(signature))
+}
@@ -0,0 +1,189 @@
+package filetype
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Type kind of an uploaded contacts file
+type Type string
+
+// file types
+const (
+	// Unknown text that is none of the supported types
+	Unknown Type = ""
+	// Binary content that is not text, such as images, pdfs or archives
+	Binary Type = "binary"
+	// CSV comma (or otherwise) separated values
+	CSV Type = "csv"
+	// VCard one or more vCards
+	VCard Type = "vcard"
+	// JSON a json array of contacts or a single contact
+	JSON Type = "json"
+	// NDJSON newline delimited json, a contact per line
+	NDJSON Type = "ndjson"
+	// XLSX an Excel workbook
+	XLSX Type = "xlsx"
+	// LDIF directory entries in the LDAP data interchange format
+	LDIF Type = "ldif"
+)
+
+// sniffLength number of bytes read from the start of a file to detect its type
+const sniffLength = 4096
+
+// extensions file types by lower case file extension
+var extensions = map[string]Type{
+	".csv":    CSV,
+	".txt":    CSV,
+	".tsv":    CSV,
+	".vcf":    VCard,
+	".vcard":  VCard,
+	".json":   JSON,
+	".ndjson": NDJSON,
+	".jsonl":  NDJSON,
+	".xlsx":   XLSX,
+	".ldif":   LDIF,
+	".ldi":    LDIF,
+}
+
+// contentTypes file types by declared media type, types browsers and clients send for any file are left out
+var contentTypes = map[string]Type{
+	"text/csv":                    CSV,
+	"text/comma-separated-values": CSV,
+	"application/csv":             CSV,
+	"text/tab-separated-values":   CSV,
+	"application/vnd.ms-excel":    CSV,
+	"text/vcard":                  VCard,
+	"text/x-vcard":                VCard,
+	"text/directory":              VCard,
+	"application/json":            JSON,
+	"application/x-ndjson":        NDJSON,
+	"application/ndjson":          NDJSON,
+	"application/jsonl":           NDJSON,
+	"text/x-ldif":                 LDIF,
+	"text/ldif":                   LDIF,
+	"application/ldif":            LDIF,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": XLSX,
+}
+
+// Detect returns the type of an uploaded file and a reader replaying it from the start.
+// The content decides when it has a clear signature, a zip holding a workbook, a vCard, an LDIF entry, json or ndjson.
+// Other text is CSV unless the extension or declared content type names vCard, LDIF, json or ndjson, empty files are CSV
+func Detect(r io.Reader, filename, contentType string) (Type, io.Reader, error) {
+	br := bufio.NewReaderSize(r, sniffLength)
+	head, err := br.Peek(sniffLength)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return Unknown, br, err
+	}
+	return detect(head, declared(filename, contentType)), br, nil
+}
+
+// declared returns the type named by the file extension or else the declared content type
+func declared(filename, contentType string) Type {
+	if t, ok := extensions[strings.ToLower(path.Ext(filename))]; ok {
+		return t
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return contentTypes[mediaType]
+}
+
+// detect sniffs the start of a file, hint is the declared type
+func detect(head []byte, hint Type) Type {
+	if len(head) == 0 {
+		return CSV
+	}
+	if bytes.HasPrefix(head, []byte("PK\x03\x04")) {
+		if hint == XLSX || bytes.Contains(head, []byte("[Content_Types].xml")) || bytes.Contains(head, []byte("xl/")) {
+			return XLSX
+		}
+		return Binary
+	}
+
+	text, ok := textOf(head)
+	if !ok {
+		return Binary
+	}
+	text = strings.TrimLeft(text, " \t\r\n")
+	switch {
+	case len(text) >= 11 && strings.EqualFold(text[:11], "BEGIN:VCARD"):
+		return VCard
+	case isLDIF(text):
+		return LDIF
+	case strings.HasPrefix(text, "{") && (hint == NDJSON || isJSONLine(text)):
+		return NDJSON
+	case strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{"):
+		return JSON
+	case strings.HasPrefix(text, "<"):
+		return Unknown
+	}
+	if hint == VCard || hint == LDIF || hint == JSON || hint == NDJSON {
+		// the importer of the declared type reports what is wrong with the content
+		return hint
+	}
+	return CSV
+}
+
+// isLDIF reports whether text starts with a dn or version line once leading comments are skipped
+func isLDIF(text string) bool {
+	for strings.HasPrefix(text, "#") {
+		i := strings.IndexByte(text, '\n')
+		if i < 0 {
+			return false
+		}
+		text = strings.TrimLeft(text[i+1:], " \t\r\n")
+	}
+	lower := strings.ToLower(text)
+	return strings.HasPrefix(lower, "dn:") || strings.HasPrefix(lower, "version:")
+}
+
+// isJSONLine reports whether the first line of text is a complete json document, which makes a file
+// starting with an object newline delimited json rather than one pretty printed object
+func isJSONLine(text string) bool {
+	line := text
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		line = text[:i]
+	}
+	return json.Valid([]byte(line))
+}
+
+// textOf returns head as text with any byte order mark removed, utf-16 is narrowed to its
+// ascii characters which is enough to sniff. ok is false when head holds binary bytes
+func textOf(head []byte) (string, bool) {
+	switch {
+	case bytes.HasPrefix(head, []byte("\xEF\xBB\xBF")):
+		head = head[3:]
+	case bytes.HasPrefix(head, []byte("\xFF\xFE")):
+		head = narrow(head[2:], 0)
+	case bytes.HasPrefix(head, []byte("\xFE\xFF")):
+		head = narrow(head[2:], 1)
+	case len(head) >= 2 && head[0] != 0 && head[1] == 0:
+		// utf-16 without a byte order mark is read as little endian
+		head = narrow(head, 0)
+	case len(head) >= 2 && head[0] == 0 && head[1] != 0:
+		head = narrow(head, 1)
+	}
+	if len(head) > 0 && !strings.HasPrefix(http.DetectContentType(head), "text/") {
+		return "", false
+	}
+	return string(head), true
+}
+
+// narrow keeps the ascii characters of utf-16, offset is the position of the low byte in each
+// code unit. Other characters become ? so they are never mistaken for binary bytes
+func narrow(b []byte, offset int) []byte {
+	narrowed := make([]byte, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		if b[i+1-offset] != 0 {
+			narrowed = append(narrowed, '?')
+			continue
+		}
+		narrowed = append(narrowed, b[i+offset])
+	}
+	return narrowed
+}
@@ -0,0 +1,49 @@
+package filetype
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		filename    string
+		contentType string
+		expected    Type
+	}{
+		{"excel csv", "ID,FirstName\r\n,tom\r\n", "contacts.csv", "application/vnd.ms-excel", CSV},
+		{"curl csv", "FirstName;Email\n", "", "application/octet-stream", CSV},
+		{"windows-1252", "First Name\nJ\xfcrgen\n", "export.txt", "", CSV},
+		{"utf-16 bom", "\xFF\xFEa\x00,\x00b\x00", "", "", CSV},
+		{"utf-16 no bom", "a\x00,\x00\x1c\x4e", "", "", CSV},
+		{"vcard", "\xEF\xBB\xBF\r\nbegin:vcard\r\nVERSION:3.0\r\n", "contacts.csv", "text/csv", VCard},
+		{"vcard utf-16be", "\xFE\xFF\x00B\x00E\x00G\x00I\x00N\x00:\x00V\x00C\x00A\x00R\x00D", "", "", VCard},
+		{"ldif", "# address book\r\n\r\nversion: 1\r\ndn: cn=tom\r\n", "", "text/plain", LDIF},
+		{"ldif by extension", "objectclass: top\n", "contacts.ldif", "", LDIF},
+		{"json", "  [{\"first_name\": \"tom\"}]", "", "application/octet-stream", JSON},
+		{"json by extension", "not json", "contacts.json", "", JSON},
+		{"pretty json object", "{\n  \"first_name\": \"tom\"\n}\n", "", "", JSON},
+		{"ndjson", "{\"first_name\": \"tom\"}\n{\"first_name\": \"ann\"}\n", "", "application/json", NDJSON},
+		{"ndjson by extension", "{\"first_name\": \n", "contacts.jsonl", "", NDJSON},
+		{"xlsx", "PK\x03\x04\x14\x00\x06\x00[Content_Types].xml", "", "application/octet-stream", XLSX},
+		{"xlsx by extension", "PK\x03\x04\x14\x00\x06\x00", "book.xlsx", "", XLSX},
+		{"zip", "PK\x03\x04\x14\x00\x06\x00photo.jpg", "contacts.zip", "", Binary},
+		{"png", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "contacts.csv", "text/csv", Binary},
+		{"pdf", "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n1 0 obj\x00", "", "", Binary},
+		{"html", "<html><body>contacts</body></html>", "", "", Unknown},
+		{"empty", "", "", "", CSV},
+	}
+	for _, test := range tests {
+		detected, r, err := Detect(strings.NewReader(test.data), test.filename, test.contentType)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.expected, detected, test.name)
+
+		replayed, _ := ioutil.ReadAll(r)
+		assert.Equal(t, test.data, string(replayed), test.name)
+	}
+}
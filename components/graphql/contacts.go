@@ -0,0 +1,510 @@
+package graphql
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/validation"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// page sizes of connections
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// contactFields the graphql names of the contact fields next to their json names
+var contactFields = []struct{ name, field string }{
+	{"firstName", "first_name"},
+	{"lastName", "last_name"},
+	{"email", "email"},
+	{"phone", "phone"},
+	{"organization", "organization"},
+	{"note", "note"},
+	{"uid", "uid"},
+	{"street", "street"},
+	{"city", "city"},
+	{"region", "region"},
+	{"postalCode", "postal_code"},
+	{"country", "country"},
+}
+
+// errStop stops an iteration of the store once the result is known
+var errStop = errors.New("stop")
+
+// organization an organization, it is known by the contacts belonging to it
+type organization struct {
+	name string
+}
+
+// tag a tag, it is known by the contacts having it
+type tag struct {
+	name string
+}
+
+// edge an item of a connection along with the cursor pointing at it
+type edge struct {
+	cursor string
+	node   interface{}
+}
+
+// connection a page of a list along with the total number of items
+type connection struct {
+	total   int
+	edges   []edge
+	hasNext bool
+}
+
+// resolver resolves the contacts schema against a store
+type resolver struct {
+	store     store.Store
+	validator validation.Validator
+}
+
+// newContactsSchema returns the schema of the contacts api
+func newContactsSchema(s store.Store, validator validation.Validator) *schema {
+	r := &resolver{store: s, validator: validator}
+	schema := newSchema("Query", "Mutation")
+	page := []*inputValue{
+		{name: "first", description: fmt.Sprintf("Most items returned, at most %d.", maxPageSize), typ: named("Int"), defaultValue: strconv.Itoa(defaultPageSize)},
+		{name: "after", description: "endCursor of the previous page.", typ: named("String")},
+	}
+	id := []*inputValue{{name: "id", typ: nonNull(named("ID"))}}
+	input := []*inputValue{{name: "input", typ: nonNull(named("ContactInput"))}}
+
+	schema.add(&namedType{kind: kindObject, name: "Query", fields: []*fieldDef{
+		{name: "contact", description: "The contact with the id, null when there is none.", typ: named("Contact"), args: id, resolve: r.contact},
+		{name: "contacts", description: "The contacts matching the filter ordered by id.", typ: nonNull(named("ContactConnection")),
+			args: append([]*inputValue{{name: "filter", typ: named("ContactFilter")}}, page...), resolve: r.contacts},
+		{name: "organization", description: "The organization with the name ignoring case, null when no contact belongs to it.", typ: named("Organization"),
+			args: []*inputValue{{name: "name", typ: nonNull(named("String"))}}, resolve: r.organization},
+		{name: "organizations", description: "The organizations contacts belong to ordered by name.", typ: nonNull(named("OrganizationConnection")),
+			args: page, resolve: r.organizations},
+		{name: "tag", description: "The tag with the name ignoring case, null when no contact has it.", typ: named("Tag"),
+			args: []*inputValue{{name: "name", typ: nonNull(named("String"))}}, resolve: r.tag},
+		{name: "tags", description: "The tags of the contacts ordered by name.", typ: nonNull(named("TagConnection")),
+			args: page, resolve: r.tags},
+	}})
+	schema.add(&namedType{kind: kindObject, name: "Mutation", fields: []*fieldDef{
+		{name: "createContact", description: "Validates and stores a new contact.", typ: nonNull(named("Contact")), args: input, resolve: r.createContact},
+		{name: "updateContact", description: "Validates and stores the fields of the input, fields left out keep their value.",
+			typ: nonNull(named("Contact")), args: append(id, input...), resolve: r.updateContact},
+		{name: "deleteContact", description: "Deletes the contact and returns its id.", typ: nonNull(named("ID")), args: id, resolve: r.deleteContact},
+	}})
+
+	contact := &namedType{kind: kindObject, name: "Contact", description: "A contact of the address book.", fields: []*fieldDef{
+		{name: "id", typ: nonNull(named("ID")), resolve: contactField("id")},
+	}}
+	for _, f := range contactFields {
+		switch f.name {
+		case "email":
+			contact.fields = append(contact.fields, &fieldDef{name: f.name, typ: nonNull(named("String")), resolve: contactField(f.field)})
+		case "organization":
+			contact.fields = append(contact.fields, &fieldDef{name: f.name, description: "The organization the contact belongs to.",
+				typ: named("Organization"), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+					if name := source.(models.Contact).Organization; name != "" {
+						return organization{name: name}, nil
+					}
+					return nil, nil
+				}})
+		default:
+			contact.fields = append(contact.fields, &fieldDef{name: f.name, typ: named("String"), resolve: contactField(f.field)})
+		}
+	}
+	contact.fields = append(contact.fields, &fieldDef{name: "tags", description: "The tags of the contact.", typ: nonNull(listOf(nonNull(named("Tag")))),
+		resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			tags := []interface{}{}
+			for _, name := range source.(models.Contact).Tags {
+				tags = append(tags, tag{name: name})
+			}
+			return tags, nil
+		}})
+	schema.add(contact)
+
+	schema.add(&namedType{kind: kindObject, name: "Organization", description: "An organization contacts belong to.", fields: []*fieldDef{
+		{name: "name", typ: nonNull(named("String")), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return source.(organization).name, nil
+		}},
+		{name: "contacts", description: "The contacts belonging to the organization ordered by id.", typ: nonNull(named("ContactConnection")), args: page,
+			resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return r.contactPage(ctx, models.ContactFilter{Organization: source.(organization).name}, args)
+			}},
+	}})
+	schema.add(&namedType{kind: kindObject, name: "Tag", description: "A tag grouping contacts, tags are lowercase.", fields: []*fieldDef{
+		{name: "name", typ: nonNull(named("String")), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return source.(tag).name, nil
+		}},
+		{name: "contacts", description: "The contacts having the tag ordered by id.", typ: nonNull(named("ContactConnection")), args: page,
+			resolve: func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error) {
+				return r.contactPage(ctx, models.ContactFilter{Tag: source.(tag).name}, args)
+			}},
+	}})
+	addConnection(schema, "Contact")
+	addConnection(schema, "Organization")
+	addConnection(schema, "Tag")
+	schema.add(&namedType{kind: kindObject, name: "PageInfo", description: "Where a page is in its list.", fields: []*fieldDef{
+		{name: "hasNextPage", typ: nonNull(named("Boolean")), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return source.(*connection).hasNext, nil
+		}},
+		{name: "endCursor", description: "Cursor of the last item, pass it as after to get the next page.", typ: named("String"),
+			resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+				if edges := source.(*connection).edges; len(edges) > 0 {
+					return edges[len(edges)-1].cursor, nil
+				}
+				return nil, nil
+			}},
+	}})
+
+	schema.add(&namedType{kind: kindInputObject, name: "ContactFilter", description: "Contacts matching every field set, ignoring case.", inputFields: []*inputValue{
+		{name: "query", description: "Text found in the first name, last name, email or organization.", typ: named("String")},
+		{name: "organization", typ: named("String")},
+		{name: "city", typ: named("String")},
+		{name: "region", typ: named("String")},
+		{name: "country", typ: named("String")},
+		{name: "tag", description: "One of the tags of the contact.", typ: named("String")},
+	}})
+	contactInput := &namedType{kind: kindInputObject, name: "ContactInput", description: "The fields of a contact, null clears a field."}
+	for _, f := range contactFields {
+		contactInput.inputFields = append(contactInput.inputFields, &inputValue{name: f.name, typ: named("String")})
+	}
+	contactInput.inputFields = append(contactInput.inputFields, &inputValue{name: "tags",
+		description: "Every tag of the contact, they are trimmed, lowercased and repeats are dropped.", typ: listOf(nonNull(named("String")))})
+	schema.add(contactInput)
+	return schema
+}
+
+// addConnection adds the connection and edge types of a paginated list of the type
+func addConnection(s *schema, name string) {
+	s.add(&namedType{kind: kindObject, name: name + "Connection", description: "A page of " + name + " items.", fields: []*fieldDef{
+		{name: "totalCount", description: "Number of items in every page.", typ: nonNull(named("Int")),
+			resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+				return source.(*connection).total, nil
+			}},
+		{name: "edges", typ: nonNull(listOf(nonNull(named(name + "Edge")))), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			edges := []interface{}{}
+			for _, e := range source.(*connection).edges {
+				edges = append(edges, e)
+			}
+			return edges, nil
+		}},
+		{name: "nodes", typ: nonNull(listOf(nonNull(named(name)))), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			nodes := []interface{}{}
+			for _, e := range source.(*connection).edges {
+				nodes = append(nodes, e.node)
+			}
+			return nodes, nil
+		}},
+		{name: "pageInfo", typ: nonNull(named("PageInfo")), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return source, nil
+		}},
+	}})
+	s.add(&namedType{kind: kindObject, name: name + "Edge", fields: []*fieldDef{
+		{name: "cursor", typ: nonNull(named("String")), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return source.(edge).cursor, nil
+		}},
+		{name: "node", typ: nonNull(named(name)), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return source.(edge).node, nil
+		}},
+	}})
+}
+
+// contactField resolves a field of a contact by its json name, empty fields are null
+func contactField(field string) resolveFunc {
+	return func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+		contact := source.(models.Contact)
+		if value := *contact.Field(field); value != "" {
+			return value, nil
+		}
+		return nil, nil
+	}
+}
+
+// contact resolves Query.contact
+func (r *resolver) contact(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	id := args["id"].(string)
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, nil
+	}
+	contact, err := r.store.Get(ctx, id)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
+
+// contacts resolves Query.contacts
+func (r *resolver) contacts(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	filter := models.ContactFilter{}
+	if f, ok := args["filter"].(map[string]interface{}); ok {
+		filter.Query, _ = f["query"].(string)
+		filter.Organization, _ = f["organization"].(string)
+		filter.City, _ = f["city"].(string)
+		filter.Region, _ = f["region"].(string)
+		filter.Country, _ = f["country"].(string)
+		filter.Tag, _ = f["tag"].(string)
+	}
+	return r.contactPage(ctx, filter, args)
+}
+
+// contactPage returns the page of the contacts matching the filter after the cursor
+func (r *resolver) contactPage(ctx context.Context, filter models.ContactFilter, args map[string]interface{}) (*connection, error) {
+	first, after, err := pageArguments(args, "contact")
+	if err != nil {
+		return nil, err
+	}
+	afterID := int64(0)
+	if after != "" {
+		if afterID, err = strconv.ParseInt(after, 10, 64); err != nil {
+			return nil, invalidCursor
+		}
+	}
+
+	conn := &connection{}
+	err = r.store.Each(ctx, filter, func(contact models.Contact) error {
+		conn.total++
+		if id, _ := strconv.ParseInt(contact.ID, 10, 64); after != "" && id <= afterID {
+			return nil
+		}
+		if len(conn.edges) < first {
+			conn.edges = append(conn.edges, edge{cursor: cursor("contact", contact.ID), node: contact})
+		} else {
+			conn.hasNext = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// organization resolves Query.organization
+func (r *resolver) organization(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	var found interface{}
+	err := r.store.Each(ctx, models.ContactFilter{Organization: args["name"].(string)}, func(contact models.Contact) error {
+		found = organization{name: contact.Organization}
+		return errStop
+	})
+	if err != nil && err != errStop {
+		return nil, err
+	}
+	return found, nil
+}
+
+// organizations resolves Query.organizations, organizations differing only in case are listed once
+// with the name of the contact with the lowest id
+func (r *resolver) organizations(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	first, after, err := pageArguments(args, "organization")
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]string{}
+	err = r.store.Each(ctx, models.ContactFilter{}, func(contact models.Contact) error {
+		key := strings.ToLower(contact.Organization)
+		if _, ok := names[key]; !ok && key != "" {
+			names[key] = contact.Organization
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(names))
+	for key := range names {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	conn := &connection{total: len(keys)}
+	for _, key := range keys {
+		if after != "" && key <= strings.ToLower(after) {
+			continue
+		}
+		if len(conn.edges) == first {
+			conn.hasNext = true
+			break
+		}
+		conn.edges = append(conn.edges, edge{cursor: cursor("organization", names[key]), node: organization{name: names[key]}})
+	}
+	return conn, nil
+}
+
+// tag resolves Query.tag
+func (r *resolver) tag(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	var found interface{}
+	err := r.store.Each(ctx, models.ContactFilter{Tag: args["name"].(string)}, func(contact models.Contact) error {
+		found = tag{name: strings.ToLower(args["name"].(string))}
+		return errStop
+	})
+	if err != nil && err != errStop {
+		return nil, err
+	}
+	return found, nil
+}
+
+// tags resolves Query.tags
+func (r *resolver) tags(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	first, after, err := pageArguments(args, "tag")
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	err = r.store.Each(ctx, models.ContactFilter{}, func(contact models.Contact) error {
+		for _, name := range contact.Tags {
+			seen[name] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	conn := &connection{total: len(names)}
+	for _, name := range names {
+		if after != "" && name <= after {
+			continue
+		}
+		if len(conn.edges) == first {
+			conn.hasNext = true
+			break
+		}
+		conn.edges = append(conn.edges, edge{cursor: cursor("tag", name), node: tag{name: name}})
+	}
+	return conn, nil
+}
+
+// createContact resolves Mutation.createContact
+func (r *resolver) createContact(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	contact := models.Contact{}
+	applyInput(&contact, args["input"].(map[string]interface{}))
+	if err := r.validate(&contact); err != nil {
+		return nil, err
+	}
+	created, err := r.store.Create(ctx, contact)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return created, nil
+}
+
+// updateContact resolves Mutation.updateContact
+func (r *resolver) updateContact(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	contact, err := r.get(ctx, args["id"].(string))
+	if err != nil {
+		return nil, err
+	}
+	applyInput(&contact, args["input"].(map[string]interface{}))
+	if err := r.validate(&contact); err != nil {
+		return nil, err
+	}
+	updated, err := r.store.Update(ctx, contact)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return updated, nil
+}
+
+// deleteContact resolves Mutation.deleteContact
+func (r *resolver) deleteContact(ctx context.Context, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	id := args["id"].(string)
+	if _, err := r.get(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := r.store.Delete(ctx, id); err != nil {
+		return nil, storeError(err)
+	}
+	return id, nil
+}
+
+// get returns the contact a mutation changes
+func (r *resolver) get(ctx context.Context, id string) (models.Contact, error) {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return models.Contact{}, &resolverError{message: "the id is not a valid contact id", code: models.CodeInvalidID}
+	}
+	contact, err := r.store.Get(ctx, id)
+	if err != nil {
+		return models.Contact{}, storeError(err)
+	}
+	return contact, nil
+}
+
+// validate validates and normalizes a contact before it is stored
+func (r *resolver) validate(contact *models.Contact) error {
+	if errs := r.validator.Validate(contact); len(errs) > 0 {
+		return &resolverError{message: "the contact has invalid fields", code: models.CodeValidationFailed, fields: errs}
+	}
+	return nil
+}
+
+// applyInput sets the fields of a ContactInput on the contact, fields left out are kept
+func applyInput(contact *models.Contact, input map[string]interface{}) {
+	for _, f := range contactFields {
+		if value, ok := input[f.name]; ok {
+			s, _ := value.(string)
+			*contact.Field(f.field) = s
+		}
+	}
+	if value, ok := input["tags"]; ok {
+		items, _ := value.([]interface{})
+		contact.Tags = []string{}
+		for _, item := range items {
+			contact.Tags = append(contact.Tags, item.(string))
+		}
+	}
+}
+
+// storeError maps store errors to the errors shown to clients
+func storeError(err error) error {
+	switch err {
+	case store.ErrNotFound:
+		return &resolverError{message: err.Error(), code: models.CodeNotFound}
+	case store.ErrDuplicateEmail:
+		return &resolverError{message: err.Error(), code: models.CodeDuplicateEmail}
+	}
+	return err
+}
+
+// invalidCursor returned for an after argument that is not a cursor of the list
+var invalidCursor = &resolverError{message: "after is not a cursor of this list", code: models.CodeInvalidParameter}
+
+// pageArguments returns the page size and the decoded cursor of a paginated field
+func pageArguments(args map[string]interface{}, kind string) (int, string, error) {
+	first, ok := args["first"].(int)
+	if !ok {
+		first = defaultPageSize
+	}
+	if first < 0 || first > maxPageSize {
+		return 0, "", &resolverError{message: fmt.Sprintf("first must be between 0 and %d", maxPageSize), code: models.CodeInvalidParameter}
+	}
+	after, _ := args["after"].(string)
+	if after == "" {
+		return first, "", nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(after)
+	if err != nil || !strings.HasPrefix(string(data), kind+":") {
+		return 0, "", invalidCursor
+	}
+	return first, strings.TrimPrefix(string(data), kind+":"), nil
+}
+
+// cursor returns the opaque cursor of an item of a list of the kind
+func cursor(kind, key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(kind + ":" + key))
+}
@@ -0,0 +1,749 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// request a GraphQL request as sent in a POST body or the query string of a GET
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// response a GraphQL response, data is left out when the request failed before execution
+type response struct {
+	Errors []*gqlError  `json:"errors,omitempty"`
+	Data   *interface{} `json:"data,omitempty"`
+}
+
+// gqlError an error of a response
+type gqlError struct {
+	Message    string                 `json:"message"`
+	Locations  []location             `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// resolverError an error a resolver reports to the client with one of the models error codes
+type resolverError struct {
+	message string
+	code    string
+	fields  []models.FieldError
+}
+
+// Error implements the error interface
+func (e *resolverError) Error() string {
+	return e.message
+}
+
+// object an output object keeping its fields in the order they were selected
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// set sets the value of a field
+func (o *object) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// MarshalJSON writes the fields in order
+func (o *object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// enumLiteral an enum value written in a document, unlike a string it is not accepted for String arguments
+type enumLiteral string
+
+// fieldGroup the selections of a field sharing a response key
+type fieldGroup struct {
+	key        string
+	selections []*selection
+}
+
+// limits bounds of the operations executed
+type limits struct {
+	maxDepth      int
+	maxComplexity int
+}
+
+// executor validates and executes one operation of a document
+type executor struct {
+	schema    *schema
+	limits    limits
+	doc       *document
+	op        *operation
+	defined   map[string]*variableDefinition
+	variables map[string]interface{}
+	errors    []*gqlError
+}
+
+// execute runs the request, valid is false when it failed before execution. Only queries are executed
+// when readOnly is set
+func (s *schema) execute(ctx context.Context, req request, l limits, readOnly bool) (resp response, valid bool) {
+	e := &executor{schema: s, limits: l, defined: map[string]*variableDefinition{}, variables: map[string]interface{}{}}
+	doc, err := parse(req.Query)
+	if err != nil {
+		e.fail(err.(*syntaxError).loc, err.Error())
+		return response{Errors: e.errors}, false
+	}
+	e.doc = doc
+	if !e.selectOperation(req.OperationName, readOnly) || !e.coerceVariables(req.Variables) || !e.validate() {
+		return response{Errors: e.errors}, false
+	}
+
+	root := s.types[s.query]
+	if e.op.kind == "mutation" {
+		root = s.types[s.mutation]
+	}
+	var data interface{}
+	if obj, ok := e.executeFields(ctx, root, nil, e.op.selections, []interface{}{}); ok {
+		data = obj
+	}
+	return response{Errors: e.errors, Data: &data}, true
+}
+
+// fail records an error at the location
+func (e *executor) fail(loc location, message string) {
+	e.errors = append(e.errors, &gqlError{Message: message, Locations: []location{loc}})
+}
+
+// selectOperation picks the operation with the name, the name may be left out when there is only one
+func (e *executor) selectOperation(name string, readOnly bool) bool {
+	for _, op := range e.doc.operations {
+		if op.name == name || name == "" && len(e.doc.operations) == 1 {
+			e.op = op
+		}
+	}
+	switch {
+	case e.op == nil && name == "":
+		e.fail(e.doc.operations[0].loc, "operationName is required when the document has several operations")
+	case e.op == nil:
+		e.fail(e.doc.operations[0].loc, fmt.Sprintf("unknown operation %q", name))
+	case e.op.kind == "mutation" && e.schema.mutation == "" || e.op.kind == "subscription":
+		e.fail(e.op.loc, fmt.Sprintf("%s operations are not supported", e.op.kind))
+		return false
+	case e.op.kind == "mutation" && readOnly:
+		e.fail(e.op.loc, "mutations must be sent with POST")
+		return false
+	}
+	return e.op != nil
+}
+
+// coerceVariables checks the provided variables against their definitions, applying defaults
+func (e *executor) coerceVariables(raw map[string]interface{}) bool {
+	ok := true
+	for _, def := range e.op.variables {
+		if _, dup := e.defined[def.name]; dup {
+			e.fail(def.loc, fmt.Sprintf("there can be only one variable named $%s", def.name))
+			ok = false
+			continue
+		}
+		e.defined[def.name] = def
+		if kind := e.schema.kindOf(&typeRef{name: def.typ.namedType()}); kind != kindScalar && kind != kindEnum && kind != kindInputObject {
+			e.fail(def.loc, fmt.Sprintf("variable $%s can not be of type %s", def.name, def.typ))
+			ok = false
+			continue
+		}
+
+		value, provided := raw[def.name]
+		if !provided && def.defaultValue != nil {
+			literal, err := e.literal(def.defaultValue)
+			if err == nil {
+				value, err = e.coerce(literal, def.typ)
+			}
+			if err != nil {
+				e.fail(def.loc, fmt.Sprintf("variable $%s has an invalid default: %s", def.name, err))
+				ok = false
+			}
+			e.variables[def.name] = value
+			continue
+		}
+		if !provided {
+			if def.typ.kind == kindNonNull {
+				e.fail(def.loc, fmt.Sprintf("variable $%s of type %s was not provided", def.name, def.typ))
+				ok = false
+			}
+			continue
+		}
+		coerced, err := e.coerce(value, def.typ)
+		if err != nil {
+			e.fail(def.loc, fmt.Sprintf("variable $%s got an invalid value: %s", def.name, err))
+			ok = false
+			continue
+		}
+		e.variables[def.name] = coerced
+	}
+	return ok
+}
+
+// validate checks the operation against the schema and the limits
+func (e *executor) validate() bool {
+	for _, f := range e.doc.fragments {
+		if t, ok := e.schema.types[f.typeCondition]; !ok || t.kind != kindObject {
+			e.fail(f.loc, fmt.Sprintf("fragment %s is on unknown type %s", f.name, f.typeCondition))
+		} else if e.spreads(f.selections, map[string]bool{f.name: true}) {
+			e.fail(f.loc, fmt.Sprintf("fragment %s spreads itself", f.name))
+		}
+	}
+	if len(e.errors) > 0 {
+		return false
+	}
+
+	root := e.schema.types[e.schema.query]
+	if e.op.kind == "mutation" {
+		root = e.schema.types[e.schema.mutation]
+	}
+	complexity := e.validateSelections(root, e.op.selections, 1)
+	if len(e.errors) == 0 && e.limits.maxComplexity > 0 && complexity > e.limits.maxComplexity {
+		e.fail(e.op.loc, fmt.Sprintf("the query has a complexity of %d, at most %d is allowed", complexity, e.limits.maxComplexity))
+	}
+	return len(e.errors) == 0
+}
+
+// spreads reports whether the selections spread one of the fragments being expanded
+func (e *executor) spreads(selections []*selection, expanding map[string]bool) bool {
+	for _, s := range selections {
+		if s.kind == selectSpread {
+			if expanding[s.name] {
+				return true
+			}
+			f, ok := e.doc.fragments[s.name]
+			if !ok {
+				continue
+			}
+			expanding[s.name] = true
+			spreads := e.spreads(f.selections, expanding)
+			delete(expanding, s.name)
+			if spreads {
+				return true
+			}
+		} else if e.spreads(s.selections, expanding) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSelections checks the selections of an object type at a depth and returns their complexity.
+// Every field costs 1 plus the cost of its selections, times the page size for fields taking a first argument
+func (e *executor) validateSelections(t *namedType, selections []*selection, depth int) int {
+	if e.limits.maxDepth > 0 && depth > e.limits.maxDepth {
+		e.fail(selections[0].loc, fmt.Sprintf("the query is nested deeper than %d fields", e.limits.maxDepth))
+		return 0
+	}
+	complexity := 0
+	for _, group := range e.collectFields(t, selections, true) {
+		first := group.selections[0]
+		def := e.fieldOf(t, first.name)
+		if def == nil {
+			e.fail(first.loc, fmt.Sprintf("cannot query field %q on type %q", first.name, t.name))
+			continue
+		}
+
+		var children []*selection
+		multiplier := 1
+		for _, s := range group.selections {
+			if s.name != first.name {
+				e.fail(s.loc, fmt.Sprintf("fields %q and %q both write %q", first.name, s.name, group.key))
+			}
+			args, err := e.argumentValues(def.args, s.arguments)
+			if err != nil {
+				e.fail(s.loc, err.Error())
+			}
+			if n, ok := args["first"].(int); ok && n > multiplier {
+				multiplier = n
+			}
+			children = append(children, s.selections...)
+		}
+
+		complexity++
+		switch kind := e.schema.kindOf(&typeRef{name: def.typ.namedType()}); {
+		case kind == kindObject && len(children) == 0:
+			e.fail(first.loc, fmt.Sprintf("field %q of type %s must have a selection of subfields", first.name, def.typ))
+		case kind != kindObject && len(children) > 0:
+			e.fail(first.loc, fmt.Sprintf("field %q of type %s can not have a selection of subfields", first.name, def.typ))
+		case kind == kindObject:
+			complexity += multiplier * e.validateSelections(e.schema.types[def.typ.namedType()], children, depth+1)
+		}
+	}
+	return complexity
+}
+
+// typenameField, schemaField and typeField are the meta fields every type or the query type has
+var (
+	typenameField = &fieldDef{name: "__typename", typ: nonNull(named("String"))}
+	schemaField   = &fieldDef{name: "__schema", typ: nonNull(named("__Schema"))}
+	typeField     = &fieldDef{name: "__type", typ: named("__Type"), args: []*inputValue{{name: "name", typ: nonNull(named("String"))}}}
+)
+
+// fieldOf returns the field of t with the name, including meta fields, or nil
+func (e *executor) fieldOf(t *namedType, name string) *fieldDef {
+	switch {
+	case name == typenameField.name:
+		return typenameField
+	case name == schemaField.name && t.name == e.schema.query:
+		return schemaField
+	case name == typeField.name && t.name == e.schema.query:
+		return typeField
+	}
+	return t.field(name)
+}
+
+// collectFields groups the fields selected on an object type by response key, expanding fragments and
+// leaving out skipped selections. Invalid fragments are reported when validating
+func (e *executor) collectFields(t *namedType, selections []*selection, validating bool) []*fieldGroup {
+	groups := []*fieldGroup{}
+	index := map[string]*fieldGroup{}
+	var collect func(selections []*selection, visited map[string]bool)
+	collect = func(selections []*selection, visited map[string]bool) {
+		for _, s := range selections {
+			if !e.included(s, validating) {
+				continue
+			}
+			switch s.kind {
+			case selectField:
+				group, ok := index[s.responseKey()]
+				if !ok {
+					group = &fieldGroup{key: s.responseKey()}
+					index[group.key] = group
+					groups = append(groups, group)
+				}
+				group.selections = append(group.selections, s)
+			case selectSpread:
+				f, ok := e.doc.fragments[s.name]
+				if !ok {
+					e.fail(s.loc, fmt.Sprintf("unknown fragment %s", s.name))
+					continue
+				}
+				if visited[s.name] {
+					continue
+				}
+				visited[s.name] = true
+				if f.typeCondition != t.name {
+					if validating {
+						e.fail(s.loc, fmt.Sprintf("fragment %s on %s can not be spread on %s", s.name, f.typeCondition, t.name))
+					}
+					continue
+				}
+				collect(f.selections, visited)
+			case selectInline:
+				if s.typeCondition != "" && s.typeCondition != t.name {
+					if validating {
+						e.fail(s.loc, fmt.Sprintf("a fragment on %s can not be spread on %s", s.typeCondition, t.name))
+					}
+					continue
+				}
+				collect(s.selections, visited)
+			}
+		}
+	}
+	collect(selections, map[string]bool{})
+	return groups
+}
+
+// included evaluates the @skip and @include directives of a selection
+func (e *executor) included(s *selection, validating bool) bool {
+	for _, d := range s.directives {
+		def := e.schema.directive(d.name)
+		if def == nil {
+			if validating {
+				e.fail(d.loc, fmt.Sprintf("unknown directive @%s", d.name))
+			}
+			continue
+		}
+		args, err := e.argumentValues(def.args, d.arguments)
+		if err != nil {
+			if validating {
+				e.fail(d.loc, err.Error())
+			}
+			continue
+		}
+		if args["if"] == (d.name == "skip") {
+			return false
+		}
+	}
+	return true
+}
+
+// executeFields resolves the selections of an object, ok is false when a non null field failed. The other
+// fields are still resolved so their errors are reported and mutations are applied
+func (e *executor) executeFields(ctx context.Context, t *namedType, source interface{}, selections []*selection, path []interface{}) (*object, bool) {
+	obj := &object{values: map[string]interface{}{}}
+	failed := false
+	for _, group := range e.collectFields(t, selections, false) {
+		value, ok := e.executeField(ctx, t, source, group, append(path[:len(path):len(path)], group.key))
+		failed = failed || !ok
+		obj.set(group.key, value)
+	}
+	if failed {
+		return nil, false
+	}
+	return obj, true
+}
+
+// executeField resolves and completes a field, ok is false when it is non null and failed
+func (e *executor) executeField(ctx context.Context, t *namedType, source interface{}, group *fieldGroup, path []interface{}) (interface{}, bool) {
+	s := group.selections[0]
+	def := e.fieldOf(t, s.name)
+	var children []*selection
+	for _, s := range group.selections {
+		children = append(children, s.selections...)
+	}
+
+	var value interface{}
+	args, err := e.argumentValues(def.args, s.arguments)
+	switch {
+	case err != nil:
+	case def == typenameField:
+		value = t.name
+	case def == schemaField:
+		value = e.schema
+	case def == typeField:
+		if _, ok := e.schema.types[args["name"].(string)]; ok {
+			value = named(args["name"].(string))
+		}
+	default:
+		value, err = def.resolve(ctx, source, args)
+	}
+	if err != nil {
+		e.fieldError(s, path, err)
+		return nil, def.typ.kind != kindNonNull
+	}
+	return e.complete(ctx, def.typ, value, s, children, path)
+}
+
+// fieldError records the error of a field, errors other than resolver errors are not shown to clients
+func (e *executor) fieldError(s *selection, path []interface{}, err error) {
+	ge := &gqlError{Message: err.Error(), Locations: []location{s.loc}, Path: path}
+	re, ok := err.(*resolverError)
+	switch {
+	case ok:
+		ge.Extensions = map[string]interface{}{"code": re.code}
+		if len(re.fields) > 0 {
+			ge.Extensions["errors"] = re.fields
+		}
+	case err != errInvalidValue:
+		ge.Message = "internal error"
+		ge.Extensions = map[string]interface{}{"code": models.CodeInternal}
+	}
+	e.errors = append(e.errors, ge)
+}
+
+// errInvalidValue a resolver returned a value its field type does not allow
+var errInvalidValue = errors.New("the field resolved to an invalid value")
+
+// complete shapes a resolved value as its type, ok is false when a non null value failed
+func (e *executor) complete(ctx context.Context, typ *typeRef, value interface{}, s *selection, children []*selection, path []interface{}) (interface{}, bool) {
+	if typ.kind == kindNonNull {
+		v, ok := e.complete(ctx, typ.ofType, value, s, children, path)
+		if ok && v == nil {
+			e.errors = append(e.errors, &gqlError{Message: "cannot return null for a non null field", Locations: []location{s.loc}, Path: path})
+		}
+		return v, ok && v != nil
+	}
+	if value == nil {
+		return nil, true
+	}
+
+	switch e.schema.kindOf(typ) {
+	case kindList:
+		items, ok := value.([]interface{})
+		if !ok {
+			e.fieldError(s, path, errInvalidValue)
+			return nil, true
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			v, ok := e.complete(ctx, typ.ofType, item, s, children, append(path[:len(path):len(path)], i))
+			if !ok {
+				return nil, true
+			}
+			list[i] = v
+		}
+		return list, true
+	case kindObject:
+		obj, ok := e.executeFields(ctx, e.schema.types[typ.name], value, children, path)
+		if !ok {
+			return nil, true
+		}
+		return obj, true
+	}
+	return value, true
+}
+
+// argumentValues coerces the arguments of a field or directive, applying defaults
+func (e *executor) argumentValues(defs []*inputValue, nodes []*argumentNode) (map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	for _, node := range nodes {
+		if argument(defs, node.name) == nil {
+			return nil, fmt.Errorf("unknown argument %q", node.name)
+		}
+	}
+	for _, def := range defs {
+		var node *argumentNode
+		for _, n := range nodes {
+			if n.name == def.name {
+				if node != nil {
+					return nil, fmt.Errorf("there can be only one argument named %q", def.name)
+				}
+				node = n
+			}
+		}
+
+		var value interface{}
+		provided := node != nil
+		if provided && node.value.kind == valueVariable {
+			_, provided = e.variables[node.value.raw]
+			if _, defined := e.defined[node.value.raw]; !defined {
+				return nil, fmt.Errorf("variable $%s is not defined", node.value.raw)
+			}
+		}
+		if provided {
+			literal, err := e.literal(node.value)
+			if err != nil {
+				return nil, fmt.Errorf("argument %q: %s", def.name, err)
+			}
+			value = literal
+		} else if def.defaultValue != "" {
+			value = e.literalOf(def.defaultValue)
+		} else if def.typ.kind != kindNonNull {
+			continue
+		}
+		coerced, err := e.coerce(value, def.typ)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q: %s", def.name, err)
+		}
+		args[def.name] = coerced
+	}
+	return args, nil
+}
+
+// argument returns the input value with the name or nil
+func argument(defs []*inputValue, name string) *inputValue {
+	for _, def := range defs {
+		if def.name == name {
+			return def
+		}
+	}
+	return nil
+}
+
+// constantValue parses the literal of a default value
+func constantValue(literal string) *valueNode {
+	p := &parser{source: literal, line: 1, col: 1}
+	p.next()
+	return p.value(true)
+}
+
+// literal returns the value of a value node, variables are replaced by their coerced values
+func (e *executor) literal(v *valueNode) (interface{}, error) {
+	switch v.kind {
+	case valueVariable:
+		if _, defined := e.defined[v.raw]; !defined {
+			return nil, fmt.Errorf("variable $%s is not defined", v.raw)
+		}
+		return e.variables[v.raw], nil
+	case valueInt:
+		n, err := strconv.ParseInt(v.raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s is out of range", v.raw)
+		}
+		return n, nil
+	case valueFloat:
+		return strconv.ParseFloat(v.raw, 64)
+	case valueString:
+		return v.raw, nil
+	case valueBoolean:
+		return v.raw == "true", nil
+	case valueEnum:
+		return enumLiteral(v.raw), nil
+	case valueList:
+		list := make([]interface{}, len(v.list))
+		for i, item := range v.list {
+			value, err := e.literal(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	case valueObject:
+		obj := map[string]interface{}{}
+		for _, field := range v.fields {
+			if _, dup := obj[field.name]; dup {
+				return nil, fmt.Errorf("there can be only one field named %q", field.name)
+			}
+			if field.value.kind == valueVariable {
+				if _, provided := e.variables[field.value.raw]; !provided {
+					if _, err := e.literal(field.value); err != nil {
+						return nil, err
+					}
+					continue
+				}
+			}
+			value, err := e.literal(field.value)
+			if err != nil {
+				return nil, err
+			}
+			obj[field.name] = value
+		}
+		return obj, nil
+	}
+	return nil, nil
+}
+
+// coerce checks an input value against its type, ints are returned as int and input objects
+// only hold the fields that were provided or have defaults
+func (e *executor) coerce(value interface{}, typ *typeRef) (interface{}, error) {
+	if typ.kind == kindNonNull {
+		if value == nil {
+			return nil, fmt.Errorf("expected a non null %s", typ.ofType)
+		}
+		return e.coerce(value, typ.ofType)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	if typ.kind == kindList {
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			v, err := e.coerce(item, typ.ofType)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = v
+		}
+		return list, nil
+	}
+
+	t, ok := e.schema.types[typ.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %s", typ.name)
+	}
+	switch t.kind {
+	case kindScalar:
+		return coerceScalar(value, t.name)
+	case kindEnum:
+		name, ok := value.(enumLiteral)
+		if s, isString := value.(string); isString {
+			name, ok = enumLiteral(s), true
+		}
+		for _, v := range t.enumValues {
+			if ok && v.name == string(name) {
+				return v.name, nil
+			}
+		}
+		return nil, fmt.Errorf("expected a value of %s", t.name)
+	case kindInputObject:
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an object of %s", t.name)
+		}
+		for name := range fields {
+			if argument(t.inputFields, name) == nil {
+				return nil, fmt.Errorf("%s has no field %q", t.name, name)
+			}
+		}
+		obj := map[string]interface{}{}
+		for _, def := range t.inputFields {
+			v, provided := fields[def.name]
+			if !provided && def.defaultValue != "" {
+				v, provided = e.literalOf(def.defaultValue), true
+			}
+			if !provided {
+				if def.typ.kind == kindNonNull {
+					return nil, fmt.Errorf("field %q of %s is required", def.name, t.name)
+				}
+				continue
+			}
+			coerced, err := e.coerce(v, def.typ)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %s", def.name, err)
+			}
+			obj[def.name] = coerced
+		}
+		return obj, nil
+	}
+	return nil, fmt.Errorf("%s can not be used as an input", t.name)
+}
+
+// literalOf returns the value of a constant literal
+func (e *executor) literalOf(literal string) interface{} {
+	value, _ := e.literal(constantValue(literal))
+	return value
+}
+
+// coerceScalar checks a value of a built in scalar, json numbers come from variables
+func coerceScalar(value interface{}, name string) (interface{}, error) {
+	if n, ok := value.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			value = i
+		} else if f, err := n.Float64(); err == nil {
+			value = f
+		}
+	}
+	if f, ok := value.(float64); ok && name != "Float" && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		value = int64(f)
+	}
+
+	switch v := value.(type) {
+	case int64:
+		switch name {
+		case "Int":
+			if v < math.MinInt32 || v > math.MaxInt32 {
+				return nil, fmt.Errorf("%d is not a 32 bit integer", v)
+			}
+			return int(v), nil
+		case "Float":
+			return float64(v), nil
+		case "ID":
+			return strconv.FormatInt(v, 10), nil
+		}
+	case float64:
+		if name == "Float" {
+			return v, nil
+		}
+	case string:
+		if name == "String" || name == "ID" {
+			return v, nil
+		}
+	case bool:
+		if name == "Boolean" {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a value of %s", name)
+}
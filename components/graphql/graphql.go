@@ -0,0 +1,179 @@
+package graphql
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/validation"
+)
+
+// Path the endpoint is served on
+const Path = "/graphql"
+
+// handler constants
+const (
+	defaultMaxDepth      = 15
+	defaultMaxComplexity = 5000
+	// maxBodySize largest request body read
+	maxBodySize = 1 << 20
+)
+
+// Options configure the handler, empty values use the defaults
+type Options struct {
+	// MaxDepth deepest nesting of fields a query may select, defaults to 15
+	MaxDepth int
+	// MaxComplexity highest complexity a query may have, defaults to 5000. Every selected field costs 1
+	// plus the cost of its subfields, which is multiplied by the page size of paginated fields
+	MaxComplexity int
+	// Playground serves a page to run queries to browsers opening the endpoint, meant for development
+	Playground bool
+}
+
+// handler is the GraphQL http.Handler
+type handler struct {
+	schema     *schema
+	limits     limits
+	playground bool
+}
+
+// NewHandler creates an http.Handler answering GraphQL queries and mutations of the contacts of store,
+// sent as json with POST or in the query string with GET. Contacts are validated like contacts created
+// through the api
+func NewHandler(store store.Store, validator validation.Validator, opts Options) http.Handler {
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = defaultMaxDepth
+	}
+	if opts.MaxComplexity <= 0 {
+		opts.MaxComplexity = defaultMaxComplexity
+	}
+	return &handler{
+		schema:     newContactsSchema(store, validator),
+		limits:     limits{maxDepth: opts.MaxDepth, maxComplexity: opts.MaxComplexity},
+		playground: opts.Playground,
+	}
+}
+
+// ServeHTTP reads the request, executes it and writes the response
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := request{}
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		if q.Get("query") == "" && h.playground && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, playgroundPage)
+			return
+		}
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := decode(strings.NewReader(v), &req.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, "variables are not a json object")
+				return
+			}
+		}
+	case http.MethodPost:
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		body := http.MaxBytesReader(w, r.Body, maxBodySize)
+		if mediaType == "application/graphql" {
+			data, err := ioutil.ReadAll(body)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "the body could not be read")
+				return
+			}
+			req.Query = string(data)
+		} else if err := decode(body, &req); err != nil {
+			writeError(w, http.StatusBadRequest, "the body is not a json GraphQL request")
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if req.Query == "" {
+		writeError(w, http.StatusBadRequest, "the request has no query")
+		return
+	}
+
+	resp, valid := h.schema.execute(r.Context(), req, h.limits, r.Method == http.MethodGet)
+	if !valid {
+		writeJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// decode decodes json keeping numbers exact
+func decode(r io.Reader, v interface{}) error {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// writeError writes a response with a single error that is not about the document
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, response{Errors: []*gqlError{{Message: message}}})
+}
+
+// writeJSON writes v as json with the status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// playgroundPage runs queries against the endpoint the page was served from. It is self contained so it
+// loads no scripts or styles from other hosts
+const playgroundPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Contacts GraphQL</title>
+  <style>
+    body { margin: 0; height: 100vh; display: flex; font: 14px monospace; }
+    form, pre { flex: 1; margin: 0; padding: 8px; display: flex; flex-direction: column; }
+    textarea { flex: 1; font: inherit; margin-bottom: 8px; }
+    #variables { flex: 0 0 6em; }
+    pre { overflow: auto; background: #f6f6f6; }
+  </style>
+</head>
+<body>
+  <form id="playground">
+    <textarea id="query" spellcheck="false">{ contacts(first: 10) { totalCount nodes { id firstName lastName email tags { name } } } }</textarea>
+    <textarea id="variables" spellcheck="false" placeholder="variables as a json object"></textarea>
+    <button type="submit">Run (Ctrl+Enter)</button>
+  </form>
+  <pre id="result"></pre>
+  <script>
+    var form = document.getElementById('playground');
+    var result = document.getElementById('result');
+    function run(event) {
+      event.preventDefault();
+      var variables = document.getElementById('variables').value.trim();
+      var body;
+      try {
+        body = JSON.stringify({ query: document.getElementById('query').value, variables: variables ? JSON.parse(variables) : null });
+      } catch (err) {
+        result.textContent = 'variables: ' + err.message;
+        return;
+      }
+      fetch(window.location.pathname, { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: body })
+        .then(function (res) { return res.json(); })
+        .then(function (data) { result.textContent = JSON.stringify(data, null, 2); })
+        .catch(function (err) { result.textContent = err.message; });
+    }
+    form.addEventListener('submit', run);
+    form.addEventListener('keydown', function (event) {
+      if (event.key === 'Enter' && (event.ctrlKey || event.metaKey)) {
+        run(event);
+      }
+    });
+  </script>
+</body>
+</html>
+`
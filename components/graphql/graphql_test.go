@@ -0,0 +1,323 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/validation"
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/squanchersquanch/contacts/services/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// result a decoded response
+type result struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []gqlError             `json:"errors"`
+}
+
+func newTestHandler(t *testing.T, opts Options) (http.Handler, store.Store) {
+	s := store.NewMemoryStore()
+	for _, c := range []models.Contact{
+		{FirstName: "Jane", LastName: "Roe", Email: "jane@acme.com", Organization: "Acme", City: "Springfield", Tags: []string{"vip", "work"}},
+		{FirstName: "John", LastName: "Doe", Email: "john@acme.com", Organization: "acme"},
+		{FirstName: "Ann", LastName: "Lee", Email: "ann@globex.com", Organization: "Globex", Tags: []string{"work"}},
+		{FirstName: "Tom", LastName: "Dob", Email: "tom@example.com"},
+	} {
+		_, err := s.Create(context.Background(), c)
+		assert.NoError(t, err)
+	}
+	return NewHandler(s, validation.NewValidator(&config.Config{}), opts), s
+}
+
+// post sends a json request and decodes the response checking its status
+func post(t *testing.T, h http.Handler, status int, query string, variables map[string]interface{}) result {
+	body, _ := json.Marshal(request{Query: query, Variables: variables})
+	req := httptest.NewRequest("POST", Path, strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, status, rr.Code, rr.Body.String())
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	res := result{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+	return res
+}
+
+// at returns the value at the path of keys and indexes
+func at(v interface{}, path ...interface{}) interface{} {
+	for _, p := range path {
+		switch p := p.(type) {
+		case string:
+			m, _ := v.(map[string]interface{})
+			v = m[p]
+		case int:
+			l, _ := v.([]interface{})
+			if p >= len(l) {
+				return nil
+			}
+			v = l[p]
+		}
+	}
+	return v
+}
+
+func TestParse(t *testing.T) {
+	doc, err := parse(`
+		# a comment
+		query Page($first: Int = 2, $filter: ContactFilter!) @cached {
+			page: contacts(first: $first, filter: $filter) { nodes { ...names } }
+			... on Query @include(if: true) { __typename }
+		}
+		fragment names on Contact { firstName, lastName, tags: note(x: [1, -2.5e3, "a\"é", """
+			block
+		""", {a: null, b: ENUM}]) }`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	op := doc.operations[0]
+	assert.Equal(t, "query", op.kind)
+	assert.Equal(t, "Page", op.name)
+	assert.Equal(t, "Int", op.variables[0].typ.String())
+	assert.Equal(t, "2", op.variables[0].defaultValue.raw)
+	assert.Equal(t, "ContactFilter!", op.variables[1].typ.String())
+	assert.Equal(t, "page", op.selections[0].responseKey())
+	assert.Equal(t, valueVariable, op.selections[0].arguments[0].value.kind)
+	assert.Equal(t, selectSpread, op.selections[0].selections[0].selections[0].kind)
+	assert.Equal(t, selectInline, op.selections[1].kind)
+	assert.Equal(t, location{Line: 5, Column: 4}, op.selections[1].loc)
+
+	list := doc.fragments["names"].selections[2].arguments[0].value.list
+	assert.Equal(t, "-2.5e3", list[1].raw)
+	assert.Equal(t, `a"é`, list[2].raw)
+	assert.Equal(t, "block", list[3].raw)
+	assert.Equal(t, valueEnum, list[4].fields[1].value.kind)
+
+	for _, invalid := range []string{``, `{}`, `{ a`, `query ($a: Int = $b) { a }`, `{ a(b: "x) }`, `{ a(b: 1.) }`, `fragment on on T { a }`, `{ a } !`} {
+		_, err := parse(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	h, _ := newTestHandler(t, Options{})
+
+	res := post(t, h, http.StatusOK, `query ($filter: ContactFilter) {
+		contacts(filter: $filter, first: 1) { totalCount nodes { id name: firstName phone organization { name } } pageInfo { hasNextPage endCursor } }
+	}`, map[string]interface{}{"filter": map[string]interface{}{"organization": "ACME"}})
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, 2.0, at(res.Data, "contacts", "totalCount"))
+	assert.Equal(t, map[string]interface{}{"id": "1", "name": "Jane", "phone": nil, "organization": map[string]interface{}{"name": "Acme"}},
+		at(res.Data, "contacts", "nodes", 0))
+	assert.Equal(t, true, at(res.Data, "contacts", "pageInfo", "hasNextPage"))
+
+	res = post(t, h, http.StatusOK, `query ($after: String) { contacts(filter: {organization: "acme"}, after: $after) { edges { node { email } } } }`,
+		map[string]interface{}{"after": cursor("contact", "1")})
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, []interface{}{map[string]interface{}{"node": map[string]interface{}{"email": "john@acme.com"}}}, at(res.Data, "contacts", "edges"))
+
+	res = post(t, h, http.StatusOK, `{
+		organizations { totalCount nodes { name contacts(first: 5) { nodes { ...person } } } }
+		organization(name: "GLOBEX") { name }
+		missing: contact(id: "99") { id }
+		invalid: contact(id: "x") { id }
+		contact(id: 4) { __typename ... on Contact { organization { name } } email @skip(if: true) }
+	}
+	fragment person on Contact { email }`, nil)
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, 2.0, at(res.Data, "organizations", "totalCount"))
+	assert.Equal(t, "Acme", at(res.Data, "organizations", "nodes", 0, "name"))
+	assert.Equal(t, "john@acme.com", at(res.Data, "organizations", "nodes", 0, "contacts", "nodes", 1, "email"))
+	assert.Equal(t, "Globex", at(res.Data, "organization", "name"))
+	assert.Nil(t, res.Data["missing"])
+	assert.Nil(t, res.Data["invalid"])
+	assert.Equal(t, map[string]interface{}{"__typename": "Contact", "organization": nil}, res.Data["contact"])
+
+	res = post(t, h, http.StatusOK, `{ first: contacts(first: 101) { totalCount } second: contacts(after: "bogus") { totalCount } organizations { totalCount } }`, nil)
+	if assert.Len(t, res.Errors, 2) {
+		assert.Equal(t, []interface{}{"first"}, res.Errors[0].Path)
+		assert.Equal(t, models.CodeInvalidParameter, res.Errors[0].Extensions["code"])
+		assert.Equal(t, []interface{}{"second"}, res.Errors[1].Path)
+	}
+	assert.Nil(t, res.Data)
+
+	res = post(t, h, http.StatusOK, `{
+		contact(id: "1") { tags { name } }
+		tags(first: 1) { totalCount nodes { name contacts { nodes { email } } } pageInfo { hasNextPage } }
+		tag(name: "WORK") { name contacts { totalCount } }
+		missingTag: tag(name: "home") { name }
+		contacts(filter: {tag: "Work", organization: "globex"}) { nodes { email tags { name } } }
+	}`, nil)
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, map[string]interface{}{"tags": []interface{}{map[string]interface{}{"name": "vip"}, map[string]interface{}{"name": "work"}}}, res.Data["contact"])
+	assert.Equal(t, 2.0, at(res.Data, "tags", "totalCount"))
+	assert.Equal(t, "vip", at(res.Data, "tags", "nodes", 0, "name"))
+	assert.Equal(t, "jane@acme.com", at(res.Data, "tags", "nodes", 0, "contacts", "nodes", 0, "email"))
+	assert.Equal(t, true, at(res.Data, "tags", "pageInfo", "hasNextPage"))
+	assert.Equal(t, map[string]interface{}{"name": "work", "contacts": map[string]interface{}{"totalCount": 2.0}}, res.Data["tag"])
+	assert.Nil(t, res.Data["missingTag"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"email": "ann@globex.com", "tags": []interface{}{map[string]interface{}{"name": "work"}}}},
+		at(res.Data, "contacts", "nodes"))
+}
+
+func TestMutation(t *testing.T) {
+	h, s := newTestHandler(t, Options{})
+
+	res := post(t, h, http.StatusOK, `mutation ($input: ContactInput!) { createContact(input: $input) { id email organization { name } } }`,
+		map[string]interface{}{"input": map[string]interface{}{"firstName": "Ann", "email": "ann@initech.com", "organization": "Initech"}})
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, "5", at(res.Data, "createContact", "id"))
+	assert.Equal(t, "Initech", at(res.Data, "createContact", "organization", "name"))
+
+	res = post(t, h, http.StatusOK, `mutation { updateContact(id: "5", input: {lastName: "Lee", organization: null, tags: [" VIP", "new", "vip"]}) { firstName lastName } }`, nil)
+	assert.Empty(t, res.Errors)
+	contact, err := s.Get(context.Background(), "5")
+	assert.NoError(t, err)
+	assert.Equal(t, models.Contact{ID: "5", FirstName: "Ann", LastName: "Lee", Email: "ann@initech.com", Tags: []string{"vip", "new"}}, contact)
+
+	res = post(t, h, http.StatusOK, `mutation { a: updateContact(id: "5", input: {note: "kept"}) { tags { name } } b: updateContact(id: "5", input: {tags: null}) { tags { name } } }`, nil)
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "vip"}, map[string]interface{}{"name": "new"}}, at(res.Data, "a", "tags"), "tags left out are kept")
+	assert.Equal(t, []interface{}{}, at(res.Data, "b", "tags"), "null clears the tags")
+
+	res = post(t, h, http.StatusOK, `mutation {
+		duplicate: createContact(input: {firstName: "Ann", email: "jane@acme.com"}) { id }
+		invalid: updateContact(id: "5", input: {email: "not an email"}) { id }
+		missing: deleteContact(id: "99")
+	}`, nil)
+	if assert.Len(t, res.Errors, 3) {
+		assert.Equal(t, models.CodeDuplicateEmail, res.Errors[0].Extensions["code"])
+		assert.Equal(t, models.CodeValidationFailed, res.Errors[1].Extensions["code"])
+		assert.NotEmpty(t, res.Errors[1].Extensions["errors"])
+		assert.Equal(t, models.CodeNotFound, res.Errors[2].Extensions["code"])
+	}
+	assert.Nil(t, res.Data)
+
+	res = post(t, h, http.StatusOK, `mutation { deleteContact(id: "5") }`, nil)
+	assert.Equal(t, "5", res.Data["deleteContact"])
+	_, err = s.Get(context.Background(), "5")
+	assert.Equal(t, store.ErrNotFound, err)
+}
+
+func TestValidation(t *testing.T) {
+	h, _ := newTestHandler(t, Options{MaxDepth: 4, MaxComplexity: 50})
+
+	tests := []struct {
+		query   string
+		message string
+	}{
+		{`{ contacts { bogus } }`, `cannot query field "bogus" on type "ContactConnection"`},
+		{`{ contacts(size: 1) { totalCount } }`, `unknown argument "size"`},
+		{`{ contact }`, `argument "id": expected a non null ID`},
+		{`{ contacts(first: "1") { totalCount } }`, `argument "first": expected a value of Int`},
+		{`{ contacts }`, `must have a selection of subfields`},
+		{`{ contacts { totalCount { x } } }`, `can not have a selection of subfields`},
+		{`{ contacts { nodes { ...missing } } }`, `unknown fragment missing`},
+		{`{ contacts { ...a } } fragment a on Contact { id }`, `fragment a on Contact can not be spread on ContactConnection`},
+		{`{ contacts { ...a } } fragment a on ContactConnection { ...a }`, `fragment a spreads itself`},
+		{`{ contacts(first: $n) { totalCount } }`, `variable $n is not defined`},
+		{`{ a: contacts { totalCount } a: organizations { totalCount } }`, `fields "contacts" and "organizations" both write "a"`},
+		{`{ contacts @defer { totalCount } }`, `unknown directive @defer`},
+		{`query ($n: Int!) { contacts(first: $n) { totalCount } }`, `variable $n of type Int! was not provided`},
+		{`{ contacts { nodes { organization { contacts { nodes { id } } } } } }`, `nested deeper than 4 fields`},
+		{`{ contacts(first: 20) { nodes { id email } } }`, `complexity of 61, at most 50 is allowed`},
+		{`mutation { bogus }`, `cannot query field "bogus" on type "Mutation"`},
+		{`subscription { contacts { totalCount } }`, `subscription operations are not supported`},
+		{`query a { __typename } query b { __typename }`, `operationName is required`},
+	}
+	for _, test := range tests {
+		res := post(t, h, http.StatusBadRequest, test.query, nil)
+		if assert.NotEmpty(t, res.Errors, test.query) {
+			assert.Contains(t, res.Errors[0].Message, test.message, test.query)
+			assert.NotEmpty(t, res.Errors[0].Locations, test.query)
+		}
+		assert.Nil(t, res.Data, test.query)
+	}
+
+	res := post(t, h, http.StatusOK, `{ contacts(first: 2) { nodes { id email } } }`, nil)
+	assert.Empty(t, res.Errors)
+}
+
+func TestIntrospection(t *testing.T) {
+	h, _ := newTestHandler(t, Options{})
+
+	res := post(t, h, http.StatusOK, `{
+		__schema { queryType { name } mutationType { name } directives { name } types { name kind } }
+		__type(name: "Contact") { kind fields { name type { kind name ofType { kind name } } } }
+		input: __type(name: "ContactInput") { inputFields { name defaultValue } }
+		contacts: __type(name: "Query") { fields { name args { name defaultValue type { name } } } }
+		missing: __type(name: "Label") { name }
+	}`, nil)
+	assert.Empty(t, res.Errors)
+	assert.Equal(t, "Query", at(res.Data, "__schema", "queryType", "name"))
+	assert.Equal(t, "Mutation", at(res.Data, "__schema", "mutationType", "name"))
+	assert.Equal(t, "include", at(res.Data, "__schema", "directives", 0, "name"))
+	assert.Equal(t, map[string]interface{}{"name": "id", "type": map[string]interface{}{
+		"kind": "NON_NULL", "name": nil, "ofType": map[string]interface{}{"kind": "SCALAR", "name": "ID"},
+	}}, at(res.Data, "__type", "fields", 0))
+	assert.Equal(t, "firstName", at(res.Data, "input", "inputFields", 0, "name"))
+	assert.Equal(t, "first", at(res.Data, "contacts", "fields", 1, "args", 1, "name"))
+	assert.Equal(t, "20", at(res.Data, "contacts", "fields", 1, "args", 1, "defaultValue"))
+	assert.Nil(t, res.Data["missing"])
+
+	kinds := map[string]interface{}{}
+	for _, typ := range at(res.Data, "__schema", "types").([]interface{}) {
+		kinds[at(typ, "name").(string)] = at(typ, "kind")
+	}
+	assert.Equal(t, "INPUT_OBJECT", kinds["ContactFilter"])
+	assert.Equal(t, "ENUM", kinds["__TypeKind"])
+	assert.Equal(t, "OBJECT", kinds["OrganizationConnection"])
+}
+
+func TestHandler(t *testing.T) {
+	h, _ := newTestHandler(t, Options{Playground: true})
+
+	req := httptest.NewRequest("GET", Path+"?query="+url.QueryEscape(`query ($id: ID!) { contact(id: $id) { email } }`)+
+		"&variables="+url.QueryEscape(`{"id": 1}`), nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"data":{"contact":{"email":"jane@acme.com"}}}`+"\n", rr.Body.String())
+
+	req = httptest.NewRequest("GET", Path+"?query="+url.QueryEscape(`mutation { deleteContact(id: "1") }`), nil)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "mutations must be sent with POST")
+
+	req = httptest.NewRequest("POST", Path, strings.NewReader(`{ contact(id: "2") { lastName firstName } }`))
+	req.Header.Set("Content-Type", "application/graphql")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, `{"data":{"contact":{"lastName":"Doe","firstName":"John"}}}`+"\n", rr.Body.String())
+
+	req = httptest.NewRequest("POST", Path, strings.NewReader(`{"query": `))
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req = httptest.NewRequest("DELETE", Path, nil)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	req = httptest.NewRequest("GET", Path, nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "window.location.pathname")
+	assert.NotContains(t, rr.Body.String(), "//", "the playground loads nothing from other hosts")
+	assert.NotRegexp(t, `(src|href)=`, rr.Body.String())
+
+	h, _ = newTestHandler(t, Options{})
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
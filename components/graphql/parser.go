@@ -0,0 +1,580 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// token kinds
+const (
+	tokenEOF = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+// selection kinds
+const (
+	selectField = iota
+	selectSpread
+	selectInline
+)
+
+// value kinds
+const (
+	valueVariable = iota
+	valueInt
+	valueFloat
+	valueString
+	valueBoolean
+	valueNull
+	valueEnum
+	valueList
+	valueObject
+)
+
+// location a line and column of a document counted from 1
+type location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// syntaxError a document that does not follow the GraphQL grammar
+type syntaxError struct {
+	message string
+	loc     location
+}
+
+// Error implements the error interface
+func (e *syntaxError) Error() string {
+	return fmt.Sprintf("syntax error: %s at %d:%d", e.message, e.loc.Line, e.loc.Column)
+}
+
+// token a lexical token of a document
+type token struct {
+	kind  int
+	value string
+	loc   location
+}
+
+// document a parsed GraphQL document
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+// operation a query or mutation
+type operation struct {
+	kind       string
+	name       string
+	variables  []*variableDefinition
+	selections []*selection
+	loc        location
+}
+
+// variableDefinition a variable an operation declares
+type variableDefinition struct {
+	name         string
+	typ          *typeRef
+	defaultValue *valueNode
+	loc          location
+}
+
+// fragment a named fragment
+type fragment struct {
+	name          string
+	typeCondition string
+	selections    []*selection
+	loc           location
+}
+
+// selection a field, fragment spread or inline fragment of a selection set
+type selection struct {
+	kind          int
+	alias         string
+	name          string
+	arguments     []*argumentNode
+	directives    []*directive
+	selections    []*selection
+	typeCondition string
+	loc           location
+}
+
+// responseKey returns the key a field is written under
+func (s *selection) responseKey() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+// argumentNode an argument of a field or directive
+type argumentNode struct {
+	name  string
+	value *valueNode
+	loc   location
+}
+
+// directive a directive like @include(if: $flag)
+type directive struct {
+	name      string
+	arguments []*argumentNode
+	loc       location
+}
+
+// valueNode a literal or variable, raw holds scalars, enums and variable names
+type valueNode struct {
+	kind   int
+	raw    string
+	list   []*valueNode
+	fields []*argumentNode
+	loc    location
+}
+
+// parser a recursive descent parser of documents
+type parser struct {
+	source string
+	pos    int
+	line   int
+	col    int
+	tok    token
+}
+
+// parse parses a document
+func parse(source string) (doc *document, err error) {
+	p := &parser{source: source, line: 1, col: 1}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*syntaxError)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, e
+		}
+	}()
+	p.next()
+	doc = &document{fragments: map[string]*fragment{}}
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.peekPunct("{"):
+			doc.operations = append(doc.operations, &operation{kind: "query", loc: p.tok.loc, selections: p.selectionSet()})
+		case p.tok.kind == tokenName && p.tok.value == "fragment":
+			f := p.fragmentDefinition()
+			if _, ok := doc.fragments[f.name]; ok {
+				p.fail(f.loc, "there can be only one fragment named "+f.name)
+			}
+			doc.fragments[f.name] = f
+		case p.tok.kind == tokenName && (p.tok.value == "query" || p.tok.value == "mutation" || p.tok.value == "subscription"):
+			doc.operations = append(doc.operations, p.operationDefinition())
+		default:
+			p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		p.fail(p.tok.loc, "the document has no operation")
+	}
+	return doc, nil
+}
+
+// fail stops parsing with a syntax error
+func (p *parser) fail(loc location, message string) {
+	panic(&syntaxError{message: message, loc: loc})
+}
+
+// unexpected fails on the current token
+func (p *parser) unexpected() {
+	if p.tok.kind == tokenEOF {
+		p.fail(p.tok.loc, "unexpected end of document")
+	}
+	p.fail(p.tok.loc, fmt.Sprintf("unexpected %q", p.tok.value))
+}
+
+// peekPunct reports whether the current token is the punctuator
+func (p *parser) peekPunct(punct string) bool {
+	return p.tok.kind == tokenPunct && p.tok.value == punct
+}
+
+// skipPunct consumes the punctuator when it is the current token
+func (p *parser) skipPunct(punct string) bool {
+	if p.peekPunct(punct) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expectPunct consumes the punctuator or fails
+func (p *parser) expectPunct(punct string) {
+	if !p.skipPunct(punct) {
+		p.unexpected()
+	}
+}
+
+// expectName consumes a name and returns it
+func (p *parser) expectName() string {
+	if p.tok.kind != tokenName {
+		p.unexpected()
+	}
+	name := p.tok.value
+	p.next()
+	return name
+}
+
+// operationDefinition parses query, mutation or subscription with an optional name and variables
+func (p *parser) operationDefinition() *operation {
+	op := &operation{kind: p.tok.value, loc: p.tok.loc}
+	p.next()
+	if p.tok.kind == tokenName {
+		op.name = p.expectName()
+	}
+	if p.skipPunct("(") {
+		for !p.skipPunct(")") {
+			v := &variableDefinition{loc: p.tok.loc}
+			p.expectPunct("$")
+			v.name = p.expectName()
+			p.expectPunct(":")
+			v.typ = p.typeReference()
+			if p.skipPunct("=") {
+				v.defaultValue = p.value(true)
+			}
+			op.variables = append(op.variables, v)
+		}
+	}
+	p.directives()
+	op.selections = p.selectionSet()
+	return op
+}
+
+// fragmentDefinition parses fragment Name on Type { ... }
+func (p *parser) fragmentDefinition() *fragment {
+	f := &fragment{loc: p.tok.loc}
+	p.next()
+	f.name = p.expectName()
+	if f.name == "on" || p.expectName() != "on" {
+		p.fail(f.loc, "invalid fragment definition")
+	}
+	f.typeCondition = p.expectName()
+	p.directives()
+	f.selections = p.selectionSet()
+	return f
+}
+
+// typeReference parses a named, list or non null type
+func (p *parser) typeReference() *typeRef {
+	var t *typeRef
+	if p.skipPunct("[") {
+		t = listOf(p.typeReference())
+		p.expectPunct("]")
+	} else {
+		t = named(p.expectName())
+	}
+	if p.skipPunct("!") {
+		t = nonNull(t)
+	}
+	return t
+}
+
+// selectionSet parses { selection ... }
+func (p *parser) selectionSet() []*selection {
+	p.expectPunct("{")
+	selections := []*selection{}
+	for !p.skipPunct("}") {
+		selections = append(selections, p.selection())
+	}
+	if len(selections) == 0 {
+		p.unexpected()
+	}
+	return selections
+}
+
+// selection parses a field, a fragment spread or an inline fragment
+func (p *parser) selection() *selection {
+	s := &selection{loc: p.tok.loc}
+	if p.skipPunct("...") {
+		if p.tok.kind == tokenName && p.tok.value != "on" {
+			s.kind = selectSpread
+			s.name = p.expectName()
+			s.directives = p.directives()
+			return s
+		}
+		s.kind = selectInline
+		if p.tok.kind == tokenName {
+			p.next()
+			s.typeCondition = p.expectName()
+		}
+		s.directives = p.directives()
+		s.selections = p.selectionSet()
+		return s
+	}
+
+	s.kind = selectField
+	s.name = p.expectName()
+	if p.skipPunct(":") {
+		s.alias, s.name = s.name, p.expectName()
+	}
+	s.arguments = p.arguments(false)
+	s.directives = p.directives()
+	if p.peekPunct("{") {
+		s.selections = p.selectionSet()
+	}
+	return s
+}
+
+// arguments parses an optional (name: value ...) list
+func (p *parser) arguments(constant bool) []*argumentNode {
+	args := []*argumentNode{}
+	if !p.skipPunct("(") {
+		return args
+	}
+	for !p.skipPunct(")") {
+		arg := &argumentNode{loc: p.tok.loc}
+		arg.name = p.expectName()
+		p.expectPunct(":")
+		arg.value = p.value(constant)
+		args = append(args, arg)
+	}
+	return args
+}
+
+// directives parses @name(arguments) directives
+func (p *parser) directives() []*directive {
+	directives := []*directive{}
+	for p.peekPunct("@") {
+		d := &directive{loc: p.tok.loc}
+		p.next()
+		d.name = p.expectName()
+		d.arguments = p.arguments(false)
+		directives = append(directives, d)
+	}
+	return directives
+}
+
+// value parses a value, variables are not allowed in constant values like defaults
+func (p *parser) value(constant bool) *valueNode {
+	v := &valueNode{loc: p.tok.loc, raw: p.tok.value}
+	switch {
+	case p.peekPunct("$") && !constant:
+		p.next()
+		v.kind, v.raw = valueVariable, p.expectName()
+		return v
+	case p.skipPunct("["):
+		v.kind = valueList
+		for !p.skipPunct("]") {
+			v.list = append(v.list, p.value(constant))
+		}
+		return v
+	case p.skipPunct("{"):
+		v.kind = valueObject
+		for !p.skipPunct("}") {
+			field := &argumentNode{loc: p.tok.loc}
+			field.name = p.expectName()
+			p.expectPunct(":")
+			field.value = p.value(constant)
+			v.fields = append(v.fields, field)
+		}
+		return v
+	case p.tok.kind == tokenInt:
+		v.kind = valueInt
+	case p.tok.kind == tokenFloat:
+		v.kind = valueFloat
+	case p.tok.kind == tokenString:
+		v.kind = valueString
+	case p.tok.kind == tokenName && (p.tok.value == "true" || p.tok.value == "false"):
+		v.kind = valueBoolean
+	case p.tok.kind == tokenName && p.tok.value == "null":
+		v.kind = valueNull
+	case p.tok.kind == tokenName:
+		v.kind = valueEnum
+	default:
+		p.unexpected()
+	}
+	p.next()
+	return v
+}
+
+// next reads the next token, skipping white space, commas and comments
+func (p *parser) next() {
+skip:
+	for p.pos < len(p.source) {
+		switch rest := p.source[p.pos:]; {
+		case rest[0] == '#':
+			for p.pos < len(p.source) && p.source[p.pos] != '\n' && p.source[p.pos] != '\r' {
+				p.advance(1)
+			}
+		case strings.HasPrefix(rest, "\uFEFF"):
+			p.pos += len("\uFEFF")
+		case strings.IndexByte(" \t,\n\r", rest[0]) >= 0:
+			p.advance(1)
+		default:
+			break skip
+		}
+	}
+
+	loc := location{Line: p.line, Column: p.col}
+	if p.pos >= len(p.source) {
+		p.tok = token{kind: tokenEOF, loc: loc}
+		return
+	}
+	rest := p.source[p.pos:]
+	switch c := rest[0]; {
+	case strings.HasPrefix(rest, "..."):
+		p.tok = token{kind: tokenPunct, value: "...", loc: loc}
+		p.advance(3)
+	case strings.IndexByte("!$&():=@[]{|}", c) >= 0:
+		p.tok = token{kind: tokenPunct, value: string(c), loc: loc}
+		p.advance(1)
+	case c == '_' || isLetter(c):
+		end := 1
+		for end < len(rest) && (rest[end] == '_' || isLetter(rest[end]) || isDigit(rest[end])) {
+			end++
+		}
+		p.tok = token{kind: tokenName, value: rest[:end], loc: loc}
+		p.advance(end)
+	case c == '-' || isDigit(c):
+		p.number(loc)
+	case strings.HasPrefix(rest, `"""`):
+		p.blockString(loc)
+	case c == '"':
+		p.str(loc)
+	default:
+		p.fail(loc, fmt.Sprintf("unexpected character %q", c))
+	}
+}
+
+// advance moves past n bytes of a single line
+func (p *parser) advance(n int) {
+	for i := 0; i < n; i++ {
+		if p.source[p.pos] == '\n' {
+			p.line++
+			p.col = 1
+		} else {
+			p.col++
+		}
+		p.pos++
+	}
+}
+
+// number reads an int or float token
+func (p *parser) number(loc location) {
+	rest := p.source[p.pos:]
+	end, kind := 0, tokenInt
+	if rest[end] == '-' {
+		end++
+	}
+	digits := func() {
+		start := end
+		for end < len(rest) && isDigit(rest[end]) {
+			end++
+		}
+		if start == end {
+			p.fail(loc, "invalid number")
+		}
+	}
+	digits()
+	if end < len(rest) && rest[end] == '.' {
+		end++
+		kind = tokenFloat
+		digits()
+	}
+	if end < len(rest) && (rest[end] == 'e' || rest[end] == 'E') {
+		end++
+		kind = tokenFloat
+		if end < len(rest) && (rest[end] == '+' || rest[end] == '-') {
+			end++
+		}
+		digits()
+	}
+	if end < len(rest) && (rest[end] == '_' || isLetter(rest[end]) || rest[end] == '.') {
+		p.fail(loc, "invalid number")
+	}
+	p.tok = token{kind: kind, value: rest[:end], loc: loc}
+	p.advance(end)
+}
+
+// str reads a quoted string token
+func (p *parser) str(loc location) {
+	rest := p.source[p.pos:]
+	var b strings.Builder
+	for i := 1; i < len(rest); {
+		c := rest[i]
+		switch {
+		case c == '"':
+			p.tok = token{kind: tokenString, value: b.String(), loc: loc}
+			p.advance(i + 1)
+			return
+		case c == '\n' || c == '\r':
+			p.fail(loc, "unterminated string")
+		case c == '\\' && i+1 < len(rest):
+			escaped := map[byte]string{'"': `"`, '\\': `\`, '/': "/", 'b': "\b", 'f': "\f", 'n': "\n", 'r': "\r", 't': "\t"}
+			if s, ok := escaped[rest[i+1]]; ok {
+				b.WriteString(s)
+				i += 2
+				continue
+			}
+			if rest[i+1] != 'u' || i+6 > len(rest) {
+				p.fail(loc, "invalid escape in string")
+			}
+			r, err := strconv.ParseUint(rest[i+2:i+6], 16, 32)
+			if err != nil {
+				p.fail(loc, "invalid escape in string")
+			}
+			b.WriteRune(rune(r))
+			i += 6
+		default:
+			_, size := utf8.DecodeRuneInString(rest[i:])
+			b.WriteString(rest[i : i+size])
+			i += size
+		}
+	}
+	p.fail(loc, "unterminated string")
+}
+
+// blockString reads a """ block string, removing the common indentation and blank first and last lines
+func (p *parser) blockString(loc location) {
+	rest := p.source[p.pos:]
+	end := 3
+	for ; end < len(rest) && !strings.HasPrefix(rest[end:], `"""`); end++ {
+		if strings.HasPrefix(rest[end:], `\"""`) {
+			end += 3
+		}
+	}
+	if end >= len(rest) {
+		p.fail(loc, "unterminated string")
+	}
+	raw := strings.Replace(rest[3:end], `\"""`, `"""`, -1)
+	lines := strings.Split(strings.Replace(raw, "\r\n", "\n", -1), "\n")
+	indent := -1
+	for _, l := range lines[1:] {
+		trimmed := strings.TrimLeft(l, " \t")
+		if trimmed != "" && (indent < 0 || len(l)-len(trimmed) < indent) {
+			indent = len(l) - len(trimmed)
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if len(lines[i]) >= indent {
+			lines[i] = lines[i][indent:]
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	p.tok = token{kind: tokenString, value: strings.Join(lines, "\n"), loc: loc}
+	p.advance(end + 3)
+}
+
+// isLetter reports whether c is an ascii letter
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// isDigit reports whether c is an ascii digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,360 @@
+package graphql
+
+import "context"
+
+// type kinds, named as introspection reports them
+const (
+	kindScalar      = "SCALAR"
+	kindObject      = "OBJECT"
+	kindInputObject = "INPUT_OBJECT"
+	kindEnum        = "ENUM"
+	kindList        = "LIST"
+	kindNonNull     = "NON_NULL"
+)
+
+// typeRef a reference to a named type or a list or non null wrapper of another reference
+type typeRef struct {
+	kind   string
+	name   string
+	ofType *typeRef
+}
+
+// named references the named type
+func named(name string) *typeRef {
+	return &typeRef{name: name}
+}
+
+// listOf references a list of t
+func listOf(t *typeRef) *typeRef {
+	return &typeRef{kind: kindList, ofType: t}
+}
+
+// nonNull references a non null t
+func nonNull(t *typeRef) *typeRef {
+	return &typeRef{kind: kindNonNull, ofType: t}
+}
+
+// String returns the reference written as in a document, like [Contact!]!
+func (t *typeRef) String() string {
+	switch t.kind {
+	case kindList:
+		return "[" + t.ofType.String() + "]"
+	case kindNonNull:
+		return t.ofType.String() + "!"
+	}
+	return t.name
+}
+
+// namedType returns the name of the type inside of any wrappers
+func (t *typeRef) namedType() string {
+	for t.ofType != nil {
+		t = t.ofType
+	}
+	return t.name
+}
+
+// resolveFunc returns the value of a field of source
+type resolveFunc func(ctx context.Context, source interface{}, args map[string]interface{}) (interface{}, error)
+
+// fieldDef a field of an object type
+type fieldDef struct {
+	name        string
+	description string
+	typ         *typeRef
+	args        []*inputValue
+	resolve     resolveFunc
+}
+
+// inputValue an argument or a field of an input object, defaultValue is a constant literal
+type inputValue struct {
+	name         string
+	description  string
+	typ          *typeRef
+	defaultValue string
+}
+
+// enumValue a value of an enum type
+type enumValue struct {
+	name        string
+	description string
+}
+
+// namedType a scalar, object, input object or enum type
+type namedType struct {
+	kind        string
+	name        string
+	description string
+	fields      []*fieldDef
+	inputFields []*inputValue
+	enumValues  []*enumValue
+}
+
+// field returns the field with the name or nil
+func (t *namedType) field(name string) *fieldDef {
+	for _, f := range t.fields {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// directiveDef a directive the executor understands
+type directiveDef struct {
+	name        string
+	description string
+	locations   []string
+	args        []*inputValue
+}
+
+// schema the types, root types and directives of an api
+type schema struct {
+	types      map[string]*namedType
+	order      []string
+	query      string
+	mutation   string
+	directives []*directiveDef
+}
+
+// newSchema returns a schema with the built in scalars, directives and introspection types
+func newSchema(query, mutation string) *schema {
+	s := &schema{types: map[string]*namedType{}, query: query, mutation: mutation}
+	s.add(&namedType{kind: kindScalar, name: "Int", description: "A signed 32 bit integer."})
+	s.add(&namedType{kind: kindScalar, name: "Float", description: "A double precision floating point number."})
+	s.add(&namedType{kind: kindScalar, name: "String", description: "UTF-8 text."})
+	s.add(&namedType{kind: kindScalar, name: "Boolean", description: "true or false."})
+	s.add(&namedType{kind: kindScalar, name: "ID", description: "A unique identifier, serialized as a string."})
+
+	condition := func(description string) []*inputValue {
+		return []*inputValue{{name: "if", description: description, typ: nonNull(named("Boolean"))}}
+	}
+	locations := []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"}
+	s.directives = []*directiveDef{
+		{name: "include", description: "Includes the selection only when if is true.", locations: locations, args: condition("Included when true.")},
+		{name: "skip", description: "Skips the selection when if is true.", locations: locations, args: condition("Skipped when true.")},
+	}
+	s.addIntrospection()
+	return s
+}
+
+// add adds a named type to the schema
+func (s *schema) add(t *namedType) {
+	s.types[t.name] = t
+	s.order = append(s.order, t.name)
+}
+
+// kindOf returns the kind of the referenced type
+func (s *schema) kindOf(t *typeRef) string {
+	if t.kind != "" {
+		return t.kind
+	}
+	if named, ok := s.types[t.name]; ok {
+		return named.kind
+	}
+	return ""
+}
+
+// directive returns the directive with the name or nil
+func (s *schema) directive(name string) *directiveDef {
+	for _, d := range s.directives {
+		if d.name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// addIntrospection adds the __Schema, __Type and related types queried by __schema and __type
+func (s *schema) addIntrospection() {
+	str := func(v string) interface{} {
+		if v == "" {
+			return nil
+		}
+		return v
+	}
+	constant := func(v interface{}) resolveFunc {
+		return func(context.Context, interface{}, map[string]interface{}) (interface{}, error) { return v, nil }
+	}
+	includeDeprecated := []*inputValue{{name: "includeDeprecated", typ: named("Boolean"), defaultValue: "false"}}
+	inputValues := func(values []*inputValue) interface{} {
+		list := make([]interface{}, len(values))
+		for i, v := range values {
+			list[i] = v
+		}
+		return list
+	}
+	deprecation := []*fieldDef{
+		{name: "isDeprecated", typ: nonNull(named("Boolean")), resolve: constant(false)},
+		{name: "deprecationReason", typ: named("String"), resolve: constant(nil)},
+	}
+
+	s.add(&namedType{kind: kindObject, name: "__Schema", description: "The types, root types and directives of the api.", fields: []*fieldDef{
+		{name: "description", typ: named("String"), resolve: constant(nil)},
+		{name: "types", typ: nonNull(listOf(nonNull(named("__Type")))), resolve: func(context.Context, interface{}, map[string]interface{}) (interface{}, error) {
+			types := make([]interface{}, len(s.order))
+			for i, name := range s.order {
+				types[i] = named(name)
+			}
+			return types, nil
+		}},
+		{name: "queryType", typ: nonNull(named("__Type")), resolve: constant(named(s.query))},
+		{name: "mutationType", typ: named("__Type"), resolve: func(context.Context, interface{}, map[string]interface{}) (interface{}, error) {
+			if s.mutation == "" {
+				return nil, nil
+			}
+			return named(s.mutation), nil
+		}},
+		{name: "subscriptionType", typ: named("__Type"), resolve: constant(nil)},
+		{name: "directives", typ: nonNull(listOf(nonNull(named("__Directive")))), resolve: func(context.Context, interface{}, map[string]interface{}) (interface{}, error) {
+			directives := make([]interface{}, len(s.directives))
+			for i, d := range s.directives {
+				directives[i] = d
+			}
+			return directives, nil
+		}},
+	}})
+
+	// typeOf returns the named type of a __Type source or nil for lists and non null types
+	typeOf := func(source interface{}) *namedType {
+		ref := source.(*typeRef)
+		if ref.kind != "" {
+			return nil
+		}
+		return s.types[ref.name]
+	}
+	s.add(&namedType{kind: kindObject, name: "__Type", description: "A type of the api or a list or non null wrapper of one.", fields: []*fieldDef{
+		{name: "kind", typ: nonNull(named("__TypeKind")), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return s.kindOf(source.(*typeRef)), nil
+		}},
+		{name: "name", typ: named("String"), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return str(source.(*typeRef).name), nil
+		}},
+		{name: "description", typ: named("String"), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			if t := typeOf(source); t != nil {
+				return str(t.description), nil
+			}
+			return nil, nil
+		}},
+		{name: "specifiedByURL", typ: named("String"), resolve: constant(nil)},
+		{name: "fields", typ: listOf(nonNull(named("__Field"))), args: includeDeprecated, resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			t := typeOf(source)
+			if t == nil || t.kind != kindObject {
+				return nil, nil
+			}
+			fields := []interface{}{}
+			for _, f := range t.fields {
+				fields = append(fields, f)
+			}
+			return fields, nil
+		}},
+		{name: "interfaces", typ: listOf(nonNull(named("__Type"))), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			if t := typeOf(source); t != nil && t.kind == kindObject {
+				return []interface{}{}, nil
+			}
+			return nil, nil
+		}},
+		{name: "possibleTypes", typ: listOf(nonNull(named("__Type"))), resolve: constant(nil)},
+		{name: "enumValues", typ: listOf(nonNull(named("__EnumValue"))), args: includeDeprecated, resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			t := typeOf(source)
+			if t == nil || t.kind != kindEnum {
+				return nil, nil
+			}
+			values := []interface{}{}
+			for _, v := range t.enumValues {
+				values = append(values, v)
+			}
+			return values, nil
+		}},
+		{name: "inputFields", typ: listOf(nonNull(named("__InputValue"))), args: includeDeprecated, resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			if t := typeOf(source); t != nil && t.kind == kindInputObject {
+				return inputValues(t.inputFields), nil
+			}
+			return nil, nil
+		}},
+		{name: "ofType", typ: named("__Type"), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			if of := source.(*typeRef).ofType; of != nil {
+				return of, nil
+			}
+			return nil, nil
+		}},
+		{name: "isOneOf", typ: named("Boolean"), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			if t := typeOf(source); t != nil && t.kind == kindInputObject {
+				return false, nil
+			}
+			return nil, nil
+		}},
+	}})
+
+	s.add(&namedType{kind: kindObject, name: "__Field", description: "A field of an object type.", fields: append([]*fieldDef{
+		{name: "name", typ: nonNull(named("String")), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return source.(*fieldDef).name, nil
+		}},
+		{name: "description", typ: named("String"), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return str(source.(*fieldDef).description), nil
+		}},
+		{name: "args", typ: nonNull(listOf(nonNull(named("__InputValue")))), args: includeDeprecated, resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return inputValues(source.(*fieldDef).args), nil
+		}},
+		{name: "type", typ: nonNull(named("__Type")), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return source.(*fieldDef).typ, nil
+		}},
+	}, deprecation...)})
+
+	s.add(&namedType{kind: kindObject, name: "__InputValue", description: "An argument or a field of an input object.", fields: append([]*fieldDef{
+		{name: "name", typ: nonNull(named("String")), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return source.(*inputValue).name, nil
+		}},
+		{name: "description", typ: named("String"), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return str(source.(*inputValue).description), nil
+		}},
+		{name: "type", typ: nonNull(named("__Type")), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return source.(*inputValue).typ, nil
+		}},
+		{name: "defaultValue", typ: named("String"), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return str(source.(*inputValue).defaultValue), nil
+		}},
+	}, deprecation...)})
+
+	s.add(&namedType{kind: kindObject, name: "__EnumValue", description: "A value of an enum type.", fields: append([]*fieldDef{
+		{name: "name", typ: nonNull(named("String")), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return source.(*enumValue).name, nil
+		}},
+		{name: "description", typ: named("String"), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return str(source.(*enumValue).description), nil
+		}},
+	}, deprecation...)})
+
+	s.add(&namedType{kind: kindObject, name: "__Directive", description: "A directive the api understands.", fields: []*fieldDef{
+		{name: "name", typ: nonNull(named("String")), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return source.(*directiveDef).name, nil
+		}},
+		{name: "description", typ: named("String"), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return str(source.(*directiveDef).description), nil
+		}},
+		{name: "isRepeatable", typ: nonNull(named("Boolean")), resolve: constant(false)},
+		{name: "locations", typ: nonNull(listOf(nonNull(named("__DirectiveLocation")))), resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			locations := []interface{}{}
+			for _, l := range source.(*directiveDef).locations {
+				locations = append(locations, l)
+			}
+			return locations, nil
+		}},
+		{name: "args", typ: nonNull(listOf(nonNull(named("__InputValue")))), args: includeDeprecated, resolve: func(_ context.Context, source interface{}, _ map[string]interface{}) (interface{}, error) {
+			return inputValues(source.(*directiveDef).args), nil
+		}},
+	}})
+
+	s.add(enum("__TypeKind", "The kind of a type.", kindScalar, kindObject, "INTERFACE", "UNION", kindEnum, kindInputObject, kindList, kindNonNull))
+	s.add(enum("__DirectiveLocation", "Where a directive may be used.", "QUERY", "MUTATION", "SUBSCRIPTION", "FIELD",
+		"FRAGMENT_DEFINITION", "FRAGMENT_SPREAD", "INLINE_FRAGMENT", "VARIABLE_DEFINITION", "SCHEMA", "SCALAR", "OBJECT",
+		"FIELD_DEFINITION", "ARGUMENT_DEFINITION", "INTERFACE", "UNION", "ENUM", "ENUM_VALUE", "INPUT_OBJECT", "INPUT_FIELD_DEFINITION"))
+}
+
+// enum returns an enum type with the values
+func enum(name, description string, values ...string) *namedType {
+	t := &namedType{kind: kindEnum, name: name, description: description}
+	for _, v := range values {
+		t.enumValues = append(t.enumValues, &enumValue{name: v})
+	}
+	return t
+}
@@ -0,0 +1,200 @@
+package imports
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// queue timing constants
+const (
+	// pollInterval how often idle workers look for jobs queued by other instances or abandoned by stopped workers
+	pollInterval = 5 * time.Second
+	// heartbeatInterval how often a running job records its progress and checks whether it was cancelled
+	heartbeatInterval = 10 * time.Second
+	// staleAfter time without a heartbeat after which a running job is claimed again
+	staleAfter = time.Minute
+	// defaultWorkers jobs processed at the same time when none are configured
+	defaultWorkers = 2
+)
+
+// ProcessFunc imports the file of job into report, calling progress with the number of rows read so far.
+// Returning a problem ends the job as failed, the import stops early when ctx is cancelled
+type ProcessFunc func(ctx context.Context, job models.ImportJob, data []byte, report *models.ImportReport, progress func(rows int)) *models.Problem
+
+// Queue runs import jobs kept in a JobStore on a pool of background workers
+type Queue interface {
+	// Submit queues a job importing data
+	Submit(ctx context.Context, job models.ImportJob, data []byte) (models.ImportJob, error)
+	// Cancel cancels a queued or running job, stopping it right away when it runs on this instance
+	Cancel(ctx context.Context, id string) (models.ImportJob, error)
+	// Start starts the workers, which process jobs with process until ctx is done or the queue is closed
+	Start(ctx context.Context, process ProcessFunc)
+	// Close stops the workers, waiting for the jobs they run to finish
+	Close()
+}
+
+// queue is the implementation of the Queue interface
+type queue struct {
+	jobs    store.JobStore
+	workers int
+	wake    chan struct{}
+	stop    context.CancelFunc
+	stopped sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+}
+
+// NewQueue creates a Queue running jobs of jobs on the given number of workers
+func NewQueue(jobs store.JobStore, workers int) Queue {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	return &queue{
+		jobs:    jobs,
+		workers: workers,
+		wake:    make(chan struct{}, workers),
+		stop:    func() {},
+		running: map[string]context.CancelFunc{},
+	}
+}
+
+// Submit queues a job importing data and wakes an idle worker
+func (q *queue) Submit(ctx context.Context, job models.ImportJob, data []byte) (models.ImportJob, error) {
+	job, err := q.jobs.CreateJob(ctx, job, data)
+	if err != nil {
+		return models.ImportJob{}, err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Cancel cancels a queued or running job
+func (q *queue) Cancel(ctx context.Context, id string) (models.ImportJob, error) {
+	job, err := q.jobs.CancelJob(ctx, id)
+	if err != nil {
+		return models.ImportJob{}, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if cancel, ok := q.running[id]; ok {
+		cancel()
+	}
+	return job, nil
+}
+
+// Start starts the workers
+func (q *queue) Start(ctx context.Context, process ProcessFunc) {
+	ctx, q.stop = context.WithCancel(ctx)
+	q.stopped.Add(q.workers)
+	for i := 0; i < q.workers; i++ {
+		go q.work(ctx, process)
+	}
+}
+
+// Close stops the workers
+func (q *queue) Close() {
+	q.stop()
+	q.stopped.Wait()
+}
+
+// work claims and runs jobs one at a time, waiting for a submitted job or the next poll when there are none.
+// It returns once ctx is done
+func (q *queue) work(ctx context.Context, process ProcessFunc) {
+	defer q.stopped.Done()
+	timer := time.NewTimer(pollInterval)
+	defer timer.Stop()
+	for ctx.Err() == nil {
+		job, data, err := q.jobs.ClaimJob(ctx, staleAfter)
+		if err == nil {
+			q.run(job, data, process)
+			continue
+		}
+		if err != store.ErrNoJob && ctx.Err() == nil {
+			log.Printf("import error: claiming a job: %s", err)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(pollInterval)
+		select {
+		case <-ctx.Done():
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// run processes a claimed job and stores its outcome. A heartbeat records the progress meanwhile
+// and stops the job once it was cancelled on another instance
+func (q *queue) run(job models.ImportJob, data []byte, process ProcessFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.mu.Lock()
+	q.running[job.ID] = cancel
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, job.ID)
+		q.mu.Unlock()
+	}()
+
+	var processed int64
+	done := make(chan struct{})
+	go q.heartbeat(job.ID, &processed, cancel, done)
+
+	report := models.NewImportReport()
+	problem := process(ctx, job, data, report, func(rows int) {
+		atomic.StoreInt64(&processed, int64(rows))
+	})
+	close(done)
+
+	job.Processed = report.Total
+	job.Report = report
+	switch {
+	case ctx.Err() != nil:
+		job.Status = models.ImportCancelled
+	case problem != nil:
+		job.Status = models.ImportFailed
+		job.Error = problem
+	default:
+		job.Status = models.ImportSucceeded
+	}
+	if err := q.jobs.FinishJob(context.Background(), job); err != nil {
+		log.Printf("import error: finishing job %s: %s", job.ID, err)
+	}
+}
+
+// heartbeat records the progress of a running job until done is closed, cancelling it once it was cancelled
+func (q *queue) heartbeat(id string, processed *int64, cancel context.CancelFunc, done <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		status, err := q.jobs.HeartbeatJob(context.Background(), id, int(atomic.LoadInt64(processed)))
+		if err != nil {
+			log.Printf("import error: heartbeat of job %s: %s", id, err)
+			continue
+		}
+		if status == models.ImportCancelled {
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package imports
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// waitFor polls the job with id until done reports true or a second passed
+func waitFor(t *testing.T, jobs store.JobStore, id string, done func(job models.ImportJob) bool) models.ImportJob {
+	deadline := time.Now().Add(time.Second)
+	for {
+		job, err := jobs.GetJob(context.Background(), id)
+		assert.NoError(t, err)
+		if done(job) || time.Now().After(deadline) {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// statusOf waits for the job with id to reach status
+func statusOf(t *testing.T, jobs store.JobStore, id, status string) models.ImportJob {
+	job := waitFor(t, jobs, id, func(job models.ImportJob) bool { return job.Status == status })
+	assert.Equal(t, status, job.Status, "job %s", id)
+	return job
+}
+
+func TestQueue(t *testing.T) {
+	jobs := store.NewMemoryStore()
+	q := NewQueue(jobs, 1)
+	defer q.Close()
+	q.Start(context.Background(), func(ctx context.Context, job models.ImportJob, data []byte, report *models.ImportReport, progress func(rows int)) *models.Problem {
+		switch string(data) {
+		case "block":
+			progress(1)
+			<-ctx.Done()
+			return &models.Problem{Status: http.StatusInternalServerError, Code: models.CodeInternal}
+		case "fail":
+			return &models.Problem{Status: http.StatusBadRequest, Code: models.CodeInvalidFile}
+		}
+		report.Total++
+		report.Accept(true)
+		return nil
+	})
+	ctx := context.Background()
+
+	done, err := q.Submit(ctx, models.ImportJob{Filename: "done.csv"}, []byte("ok"))
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImportQueued, done.Status)
+	job := statusOf(t, jobs, done.ID, models.ImportSucceeded)
+	assert.Equal(t, 1, job.Processed)
+	assert.Equal(t, 1, job.Report.Created)
+	assert.NotNil(t, job.FinishedAt)
+
+	failed, _ := q.Submit(ctx, models.ImportJob{}, []byte("fail"))
+	job = statusOf(t, jobs, failed.ID, models.ImportFailed)
+	assert.Equal(t, models.CodeInvalidFile, job.Error.Code)
+
+	// the only worker is busy so the next job stays queued until it is cancelled
+	running, _ := q.Submit(ctx, models.ImportJob{}, []byte("block"))
+	statusOf(t, jobs, running.ID, models.ImportRunning)
+	queued, _ := q.Submit(ctx, models.ImportJob{}, []byte("ok"))
+	job, err = q.Cancel(ctx, queued.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImportCancelled, job.Status)
+
+	_, err = q.Cancel(ctx, running.ID)
+	assert.NoError(t, err)
+	job = statusOf(t, jobs, running.ID, models.ImportCancelled)
+	assert.Nil(t, job.Error)
+	job, _ = jobs.GetJob(ctx, queued.ID)
+	assert.Nil(t, job.Report)
+	assert.NotNil(t, job.FinishedAt)
+
+	_, err = q.Cancel(ctx, done.ID)
+	assert.Equal(t, store.ErrJobFinished, err)
+	_, err = q.Cancel(ctx, "404")
+	assert.Equal(t, store.ErrJobNotFound, err)
+}
+
+func TestClose(t *testing.T) {
+	jobs := store.NewMemoryStore()
+	q := NewQueue(jobs, 2)
+	q.Start(context.Background(), func(ctx context.Context, job models.ImportJob, data []byte, report *models.ImportReport, progress func(rows int)) *models.Problem {
+		return nil
+	})
+	q.Close()
+
+	// the workers returned so nothing claims the job
+	submitted, err := q.Submit(context.Background(), models.ImportJob{}, []byte("ok"))
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	job, _ := jobs.GetJob(context.Background(), submitted.ID)
+	assert.Equal(t, models.ImportQueued, job.Status)
+}
+
+func TestClaimAbandoned(t *testing.T) {
+	jobs := store.NewMemoryStore()
+	ctx := context.Background()
+	created, _ := jobs.CreateJob(ctx, models.ImportJob{Filename: "contacts.csv"}, []byte("data"))
+
+	job, data, err := jobs.ClaimJob(ctx, staleAfter)
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, job.ID)
+	assert.Equal(t, models.ImportRunning, job.Status)
+	assert.Equal(t, "data", string(data))
+
+	_, _, err = jobs.ClaimJob(ctx, staleAfter)
+	assert.Equal(t, store.ErrNoJob, err)
+
+	// a worker that stopped without finishing the job no longer sends heartbeats
+	time.Sleep(time.Millisecond)
+	job, data, err = jobs.ClaimJob(ctx, time.Nanosecond)
+	assert.NoError(t, err)
+	assert.Equal(t, created.ID, job.ID)
+	assert.Equal(t, "data", string(data))
+}
@@ -0,0 +1,190 @@
+package ldap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// ber identifier classes
+const (
+	classUniversal   = 0x00
+	classApplication = 0x40
+	classContext     = 0x80
+
+	// constructedBit marks elements holding other elements
+	constructedBit = 0x20
+)
+
+// universal tags
+const (
+	tagBoolean     = 1
+	tagInteger     = 2
+	tagOctetString = 4
+	tagEnumerated  = 10
+	tagSequence    = 16
+	tagSet         = 17
+)
+
+// maxMessageSize largest message read, a larger one closes the connection
+const maxMessageSize = 1 << 20
+
+// ber errors
+var (
+	errTruncated  = errors.New("ber: truncated element")
+	errLength     = errors.New("ber: unsupported length")
+	errHighTag    = errors.New("ber: tag numbers above 30 are not supported")
+	errTooLarge   = errors.New("ber: message too large")
+	errNotInteger = errors.New("ber: invalid integer")
+)
+
+// element a decoded BER element of the subset LDAP uses, definite lengths and tags up to 30
+type element struct {
+	class       byte
+	constructed bool
+	tag         int
+	// data content octets
+	data []byte
+	// children decoded content of a constructed element
+	children []*element
+}
+
+// is reports whether the element has the class and tag
+func (e *element) is(class byte, tag int) bool {
+	return e.class == class && e.tag == tag
+}
+
+// str returns the content as a string
+func (e *element) str() string {
+	return string(e.data)
+}
+
+// integer returns the content as a two's complement integer
+func (e *element) integer() (int64, error) {
+	if len(e.data) == 0 || len(e.data) > 8 {
+		return 0, errNotInteger
+	}
+	n := int64(int8(e.data[0]))
+	for _, b := range e.data[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+// readElement reads the next element from r
+func readElement(r io.Reader) (*element, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int(header[1])
+	if length&0x80 != 0 {
+		size := make([]byte, length&0x7f)
+		if len(size) == 0 || len(size) > 4 {
+			return nil, errLength
+		}
+		if _, err := io.ReadFull(r, size); err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, b := range size {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxMessageSize {
+		return nil, errTooLarge
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return newElement(header[0], content)
+}
+
+// decodeElement decodes the element at the start of data returning the number of bytes it takes
+func decodeElement(data []byte) (*element, int, error) {
+	if len(data) < 2 {
+		return nil, 0, errTruncated
+	}
+	length, offset := int(data[1]), 2
+	if length&0x80 != 0 {
+		size := length & 0x7f
+		if size == 0 || size > 4 {
+			return nil, 0, errLength
+		}
+		if len(data) < offset+size {
+			return nil, 0, errTruncated
+		}
+		length = 0
+		for _, b := range data[offset : offset+size] {
+			length = length<<8 | int(b)
+		}
+		offset += size
+	}
+	if length < 0 || len(data)-offset < length {
+		return nil, 0, errTruncated
+	}
+	e, err := newElement(data[0], data[offset:offset+length])
+	return e, offset + length, err
+}
+
+// newElement creates the element of an identifier octet and its content, decoding the children of constructed elements
+func newElement(identifier byte, content []byte) (*element, error) {
+	if identifier&0x1f == 0x1f {
+		return nil, errHighTag
+	}
+	e := &element{
+		class:       identifier & 0xc0,
+		constructed: identifier&constructedBit != 0,
+		tag:         int(identifier & 0x1f),
+		data:        content,
+	}
+	for rest := content; e.constructed && len(rest) > 0; {
+		child, n, err := decodeElement(rest)
+		if err != nil {
+			return nil, err
+		}
+		e.children = append(e.children, child)
+		rest = rest[n:]
+	}
+	return e, nil
+}
+
+// encode returns an element with the given content
+func encode(class byte, constructed bool, tag int, content []byte) []byte {
+	identifier := class | byte(tag)
+	if constructed {
+		identifier |= constructedBit
+	}
+	b := []byte{identifier}
+	if len(content) < 0x80 {
+		b = append(b, byte(len(content)))
+	} else {
+		size := []byte{}
+		for n := len(content); n > 0; n >>= 8 {
+			size = append([]byte{byte(n)}, size...)
+		}
+		b = append(append(b, 0x80|byte(len(size))), size...)
+	}
+	return append(b, content...)
+}
+
+// encodeInteger returns an integer element in its shortest two's complement form
+func encodeInteger(class byte, tag int, n int64) []byte {
+	content := []byte{byte(n)}
+	for n < -0x80 || n >= 0x80 {
+		n >>= 8
+		content = append([]byte{byte(n)}, content...)
+	}
+	return encode(class, false, tag, content)
+}
+
+// encodeString returns an octet string element
+func encodeString(class byte, tag int, s string) []byte {
+	return encode(class, false, tag, []byte(s))
+}
+
+// encodeConstructed returns a constructed element holding children
+func encodeConstructed(class byte, tag int, children ...[]byte) []byte {
+	return encode(class, true, tag, bytes.Join(children, nil))
+}
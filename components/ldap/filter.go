@@ -0,0 +1,282 @@
+package ldap
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/squanchersquanch/contacts/components/ldif"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// filter choices, the context tags of the Filter of RFC 4511
+const (
+	filterAnd            = 0
+	filterOr             = 1
+	filterNot            = 2
+	filterEquality       = 3
+	filterSubstrings     = 4
+	filterGreaterOrEqual = 5
+	filterLessOrEqual    = 6
+	filterPresent        = 7
+	filterApprox         = 8
+	filterExtensible     = 9
+)
+
+// substring choices
+const (
+	substringInitial = 0
+	substringAny     = 1
+	substringFinal   = 2
+)
+
+// maxFilterDepth deepest nesting of and, or and not accepted
+const maxFilterDepth = 32
+
+// errFilter is returned for filters that are not encoded as RFC 4511 asks
+var errFilter = errors.New("invalid filter")
+
+// aliases long attribute names mapped to the short names entries are written with, keys are lower case
+var aliases = map[string]string{
+	"commonname":          "cn",
+	"surname":             "sn",
+	"rfc822mailbox":       "mail",
+	"email":               "mail",
+	"emailaddress":        "mail",
+	"organizationname":    "o",
+	"localityname":        "l",
+	"stateorprovincename": "st",
+	"streetaddress":       "street",
+	"countryname":         "c",
+}
+
+// canonical returns the lower case short name of an attribute description, options like ;lang-en are dropped
+func canonical(name string) string {
+	name = strings.ToLower(name)
+	if i := strings.IndexByte(name, ';'); i >= 0 {
+		name = name[:i]
+	}
+	if alias, ok := aliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// entry a directory entry returned by a search
+type entry struct {
+	dn         string
+	attributes []ldif.Attribute
+}
+
+// values returns the values of the attribute with the canonical name
+func (e entry) values(name string) []string {
+	values := []string{}
+	for _, attr := range e.attributes {
+		if canonical(attr.Name) == name {
+			values = append(values, attr.Value)
+		}
+	}
+	return values
+}
+
+// filter a decoded search filter, attribute holds the canonical name
+type filter struct {
+	choice    int
+	children  []*filter
+	attribute string
+	value     string
+	initial   string
+	any       []string
+	final     string
+}
+
+// parseFilter decodes the filter of a search request
+func parseFilter(e *element) (*filter, error) {
+	return parseFilterDepth(e, 0)
+}
+
+// parseFilterDepth decodes a filter nested depth levels deep
+func parseFilterDepth(e *element, depth int) (*filter, error) {
+	if e.class != classContext || depth > maxFilterDepth {
+		return nil, errFilter
+	}
+	f := &filter{choice: e.tag}
+	switch e.tag {
+	case filterAnd, filterOr:
+		if !e.constructed {
+			return nil, errFilter
+		}
+		for _, child := range e.children {
+			c, err := parseFilterDepth(child, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			f.children = append(f.children, c)
+		}
+	case filterNot:
+		if !e.constructed || len(e.children) != 1 {
+			return nil, errFilter
+		}
+		c, err := parseFilterDepth(e.children[0], depth+1)
+		if err != nil {
+			return nil, err
+		}
+		f.children = []*filter{c}
+	case filterEquality, filterGreaterOrEqual, filterLessOrEqual, filterApprox:
+		if !e.constructed || len(e.children) != 2 {
+			return nil, errFilter
+		}
+		f.attribute = canonical(e.children[0].str())
+		f.value = e.children[1].str()
+	case filterSubstrings:
+		if !e.constructed || len(e.children) != 2 || len(e.children[1].children) == 0 {
+			return nil, errFilter
+		}
+		f.attribute = canonical(e.children[0].str())
+		for _, s := range e.children[1].children {
+			switch s.tag {
+			case substringInitial:
+				f.initial = s.str()
+			case substringAny:
+				f.any = append(f.any, s.str())
+			case substringFinal:
+				f.final = s.str()
+			default:
+				return nil, errFilter
+			}
+		}
+	case filterPresent:
+		if e.constructed {
+			return nil, errFilter
+		}
+		f.attribute = canonical(e.str())
+	case filterExtensible:
+		// extensible matching rules are not supported, the filter matches nothing
+	default:
+		return nil, errFilter
+	}
+	return f, nil
+}
+
+// matches reports whether the filter selects the entry. Values are compared ignoring case,
+// telephone numbers also ignoring spaces and hyphens
+func (f *filter) matches(e entry) bool {
+	switch f.choice {
+	case filterAnd:
+		for _, c := range f.children {
+			if !c.matches(e) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, c := range f.children {
+			if c.matches(e) {
+				return true
+			}
+		}
+		return false
+	case filterNot:
+		return !f.children[0].matches(e)
+	case filterPresent:
+		return f.attribute == "objectclass" || len(e.values(f.attribute)) > 0
+	case filterExtensible:
+		return false
+	}
+
+	for _, value := range e.values(f.attribute) {
+		if f.matchValue(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchValue reports whether a single value of the attribute matches an assertion
+func (f *filter) matchValue(value string) bool {
+	normalize := f.normalizer()
+	value = normalize(value)
+	switch f.choice {
+	case filterEquality:
+		return value == normalize(f.value)
+	case filterApprox:
+		return strings.Join(strings.Fields(value), "") == strings.Join(strings.Fields(normalize(f.value)), "")
+	case filterGreaterOrEqual:
+		return value >= normalize(f.value)
+	case filterLessOrEqual:
+		return value <= normalize(f.value)
+	case filterSubstrings:
+		if !strings.HasPrefix(value, normalize(f.initial)) {
+			return false
+		}
+		value = value[len(normalize(f.initial)):]
+		for _, s := range f.any {
+			s = normalize(s)
+			i := strings.Index(value, s)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(s):]
+		}
+		return strings.HasSuffix(value, normalize(f.final))
+	}
+	return false
+}
+
+// normalizer returns the function values of the attribute are compared after
+func (f *filter) normalizer() func(string) string {
+	if f.attribute == "telephonenumber" {
+		return func(s string) string {
+			return strings.NewReplacer(" ", "", "-", "").Replace(strings.ToLower(s))
+		}
+	}
+	return strings.ToLower
+}
+
+// contactFilter returns a store filter selecting a superset of the contacts the filter matches,
+// so fewer contacts are read. Only equality and substring assertions at the top level or in a
+// top level and are used, everything else is left to matches
+func (f *filter) contactFilter() models.ContactFilter {
+	cf := models.ContactFilter{}
+	assertions := []*filter{f}
+	if f.choice == filterAnd {
+		assertions = f.children
+	}
+	query := func(s string) {
+		if len(s) > len(cf.Query) {
+			cf.Query = s
+		}
+	}
+	for _, a := range assertions {
+		switch {
+		case a.choice == filterEquality && a.attribute == "o":
+			cf.Organization = a.value
+		case a.choice == filterEquality && a.attribute == "l":
+			cf.City = a.value
+		case a.choice == filterEquality && a.attribute == "st":
+			cf.Region = a.value
+		case a.choice == filterEquality && queryAttribute(a.attribute, a.value):
+			query(a.value)
+		case a.choice == filterSubstrings:
+			for _, s := range append([]string{a.initial, a.final}, a.any...) {
+				if queryAttribute(a.attribute, s) {
+					query(s)
+				}
+			}
+		}
+	}
+	return cf
+}
+
+// queryAttribute reports whether every contact with value in the attribute is found by
+// a store query for value. The query searches the names, email and organization separately
+// so values of cn spanning both names can not be used
+func queryAttribute(attribute, value string) bool {
+	switch attribute {
+	case "givenname", "mail", "o":
+		return true
+	case "cn", "sn":
+		// cn and sn fall back to the email and the whole name
+		return !strings.Contains(value, " ")
+	}
+	return false
+}
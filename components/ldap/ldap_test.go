@@ -0,0 +1,314 @@
+package ldap
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/squanchersquanch/contacts/components/ldif"
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// octets returns an octet string element
+func octets(s string) []byte {
+	return encodeString(classUniversal, tagOctetString, s)
+}
+
+// and, or, not, eq, sub and present encode filters
+func and(filters ...[]byte) []byte {
+	return encodeConstructed(classContext, filterAnd, filters...)
+}
+
+func or(filters ...[]byte) []byte {
+	return encodeConstructed(classContext, filterOr, filters...)
+}
+
+func not(filter []byte) []byte {
+	return encodeConstructed(classContext, filterNot, filter)
+}
+
+func eq(attribute, value string) []byte {
+	return encodeConstructed(classContext, filterEquality, octets(attribute), octets(value))
+}
+
+func sub(attribute, initial string, any []string, final string) []byte {
+	pieces := [][]byte{}
+	if initial != "" {
+		pieces = append(pieces, encodeString(classContext, substringInitial, initial))
+	}
+	for _, s := range any {
+		pieces = append(pieces, encodeString(classContext, substringAny, s))
+	}
+	if final != "" {
+		pieces = append(pieces, encodeString(classContext, substringFinal, final))
+	}
+	return encodeConstructed(classContext, filterSubstrings, octets(attribute), encodeConstructed(classUniversal, tagSequence, pieces...))
+}
+
+func present(attribute string) []byte {
+	return encodeString(classContext, filterPresent, attribute)
+}
+
+// decode decodes a single element
+func decode(t *testing.T, data []byte) *element {
+	e, n, err := decodeElement(data)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	return e
+}
+
+func TestBER(t *testing.T) {
+	for _, n := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 65535, 1 << 40} {
+		e := decode(t, encodeInteger(classUniversal, tagInteger, n))
+		got, err := e.integer()
+		assert.NoError(t, err)
+		assert.Equal(t, n, got)
+	}
+	assert.Equal(t, []byte{0x02, 0x02, 0x00, 0x80}, encodeInteger(classUniversal, tagInteger, 128))
+	assert.Equal(t, []byte{0x02, 0x01, 0xff}, encodeInteger(classUniversal, tagInteger, -1))
+
+	long := string(bytes.Repeat([]byte("a"), 300))
+	e := decode(t, encodeConstructed(classApplication, opSearchRequest, octets("x"), octets(long)))
+	assert.True(t, e.is(classApplication, opSearchRequest))
+	assert.True(t, e.constructed)
+	assert.Len(t, e.children, 2)
+	assert.Equal(t, long, e.children[1].str())
+
+	e, err := readElement(bytes.NewReader(encodeConstructed(classUniversal, tagSequence, octets("x"))))
+	assert.NoError(t, err)
+	assert.Equal(t, "x", e.children[0].str())
+
+	_, _, err = decodeElement([]byte{0x04, 0x05, 'a'})
+	assert.Equal(t, errTruncated, err)
+	_, _, err = decodeElement([]byte{0x04, 0x80})
+	assert.Equal(t, errLength, err)
+	_, err = readElement(bytes.NewReader([]byte{0x30, 0x84, 0x7f, 0xff, 0xff, 0xff}))
+	assert.Equal(t, errTooLarge, err)
+}
+
+func TestFilter(t *testing.T) {
+	contact := models.Contact{FirstName: "John", LastName: "Doe", Email: "john@acme.com", Phone: "+1 555-0100", Organization: "Acme", City: "Springfield"}
+	e := entry{dn: ldif.DN(contact, "ou=contacts"), attributes: ldif.Attributes(contact)}
+
+	tests := []struct {
+		name    string
+		filter  []byte
+		matches bool
+		query   models.ContactFilter
+	}{
+		{"equality", eq("mail", "JOHN@acme.com"), true, models.ContactFilter{Query: "JOHN@acme.com"}},
+		{"alias", eq("commonName", "john doe"), true, models.ContactFilter{}},
+		{"object class", eq("objectClass", "inetOrgPerson"), true, models.ContactFilter{}},
+		{"present", present("telephoneNumber"), true, models.ContactFilter{}},
+		{"missing", present("postalCode"), false, models.ContactFilter{}},
+		{"initial", sub("cn", "jo", nil, ""), true, models.ContactFilter{Query: "jo"}},
+		{"final", sub("mail", "", nil, "@acme.com"), true, models.ContactFilter{Query: "@acme.com"}},
+		{"any", sub("sn", "", []string{"do"}, "e"), true, models.ContactFilter{Query: "do"}},
+		{"no match", sub("cn", "ja", nil, ""), false, models.ContactFilter{Query: "ja"}},
+		{"phone", sub("telephoneNumber", "", []string{"5550100"}, ""), true, models.ContactFilter{}},
+		{"or", or(sub("cn", "jo", nil, ""), sub("mail", "", nil, "@acme.com")), true, models.ContactFilter{}},
+		{"and", and(eq("o", "acme"), eq("l", "Springfield"), sub("cn", "", []string{"john d"}, "")), true,
+			models.ContactFilter{Organization: "acme", City: "Springfield"}},
+		{"not", not(eq("o", "acme")), false, models.ContactFilter{}},
+	}
+	for _, test := range tests {
+		f, err := parseFilter(decode(t, test.filter))
+		if !assert.NoError(t, err, test.name) {
+			continue
+		}
+		assert.Equal(t, test.matches, f.matches(e), test.name)
+		assert.Equal(t, test.query, f.contactFilter(), test.name)
+		if test.matches {
+			assert.True(t, f.contactFilter().Matches(contact), test.name)
+		}
+	}
+
+	_, err := parseFilter(decode(t, encodeConstructed(classContext, filterNot, eq("cn", "a"), eq("cn", "b"))))
+	assert.Equal(t, errFilter, err)
+	_, err = parseFilter(decode(t, octets("cn=john")))
+	assert.Equal(t, errFilter, err)
+}
+
+func TestDN(t *testing.T) {
+	assert.True(t, equalDN("mail=John@Acme.com, OU=Contacts", "mail=john@acme.com,ou=contacts"))
+	assert.True(t, equalDN(`cn=Doe\2C John,ou=contacts`, `commonName=doe\, john,ou=contacts`))
+	assert.False(t, equalDN("ou=contacts", "ou=people"))
+
+	rdn, parent := splitRDN(`mail=a\,b@acme.com,ou=contacts,dc=example`)
+	assert.Equal(t, `mail=a\,b@acme.com`, rdn)
+	assert.Equal(t, "ou=contacts,dc=example", parent)
+	assert.Equal(t, "a,b@acme.com", unescapeValue(rdnValue(rdn)))
+}
+
+// client a connection to a test server
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	id   int64
+}
+
+// request sends an operation and returns the protocol operations of the responses up to the one with the done tag
+func (c *client) request(op []byte, done int) []*element {
+	c.id++
+	_, err := c.conn.Write(encodeConstructed(classUniversal, tagSequence, encodeInteger(classUniversal, tagInteger, c.id), op))
+	assert.NoError(c.t, err)
+	responses := []*element{}
+	for {
+		packet, err := readElement(c.conn)
+		if !assert.NoError(c.t, err) {
+			return responses
+		}
+		id, response, err := parseMessage(packet)
+		assert.NoError(c.t, err)
+		assert.Equal(c.t, c.id, id)
+		responses = append(responses, response)
+		if response.tag == done {
+			return responses
+		}
+	}
+}
+
+// bind sends a simple bind and returns its result code
+func (c *client) bind(name, password string) int64 {
+	responses := c.request(encodeConstructed(classApplication, opBindRequest,
+		encodeInteger(classUniversal, tagInteger, 3), octets(name), encodeString(classContext, 0, password)), opBindResponse)
+	return resultCode(c.t, responses[len(responses)-1])
+}
+
+// search sends a search and returns the entries found and the result code
+func (c *client) search(base string, scope int, sizeLimit int64, filter []byte, attributes ...string) ([]entry, int64) {
+	selection := [][]byte{}
+	for _, a := range attributes {
+		selection = append(selection, octets(a))
+	}
+	responses := c.request(encodeConstructed(classApplication, opSearchRequest,
+		octets(base),
+		encodeInteger(classUniversal, tagEnumerated, int64(scope)),
+		encodeInteger(classUniversal, tagEnumerated, 0),
+		encodeInteger(classUniversal, tagInteger, sizeLimit),
+		encodeInteger(classUniversal, tagInteger, 0),
+		encode(classUniversal, false, tagBoolean, []byte{0}),
+		filter,
+		encodeConstructed(classUniversal, tagSequence, selection...)), opSearchResultDone)
+
+	entries := []entry{}
+	for _, r := range responses[:len(responses)-1] {
+		e := entry{dn: r.children[0].str()}
+		for _, attr := range r.children[1].children {
+			for _, value := range attr.children[1].children {
+				e.attributes = append(e.attributes, ldif.Attribute{Name: attr.children[0].str(), Value: value.str()})
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, resultCode(c.t, responses[len(responses)-1])
+}
+
+// resultCode returns the result code of an LDAPResult
+func resultCode(t *testing.T, response *element) int64 {
+	code, err := response.children[0].integer()
+	assert.NoError(t, err)
+	return code
+}
+
+// dial starts a server for contacts and connects to it
+func dial(t *testing.T, contacts []models.Contact, opts Options) (*client, func()) {
+	s := store.NewMemoryStore()
+	for _, contact := range contacts {
+		_, err := s.Create(context.Background(), contact)
+		assert.NoError(t, err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go NewServer(s, opts).Serve(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	return &client{t: t, conn: conn}, func() {
+		conn.Close()
+		l.Close()
+	}
+}
+
+// dns returns the names of entries
+func dns(entries []entry) []string {
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.dn)
+	}
+	return names
+}
+
+func TestServer(t *testing.T) {
+	contacts := []models.Contact{
+		{FirstName: "John", LastName: "Doe", Email: "john@acme.com", Phone: "+15550100", Organization: "Acme"},
+		{FirstName: "Jane", LastName: "Roe", Email: "jane@example.com", Phone: "+15550101"},
+		{FirstName: "Joan", LastName: "Poe", Email: "joan@acme.com", Phone: "+15550102", Organization: "Acme"},
+	}
+	c, stop := dial(t, contacts, Options{BaseDN: "ou=contacts,dc=example,dc=com"})
+	defer stop()
+	base := "ou=contacts,dc=example,dc=com"
+
+	assert.EqualValues(t, resultSuccess, c.bind("", ""))
+
+	entries, code := c.search(base, scopeSub, 0, or(sub("cn", "jo", nil, ""), sub("mail", "", nil, "@acme.com")), "cn", "mail")
+	assert.EqualValues(t, resultSuccess, code)
+	assert.ElementsMatch(t, []string{"mail=john@acme.com," + base, "mail=joan@acme.com," + base}, dns(entries))
+	for _, e := range entries {
+		assert.Len(t, e.attributes, 2)
+	}
+
+	entries, code = c.search(base, scopeOne, 0, eq("objectClass", "inetOrgPerson"), "1.1")
+	assert.EqualValues(t, resultSuccess, code)
+	assert.Len(t, entries, 3)
+	assert.Empty(t, entries[0].attributes)
+
+	entries, code = c.search(base, scopeSub, 0, present("objectClass"))
+	assert.EqualValues(t, resultSuccess, code)
+	assert.Len(t, entries, 4)
+
+	entries, code = c.search(base, scopeSub, 2, present("mail"))
+	assert.EqualValues(t, resultSizeLimitExceeded, code)
+	assert.Len(t, entries, 2)
+
+	entries, code = c.search("MAIL=Jane@example.com, "+base, scopeBase, 0, present("objectClass"))
+	assert.EqualValues(t, resultSuccess, code)
+	if assert.Len(t, entries, 1) {
+		assert.Contains(t, entries[0].attributes, ldif.Attribute{Name: "telephoneNumber", Value: "+15550101"})
+	}
+
+	_, code = c.search("mail=nobody@example.com,"+base, scopeBase, 0, present("objectClass"))
+	assert.EqualValues(t, resultNoSuchObject, code)
+	_, code = c.search("ou=people,dc=example,dc=com", scopeSub, 0, present("objectClass"))
+	assert.EqualValues(t, resultNoSuchObject, code)
+
+	entries, code = c.search("", scopeBase, 0, present("objectClass"), "namingContexts")
+	assert.EqualValues(t, resultSuccess, code)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, []ldif.Attribute{{Name: "namingContexts", Value: base}}, entries[0].attributes)
+	}
+
+	responses := c.request(encodeString(classApplication, opDelRequest, "mail=john@acme.com,"+base), opDelRequest+1)
+	assert.EqualValues(t, resultUnwillingToPerform, resultCode(t, responses[0]))
+}
+
+func TestServerBind(t *testing.T) {
+	contacts := []models.Contact{{FirstName: "John", LastName: "Doe", Email: "john@acme.com"}}
+	c, stop := dial(t, contacts, Options{BindDN: "cn=phone,ou=devices", Password: "secret"})
+	defer stop()
+
+	_, code := c.search("ou=contacts", scopeSub, 0, present("objectClass"))
+	assert.EqualValues(t, resultInsufficientAccessRights, code)
+
+	assert.EqualValues(t, resultInvalidCredentials, c.bind("cn=phone,ou=devices", "wrong"))
+	assert.EqualValues(t, resultUnwillingToPerform, c.bind("cn=phone,ou=devices", ""))
+	_, code = c.search("ou=contacts", scopeSub, 0, present("objectClass"))
+	assert.EqualValues(t, resultInsufficientAccessRights, code)
+
+	assert.EqualValues(t, resultSuccess, c.bind("CN=phone, ou=devices", "secret"))
+	entries, code := c.search("ou=contacts", scopeSub, 0, sub("cn", "", []string{"doe"}, ""))
+	assert.EqualValues(t, resultSuccess, code)
+	assert.Equal(t, []string{"mail=john@acme.com,ou=contacts"}, dns(entries))
+}
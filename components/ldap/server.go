@@ -0,0 +1,498 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/squanchersquanch/contacts/components/ldif"
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// protocol operations, the application tags of RFC 4511
+const (
+	opBindRequest       = 0
+	opBindResponse      = 1
+	opUnbindRequest     = 2
+	opSearchRequest     = 3
+	opSearchResultEntry = 4
+	opSearchResultDone  = 5
+	opModifyRequest     = 6
+	opAddRequest        = 8
+	opDelRequest        = 10
+	opModifyDNRequest   = 12
+	opCompareRequest    = 14
+	opAbandonRequest    = 16
+	opExtendedRequest   = 23
+	opExtendedResponse  = 24
+)
+
+// result codes
+const (
+	resultSuccess                  = 0
+	resultProtocolError            = 2
+	resultTimeLimitExceeded        = 3
+	resultSizeLimitExceeded        = 4
+	resultAuthMethodNotSupported   = 7
+	resultNoSuchObject             = 32
+	resultInvalidCredentials       = 49
+	resultInsufficientAccessRights = 50
+	resultUnwillingToPerform       = 53
+	resultOther                    = 80
+)
+
+// search scopes
+const (
+	scopeBase = 0
+	scopeOne  = 1
+	scopeSub  = 2
+)
+
+// option defaults
+const (
+	defaultBaseDN    = "ou=contacts"
+	defaultSizeLimit = 500
+)
+
+// connection timing constants
+const (
+	// idleTimeout connections without a request for this long are closed
+	idleTimeout = 5 * time.Minute
+	// writeTimeout time a client has to read a response
+	writeTimeout = 30 * time.Second
+	// searchTimeout longest a search runs when the client asks for no shorter time limit
+	searchTimeout = 30 * time.Second
+	// acceptDelay wait after a temporary error accepting a connection
+	acceptDelay = 50 * time.Millisecond
+)
+
+// message errors
+var (
+	errMessage   = errors.New("invalid ldap message")
+	errSizeLimit = errors.New("size limit exceeded")
+)
+
+// Options configure a Server, empty values use the defaults
+type Options struct {
+	// BaseDN entry the contacts are listed below, defaults to ou=contacts
+	BaseDN string
+	// BindDN and Password a client binds with to search, any client may search when BindDN is empty
+	BindDN   string
+	Password string
+	// SizeLimit most entries a search returns, defaults to 500
+	SizeLimit int
+}
+
+// Server answers LDAP bind and search requests with the contacts of a store, it is read only
+type Server interface {
+	// Serve answers the connections accepted on l until it fails or is closed
+	Serve(l net.Listener) error
+	// ListenAndServe listens on the tcp address addr and serves its connections
+	ListenAndServe(addr string) error
+}
+
+// server is the implementation of the Server interface
+type server struct {
+	store     store.Store
+	baseDN    string
+	bindDN    string
+	password  string
+	sizeLimit int
+}
+
+// NewServer creates a Server listing every contact of store as an inetOrgPerson entry below the base DN,
+// named by ldif.DN. Search filters are matched against the attributes of ldif.Attributes
+func NewServer(store store.Store, opts Options) Server {
+	if opts.BaseDN == "" {
+		opts.BaseDN = defaultBaseDN
+	}
+	if opts.SizeLimit <= 0 {
+		opts.SizeLimit = defaultSizeLimit
+	}
+	return &server{
+		store:     store,
+		baseDN:    opts.BaseDN,
+		bindDN:    opts.BindDN,
+		password:  opts.Password,
+		sizeLimit: opts.SizeLimit,
+	}
+}
+
+// ListenAndServe listens on addr and serves its connections
+func (s *server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve answers every connection accepted on l in its own goroutine
+func (s *server) Serve(l net.Listener) error {
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(acceptDelay)
+				continue
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// session a client connection, bound reports whether it may search
+type session struct {
+	conn  net.Conn
+	w     *bufio.Writer
+	bound bool
+}
+
+// send writes an LDAPMessage with the id and protocol operation
+func (sess *session) send(id int64, op []byte) error {
+	sess.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := sess.w.Write(encodeConstructed(classUniversal, tagSequence, encodeInteger(classUniversal, tagInteger, id), op))
+	return err
+}
+
+// serveConn answers the requests of a connection one after another until it is unbound, closed or sends an invalid message
+func (s *server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	sess := &session{conn: conn, w: bufio.NewWriter(conn), bound: s.bindDN == ""}
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		packet, err := readElement(r)
+		if err != nil {
+			if ne, ok := err.(net.Error); err != io.EOF && (!ok || !ne.Timeout()) {
+				log.Printf("ldap error: %s", err)
+			}
+			return
+		}
+		id, op, err := parseMessage(packet)
+		if err != nil {
+			log.Printf("ldap error: %s", err)
+			return
+		}
+		if !s.handle(sess, id, op) {
+			return
+		}
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := sess.w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// parseMessage returns the message id and protocol operation of an LDAPMessage, controls are ignored
+func parseMessage(packet *element) (int64, *element, error) {
+	if !packet.is(classUniversal, tagSequence) || len(packet.children) < 2 ||
+		!packet.children[0].is(classUniversal, tagInteger) {
+		return 0, nil, errMessage
+	}
+	id, err := packet.children[0].integer()
+	if err != nil {
+		return 0, nil, errMessage
+	}
+	return id, packet.children[1], nil
+}
+
+// handle answers a request, it returns false when the connection is to be closed
+func (s *server) handle(sess *session, id int64, op *element) bool {
+	if op.class != classApplication {
+		return false
+	}
+	switch op.tag {
+	case opBindRequest:
+		return s.bind(sess, id, op) == nil
+	case opUnbindRequest:
+		return false
+	case opSearchRequest:
+		return s.search(sess, id, op) == nil
+	case opAbandonRequest:
+		// requests are answered in order so there is never one left to abandon
+		return true
+	case opModifyRequest, opAddRequest, opDelRequest, opModifyDNRequest, opCompareRequest:
+		// every response tag follows the tag of its request
+		return sess.send(id, result(op.tag+1, resultUnwillingToPerform, "the directory is read only")) == nil
+	case opExtendedRequest:
+		return sess.send(id, result(opExtendedResponse, resultProtocolError, "extended operations are not supported")) == nil
+	}
+	return false
+}
+
+// result returns an LDAPResult with the operation tag op
+func result(op, code int, message string) []byte {
+	return encodeConstructed(classApplication, op,
+		encodeInteger(classUniversal, tagEnumerated, int64(code)),
+		encodeString(classUniversal, tagOctetString, ""),
+		encodeString(classUniversal, tagOctetString, message))
+}
+
+// bind authenticates a session with a simple bind. Anonymous binds succeed but only allow
+// searching when no bind DN is configured, in which case any simple bind is accepted
+func (s *server) bind(sess *session, id int64, op *element) error {
+	if !op.constructed || len(op.children) != 3 {
+		return sess.send(id, result(opBindResponse, resultProtocolError, "invalid bind request"))
+	}
+	version, err := op.children[0].integer()
+	name, auth := op.children[1].str(), op.children[2]
+
+	sess.bound = s.bindDN == ""
+	code, message := resultSuccess, ""
+	switch {
+	case err != nil || version != 2 && version != 3:
+		code, message = resultProtocolError, "only LDAP versions 2 and 3 are supported"
+	case !auth.is(classContext, 0):
+		code, message = resultAuthMethodNotSupported, "only simple binds are supported"
+	case name != "" && len(auth.data) == 0:
+		code, message = resultUnwillingToPerform, "unauthenticated binds are not allowed"
+	case s.bindDN == "" || name == "":
+	case equalDN(name, s.bindDN) && subtle.ConstantTimeCompare(auth.data, []byte(s.password)) == 1:
+		sess.bound = true
+	default:
+		code = resultInvalidCredentials
+	}
+	return sess.send(id, result(opBindResponse, code, message))
+}
+
+// search sends the entries matching a search request followed by its result, an error is returned
+// only when the connection failed
+func (s *server) search(sess *session, id int64, op *element) error {
+	done := func(code int, message string) error {
+		return sess.send(id, result(opSearchResultDone, code, message))
+	}
+	if !op.constructed || len(op.children) != 8 {
+		return done(resultProtocolError, "invalid search request")
+	}
+	if !sess.bound {
+		return done(resultInsufficientAccessRights, "bind before searching")
+	}
+	base := op.children[0].str()
+	scope, scopeErr := op.children[1].integer()
+	sizeLimit, sizeErr := op.children[3].integer()
+	timeLimit, timeErr := op.children[4].integer()
+	typesOnly := len(op.children[5].data) == 1 && op.children[5].data[0] != 0
+	f, filterErr := parseFilter(op.children[6])
+	if scopeErr != nil || sizeErr != nil || timeErr != nil || filterErr != nil || scope < scopeBase || scope > scopeSub {
+		return done(resultProtocolError, "invalid search request")
+	}
+	attributes := []string{}
+	for _, a := range op.children[7].children {
+		attributes = append(attributes, a.str())
+	}
+
+	limit := s.sizeLimit
+	if sizeLimit > 0 && sizeLimit < int64(limit) {
+		limit = int(sizeLimit)
+	}
+	timeout := searchTimeout
+	if timeLimit > 0 && timeLimit < int64(searchTimeout/time.Second) {
+		timeout = time.Duration(timeLimit) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	sent := 0
+	var sendErr error
+	send := func(e entry) error {
+		if !f.matches(e) {
+			return nil
+		}
+		if sent == limit {
+			return errSizeLimit
+		}
+		sent++
+		sendErr = sess.send(id, searchEntry(e, attributes, typesOnly))
+		return sendErr
+	}
+	contacts := func(filter models.ContactFilter, match func(models.Contact) bool) error {
+		return s.store.Each(ctx, filter, func(contact models.Contact) error {
+			if !match(contact) {
+				return nil
+			}
+			return send(entry{dn: ldif.DN(contact, s.baseDN), attributes: ldif.Attributes(contact)})
+		})
+	}
+
+	var err error
+	rdn, parent := splitRDN(base)
+	switch {
+	case base == "" && scope == scopeBase:
+		err = send(s.rootDSE())
+	case equalDN(base, s.baseDN):
+		if scope != scopeOne {
+			err = send(s.baseEntry())
+		}
+		if err == nil && scope != scopeBase {
+			err = contacts(f.contactFilter(), func(models.Contact) bool { return true })
+		}
+	case equalDN(parent, s.baseDN) && canonical(rdnAttribute(rdn)) == "mail":
+		// a single contact, which has no entries below it
+		email := unescapeValue(rdnValue(rdn))
+		found := false
+		err = contacts(models.ContactFilter{Query: email}, func(contact models.Contact) bool {
+			match := strings.EqualFold(contact.Email, email)
+			found = found || match
+			return match && scope != scopeOne
+		})
+		if err == nil && !found {
+			return done(resultNoSuchObject, "")
+		}
+	default:
+		return done(resultNoSuchObject, "")
+	}
+
+	switch {
+	case sendErr != nil:
+		return sendErr
+	case err == errSizeLimit:
+		return done(resultSizeLimitExceeded, "")
+	case ctx.Err() == context.DeadlineExceeded:
+		return done(resultTimeLimitExceeded, "")
+	case err != nil:
+		log.Printf("ldap error: %s", err)
+		return done(resultOther, "the search failed")
+	}
+	return done(resultSuccess, "")
+}
+
+// rootDSE returns the entry describing the server
+func (s *server) rootDSE() entry {
+	return entry{attributes: []ldif.Attribute{
+		{Name: "objectClass", Value: "top"},
+		{Name: "namingContexts", Value: s.baseDN},
+		{Name: "supportedLDAPVersion", Value: "2"},
+		{Name: "supportedLDAPVersion", Value: "3"},
+	}}
+}
+
+// baseEntry returns the entry the contacts are listed below
+func (s *server) baseEntry() entry {
+	rdn, _ := splitRDN(s.baseDN)
+	attribute, value := rdnAttribute(rdn), unescapeValue(rdnValue(rdn))
+	class := map[string]string{"ou": "organizationalUnit", "o": "organization", "dc": "domain"}[canonical(attribute)]
+	if class == "" {
+		class = "extensibleObject"
+	}
+	return entry{dn: s.baseDN, attributes: []ldif.Attribute{
+		{Name: "objectClass", Value: "top"},
+		{Name: "objectClass", Value: class},
+		{Name: attribute, Value: value},
+	}}
+}
+
+// searchEntry returns a SearchResultEntry with the selected attributes of e, only their names when typesOnly is set
+func searchEntry(e entry, selection []string, typesOnly bool) []byte {
+	names := []string{}
+	values := map[string][][]byte{}
+	for _, attr := range e.attributes {
+		if !selected(selection, attr.Name) {
+			continue
+		}
+		if _, ok := values[attr.Name]; !ok {
+			names = append(names, attr.Name)
+			values[attr.Name] = [][]byte{}
+		}
+		if !typesOnly {
+			values[attr.Name] = append(values[attr.Name], encodeString(classUniversal, tagOctetString, attr.Value))
+		}
+	}
+	attributes := [][]byte{}
+	for _, name := range names {
+		attributes = append(attributes, encodeConstructed(classUniversal, tagSequence,
+			encodeString(classUniversal, tagOctetString, name),
+			encodeConstructed(classUniversal, tagSet, values[name]...)))
+	}
+	return encodeConstructed(classApplication, opSearchResultEntry,
+		encodeString(classUniversal, tagOctetString, e.dn),
+		encodeConstructed(classUniversal, tagSequence, attributes...))
+}
+
+// selected reports whether a search asking for the attributes in selection returns the attribute name,
+// all attributes are returned when it is empty or holds * and none when it only holds 1.1
+func selected(selection []string, name string) bool {
+	if len(selection) == 0 {
+		return true
+	}
+	for _, s := range selection {
+		if s == "*" || canonical(s) == canonical(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitRDN splits dn into its first relative distinguished name and the dn of its parent
+func splitRDN(dn string) (string, string) {
+	for i := 0; i < len(dn); i++ {
+		switch dn[i] {
+		case '\\':
+			i++
+		case ',':
+			return dn[:i], dn[i+1:]
+		}
+	}
+	return dn, ""
+}
+
+// rdnAttribute returns the attribute name of a relative distinguished name
+func rdnAttribute(rdn string) string {
+	if i := strings.IndexByte(rdn, '='); i >= 0 {
+		return strings.TrimSpace(rdn[:i])
+	}
+	return ""
+}
+
+// rdnValue returns the escaped attribute value of a relative distinguished name
+func rdnValue(rdn string) string {
+	if i := strings.IndexByte(rdn, '='); i >= 0 {
+		return strings.TrimSpace(rdn[i+1:])
+	}
+	return ""
+}
+
+// unescapeValue removes the escaping of RFC 4514 from an attribute value
+func unescapeValue(value string) string {
+	b := []byte{}
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			if i+2 < len(value) {
+				if decoded, err := hex.DecodeString(value[i+1 : i+3]); err == nil {
+					b = append(b, decoded[0])
+					i += 2
+					continue
+				}
+			}
+			i++
+		}
+		b = append(b, value[i])
+	}
+	return string(b)
+}
+
+// normalizeDN returns dn with canonical attribute names and lower case unescaped values so equal names compare equal
+func normalizeDN(dn string) string {
+	rdns := []string{}
+	for rest := strings.TrimSpace(dn); rest != ""; {
+		var rdn string
+		rdn, rest = splitRDN(rest)
+		rdns = append(rdns, canonical(rdnAttribute(rdn))+"="+strings.ToLower(unescapeValue(rdnValue(rdn))))
+	}
+	return strings.Join(rdns, ",")
+}
+
+// equalDN reports whether two distinguished names are equal
+func equalDN(a, b string) bool {
+	return normalizeDN(a) == normalizeDN(b)
+}
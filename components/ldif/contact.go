@@ -0,0 +1,188 @@
+package ldif
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// encoding constants
+const (
+	// foldLength lines longer than this many octets are folded
+	foldLength = 76
+	// objectClasses written for every entry, inetOrgPerson holds every exported attribute
+	objectClasses = "top person organizationalPerson inetOrgPerson"
+)
+
+// ToContact maps the inetOrgPerson attributes of entry to a contact, the contact has no id.
+// The name falls back to cn when givenName and sn are missing and the phone to mobile,
+// attributes written by Thunderbird and OpenLDAP use the same names
+func ToContact(entry *Entry) models.Contact {
+	contact := models.Contact{
+		FirstName:    entry.Get("givenName"),
+		LastName:     entry.Get("sn"),
+		Email:        entry.Get("mail"),
+		Phone:        entry.Get("telephoneNumber"),
+		Organization: entry.Get("o"),
+		Note:         entry.Get("description"),
+		Street:       entry.Get("street"),
+		City:         entry.Get("l"),
+		Region:       entry.Get("st"),
+		PostalCode:   entry.Get("postalCode"),
+		Country:      entry.Get("c"),
+	}
+	if contact.FirstName == "" && contact.LastName == "" {
+		name := strings.Fields(entry.Get("cn"))
+		if len(name) > 0 {
+			contact.LastName = name[len(name)-1]
+			contact.FirstName = strings.Join(name[:len(name)-1], " ")
+		}
+	}
+	if contact.Phone == "" {
+		contact.Phone = entry.Get("mobile")
+	}
+	return contact
+}
+
+// Encode writes contacts as inetOrgPerson entries named by DN with their Attributes
+func Encode(w io.Writer, contacts []models.Contact, baseDN string) error {
+	bw := bufio.NewWriter(w)
+	for _, contact := range contacts {
+		if _, err := bw.WriteString(entryText(contact, baseDN)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Header returns the version line starting an LDIF file
+func Header() string {
+	return "version: 1\n\n"
+}
+
+// Attribute a single value of an entry
+type Attribute struct {
+	Name  string
+	Value string
+}
+
+// DN returns the distinguished name of the entry of contact, mail=<email> below baseDN or without a base when it is empty
+func DN(contact models.Contact, baseDN string) string {
+	dn := "mail=" + escapeDN(contact.Email)
+	if baseDN != "" {
+		dn += "," + baseDN
+	}
+	return dn
+}
+
+// Attributes returns the objectClass and inetOrgPerson attributes of the entry of contact in the order they are written,
+// empty fields are left out. The country is not included since inetOrgPerson has no country attribute
+func Attributes(contact models.Contact) []Attribute {
+	cn := strings.TrimSpace(contact.FirstName + " " + contact.LastName)
+	if cn == "" {
+		cn = contact.Email
+	}
+	sn := contact.LastName
+	if sn == "" {
+		// sn is required by person
+		sn = cn
+	}
+
+	attributes := []Attribute{}
+	for _, class := range strings.Fields(objectClasses) {
+		attributes = append(attributes, Attribute{"objectClass", class})
+	}
+	for _, attr := range []Attribute{
+		{"cn", cn},
+		{"givenName", contact.FirstName},
+		{"sn", sn},
+		{"mail", contact.Email},
+		{"telephoneNumber", contact.Phone},
+		{"o", contact.Organization},
+		{"description", contact.Note},
+		{"street", contact.Street},
+		{"l", contact.City},
+		{"st", contact.Region},
+		{"postalCode", contact.PostalCode},
+	} {
+		if attr.Value != "" {
+			attributes = append(attributes, attr)
+		}
+	}
+	return attributes
+}
+
+// entryText returns the folded lines of the entry for contact followed by a blank line
+func entryText(contact models.Contact, baseDN string) string {
+	var b strings.Builder
+	b.WriteString(attribute("dn", DN(contact, baseDN)))
+	for _, attr := range Attributes(contact) {
+		b.WriteString(attribute(attr.Name, attr.Value))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// attribute returns the folded line of an attribute, values that are not safe strings are base64 encoded
+func attribute(name, value string) string {
+	l := name + ": " + value
+	if !isSafe(value) {
+		l = name + ":: " + base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	return fold(l) + "\n"
+}
+
+// isSafe reports whether value can be written as is, it must be ascii without line breaks
+// and must not start with a space, colon or less than sign nor end with a space
+func isSafe(value string) bool {
+	if value == "" {
+		return true
+	}
+	if strings.IndexAny(value[:1], " :<") == 0 || strings.HasSuffix(value, " ") {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c == 0 || c == '\n' || c == '\r' || c > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+// fold splits a line longer than foldLength into continuation lines starting with a space
+func fold(l string) string {
+	if len(l) <= foldLength {
+		return l
+	}
+	var b strings.Builder
+	b.WriteString(l[:foldLength])
+	for l = l[foldLength:]; len(l) > 0; {
+		n := foldLength - 1
+		if n > len(l) {
+			n = len(l)
+		}
+		b.WriteString("\n ")
+		b.WriteString(l[:n])
+		l = l[n:]
+	}
+	return b.String()
+}
+
+// escapeDN escapes an attribute value for use in a distinguished name following RFC 4514
+func escapeDN(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case strings.IndexByte(`,+"\<>;=`, c) >= 0,
+			c == '#' && i == 0,
+			c == ' ' && (i == 0 || i == len(value)-1):
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
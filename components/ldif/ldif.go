@@ -0,0 +1,183 @@
+package ldif
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxLineLength longest physical line read, longer values are expected to be folded
+const maxLineLength = 1 << 20
+
+// Entry a single record of an LDIF file
+type Entry struct {
+	// Index position of the entry in the file counting from 0
+	Index int
+	// DN distinguished name of the entry
+	DN string
+	// Attributes values by lower case attribute name, attribute options such as ;lang-en are dropped
+	Attributes map[string][]string
+}
+
+// Get returns the first value of the attribute named name or an empty string
+func (e *Entry) Get(name string) string {
+	values := e.Attributes[strings.ToLower(name)]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// ParseError reports an entry that could not be parsed
+type ParseError struct {
+	// Index position of the entry in the file counting from 0
+	Index int
+	// Line line of the file the problem was found on counting from 1
+	Line int
+	// Message describes why the entry was rejected
+	Message string
+}
+
+// Error implements the error interface
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("entry %d line %d: %s", e.Index, e.Line, e.Message)
+}
+
+// line a logical line after unfolding along with the physical line it starts on
+type line struct {
+	number int
+	text   string
+}
+
+// Decode reads every entry of an LDIF content file in r. Entries that can not be parsed are skipped
+// and reported by index in errs while the remaining entries are still returned, err is only set when r fails.
+// Change records other than changetype add are rejected since they describe changes rather than entries
+func Decode(r io.Reader) (entries []*Entry, errs []*ParseError, err error) {
+	records, err := unfold(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	index := 0
+	for i, record := range records {
+		if i == 0 && len(record) > 0 && strings.HasPrefix(strings.ToLower(record[0].text), "version:") {
+			record = record[1:]
+		}
+		if len(record) == 0 {
+			continue
+		}
+		entry, broken := parseRecord(index, record)
+		if broken != nil {
+			errs = append(errs, broken)
+		} else {
+			entries = append(entries, entry)
+		}
+		index++
+	}
+	return entries, errs, nil
+}
+
+// parseRecord parses the lines of a single record
+func parseRecord(index int, record []line) (*Entry, *ParseError) {
+	entry := &Entry{Index: index, Attributes: map[string][]string{}}
+	for i, l := range record {
+		name, value, err := parseLine(l.text)
+		if err != nil {
+			return nil, &ParseError{Index: index, Line: l.number, Message: err.Error()}
+		}
+		switch {
+		case name == "" && i > 0:
+		case i == 0 && name != "dn":
+			return nil, &ParseError{Index: index, Line: l.number, Message: "entry does not start with dn"}
+		case i == 0:
+			entry.DN = value
+		case name == "changetype" && !strings.EqualFold(value, "add"):
+			return nil, &ParseError{Index: index, Line: l.number, Message: "unsupported changetype " + value}
+		case name == "changetype", name == "control":
+		default:
+			entry.Attributes[name] = append(entry.Attributes[name], value)
+		}
+	}
+	return entry, nil
+}
+
+// parseLine splits an attribute line into its lower case name without options and its decoded value,
+// the name is empty for values that are skipped
+func parseLine(text string) (string, string, error) {
+	colon := strings.IndexByte(text, ':')
+	if colon <= 0 {
+		return "", "", fmt.Errorf("invalid line %s", truncate(text))
+	}
+	name := strings.ToLower(text[:colon])
+	if semi := strings.IndexByte(name, ';'); semi >= 0 {
+		name = name[:semi]
+	}
+	value := text[colon+1:]
+	switch {
+	case strings.HasPrefix(value, ":"):
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+		if err != nil {
+			return "", "", fmt.Errorf("invalid base64 value of %s", name)
+		}
+		if !utf8.Valid(decoded) {
+			// binary values such as jpegPhoto have no contact field, they are skipped
+			return "", "", nil
+		}
+		return name, string(decoded), nil
+	case strings.HasPrefix(value, "<"):
+		return "", "", fmt.Errorf("url value of %s is not supported", name)
+	}
+	return name, strings.TrimLeft(value, " "), nil
+}
+
+// unfold reads the records of r as logical lines, comments are dropped and folded lines are joined
+func unfold(r io.Reader) ([][]line, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+
+	records := [][]line{}
+	record := []line{}
+	comment := false
+	for number := 1; scanner.Scan(); number++ {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if number == 1 {
+			text = strings.TrimPrefix(text, "\xEF\xBB\xBF")
+		}
+		switch {
+		case text == "":
+			if len(record) > 0 {
+				records = append(records, record)
+				record = []line{}
+			}
+			comment = false
+		case strings.HasPrefix(text, " "):
+			// a continuation of the previous line, or of a comment
+			if !comment && len(record) > 0 {
+				record[len(record)-1].text += text[1:]
+			}
+		case strings.HasPrefix(text, "#"):
+			comment = true
+		default:
+			comment = false
+			record = append(record, line{number: number, text: text})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(record) > 0 {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// truncate shortens text quoted in error messages
+func truncate(text string) string {
+	if len(text) > 40 {
+		return text[:40] + "..."
+	}
+	return text
+}
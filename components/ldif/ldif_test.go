@@ -0,0 +1,103 @@
+package ldif
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// thunderbird an address book exported by Thunderbird, the second entry has a folded, base64 encoded name
+const thunderbird = "version: 1\r\n" +
+	"# exported address book\r\n" +
+	"\r\n" +
+	"dn: cn=Tom Dob,mail=tom.dobs@gmail.com\r\n" +
+	"objectclass: top\r\n" +
+	"objectclass: inetOrgPerson\r\n" +
+	"givenName: Tom\r\n" +
+	"sn: Dob\r\n" +
+	"cn: Tom Dob\r\n" +
+	"mail: tom.dobs@gmail.com\r\n" +
+	"telephoneNumber: 5555555555\r\n" +
+	"o: Acme\r\n" +
+	"c: US\r\n" +
+	"\r\n" +
+	"dn:: Y249SsO8cmdlbiBNw7xsbGVyLG1haWw9anVlcmdlbkBleGFtcGxlLmNvbQ==\r\n" +
+	"cn:: SsO8cmdlbiBN\r\n" +
+	" w7xsbGVy\r\n" +
+	"mail: juergen@example.com\r\n" +
+	"mobile: 0170 555\r\n" +
+	"jpegPhoto:: /9j/4AAQ\r\n" +
+	"\r\n" +
+	"dn: cn=broken\r\n" +
+	"changetype: delete\r\n" +
+	"\r\n" +
+	"cn: no dn\r\n"
+
+func TestDecode(t *testing.T) {
+	entries, errs, err := Decode(strings.NewReader(thunderbird))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Len(t, errs, 2)
+
+	assert.Equal(t, "cn=Tom Dob,mail=tom.dobs@gmail.com", entries[0].DN)
+	assert.Equal(t, []string{"top", "inetOrgPerson"}, entries[0].Attributes["objectclass"])
+	assert.Equal(t, models.Contact{
+		FirstName:    "Tom",
+		LastName:     "Dob",
+		Email:        "tom.dobs@gmail.com",
+		Phone:        "5555555555",
+		Organization: "Acme",
+		Country:      "US",
+	}, ToContact(entries[0]))
+
+	assert.Equal(t, 1, entries[1].Index)
+	assert.Equal(t, "cn=Jürgen Müller,mail=juergen@example.com", entries[1].DN)
+	assert.Equal(t, models.Contact{
+		FirstName: "Jürgen",
+		LastName:  "Müller",
+		Email:     "juergen@example.com",
+		Phone:     "0170 555",
+	}, ToContact(entries[1]))
+
+	assert.Equal(t, 2, errs[0].Index)
+	assert.Equal(t, "entry 2 line 23: unsupported changetype delete", errs[0].Error())
+	assert.Equal(t, "entry 3 line 25: entry does not start with dn", errs[1].Error())
+}
+
+func TestEncode(t *testing.T) {
+	contacts := []models.Contact{
+		{FirstName: "Tom", LastName: "Dob", Email: "tom.dobs@gmail.com", Phone: "+15555555555", Country: "US"},
+		{FirstName: "Jürgen", Email: "juergen+work@example.com", Note: strings.Repeat("long note ", 10)},
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteString(Header())
+	assert.NoError(t, Encode(buf, contacts, "ou=contacts,dc=example,dc=com"))
+
+	text := buf.String()
+	assert.True(t, strings.HasPrefix(text, "version: 1\n\ndn: mail=tom.dobs@gmail.com,ou=contacts,dc=example,dc=com\n"))
+	assert.Contains(t, text, "objectClass: inetOrgPerson\ncn: Tom Dob\ngivenName: Tom\nsn: Dob\n")
+	assert.NotContains(t, text, "c: US")
+	assert.Contains(t, text, "dn: mail=juergen\\+work@example.com,ou=contacts,dc=example,dc=com\n")
+	assert.Contains(t, text, "cn:: SsO8cmdlbg==\n")
+	for _, l := range strings.Split(text, "\n") {
+		assert.True(t, len(l) <= foldLength, l)
+	}
+
+	entries, errs, err := Decode(buf)
+	assert.NoError(t, err)
+	assert.Empty(t, errs)
+	assert.Len(t, entries, 2)
+	contacts[0].Country = ""
+	assert.Equal(t, contacts[0], ToContact(entries[0]))
+	juergen := ToContact(entries[1])
+	assert.Equal(t, contacts[1].Note, juergen.Note)
+	assert.Equal(t, "Jürgen", juergen.FirstName)
+}
+
+func TestEscapeDN(t *testing.T) {
+	assert.Equal(t, `a\,b\+c\=d`, escapeDN("a,b+c=d"))
+	assert.Equal(t, `\#a b\ `, escapeDN("#a b "))
+}
@@ -0,0 +1,41 @@
+package qrcode
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// quietZone light border around the symbol in modules required by readers
+const quietZone = 4
+
+// Image renders the code with its quiet zone scaled to at most size pixels wide,
+// every module is at least one pixel so small sizes may be exceeded
+func (c *Code) Image(size int) image.Image {
+	modules := c.Size + quietZone*2
+	scale := max(1, size/modules)
+	width := modules * scale
+
+	img := image.NewPaletted(image.Rect(0, 0, width, width), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			left, top := (x+quietZone)*scale, (y+quietZone)*scale
+			for py := top; py < top+scale; py++ {
+				for px := left; px < left+scale; px++ {
+					img.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG writes the code as a png image of at most size pixels wide
+func (c *Code) WritePNG(w io.Writer, size int) error {
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	return encoder.Encode(w, c.Image(size))
+}
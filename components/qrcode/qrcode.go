@@ -0,0 +1,479 @@
+package qrcode
+
+import (
+	"errors"
+	"strings"
+)
+
+// Level error correction level of a QR code
+type Level int
+
+// error correction levels, each recovers roughly 7%, 15%, 25% and 30% of the codewords
+const (
+	Low Level = iota
+	Medium
+	Quartile
+	High
+)
+
+// version limits
+const (
+	minVersion = 1
+	maxVersion = 40
+)
+
+// byteMode mode indicator for 8 bit data
+const byteMode = 0x4
+
+// penalty weights used to pick the mask
+const (
+	penaltyRun     = 3
+	penaltyBlock   = 3
+	penaltyFinder  = 40
+	penaltyBalance = 10
+)
+
+// ErrTooLong is returned when the data does not fit in a version 40 symbol at the requested level
+var ErrTooLong = errors.New("data too long for a qr code")
+
+// ParseLevel returns the level named by one of L, M, Q or H
+func ParseLevel(name string) (Level, bool) {
+	switch strings.ToUpper(name) {
+	case "L":
+		return Low, true
+	case "M":
+		return Medium, true
+	case "Q":
+		return Quartile, true
+	case "H":
+		return High, true
+	}
+	return 0, false
+}
+
+// Code an encoded QR code symbol
+type Code struct {
+	// Version 1 to 40
+	Version int
+	// Level ...
+	Level Level
+	// Size width and height in modules
+	Size int
+
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// Dark reports whether the module at column x and row y is dark
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Encode encodes data in byte mode using the smallest version that fits at level
+func Encode(data []byte, level Level) (*Code, error) {
+	version := minVersion
+	for ; version <= maxVersion; version++ {
+		capacity := numDataCodewords(version, level) * 8
+		if 4+charCountBits(version)+len(data)*8 <= capacity {
+			break
+		}
+	}
+	if version > maxVersion {
+		return nil, ErrTooLong
+	}
+
+	size := version*4 + 17
+	c := &Code{Version: version, Level: level, Size: size}
+	c.modules = newGrid(size)
+	c.isFunction = newGrid(size)
+	c.drawFunctionPatterns()
+	c.drawCodewords(addErrorCorrection(dataCodewords(data, version, level), version, level))
+
+	best, minPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); minPenalty < 0 || penalty < minPenalty {
+			best, minPenalty = mask, penalty
+		}
+		// masking twice restores the modules
+		c.applyMask(mask)
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+	return c, nil
+}
+
+// newGrid allocates a size by size grid of modules
+func newGrid(size int) [][]bool {
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+	return grid
+}
+
+// charCountBits length of the character count indicator for byte mode in version
+func charCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// numRawDataModules modules available for data and error correction codewords in version
+func numRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// numDataCodewords data codewords that fit in version at level
+func numDataCodewords(version int, level Level) int {
+	return numRawDataModules(version)/8 - eccCodewordsPerBlock[level][version]*numErrorCorrectionBlocks[level][version]
+}
+
+// dataCodewords builds the padded data codewords: mode, character count, data and terminator
+func dataCodewords(data []byte, version int, level Level) []byte {
+	bb := &bitBuffer{}
+	bb.append(byteMode, 4)
+	bb.append(len(data), charCountBits(version))
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+
+	capacity := numDataCodewords(version, level) * 8
+	bb.append(0, min(4, capacity-bb.len()))
+	bb.append(0, (8-bb.len()%8)%8)
+	for pad := 0xEC; bb.len() < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+	return bb.bytes()
+}
+
+// addErrorCorrection splits data into blocks, appends the error correction codewords of each block and interleaves them
+func addErrorCorrection(data []byte, version int, level Level) []byte {
+	numBlocks := numErrorCorrectionBlocks[level][version]
+	eccLen := eccCodewordsPerBlock[level][version]
+	rawCodewords := numRawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range blocks {
+		n := shortBlockLen - eccLen
+		if i >= numShortBlocks {
+			n++
+		}
+		block := append([]byte{}, data[k:k+n]...)
+		k += n
+		ecc := reedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			// short blocks are padded so every block has the same layout, the pad is skipped when interleaving
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := 0; i < len(blocks[0]); i++ {
+		for j, block := range blocks {
+			if i != shortBlockLen-eccLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// drawFunctionPatterns draws the timing, finder and alignment patterns along with the version information
+// and reserves the format information area
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinderPattern(3, 3)
+	c.drawFinderPattern(c.Size-4, 3)
+	c.drawFinderPattern(3, c.Size-4)
+
+	positions := alignmentPositions(c.Version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// alignment patterns never overlap the finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignmentPattern(x, y)
+		}
+	}
+
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+// drawFinderPattern draws a finder pattern and its separator centred on x, y
+func (c *Code) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= c.Size || yy < 0 || yy >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignmentPattern draws an alignment pattern centred on x, y
+func (c *Code) drawAlignmentPattern(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// alignmentPositions centre coordinates of the alignment patterns in version
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	positions := make([]int, numAlign)
+	positions[0] = 6
+	for i, pos := numAlign-1, version*4+10; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// drawFormatBits draws both copies of the format information for the level and mask
+func (c *Code) drawFormatBits(mask int) {
+	data := formatBits[c.Level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(bits, i))
+	}
+	c.setFunction(8, 7, bit(bits, 6))
+	c.setFunction(8, 8, bit(bits, 7))
+	c.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(bits, i))
+	}
+	// the dark module is always set
+	c.setFunction(8, c.Size-8, true)
+}
+
+// drawVersion draws both copies of the version information used from version 7
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+	rem := c.Version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := c.Version<<12 | rem
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, bit(bits, i))
+		c.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// setFunction sets a module that belongs to a function pattern
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+// drawCodewords places the codewords in the zigzag pattern of two module wide columns from the bottom right
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			// skip the vertical timing pattern
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if !c.isFunction[y][x] && i < len(codewords)*8 {
+					c.modules[y][x] = bit(int(codewords[i>>3]), 7-(i&7))
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by mask, applying it twice undoes it
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.isFunction[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			c.modules[y][x] = c.modules[y][x] != invert
+		}
+	}
+}
+
+// penalty scores how hard the symbol is to read, the mask with the lowest score is used
+func (c *Code) penalty() int {
+	result := 0
+	for i := 0; i < c.Size; i++ {
+		row := make([]bool, c.Size)
+		col := make([]bool, c.Size)
+		for j := 0; j < c.Size; j++ {
+			row[j], col[j] = c.modules[i][j], c.modules[j][i]
+		}
+		result += linePenalty(row) + linePenalty(col)
+	}
+
+	dark := 0
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				m := c.modules[y][x]
+				if m == c.modules[y][x-1] && m == c.modules[y-1][x] && m == c.modules[y-1][x-1] {
+					result += penaltyBlock
+				}
+			}
+		}
+	}
+
+	total := c.Size * c.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return result + k*penaltyBalance
+}
+
+// finderLike dark and light sequence resembling a finder pattern next to four light modules
+var finderLike = [][]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// linePenalty scores runs of the same colour and finder like patterns in a row or column
+func linePenalty(line []bool) int {
+	result := 0
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			result += penaltyRun + run - 5
+		}
+		run = 1
+	}
+
+	for i := 0; i+len(finderLike[0]) <= len(line); i++ {
+		for _, pattern := range finderLike {
+			match := true
+			for j, dark := range pattern {
+				if line[i+j] != dark {
+					match = false
+					break
+				}
+			}
+			if match {
+				result += penaltyFinder
+			}
+		}
+	}
+	return result
+}
+
+// bit reports whether bit i of x is set
+func bit(x, i int) bool {
+	return (x>>uint(i))&1 != 0
+}
+
+// abs ...
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// bitBuffer accumulates bits most significant first
+type bitBuffer struct {
+	bits []bool
+}
+
+// append adds the n low bits of value
+func (bb *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		bb.bits = append(bb.bits, bit(value, i))
+	}
+}
+
+// len number of bits in the buffer
+func (bb *bitBuffer) len() int {
+	return len(bb.bits)
+}
+
+// bytes packs the bits into bytes, the length must be a multiple of 8
+func (bb *bitBuffer) bytes() []byte {
+	result := make([]byte, len(bb.bits)/8)
+	for i, b := range bb.bits {
+		if b {
+			result[i/8] |= 1 << uint(7-i%8)
+		}
+	}
+	return result
+}
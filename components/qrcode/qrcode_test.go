@@ -0,0 +1,113 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// HELLO WORLD as 1-M from the QR code specification walkthrough
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	ecc := reedSolomonRemainder(data, reedSolomonDivisor(10))
+	assert.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}, ecc)
+}
+
+func TestNumDataCodewords(t *testing.T) {
+	expected := map[int][4]int{
+		1:  {19, 16, 13, 9},
+		10: {274, 216, 154, 122},
+		40: {2956, 2334, 1666, 1276},
+	}
+	for version, counts := range expected {
+		for level, count := range counts {
+			assert.Equal(t, count, numDataCodewords(version, Level(level)), "version %d level %d", version, level)
+		}
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	assert.Nil(t, alignmentPositions(1))
+	assert.Equal(t, []int{6, 22, 38}, alignmentPositions(7))
+	assert.Equal(t, []int{6, 34, 60, 86, 112, 138}, alignmentPositions(32))
+	assert.Equal(t, []int{6, 30, 58, 86, 114, 142, 170}, alignmentPositions(40))
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	c := &Code{Version: 7, Level: Low, Size: 45, modules: newGrid(45), isFunction: newGrid(45)}
+	c.drawFormatBits(0)
+	c.drawVersion()
+
+	// format bits are read from bit 14 down along the top left copy
+	format := 0
+	for i := 14; i >= 9; i-- {
+		format = format<<1 | boolBit(c.Dark(14-i, 8))
+	}
+	format = format<<1 | boolBit(c.Dark(7, 8))
+	format = format<<1 | boolBit(c.Dark(8, 8))
+	format = format<<1 | boolBit(c.Dark(8, 7))
+	for i := 5; i >= 0; i-- {
+		format = format<<1 | boolBit(c.Dark(8, i))
+	}
+	assert.Equal(t, 0x77C4, format)
+
+	version := 0
+	for i := 17; i >= 0; i-- {
+		version = version<<1 | boolBit(c.Dark(c.Size-11+i%3, i/3))
+	}
+	assert.Equal(t, 0x07C94, version)
+}
+
+func TestEncode(t *testing.T) {
+	c, err := Encode([]byte("BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Tom Dob\r\nEND:VCARD\r\n"), Medium)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, c.Version)
+	assert.Equal(t, 33, c.Size)
+
+	// finder patterns in three corners and the dark module
+	for _, corner := range [][2]int{{0, 0}, {c.Size - 7, 0}, {0, c.Size - 7}} {
+		assert.True(t, c.Dark(corner[0], corner[1]))
+		assert.True(t, c.Dark(corner[0]+3, corner[1]+3))
+		assert.False(t, c.Dark(corner[0]+1, corner[1]+1))
+	}
+	assert.True(t, c.Dark(8, c.Size-8))
+
+	_, err = Encode(make([]byte, 2954), Low)
+	assert.Equal(t, ErrTooLong, err)
+	c, err = Encode(make([]byte, 2953), Low)
+	assert.NoError(t, err)
+	assert.Equal(t, 40, c.Version)
+}
+
+func TestWritePNG(t *testing.T) {
+	c, err := Encode([]byte("MECARD:N:Dob,Tom;;"), High)
+	assert.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, c.WritePNG(buf, 300))
+	img, err := png.Decode(buf)
+	assert.NoError(t, err)
+
+	modules := c.Size + quietZone*2
+	assert.Equal(t, modules*(300/modules), img.Bounds().Dx())
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xFFFF), r)
+}
+
+func TestParseLevel(t *testing.T) {
+	level, ok := ParseLevel("q")
+	assert.True(t, ok)
+	assert.Equal(t, Quartile, level)
+	_, ok = ParseLevel("X")
+	assert.False(t, ok)
+}
+
+// boolBit returns 1 for a dark module
+func boolBit(dark bool) int {
+	if dark {
+		return 1
+	}
+	return 0
+}
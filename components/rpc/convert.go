@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	contactsv1 "github.com/squanchersquanch/contacts/api/contacts/v1"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// toProto converts a contact to its message
+func toProto(contact models.Contact) *contactsv1.Contact {
+	return &contactsv1.Contact{
+		Id:           contact.ID,
+		FirstName:    contact.FirstName,
+		LastName:     contact.LastName,
+		Email:        contact.Email,
+		Phone:        contact.Phone,
+		Organization: contact.Organization,
+		Note:         contact.Note,
+		Uid:          contact.UID,
+		Street:       contact.Street,
+		City:         contact.City,
+		Region:       contact.Region,
+		PostalCode:   contact.PostalCode,
+		Country:      contact.Country,
+		Tags:         contact.Tags,
+	}
+}
+
+// fromProto converts a message to a contact, a nil message is an empty contact. A message without tags
+// keeps the stored tags on update
+func fromProto(contact *contactsv1.Contact) models.Contact {
+	return models.Contact{
+		ID:           contact.GetId(),
+		FirstName:    contact.GetFirstName(),
+		LastName:     contact.GetLastName(),
+		Email:        contact.GetEmail(),
+		Phone:        contact.GetPhone(),
+		Organization: contact.GetOrganization(),
+		Note:         contact.GetNote(),
+		UID:          contact.GetUid(),
+		Street:       contact.GetStreet(),
+		City:         contact.GetCity(),
+		Region:       contact.GetRegion(),
+		PostalCode:   contact.GetPostalCode(),
+		Country:      contact.GetCountry(),
+		Tags:         contact.GetTags(),
+	}
+}
+
+// fromFilter converts a filter message, a nil filter matches every contact
+func fromFilter(filter *contactsv1.ContactFilter) models.ContactFilter {
+	return models.ContactFilter{
+		Query:        filter.GetQuery(),
+		Organization: filter.GetOrganization(),
+		City:         filter.GetCity(),
+		Region:       filter.GetRegion(),
+		Country:      filter.GetCountry(),
+	}
+}
+
+// toImportResponse converts an import report
+func toImportResponse(report *models.ImportReport) *contactsv1.ImportResponse {
+	res := &contactsv1.ImportResponse{
+		Total:    int32(report.Total),
+		Created:  int32(report.Created),
+		Updated:  int32(report.Updated),
+		Rejected: int32(report.Rejected),
+	}
+	for _, err := range report.Errors {
+		res.Errors = append(res.Errors, &contactsv1.FieldError{Field: err.Field, Message: err.Message})
+	}
+	return res
+}
@@ -0,0 +1,216 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	contactsv1 "github.com/squanchersquanch/contacts/api/contacts/v1"
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/validation"
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/squanchersquanch/contacts/services/config"
+	"github.com/stretchr/testify/assert"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+)
+
+// dial serves the contacts in a memory store on a local port and connects to it
+func dial(t *testing.T, contacts []models.Contact) (*grpc.ClientConn, func()) {
+	s := store.NewMemoryStore()
+	for _, contact := range contacts {
+		_, err := s.Create(context.Background(), contact)
+		assert.NoError(t, err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := NewServer(s, validation.NewValidator(&config.Config{}))
+	go server.Serve(l)
+
+	conn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	return conn, func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func TestContacts(t *testing.T) {
+	conn, stop := dial(t, nil)
+	defer stop()
+	c := contactsv1.NewContactServiceClient(conn)
+	ctx := context.Background()
+
+	created, err := c.Create(ctx, &contactsv1.CreateRequest{Contact: &contactsv1.Contact{Id: "7", FirstName: "tom", Email: "tom@example.com",
+		Tags: []string{"Friends"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", created.GetId(), "the id is assigned by the store")
+	assert.Equal(t, []string{"friends"}, created.GetTags())
+
+	created.LastName = "dob"
+	updated, err := c.Update(ctx, &contactsv1.UpdateRequest{Contact: created})
+	assert.NoError(t, err)
+	assert.Equal(t, "dob", updated.GetLastName())
+
+	contact, err := c.Get(ctx, &contactsv1.GetRequest{Id: "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "dob", contact.GetLastName())
+
+	_, err = c.Create(ctx, &contactsv1.CreateRequest{Contact: &contactsv1.Contact{FirstName: "ann", Email: "ann"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, err.Error(), "email must be a valid email address")
+	_, err = c.Create(ctx, &contactsv1.CreateRequest{Contact: &contactsv1.Contact{FirstName: "tim", Email: "tom@example.com"}})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = c.Update(ctx, &contactsv1.UpdateRequest{Contact: &contactsv1.Contact{Id: "9", FirstName: "tim", Email: "tim@example.com"}})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = c.Get(ctx, &contactsv1.GetRequest{Id: "one"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = c.Get(ctx, &contactsv1.GetRequest{Id: "2147483648"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = c.Delete(ctx, &contactsv1.DeleteRequest{Id: "1"})
+	assert.NoError(t, err)
+	_, err = c.Get(ctx, &contactsv1.GetRequest{Id: "1"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = c.Delete(ctx, &contactsv1.DeleteRequest{Id: "1"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestList(t *testing.T) {
+	conn, stop := dial(t, []models.Contact{
+		{FirstName: "ann", Email: "ann@acme.com", Organization: "Acme"},
+		{FirstName: "bob", Email: "bob@globex.com", Organization: "Globex"},
+		{FirstName: "cat", Email: "cat@acme.com", Organization: "acme"},
+		{FirstName: "dan", Email: "dan@acme.com", Organization: "Acme"},
+	})
+	defer stop()
+	c := contactsv1.NewContactServiceClient(conn)
+	ctx := context.Background()
+
+	names := []string{}
+	req := &contactsv1.ListRequest{PageSize: 2, Filter: &contactsv1.ContactFilter{Organization: "acme"}}
+	pages := 0
+	for {
+		res, err := c.List(ctx, req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		pages++
+		for _, contact := range res.GetContacts() {
+			names = append(names, contact.GetFirstName())
+		}
+		if res.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = res.GetNextPageToken()
+	}
+	assert.Equal(t, []string{"ann", "cat", "dan"}, names)
+	assert.Equal(t, 2, pages)
+
+	res, err := c.List(ctx, &contactsv1.ListRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, res.GetContacts(), 4)
+	assert.Empty(t, res.GetNextPageToken())
+
+	_, err = c.List(ctx, &contactsv1.ListRequest{PageSize: 1001})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = c.List(ctx, &contactsv1.ListRequest{PageToken: "next"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = c.List(ctx, &contactsv1.ListRequest{PageToken: "9999999999"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestExport(t *testing.T) {
+	conn, stop := dial(t, []models.Contact{
+		{FirstName: "ann", Email: "ann@acme.com", Organization: "Acme"},
+		{FirstName: "bob", Email: "bob@globex.com", Organization: "Globex"},
+		{FirstName: "cat", Email: "cat@acme.com", Organization: "Acme"},
+	})
+	defer stop()
+	c := contactsv1.NewContactServiceClient(conn)
+
+	stream, err := c.Export(context.Background(), &contactsv1.ExportRequest{Filter: &contactsv1.ContactFilter{Query: "acme"}})
+	assert.NoError(t, err)
+	names := []string{}
+	for {
+		contact, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		names = append(names, contact.GetFirstName())
+	}
+	assert.Equal(t, []string{"ann", "cat"}, names)
+}
+
+func TestImport(t *testing.T) {
+	conn, stop := dial(t, []models.Contact{{FirstName: "ann", Email: "ann@acme.com"}})
+	defer stop()
+	c := contactsv1.NewContactServiceClient(conn)
+	ctx := context.Background()
+
+	stream, err := c.Import(ctx)
+	assert.NoError(t, err)
+	for _, contact := range []*contactsv1.Contact{
+		{FirstName: "bob", Email: "bob@acme.com"},
+		{FirstName: "ann", Email: "ann@acme.com"},
+		{FirstName: "cat", Email: "cat"},
+	} {
+		assert.NoError(t, stream.Send(&contactsv1.ImportRequest{Contact: contact}))
+	}
+	res, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), res.GetTotal())
+	assert.Equal(t, int32(1), res.GetCreated())
+	assert.Equal(t, int32(2), res.GetRejected())
+	assert.Equal(t, []string{"rows[1].email", "rows[2].email"}, []string{res.GetErrors()[0].GetField(), res.GetErrors()[1].GetField()})
+
+	stream, err = c.Import(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&contactsv1.ImportRequest{Contact: &contactsv1.Contact{FirstName: "anne", Email: "ann@acme.com"}, ByEmail: true}))
+	assert.NoError(t, stream.Send(&contactsv1.ImportRequest{Contact: &contactsv1.Contact{FirstName: "dan", Email: "dan@acme.com"}}))
+	res, err = stream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), res.GetCreated())
+	assert.Equal(t, int32(1), res.GetUpdated())
+	contact, err := c.Get(ctx, &contactsv1.GetRequest{Id: "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "anne", contact.GetFirstName())
+}
+
+func TestHealthAndReflection(t *testing.T) {
+	conn, stop := dial(t, nil)
+	defer stop()
+	ctx := context.Background()
+
+	health := grpc_health_v1.NewHealthClient(conn)
+	for _, service := range []string{"", "contacts.v1.ContactService"} {
+		res, err := health.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: service})
+		assert.NoError(t, err)
+		assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, res.GetStatus())
+	}
+
+	stream, err := grpc_reflection_v1.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&grpc_reflection_v1.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_ListServices{},
+	}))
+	res, err := stream.Recv()
+	if assert.NoError(t, err) {
+		services := []string{}
+		for _, service := range res.GetListServicesResponse().GetService() {
+			services = append(services, service.GetName())
+		}
+		assert.Contains(t, services, "contacts.v1.ContactService")
+		assert.Contains(t, services, "grpc.health.v1.Health")
+	}
+	stream.CloseSend()
+}
@@ -0,0 +1,262 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	contactsv1 "github.com/squanchersquanch/contacts/api/contacts/v1"
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/validation"
+	"github.com/squanchersquanch/contacts/models"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// page sizes of List
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Server serves the contacts.v1.ContactService along with the grpc health and reflection services
+type Server interface {
+	// Serve answers the connections accepted on l until it fails or is stopped
+	Serve(l net.Listener) error
+	// ListenAndServe listens on the tcp address addr and serves its connections
+	ListenAndServe(addr string) error
+	// Stop stops accepting connections and returns once the running calls finished
+	Stop()
+}
+
+// server is the implementation of the Server interface
+type server struct {
+	grpc *grpc.Server
+}
+
+// NewServer creates a Server reading and writing the contacts of store, contacts are validated by validator
+// before they are stored
+func NewServer(store store.Store, validator validation.Validator) Server {
+	s := grpc.NewServer()
+	contactsv1.RegisterContactServiceServer(s, &contactService{store: store, validator: validator})
+
+	checks := health.NewServer()
+	checks.SetServingStatus(contactsv1.ContactService_ServiceDesc.ServiceName, grpc_health_v1.HealthCheckResponse_SERVING)
+	grpc_health_v1.RegisterHealthServer(s, checks)
+	reflection.Register(s)
+	return &server{grpc: s}
+}
+
+// ListenAndServe listens on addr and serves its connections
+func (s *server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve answers the connections accepted on l
+func (s *server) Serve(l net.Listener) error {
+	return s.grpc.Serve(l)
+}
+
+// Stop stops the server gracefully
+func (s *server) Stop() {
+	s.grpc.GracefulStop()
+}
+
+// contactService implements contactsv1.ContactServiceServer over a store
+type contactService struct {
+	contactsv1.UnimplementedContactServiceServer
+	store     store.Store
+	validator validation.Validator
+}
+
+// Get returns the contact with the id
+func (c *contactService) Get(ctx context.Context, req *contactsv1.GetRequest) (*contactsv1.Contact, error) {
+	if !isID(req.GetId()) {
+		return nil, errInvalidID
+	}
+	contact, err := c.store.Get(ctx, req.GetId())
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return toProto(contact), nil
+}
+
+// List returns a page of the contacts matching the filter, the page token is the id of the last contact
+// of the previous page
+func (c *contactService) List(ctx context.Context, req *contactsv1.ListRequest) (*contactsv1.ListResponse, error) {
+	size := int(req.GetPageSize())
+	switch {
+	case size < 0 || size > maxPageSize:
+		return nil, status.Errorf(codes.InvalidArgument, "page_size must be between 0 and %d", maxPageSize)
+	case size == 0:
+		size = defaultPageSize
+	}
+	if token := req.GetPageToken(); token != "" && !isID(token) {
+		return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+	}
+
+	// one contact past the page tells whether there is a next page
+	contacts, err := c.store.Page(ctx, fromFilter(req.GetFilter()), req.GetPageToken(), size+1)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	res := &contactsv1.ListResponse{}
+	if len(contacts) > size {
+		contacts = contacts[:size]
+		res.NextPageToken = contacts[size-1].ID
+	}
+	for _, contact := range contacts {
+		res.Contacts = append(res.Contacts, toProto(contact))
+	}
+	return res, nil
+}
+
+// Create validates and stores a new contact
+func (c *contactService) Create(ctx context.Context, req *contactsv1.CreateRequest) (*contactsv1.Contact, error) {
+	contact := fromProto(req.GetContact())
+	contact.ID = ""
+	if err := c.validate(&contact); err != nil {
+		return nil, err
+	}
+	created, err := c.store.Create(ctx, contact)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return toProto(created), nil
+}
+
+// Update validates and replaces an existing contact, its extra emails, phones and addresses are kept
+func (c *contactService) Update(ctx context.Context, req *contactsv1.UpdateRequest) (*contactsv1.Contact, error) {
+	contact := fromProto(req.GetContact())
+	if !isID(contact.ID) {
+		return nil, errInvalidID
+	}
+	if err := c.validate(&contact); err != nil {
+		return nil, err
+	}
+	updated, err := c.store.Update(ctx, contact)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return toProto(updated), nil
+}
+
+// Delete deletes the contact with the id
+func (c *contactService) Delete(ctx context.Context, req *contactsv1.DeleteRequest) (*contactsv1.DeleteResponse, error) {
+	if !isID(req.GetId()) {
+		return nil, errInvalidID
+	}
+	if _, err := c.store.Get(ctx, req.GetId()); err != nil {
+		return nil, storeError(err)
+	}
+	if err := c.store.Delete(ctx, req.GetId()); err != nil {
+		return nil, storeError(err)
+	}
+	return &contactsv1.DeleteResponse{}, nil
+}
+
+// Export streams every contact matching the filter
+func (c *contactService) Export(req *contactsv1.ExportRequest, stream contactsv1.ContactService_ExportServer) error {
+	err := c.store.Each(stream.Context(), fromFilter(req.GetFilter()), func(contact models.Contact) error {
+		return stream.Send(toProto(contact))
+	})
+	if err != nil {
+		return storeError(err)
+	}
+	return nil
+}
+
+// Import validates and stores every streamed contact, rows failing validation or taking the email of
+// another contact are reported and skipped
+func (c *contactService) Import(stream contactsv1.ContactService_ImportServer) error {
+	ctx := stream.Context()
+	report := models.NewImportReport()
+	byEmail := false
+	for row := 0; ; row++ {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if row == 0 {
+			byEmail = req.GetByEmail()
+		}
+		report.Total++
+
+		contact := fromProto(req.GetContact())
+		contact.ID = ""
+		if errs := c.validator.Validate(&contact); len(errs) > 0 {
+			report.Reject(row, errs...)
+			continue
+		}
+		created := true
+		if byEmail {
+			_, created, err = c.store.UpsertByEmail(ctx, contact)
+		} else {
+			_, err = c.store.Create(ctx, contact)
+		}
+		switch err {
+		case nil:
+			report.Accept(created)
+		case store.ErrDuplicateEmail:
+			report.Reject(row, models.FieldError{Field: "email", Message: err.Error()})
+		default:
+			return storeError(err)
+		}
+	}
+	return stream.SendAndClose(toImportResponse(report))
+}
+
+// validate validates and normalizes a contact before it is stored
+func (c *contactService) validate(contact *models.Contact) error {
+	errs := c.validator.Validate(contact)
+	if len(errs) == 0 {
+		return nil
+	}
+	fields := make([]string, len(errs))
+	for i, err := range errs {
+		fields[i] = fmt.Sprintf("%s %s", err.Field, err.Message)
+	}
+	return status.Errorf(codes.InvalidArgument, "the contact has invalid fields: %s", strings.Join(fields, ", "))
+}
+
+// errInvalidID is returned for ids that are not numbers or out of the range of ids
+var errInvalidID = status.Error(codes.InvalidArgument, "the id is not a valid contact id")
+
+// isID reports whether id is a valid contact id, ids are stored as 32 bit integers
+func isID(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 32)
+	return err == nil
+}
+
+// storeError returns the status of an error of the store
+func storeError(err error) error {
+	switch err {
+	case store.ErrNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case store.ErrDuplicateEmail:
+		return status.Error(codes.AlreadyExists, err.Error())
+	case context.Canceled, context.DeadlineExceeded:
+		return status.FromContextError(err).Err()
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	log.Printf("rpc: %v", err)
+	return status.Error(codes.Internal, "internal error")
+}
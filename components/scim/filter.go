@@ -0,0 +1,413 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// token kinds of a filter
+const (
+	tokenWord = iota
+	tokenString
+	tokenPunct
+)
+
+// errFilter is returned for filters that do not follow the grammar of RFC 7644 section 3.4.2.2
+var errFilter = errors.New("invalid filter")
+
+// token a word, string literal or one of ( ) [ ] of a filter
+type token struct {
+	kind int
+	text string
+}
+
+// expr a parsed filter. op is and, or, not, [ for value paths like emails[type eq "work"],
+// pr or a comparison operator, value holds the compared string, number, bool or nil
+type expr struct {
+	op       string
+	children []*expr
+	path     string
+	value    interface{}
+}
+
+// compareOps comparison operators of the filter grammar
+var compareOps = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true, "gt": true, "ge": true, "lt": true, "le": true,
+}
+
+// tokenize splits a filter into tokens, string literals are decoded as json strings
+func tokenize(s string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.IndexByte("()[]", c) >= 0:
+			tokens = append(tokens, token{tokenPunct, string(c)})
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(s) && s[end] != '"'; end++ {
+				if s[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(s) {
+				return nil, errFilter
+			}
+			var text string
+			if err := json.Unmarshal([]byte(s[i:end+1]), &text); err != nil {
+				return nil, errFilter
+			}
+			tokens = append(tokens, token{tokenString, text})
+			i = end + 1
+		default:
+			end := i
+			for end < len(s) && strings.IndexByte(" \t()[]\"", s[end]) < 0 {
+				end++
+			}
+			tokens = append(tokens, token{tokenWord, s[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// parser a recursive descent parser over the tokens of a filter, and binds tighter than or
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parseFilter parses a filter
+func parseFilter(s string) (*expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	e, err := p.or()
+	if err == nil && p.pos != len(p.tokens) {
+		err = errFilter
+	}
+	return e, err
+}
+
+// peek returns the next token, a zero token at the end
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{kind: -1}
+}
+
+// keyword reports whether the next token is the word w, consuming it when it is
+func (p *parser) keyword(w string) bool {
+	if t := p.peek(); t.kind == tokenWord && strings.EqualFold(t.text, w) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// punct consumes the punctuation c or fails
+func (p *parser) punct(c string) error {
+	if t := p.peek(); t.kind != tokenPunct || t.text != c {
+		return errFilter
+	}
+	p.pos++
+	return nil
+}
+
+// or parses expressions joined by or
+func (p *parser) or() (*expr, error) {
+	left, err := p.and()
+	for err == nil && p.keyword("or") {
+		var right *expr
+		if right, err = p.and(); err == nil {
+			left = &expr{op: "or", children: []*expr{left, right}}
+		}
+	}
+	return left, err
+}
+
+// and parses expressions joined by and
+func (p *parser) and() (*expr, error) {
+	left, err := p.unary()
+	for err == nil && p.keyword("and") {
+		var right *expr
+		if right, err = p.unary(); err == nil {
+			left = &expr{op: "and", children: []*expr{left, right}}
+		}
+	}
+	return left, err
+}
+
+// unary parses a negation, a parenthesized filter, a value path or an attribute expression
+func (p *parser) unary() (*expr, error) {
+	if p.keyword("not") {
+		if err := p.punct("("); err != nil {
+			return nil, err
+		}
+		e, err := p.group(")")
+		return &expr{op: "not", children: []*expr{e}}, err
+	}
+	if p.punct("(") == nil {
+		return p.group(")")
+	}
+
+	path := p.peek()
+	if path.kind != tokenWord {
+		return nil, errFilter
+	}
+	p.pos++
+	if p.punct("[") == nil {
+		e, err := p.group("]")
+		return &expr{op: "[", path: path.text, children: []*expr{e}}, err
+	}
+	if p.keyword("pr") {
+		return &expr{op: "pr", path: path.text}, nil
+	}
+	op := strings.ToLower(p.peek().text)
+	if p.peek().kind != tokenWord || !compareOps[op] {
+		return nil, errFilter
+	}
+	p.pos++
+	value, err := p.value()
+	return &expr{op: op, path: path.text, value: value}, err
+}
+
+// group parses a filter followed by the closing punctuation
+func (p *parser) group(closing string) (*expr, error) {
+	e, err := p.or()
+	if err == nil {
+		err = p.punct(closing)
+	}
+	return e, err
+}
+
+// value parses a string, number, true, false or null
+func (p *parser) value() (interface{}, error) {
+	t := p.peek()
+	p.pos++
+	switch {
+	case t.kind == tokenString:
+		return t.text, nil
+	case t.kind != tokenWord:
+		return nil, errFilter
+	case t.text == "true", t.text == "false":
+		return t.text == "true", nil
+	case t.text == "null":
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return nil, errFilter
+	}
+	return n, nil
+}
+
+// matches reports whether the filter selects a resource in its json form
+func (e *expr) matches(obj map[string]interface{}) bool {
+	switch e.op {
+	case "and":
+		return e.children[0].matches(obj) && e.children[1].matches(obj)
+	case "or":
+		return e.children[0].matches(obj) || e.children[1].matches(obj)
+	case "not":
+		return !e.children[0].matches(obj)
+	case "[":
+		for _, v := range resolve(obj, e.path) {
+			if m, ok := v.(map[string]interface{}); ok && e.children[0].matches(m) {
+				return true
+			}
+		}
+		return false
+	}
+
+	values := []interface{}{}
+	for _, v := range resolve(obj, e.path) {
+		// multi-valued attributes are compared by their value sub-attribute
+		if m, ok := v.(map[string]interface{}); ok {
+			v, _ = lookup(m, "value")
+		}
+		if v != nil && v != "" {
+			values = append(values, v)
+		}
+	}
+	switch {
+	case e.op == "pr":
+		return len(values) > 0
+	case e.value == nil && (e.op == "eq" || e.op == "ne"):
+		return (len(values) > 0) == (e.op == "ne")
+	case e.op == "ne":
+		return !(&expr{op: "eq", path: e.path, value: e.value}).matches(obj)
+	}
+	caseExact := strings.EqualFold(e.path, "id") || strings.EqualFold(e.path, "externalId")
+	for _, v := range values {
+		if compare(e.op, v, e.value, caseExact) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare applies a comparison operator to an attribute value and the value of the filter,
+// strings are compared ignoring case unless caseExact is set
+func compare(op string, actual, expected interface{}, caseExact bool) bool {
+	switch a := actual.(type) {
+	case string:
+		e, ok := expected.(string)
+		if !ok {
+			return false
+		}
+		if !caseExact {
+			a, e = strings.ToLower(a), strings.ToLower(e)
+		}
+		switch op {
+		case "co":
+			return strings.Contains(a, e)
+		case "sw":
+			return strings.HasPrefix(a, e)
+		case "ew":
+			return strings.HasSuffix(a, e)
+		}
+		return order(op, strings.Compare(a, e))
+	case float64:
+		e, ok := expected.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case a < e:
+			return order(op, -1)
+		case a > e:
+			return order(op, 1)
+		}
+		return order(op, 0)
+	case bool:
+		e, ok := expected.(bool)
+		return ok && op == "eq" && a == e
+	}
+	return false
+}
+
+// order reports whether the result of a comparison satisfies eq, gt, ge, lt or le
+func order(op string, c int) bool {
+	switch op {
+	case "eq":
+		return c == 0
+	case "gt":
+		return c > 0
+	case "ge":
+		return c >= 0
+	case "lt":
+		return c < 0
+	case "le":
+		return c <= 0
+	}
+	return false
+}
+
+// resolve returns the values of an attribute path like name.givenName or emails.value,
+// the elements of multi-valued attributes are returned one by one
+func resolve(obj map[string]interface{}, path string) []interface{} {
+	obj, path = schemaObject(obj, path)
+	parts := strings.SplitN(path, ".", 2)
+	v, ok := lookup(obj, parts[0])
+	if !ok {
+		return nil
+	}
+	values := flatten(v)
+	if len(parts) == 1 {
+		return values
+	}
+	sub := []interface{}{}
+	for _, v := range values {
+		if m, ok := v.(map[string]interface{}); ok {
+			if sv, ok := lookup(m, parts[1]); ok {
+				sub = append(sub, flatten(sv)...)
+			}
+		}
+	}
+	return sub
+}
+
+// flatten returns the elements of a list or the value itself
+func flatten(v interface{}) []interface{} {
+	if list, ok := v.([]interface{}); ok {
+		return list
+	}
+	return []interface{}{v}
+}
+
+// schemaObject returns the object and the rest of a path prefixed with the urn of the core or enterprise user schema,
+// attributes of the enterprise extension are kept in an object named by its urn
+func schemaObject(obj map[string]interface{}, path string) (map[string]interface{}, string) {
+	switch lower := strings.ToLower(path); {
+	case strings.HasPrefix(lower, strings.ToLower(SchemaUser)+":"):
+		return obj, path[len(SchemaUser)+1:]
+	case strings.HasPrefix(lower, strings.ToLower(SchemaEnterpriseUser)+":"):
+		v, _ := lookup(obj, SchemaEnterpriseUser)
+		m, _ := v.(map[string]interface{})
+		return m, path[len(SchemaEnterpriseUser)+1:]
+	}
+	return obj, path
+}
+
+// lookup returns the attribute of obj with name ignoring case, attribute names are case insensitive
+func lookup(obj map[string]interface{}, name string) (interface{}, bool) {
+	if v, ok := obj[name]; ok {
+		return v, true
+	}
+	for k, v := range obj {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// contactFilter returns a store filter selecting a superset of the users the filter matches so fewer contacts
+// are read. Only comparisons of strings at the top level or in a top level and are used, matches decides the rest
+func (e *expr) contactFilter() models.ContactFilter {
+	cf := models.ContactFilter{}
+	comparisons := []*expr{e}
+	for i := 0; i < len(comparisons); i++ {
+		if comparisons[i].op == "and" {
+			comparisons = append(comparisons, comparisons[i].children...)
+		}
+	}
+	for _, c := range comparisons {
+		value, ok := c.value.(string)
+		if !ok || value == "" {
+			continue
+		}
+		path := strings.ToLower(c.path)
+		if strings.HasPrefix(path, strings.ToLower(SchemaUser)+":") {
+			path = path[len(SchemaUser)+1:]
+		}
+		switch {
+		case c.op == "eq" && path == strings.ToLower(SchemaEnterpriseUser)+":organization":
+			cf.Organization = value
+		case c.op == "eq" && path == "addresses.locality":
+			cf.City = value
+		case c.op == "eq" && path == "addresses.region":
+			cf.Region = value
+		case c.op == "eq" && path == "addresses.country":
+			cf.Country = value
+		case c.op == "eq" || c.op == "co" || c.op == "sw" || c.op == "ew":
+			switch path {
+			case "username", "emails", "emails.value", "name.givenname", "name.familyname":
+				if len(value) > len(cf.Query) {
+					cf.Query = value
+				}
+			}
+		}
+	}
+	return cf
+}
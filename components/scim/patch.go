@@ -0,0 +1,219 @@
+package scim
+
+import (
+	"net/http"
+	"strings"
+)
+
+// patchRequest a PatchOp message, RFC 7644 section 3.5.2
+type patchRequest struct {
+	Schemas    []string    `json:"schemas"`
+	Operations []operation `json:"Operations"`
+}
+
+// operation a single add, replace or remove of a patch
+type operation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// applyPatch applies the operations in order to a resource in its json form. Operation names are matched
+// ignoring case and operations without a path apply each member of their value, members may be paths
+// themselves like name.givenName
+func applyPatch(obj map[string]interface{}, operations []operation) *scimError {
+	for _, o := range operations {
+		op := strings.ToLower(o.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return newError(http.StatusBadRequest, "invalidSyntax", "unknown operation "+o.Op)
+		}
+		if o.Path != "" {
+			if err := applyPath(obj, op, o.Path, o.Value); err != nil {
+				return err
+			}
+			continue
+		}
+		members, ok := o.Value.(map[string]interface{})
+		if op == "remove" || !ok {
+			return newError(http.StatusBadRequest, "noTarget", o.Op+" without a path needs an object value")
+		}
+		for path, value := range members {
+			if err := applyPath(obj, op, path, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyPath applies an operation to the attribute a path names, either attr, attr.sub or attr[filter].sub
+func applyPath(obj map[string]interface{}, op, path string, value interface{}) *scimError {
+	invalidPath := newError(http.StatusBadRequest, "invalidPath", "invalid path "+path)
+	switch lower := strings.ToLower(path); {
+	case strings.HasPrefix(lower, strings.ToLower(SchemaUser)+":"):
+		path = path[len(SchemaUser)+1:]
+	case strings.HasPrefix(lower, strings.ToLower(SchemaEnterpriseUser)+":"):
+		ext, ok := child(obj, SchemaEnterpriseUser, op != "remove")
+		if !ok {
+			return nil
+		}
+		obj, path = ext, path[len(SchemaEnterpriseUser)+1:]
+	}
+
+	attr, filter, sub := path, "", ""
+	switch open, dot := strings.IndexByte(path, '['), strings.IndexByte(path, '.'); {
+	case strings.EqualFold(path, SchemaEnterpriseUser):
+		// the whole extension, its urn holds a dot
+	case open >= 0:
+		end := strings.LastIndexByte(path, ']')
+		if end < open || path[end+1:] != "" && !strings.HasPrefix(path[end+1:], ".") {
+			return invalidPath
+		}
+		attr, filter, sub = path[:open], path[open+1:end], strings.TrimPrefix(path[end+1:], ".")
+	case dot >= 0:
+		attr, sub = path[:dot], path[dot+1:]
+	}
+	if attr == "" {
+		return invalidPath
+	}
+
+	if filter != "" {
+		f, err := parseFilter(filter)
+		if err != nil {
+			return invalidPath
+		}
+		return applyFilter(obj, op, attr, f, sub, value)
+	}
+	if sub != "" {
+		if existing, _ := lookup(obj, attr); existing != nil {
+			if _, ok := existing.(map[string]interface{}); !ok {
+				return invalidPath
+			}
+		}
+		m, ok := child(obj, attr, op != "remove")
+		if !ok {
+			return nil
+		}
+		if op == "remove" {
+			remove(m, sub)
+		} else {
+			set(m, sub, value)
+		}
+		return nil
+	}
+
+	existing, found := lookup(obj, attr)
+	switch {
+	case op == "remove":
+		remove(obj, attr)
+	case op == "add" && found:
+		// add appends to multi-valued attributes and merges into complex ones
+		switch e := existing.(type) {
+		case []interface{}:
+			set(obj, attr, append(e, flatten(value)...))
+		case map[string]interface{}:
+			members, ok := value.(map[string]interface{})
+			if !ok {
+				return newError(http.StatusBadRequest, "invalidValue", attr+" needs an object value")
+			}
+			for k, v := range members {
+				set(e, k, v)
+			}
+		default:
+			set(obj, attr, value)
+		}
+	default:
+		set(obj, attr, value)
+	}
+	return nil
+}
+
+// applyFilter applies an operation to the elements of a multi-valued attribute a filter selects, or to their sub
+// attribute. Adding to or replacing a value selected by an equality like emails[type eq "work"].value creates it
+// when no element matches
+func applyFilter(obj map[string]interface{}, op, attr string, f *expr, sub string, value interface{}) *scimError {
+	existing, _ := lookup(obj, attr)
+	list, _ := existing.([]interface{})
+	kept := []interface{}{}
+	matched := false
+	for _, v := range list {
+		element, ok := v.(map[string]interface{})
+		if !ok || !f.matches(element) {
+			kept = append(kept, v)
+			continue
+		}
+		matched = true
+		switch {
+		case op == "remove" && sub == "":
+			continue
+		case op == "remove":
+			remove(element, sub)
+		case sub != "":
+			set(element, sub, value)
+		default:
+			members, ok := value.(map[string]interface{})
+			if !ok {
+				return newError(http.StatusBadRequest, "invalidValue", attr+" needs an object value")
+			}
+			for k, v := range members {
+				set(element, k, v)
+			}
+		}
+		kept = append(kept, element)
+	}
+
+	if !matched && op != "remove" {
+		if f.op != "eq" || strings.Contains(f.path, ".") {
+			return newError(http.StatusBadRequest, "noTarget", "no value of "+attr+" matches the filter")
+		}
+		element := map[string]interface{}{f.path: f.value}
+		if sub != "" {
+			set(element, sub, value)
+		} else if members, ok := value.(map[string]interface{}); ok {
+			for k, v := range members {
+				set(element, k, v)
+			}
+		}
+		kept = append(kept, element)
+	}
+	if len(kept) == 0 {
+		remove(obj, attr)
+		return nil
+	}
+	set(obj, attr, kept)
+	return nil
+}
+
+// child returns the complex attribute of obj with name, creating it when create is set
+func child(obj map[string]interface{}, name string, create bool) (map[string]interface{}, bool) {
+	if v, ok := lookup(obj, name); ok {
+		m, ok := v.(map[string]interface{})
+		return m, ok
+	}
+	if !create {
+		return nil, false
+	}
+	m := map[string]interface{}{}
+	obj[name] = m
+	return m, true
+}
+
+// set sets the attribute of obj with name ignoring case, keeping the spelling of an existing attribute
+func set(obj map[string]interface{}, name string, value interface{}) {
+	for k := range obj {
+		if strings.EqualFold(k, name) {
+			obj[k] = value
+			return
+		}
+	}
+	obj[name] = value
+}
+
+// remove removes the attribute of obj with name ignoring case
+func remove(obj map[string]interface{}, name string) {
+	for k := range obj {
+		if strings.EqualFold(k, name) {
+			delete(obj, k)
+		}
+	}
+}
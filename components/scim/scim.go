@@ -0,0 +1,455 @@
+package scim
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/validation"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// paths served, every contact is a User
+const (
+	// Root path the server is mounted on
+	Root = "/scim/v2"
+
+	usersPath                 = Root + "/Users"
+	serviceProviderConfigPath = Root + "/ServiceProviderConfig"
+	resourceTypesPath         = Root + "/ResourceTypes"
+)
+
+// schema urns
+const (
+	// SchemaUser core User schema
+	SchemaUser = "urn:ietf:params:scim:schemas:core:2.0:User"
+	// SchemaEnterpriseUser enterprise User extension holding the organization
+	SchemaEnterpriseUser = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+
+	schemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	schemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	schemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	schemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// server constants
+const (
+	contentType = "application/scim+json"
+	// defaultCount users listed per page when the request does not ask for a count
+	defaultCount = 100
+	// maxResults most users listed per page
+	maxResults = 1000
+	// maxBodySize largest request body read
+	maxBodySize = 1 << 20
+)
+
+// scimError an error response, RFC 7644 section 3.12
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+	Status   string   `json:"status"`
+	status   int
+}
+
+// newError creates an error response with the status, scimType and detail
+func newError(status int, scimType, detail string) *scimError {
+	return &scimError{
+		Schemas:  []string{schemaError},
+		ScimType: scimType,
+		Detail:   detail,
+		Status:   strconv.Itoa(status),
+		status:   status,
+	}
+}
+
+// Error implements the error interface
+func (e *scimError) Error() string {
+	return e.Detail
+}
+
+// errInactive responded to users set inactive, contacts have no inactive state so deprovisioning deletes them
+var errInactive = newError(http.StatusBadRequest, "mutability", "users can not be deactivated, delete them instead")
+
+// listResponse a page of resources
+type listResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// handler is the SCIM http.Handler
+type handler struct {
+	store     store.Store
+	validator validation.Validator
+	token     string
+}
+
+// NewHandler creates an http.Handler provisioning contacts as SCIM 2.0 Users (RFC 7643, RFC 7644) below Root.
+// Requests need the bearer token, every request is refused when token is empty. Users are validated like contacts created through the api
+func NewHandler(store store.Store, validator validation.Validator, token string) http.Handler {
+	return &handler{
+		store:     store,
+		validator: validator,
+		token:     token,
+	}
+}
+
+// ServeHTTP dispatches a request by path and method
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if h.token == "" || !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(h.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+		writeError(w, newError(http.StatusUnauthorized, "", "a valid bearer token is required"))
+		return
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	id := strings.TrimPrefix(path, usersPath+"/")
+	switch {
+	case path == usersPath && r.Method == http.MethodGet:
+		h.list(w, r)
+	case path == usersPath && r.Method == http.MethodPost:
+		h.create(w, r)
+	case id != path && !strings.Contains(id, "/"):
+		h.user(w, r, id)
+	case path == serviceProviderConfigPath && r.Method == http.MethodGet:
+		h.serviceProviderConfig(w)
+	case path == resourceTypesPath && r.Method == http.MethodGet:
+		h.resourceTypes(w, r)
+	case path == usersPath, path == serviceProviderConfigPath, path == resourceTypesPath:
+		writeError(w, newError(http.StatusMethodNotAllowed, "", "method not allowed"))
+	default:
+		writeError(w, newError(http.StatusNotFound, "", "no such endpoint"))
+	}
+}
+
+// user dispatches a request for a single user by method
+func (h *handler) user(w http.ResponseWriter, r *http.Request, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		if contact, ok := h.load(w, r, id); ok {
+			writeJSON(w, http.StatusOK, newUser(contact, location(r, contact.ID)))
+		}
+	case http.MethodPut:
+		h.replace(w, r, id)
+	case http.MethodPatch:
+		h.patch(w, r, id)
+	case http.MethodDelete:
+		h.delete(w, r, id)
+	default:
+		writeError(w, newError(http.StatusMethodNotAllowed, "", "method not allowed"))
+	}
+}
+
+// list lists a page of the users matching the filter parameter, pages are selected by startIndex and count
+func (h *handler) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	startIndex, count := 1, defaultCount
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{{"startIndex", &startIndex}, {"count", &count}} {
+		if s := q.Get(p.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				writeError(w, newError(http.StatusBadRequest, "invalidValue", p.name+" must be an integer"))
+				return
+			}
+			*p.value = n
+		}
+	}
+	// RFC 7644 section 3.4.2.4 treats values out of range as the nearest valid one
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = 0
+	} else if count > maxResults {
+		count = maxResults
+	}
+
+	var f *expr
+	filter := models.ContactFilter{}
+	if s := q.Get("filter"); s != "" {
+		var err error
+		if f, err = parseFilter(s); err != nil {
+			writeError(w, newError(http.StatusBadRequest, "invalidFilter", "the filter can not be parsed"))
+			return
+		}
+		filter = f.contactFilter()
+	}
+
+	total := 0
+	users := []user{}
+	err := h.store.Each(r.Context(), filter, func(contact models.Contact) error {
+		u := newUser(contact, location(r, contact.ID))
+		if f != nil {
+			obj, err := toMap(u)
+			if err != nil || !f.matches(obj) {
+				return err
+			}
+		}
+		total++
+		if total >= startIndex && len(users) < count {
+			users = append(users, u)
+		}
+		return nil
+	})
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(users),
+		Resources:    users,
+	})
+}
+
+// create creates the contact of a user
+func (h *handler) create(w http.ResponseWriter, r *http.Request) {
+	u := user{}
+	if err := decode(r, &u); err != nil {
+		writeError(w, err)
+		return
+	}
+	if !u.active() {
+		writeError(w, errInactive)
+		return
+	}
+	contact := u.contact("")
+	if err := h.validate(&contact); err != nil {
+		writeError(w, err)
+		return
+	}
+	created, err := h.store.Create(r.Context(), contact)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	w.Header().Set("Location", location(r, created.ID))
+	writeJSON(w, http.StatusCreated, newUser(created, location(r, created.ID)))
+}
+
+// replace replaces the contact of a user. The note, which users have no attribute for, is kept, as is the uid
+// when the user has no external id
+func (h *handler) replace(w http.ResponseWriter, r *http.Request, id string) {
+	existing, ok := h.load(w, r, id)
+	if !ok {
+		return
+	}
+	u := user{}
+	if err := decode(r, &u); err != nil {
+		writeError(w, err)
+		return
+	}
+	h.save(w, r, existing, u)
+}
+
+// patch applies a PatchOp to the user of a contact
+func (h *handler) patch(w http.ResponseWriter, r *http.Request, id string) {
+	existing, ok := h.load(w, r, id)
+	if !ok {
+		return
+	}
+	req := patchRequest{}
+	if err := decode(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	obj, err := toMap(newUser(existing, location(r, existing.ID)))
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	if err := applyPatch(obj, req.Operations); err != nil {
+		writeError(w, err)
+		return
+	}
+	u := user{}
+	if data, err := json.Marshal(obj); err != nil || json.Unmarshal(data, &u) != nil {
+		writeError(w, newError(http.StatusBadRequest, "invalidValue", "the patched user is not valid"))
+		return
+	}
+	h.save(w, r, existing, u)
+}
+
+// save updates existing with the attributes of u
+func (h *handler) save(w http.ResponseWriter, r *http.Request, existing models.Contact, u user) {
+	ctx := r.Context()
+	if !u.active() {
+		writeError(w, errInactive)
+		return
+	}
+
+	contact := u.contact(existing.Email)
+	contact.ID = existing.ID
+	contact.Note = existing.Note
+	if contact.UID == "" {
+		contact.UID = existing.UID
+	}
+	if err := h.validate(&contact); err != nil {
+		writeError(w, err)
+		return
+	}
+	updated, err := h.store.Update(ctx, contact)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newUser(updated, location(r, updated.ID)))
+}
+
+// delete deletes the contact of a user
+func (h *handler) delete(w http.ResponseWriter, r *http.Request, id string) {
+	if _, err := strconv.Atoi(id); err != nil {
+		storeError(w, store.ErrNotFound)
+		return
+	}
+	if err := h.store.Delete(r.Context(), id); err != nil {
+		storeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// load returns the contact with id, responding 404 when there is none
+func (h *handler) load(w http.ResponseWriter, r *http.Request, id string) (models.Contact, bool) {
+	if _, err := strconv.Atoi(id); err != nil {
+		storeError(w, store.ErrNotFound)
+		return models.Contact{}, false
+	}
+	contact, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		storeError(w, err)
+		return models.Contact{}, false
+	}
+	return contact, true
+}
+
+// validate normalizes and validates a contact, the field errors are listed in the detail
+func (h *handler) validate(contact *models.Contact) *scimError {
+	errs := h.validator.Validate(contact)
+	if errs == nil {
+		return nil
+	}
+	details := []string{}
+	for _, e := range errs {
+		details = append(details, e.Field+": "+e.Message)
+	}
+	return newError(http.StatusBadRequest, "invalidValue", strings.Join(details, "; "))
+}
+
+// serviceProviderConfig describes the features supported
+func (h *handler) serviceProviderConfig(w http.ResponseWriter) {
+	supported := func(b bool) map[string]interface{} {
+		return map[string]interface{}{"supported": b}
+	}
+	schemes := []map[string]interface{}{{
+		"type":        "oauthbearertoken",
+		"name":        "Bearer Token",
+		"description": "Authentication with the token configured as scim.token",
+	}}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"schemas":               []string{schemaServiceProviderConfig},
+		"patch":                 supported(true),
+		"bulk":                  map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":                map[string]interface{}{"supported": true, "maxResults": maxResults},
+		"changePassword":        supported(false),
+		"sort":                  supported(false),
+		"etag":                  supported(false),
+		"authenticationSchemes": schemes,
+	})
+}
+
+// resourceTypes lists the User resource type, groups are not supported
+func (h *handler) resourceTypes(w http.ResponseWriter, r *http.Request) {
+	users := map[string]interface{}{
+		"schemas":          []string{schemaResourceType},
+		"id":               "User",
+		"name":             "User",
+		"endpoint":         "/Users",
+		"schema":           SchemaUser,
+		"schemaExtensions": []map[string]interface{}{{"schema": SchemaEnterpriseUser, "required": false}},
+		"meta":             meta{ResourceType: "ResourceType", Location: baseURL(r) + resourceTypesPath + "/User"},
+	}
+	writeJSON(w, http.StatusOK, listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: 1,
+		StartIndex:   1,
+		ItemsPerPage: 1,
+		Resources:    []interface{}{users},
+	})
+}
+
+// baseURL returns the scheme and host a request was sent to
+func baseURL(r *http.Request) string {
+	if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+// location returns the url of the user with id
+func location(r *http.Request, id string) string {
+	return baseURL(r) + usersPath + "/" + id
+}
+
+// toMap returns the json form of a resource, which filters and patches operate on
+func toMap(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	obj := map[string]interface{}{}
+	return obj, json.Unmarshal(data, &obj)
+}
+
+// decode reads the json body of a request into v
+func decode(r *http.Request, v interface{}) *scimError {
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(v); err != nil {
+		return newError(http.StatusBadRequest, "invalidSyntax", err.Error())
+	}
+	return nil
+}
+
+// storeError responds with the error response of a store error
+func storeError(w http.ResponseWriter, err error) {
+	switch err {
+	case store.ErrNotFound:
+		writeError(w, newError(http.StatusNotFound, "", "user not found"))
+	case store.ErrDuplicateEmail:
+		writeError(w, newError(http.StatusConflict, "uniqueness", err.Error()))
+	default:
+		internalError(w, err)
+	}
+}
+
+// internalError logs err and responds 500
+func internalError(w http.ResponseWriter, err error) {
+	log.Printf("scim error: %s", err)
+	writeError(w, newError(http.StatusInternalServerError, "", http.StatusText(http.StatusInternalServerError)))
+}
+
+// writeError writes an error response
+func writeError(w http.ResponseWriter, e *scimError) {
+	writeJSON(w, e.status, e)
+}
+
+// writeJSON writes v as a SCIM json response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
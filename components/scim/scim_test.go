@@ -0,0 +1,234 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/validation"
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/squanchersquanch/contacts/services/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testToken = "secret"
+
+	janeUser = `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "jane@acme.com",
+		"externalId": "00u1", "name": {"givenName": "Jane", "familyName": "Roe"},
+		"emails": [{"value": "jane@acme.com", "type": "work", "primary": true}],
+		"phoneNumbers": [{"value": "+1 555 0100", "type": "work"}],
+		"addresses": [{"type": "work", "locality": "Springfield", "country": "US"}],
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"organization": "Acme"}}`
+)
+
+// serve runs an authenticated request against h
+func serve(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// userOf decodes a user response checking its status
+func userOf(t *testing.T, rr *httptest.ResponseRecorder, status int) user {
+	assert.Equal(t, status, rr.Code, rr.Body.String())
+	assert.Equal(t, contentType, rr.Header().Get("Content-Type"))
+	u := user{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &u))
+	return u
+}
+
+// errorOf decodes an error response checking its status and scimType
+func errorOf(t *testing.T, rr *httptest.ResponseRecorder, status int, scimType string) scimError {
+	assert.Equal(t, status, rr.Code, rr.Body.String())
+	e := scimError{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &e))
+	assert.Equal(t, []string{schemaError}, e.Schemas)
+	assert.Equal(t, scimType, e.ScimType)
+	return e
+}
+
+func newTestHandler() (http.Handler, store.Store) {
+	s := store.NewMemoryStore()
+	return NewHandler(s, validation.NewValidator(&config.Config{}), testToken), s
+}
+
+func TestFilter(t *testing.T) {
+	obj, err := toMap(newUser(models.Contact{
+		ID: "7", UID: "00u7", FirstName: "John", LastName: "Doe", Email: "john@acme.com", Organization: "Acme", City: "Springfield",
+	}, "http://example.com/scim/v2/Users/7"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		filter  string
+		matches bool
+	}{
+		{`userName eq "JOHN@acme.com"`, true},
+		{`userName eq "jane@acme.com"`, false},
+		{`externalId eq "00U7"`, false},
+		{`name.givenName sw "jo" and name.familyName ew "oe"`, true},
+		{`emails co "@acme" or userName eq "x"`, true},
+		{`emails[type eq "work" and value ew ".com"]`, true},
+		{`emails[type eq "home"]`, false},
+		{`not (phoneNumbers pr)`, true},
+		{`active eq true and meta.resourceType eq "User"`, true},
+		{`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:organization eq "acme"`, true},
+		{`addresses.locality ne "Springfield"`, false},
+		{`title eq null`, true},
+		{`userName gt "a" and userName lt "k"`, true},
+		{`((userName eq "x") or (id eq "7"))`, true},
+	}
+	for _, test := range tests {
+		f, err := parseFilter(test.filter)
+		if assert.NoError(t, err, test.filter) {
+			assert.Equal(t, test.matches, f.matches(obj), test.filter)
+		}
+	}
+
+	for _, invalid := range []string{`userName`, `userName eq`, `userName is "x"`, `(userName pr`, `emails[type eq "work"`, `userName eq "x" and`, `userName eq "x`} {
+		_, err := parseFilter(invalid)
+		assert.Equal(t, errFilter, err, invalid)
+	}
+
+	f, err := parseFilter(`userName eq "john@acme.com" and urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:organization eq "Acme"`)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ContactFilter{Query: "john@acme.com", Organization: "Acme"}, f.contactFilter())
+	f, err = parseFilter(`userName eq "john@acme.com" or name.givenName eq "Jo"`)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ContactFilter{}, f.contactFilter())
+}
+
+func TestPatch(t *testing.T) {
+	obj, err := toMap(newUser(models.Contact{ID: "7", FirstName: "John", LastName: "Doe", Email: "john@acme.com"}, ""))
+	assert.NoError(t, err)
+
+	ops := []operation{}
+	assert.NoError(t, json.Unmarshal([]byte(`[
+		{"op": "Replace", "path": "name.givenName", "value": "Johnny"},
+		{"op": "add", "path": "phoneNumbers[type eq \"work\"].value", "value": "+15550100"},
+		{"op": "replace", "path": "emails[type eq \"work\"].value", "value": "johnny@acme.com"},
+		{"op": "add", "value": {"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:organization": "Acme", "displayName": "Johnny Doe"}},
+		{"op": "remove", "path": "name.familyName"}
+	]`), &ops))
+	assert.Nil(t, applyPatch(obj, ops))
+
+	u := user{}
+	data, _ := json.Marshal(obj)
+	assert.NoError(t, json.Unmarshal(data, &u))
+	contact := u.contact("john@acme.com")
+	assert.Equal(t, "Johnny", contact.FirstName)
+	assert.Equal(t, "", contact.LastName)
+	assert.Equal(t, "johnny@acme.com", contact.Email)
+	assert.Equal(t, "+15550100", contact.Phone)
+	assert.Equal(t, "Acme", contact.Organization)
+
+	assert.Equal(t, "invalidSyntax", applyPatch(obj, []operation{{Op: "move", Path: "userName"}}).ScimType)
+	assert.Equal(t, "noTarget", applyPatch(obj, []operation{{Op: "remove"}}).ScimType)
+	assert.Equal(t, "invalidPath", applyPatch(obj, []operation{{Op: "replace", Path: "emails[type eq", Value: "x"}}).ScimType)
+	assert.Equal(t, "noTarget", applyPatch(obj, []operation{{Op: "replace", Path: `emails[value co "x"].type`, Value: "home"}}).ScimType)
+}
+
+func TestUsers(t *testing.T) {
+	h, s := newTestHandler()
+
+	created := userOf(t, serve(h, "POST", usersPath, janeUser), http.StatusCreated)
+	assert.Equal(t, "1", created.ID)
+	assert.Equal(t, "jane@acme.com", created.UserName)
+	assert.Equal(t, "00u1", created.ExternalID)
+	assert.Equal(t, "http://example.com/scim/v2/Users/1", created.Meta.Location)
+	contact, err := s.Get(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.Contact{ID: "1", UID: "00u1", FirstName: "Jane", LastName: "Roe", Email: "jane@acme.com",
+		Phone: "+15550100", Organization: "Acme", City: "Springfield", Country: "US"}, contact)
+
+	errorOf(t, serve(h, "POST", usersPath, janeUser), http.StatusConflict, "uniqueness")
+	errorOf(t, serve(h, "POST", usersPath, `{"userName": "not an email"}`), http.StatusBadRequest, "invalidValue")
+	errorOf(t, serve(h, "POST", usersPath, `{"userName": `), http.StatusBadRequest, "invalidSyntax")
+	userOf(t, serve(h, "POST", usersPath, `{"userName": "john@example.com", "displayName": "John Doe"}`), http.StatusCreated)
+
+	u := userOf(t, serve(h, "GET", usersPath+"/2", ""), http.StatusOK)
+	assert.Equal(t, &name{Formatted: "John Doe", GivenName: "John", FamilyName: "Doe"}, u.Name)
+	errorOf(t, serve(h, "GET", usersPath+"/99", ""), http.StatusNotFound, "")
+	errorOf(t, serve(h, "GET", usersPath+"/abc", ""), http.StatusNotFound, "")
+
+	list := struct {
+		listResponse
+		Resources []user `json:"Resources"`
+	}{}
+	rr := serve(h, "GET", usersPath+`?filter=userName+eq+"JANE@acme.com"`, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	assert.Equal(t, 1, list.TotalResults)
+	if assert.Len(t, list.Resources, 1) {
+		assert.Equal(t, "1", list.Resources[0].ID)
+	}
+
+	rr = serve(h, "GET", usersPath+"?startIndex=2&count=5", "")
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	assert.Equal(t, 2, list.TotalResults)
+	assert.Equal(t, 2, list.StartIndex)
+	assert.Equal(t, 1, list.ItemsPerPage)
+	assert.Equal(t, "2", list.Resources[0].ID)
+
+	rr = serve(h, "GET", usersPath+"?count=0", "")
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+	assert.Equal(t, 2, list.TotalResults)
+	assert.Empty(t, list.Resources)
+	errorOf(t, serve(h, "GET", usersPath+"?filter=userName+eq", ""), http.StatusBadRequest, "invalidFilter")
+	errorOf(t, serve(h, "GET", usersPath+"?count=many", ""), http.StatusBadRequest, "invalidValue")
+
+	u = userOf(t, serve(h, "PUT", usersPath+"/2", `{"userName": "john.doe@example.com", "name": {"givenName": "Johnny"}}`), http.StatusOK)
+	assert.Equal(t, "john.doe@example.com", u.UserName)
+	assert.Equal(t, "Johnny", u.Name.GivenName)
+	errorOf(t, serve(h, "PUT", usersPath+"/2", `{"userName": "jane@acme.com", "displayName": "Jane Roe"}`), http.StatusConflict, "uniqueness")
+
+	u = userOf(t, serve(h, "PATCH", usersPath+"/2", `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "replace", "path": "userName", "value": "johnny@example.com"}]}`), http.StatusOK)
+	assert.Equal(t, "johnny@example.com", u.UserName)
+
+	errorOf(t, serve(h, "PATCH", usersPath+"/2", `{"Operations": [{"op": "Replace", "path": "active", "value": "False"}]}`), http.StatusBadRequest, "mutability")
+	errorOf(t, serve(h, "PUT", usersPath+"/2", `{"userName": "johnny@example.com", "active": false}`), http.StatusBadRequest, "mutability")
+	errorOf(t, serve(h, "POST", usersPath, `{"userName": "gone@example.com", "active": false}`), http.StatusBadRequest, "mutability")
+	contact, err = s.Get(context.Background(), "2")
+	assert.NoError(t, err)
+	assert.Equal(t, "johnny@example.com", contact.Email)
+
+	assert.Equal(t, http.StatusNoContent, serve(h, "DELETE", usersPath+"/1", "").Code)
+	errorOf(t, serve(h, "DELETE", usersPath+"/1", ""), http.StatusNotFound, "")
+}
+
+func TestDiscoveryAndAuth(t *testing.T) {
+	h, _ := newTestHandler()
+
+	rr := serve(h, "GET", serviceProviderConfigPath, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"patch":{"supported":true}`)
+	assert.Contains(t, rr.Body.String(), `"oauthbearertoken"`)
+
+	rr = serve(h, "GET", resourceTypesPath, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"endpoint":"/Users"`)
+
+	errorOf(t, serve(h, "GET", Root+"/Groups", ""), http.StatusNotFound, "")
+	errorOf(t, serve(h, "DELETE", usersPath, ""), http.StatusMethodNotAllowed, "")
+
+	req := httptest.NewRequest("GET", usersPath, nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	errorOf(t, rr, http.StatusUnauthorized, "")
+	assert.Equal(t, `Bearer realm="scim"`, rr.Header().Get("WWW-Authenticate"))
+
+	// without a token every request is refused
+	req = httptest.NewRequest("GET", usersPath, nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rr = httptest.NewRecorder()
+	NewHandler(store.NewMemoryStore(), validation.NewValidator(&config.Config{}), "").ServeHTTP(rr, req)
+	errorOf(t, rr, http.StatusUnauthorized, "")
+}
@@ -0,0 +1,187 @@
+package scim
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// flag a boolean that also accepts the strings "True" and "False" some identity providers send
+type flag bool
+
+// UnmarshalJSON reads a json bool or a string holding one
+func (f *flag) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		*f = flag(b)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b, err := strconv.ParseBool(s)
+	*f = flag(b)
+	return err
+}
+
+// user a SCIM User resource, RFC 7643 section 4.1
+type user struct {
+	Schemas      []string     `json:"schemas"`
+	ID           string       `json:"id,omitempty"`
+	ExternalID   string       `json:"externalId,omitempty"`
+	UserName     string       `json:"userName"`
+	Name         *name        `json:"name,omitempty"`
+	DisplayName  string       `json:"displayName,omitempty"`
+	Active       *flag        `json:"active,omitempty"`
+	Emails       []multiValue `json:"emails,omitempty"`
+	PhoneNumbers []multiValue `json:"phoneNumbers,omitempty"`
+	Addresses    []address    `json:"addresses,omitempty"`
+	Enterprise   *enterprise  `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+	Meta         *meta        `json:"meta,omitempty"`
+}
+
+// name the components of the name of a user
+type name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// multiValue an email or phone number
+type multiValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary flag   `json:"primary,omitempty"`
+}
+
+// address a physical mailing address
+type address struct {
+	Formatted     string `json:"formatted,omitempty"`
+	StreetAddress string `json:"streetAddress,omitempty"`
+	Locality      string `json:"locality,omitempty"`
+	Region        string `json:"region,omitempty"`
+	PostalCode    string `json:"postalCode,omitempty"`
+	Country       string `json:"country,omitempty"`
+	Type          string `json:"type,omitempty"`
+	Primary       flag   `json:"primary,omitempty"`
+}
+
+// enterprise attributes of the enterprise user extension, RFC 7643 section 4.3
+type enterprise struct {
+	Organization string `json:"organization,omitempty"`
+}
+
+// meta resource metadata, contacts have no timestamps or versions
+type meta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location"`
+}
+
+// newUser returns the User resource of contact, location is the url of the resource.
+// The email is the user name and the uid the external id
+func newUser(contact models.Contact, location string) user {
+	active := flag(true)
+	u := user{
+		Schemas:     []string{SchemaUser},
+		ID:          contact.ID,
+		ExternalID:  contact.UID,
+		UserName:    contact.Email,
+		DisplayName: strings.TrimSpace(contact.FirstName + " " + contact.LastName),
+		Active:      &active,
+		Meta:        &meta{ResourceType: "User", Location: location},
+	}
+	if contact.FirstName != "" || contact.LastName != "" {
+		u.Name = &name{Formatted: u.DisplayName, GivenName: contact.FirstName, FamilyName: contact.LastName}
+	}
+	if contact.Email != "" {
+		u.Emails = []multiValue{{Value: contact.Email, Type: "work", Primary: true}}
+	}
+	if contact.Phone != "" {
+		u.PhoneNumbers = []multiValue{{Value: contact.Phone, Type: "work", Primary: true}}
+	}
+	if contact.Street != "" || contact.City != "" || contact.Region != "" || contact.PostalCode != "" || contact.Country != "" {
+		u.Addresses = []address{{
+			StreetAddress: contact.Street,
+			Locality:      contact.City,
+			Region:        contact.Region,
+			PostalCode:    contact.PostalCode,
+			Country:       contact.Country,
+			Type:          "work",
+			Primary:       true,
+		}}
+	}
+	if contact.Organization != "" {
+		u.Schemas = append(u.Schemas, SchemaEnterpriseUser)
+		u.Enterprise = &enterprise{Organization: contact.Organization}
+	}
+	return u
+}
+
+// contact maps the user to a contact without an id, previous is the email the contact had before. The email
+// is the primary email unless only the user name was changed from it, the phone and address are the primary
+// ones. Names fall back to the formatted and display names
+func (u *user) contact(previous string) models.Contact {
+	contact := models.Contact{
+		UID:   u.ExternalID,
+		Email: strings.TrimSpace(u.UserName),
+	}
+	if i := primary(len(u.Emails), func(i int) bool { return bool(u.Emails[i].Primary) }); i >= 0 && u.Emails[i].Value != "" {
+		email := strings.TrimSpace(u.Emails[i].Value)
+		renamed := !strings.EqualFold(contact.Email, previous) && strings.Contains(contact.Email, "@")
+		if !strings.EqualFold(email, previous) || !renamed {
+			contact.Email = email
+		}
+	}
+	if u.Name != nil {
+		contact.FirstName, contact.LastName = u.Name.GivenName, u.Name.FamilyName
+		if contact.FirstName == "" && contact.LastName == "" {
+			contact.FirstName, contact.LastName = splitName(u.Name.Formatted)
+		}
+	}
+	if contact.FirstName == "" && contact.LastName == "" {
+		contact.FirstName, contact.LastName = splitName(u.DisplayName)
+	}
+	if i := primary(len(u.PhoneNumbers), func(i int) bool { return bool(u.PhoneNumbers[i].Primary) }); i >= 0 {
+		contact.Phone = u.PhoneNumbers[i].Value
+	}
+	if i := primary(len(u.Addresses), func(i int) bool { return bool(u.Addresses[i].Primary) }); i >= 0 {
+		a := u.Addresses[i]
+		contact.Street, contact.City, contact.Region = a.StreetAddress, a.Locality, a.Region
+		contact.PostalCode, contact.Country = a.PostalCode, a.Country
+	}
+	if u.Enterprise != nil {
+		contact.Organization = u.Enterprise.Organization
+	}
+	return contact
+}
+
+// active reports whether the user is active, users are active unless they say otherwise
+func (u *user) active() bool {
+	return u.Active == nil || bool(*u.Active)
+}
+
+// primary returns the index of the primary value of a multi-valued attribute with n values, the first one when
+// none is primary and -1 when there are none
+func primary(n int, isPrimary func(i int) bool) int {
+	for i := 0; i < n; i++ {
+		if isPrimary(i) {
+			return i
+		}
+	}
+	if n > 0 {
+		return 0
+	}
+	return -1
+}
+
+// splitName splits a full name into first names and the last name
+func splitName(full string) (string, string) {
+	fields := strings.Fields(full)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	return strings.Join(fields[:len(fields)-1], " "), fields[len(fields)-1]
+}
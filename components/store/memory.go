@@ -0,0 +1,639 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// errPageFull stops Each once a page is full
+var errPageFull = errors.New("page full")
+
+// memoryStore is an in memory implementation of the Store interface, used by tests and tools
+type memoryStore struct {
+	mu       sync.RWMutex
+	lastID   int
+	contacts map[string]models.Contact
+	history  []models.HistoryEntry
+	changes  []models.Change
+
+	lastJobID int
+	jobs      map[string]*memoryJob
+
+	lastExportID int
+	exports      map[string]*memoryExport
+}
+
+// memoryJob an import job along with its file and last heartbeat
+type memoryJob struct {
+	job       models.ImportJob
+	data      []byte
+	heartbeat time.Time
+}
+
+// memoryExport an export job along with its last heartbeat
+type memoryExport struct {
+	job       models.ExportJob
+	heartbeat time.Time
+}
+
+// NewMemoryStore creates an empty Store kept in memory
+func NewMemoryStore() Store {
+	return &memoryStore{
+		contacts: map[string]models.Contact{},
+		jobs:     map[string]*memoryJob{},
+		exports:  map[string]*memoryExport{},
+	}
+}
+
+// List returns every contact ordered by id
+func (s *memoryStore) List(ctx context.Context) ([]models.Contact, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	contacts := make([]models.Contact, 0, len(s.contacts))
+	for _, contact := range s.contacts {
+		contacts = append(contacts, contact)
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		a, _ := strconv.Atoi(contacts[i].ID)
+		b, _ := strconv.Atoi(contacts[j].ID)
+		return a < b
+	})
+	return contacts, nil
+}
+
+// Each calls fn with every contact matching filter ordered by id, stopping when ctx is done
+func (s *memoryStore) Each(ctx context.Context, filter models.ContactFilter, fn EachFunc) error {
+	contacts, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, contact := range contacts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !filter.Matches(contact) {
+			continue
+		}
+		if err := fn(contact); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Page returns up to limit contacts matching filter with an id greater than after, ordered by id
+func (s *memoryStore) Page(ctx context.Context, filter models.ContactFilter, after string, limit int) ([]models.Contact, error) {
+	start, _ := strconv.Atoi(after)
+	page := []models.Contact{}
+	err := s.Each(ctx, filter, func(contact models.Contact) error {
+		if id, _ := strconv.Atoi(contact.ID); id <= start {
+			return nil
+		}
+		if limit > 0 && len(page) == limit {
+			return errPageFull
+		}
+		page = append(page, contact)
+		return nil
+	})
+	if err != nil && err != errPageFull {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Get returns the contact with id
+func (s *memoryStore) Get(ctx context.Context, id string) (models.Contact, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	contact, ok := s.contacts[id]
+	if !ok {
+		return models.Contact{}, ErrNotFound
+	}
+	return contact, nil
+}
+
+// GetByUID returns the contact with the lowest id using uid
+func (s *memoryStore) GetByUID(ctx context.Context, uid string) (models.Contact, error) {
+	contacts, err := s.List(ctx)
+	if err != nil {
+		return models.Contact{}, err
+	}
+	for _, contact := range contacts {
+		if uid != "" && contact.UID == uid {
+			return contact, nil
+		}
+	}
+	return models.Contact{}, ErrNotFound
+}
+
+// Create inserts a new contact returning it with its id
+func (s *memoryStore) Create(ctx context.Context, contact models.Contact) (models.Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(contact)
+}
+
+// Update replaces the contact with the same id
+func (s *memoryStore) Update(ctx context.Context, contact models.Contact) (models.Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(contact)
+}
+
+// UpdateIf replaces the contact with the same id when check accepts the stored contact
+func (s *memoryStore) UpdateIf(ctx context.Context, contact models.Contact, check CheckFunc) (models.Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.contacts[contact.ID]
+	if !ok {
+		return models.Contact{}, ErrNotFound
+	}
+	if err := check(old); err != nil {
+		return models.Contact{}, err
+	}
+	return s.update(contact)
+}
+
+// UpsertByEmail inserts the contact or updates the contact with the same email keeping the stored optional
+// fields contact leaves empty, reporting whether a new contact was created
+func (s *memoryStore) UpsertByEmail(ctx context.Context, contact models.Contact) (models.Contact, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.findByEmail(contact.Email)
+	if !ok {
+		contact, err := s.create(contact)
+		return contact, err == nil, err
+	}
+	contact.ID = existing.ID
+	optional := []struct {
+		value  *string
+		stored string
+	}{
+		{&contact.Organization, existing.Organization}, {&contact.Note, existing.Note}, {&contact.UID, existing.UID},
+		{&contact.Street, existing.Street}, {&contact.City, existing.City}, {&contact.Region, existing.Region},
+		{&contact.PostalCode, existing.PostalCode}, {&contact.Country, existing.Country},
+	}
+	for _, field := range optional {
+		if *field.value == "" {
+			*field.value = field.stored
+		}
+	}
+	contact, err := s.update(contact)
+	return contact, false, err
+}
+
+// Delete removes the contact with id
+func (s *memoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contact, ok := s.contacts[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.contacts, id)
+	s.logChange(contact, true)
+	return nil
+}
+
+// DeleteIf removes the contact with id when check accepts it
+func (s *memoryStore) DeleteIf(ctx context.Context, id string, check CheckFunc) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contact, ok := s.contacts[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := check(contact); err != nil {
+		return err
+	}
+	delete(s.contacts, id)
+	s.logChange(contact, true)
+	return nil
+}
+
+// Merge combines the contacts in req with merge and keeps only the result, recording the merge in history
+func (s *memoryStore) Merge(ctx context.Context, req models.MergeRequest, merge MergeFunc) (models.Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contacts := []models.Contact{}
+	for _, id := range req.IDs {
+		contact, ok := s.contacts[id]
+		if !ok {
+			return models.Contact{}, ErrNotFound
+		}
+		contacts = append(contacts, contact)
+	}
+	merged, err := merge(contacts)
+	if err != nil {
+		return models.Contact{}, err
+	}
+	history := newMergeHistory(req, contacts, merged)
+
+	for _, contact := range s.contacts {
+		if contact.Email == merged.Email && contact.ID != merged.ID && !contains(history.MergedIDs, contact.ID) {
+			return models.Contact{}, ErrDuplicateEmail
+		}
+	}
+	for _, id := range history.MergedIDs {
+		s.logChange(s.contacts[id], true)
+		delete(s.contacts, id)
+	}
+	s.logUpdate(s.contacts[merged.ID], merged)
+	s.contacts[merged.ID] = merged
+	s.history = append(s.history, models.HistoryEntry{
+		ID:        strconv.Itoa(len(s.history) + 1),
+		ContactID: merged.ID,
+		Action:    HistoryMerge,
+		Data:      history,
+		CreatedAt: time.Now(),
+	})
+	return merged, nil
+}
+
+// BulkImport stores every row of next at once, matching rows by email when byEmail is set or else by id.
+// Rows repeating an earlier email or id, unknown ids and emails of other contacts are skipped as conflicts,
+// nothing is stored when next fails
+func (s *memoryStore) BulkImport(ctx context.Context, byEmail bool, next RowSource) (BulkResult, error) {
+	rows := []BulkRow{}
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return BulkResult{}, err
+		}
+		rows = append(rows, row)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := BulkResult{Conflicts: []BulkConflict{}}
+	emails, ids := map[string]bool{}, map[string]bool{}
+	for _, row := range rows {
+		contact := row.Contact
+		var err error
+		created := false
+		switch {
+		case emails[contact.Email]:
+			err = ErrRepeatedEmail
+		case !byEmail && contact.ID != "" && ids[contact.ID]:
+			err = ErrRepeatedID
+		case byEmail:
+			contact.ID = ""
+			if existing, ok := s.findByEmail(contact.Email); ok {
+				contact.ID = existing.ID
+				_, err = s.update(contact)
+			} else {
+				_, err = s.create(contact)
+				created = true
+			}
+		case contact.ID != "":
+			_, err = s.update(contact)
+		default:
+			_, err = s.create(contact)
+			created = true
+		}
+		emails[contact.Email] = true
+		ids[contact.ID] = true
+
+		switch err {
+		case nil:
+			if created {
+				result.Created++
+			} else {
+				result.Updated++
+			}
+		case ErrNotFound, ErrRepeatedID:
+			result.Conflicts = append(result.Conflicts, BulkConflict{Index: row.Index, Field: "id", Message: err.Error()})
+		default:
+			result.Conflicts = append(result.Conflicts, BulkConflict{Index: row.Index, Field: "email", Message: err.Error()})
+		}
+	}
+	return result, nil
+}
+
+// SyncToken returns the token of the latest change
+func (s *memoryStore) SyncToken(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.changes)), nil
+}
+
+// Changes returns the latest change of every contact and uid changed after since
+func (s *memoryStore) Changes(ctx context.Context, since int64) ([]models.Change, int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token := int64(len(s.changes))
+	if since < 0 || since > token {
+		return nil, 0, ErrInvalidSyncToken
+	}
+	latest := map[[2]string]int64{}
+	for _, change := range s.changes[since:] {
+		latest[[2]string{change.ContactID, change.UID}] = change.Token
+	}
+	changes := []models.Change{}
+	for _, change := range s.changes[since:] {
+		if latest[[2]string{change.ContactID, change.UID}] == change.Token {
+			changes = append(changes, change)
+		}
+	}
+	return changes, token, nil
+}
+
+// CreateJob queues a job importing data
+func (s *memoryStore) CreateJob(ctx context.Context, job models.ImportJob, data []byte) (models.ImportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastJobID++
+	job.ID = strconv.Itoa(s.lastJobID)
+	job.Status = models.ImportQueued
+	job.CreatedAt = time.Now()
+	s.jobs[job.ID] = &memoryJob{job: job, data: data}
+	return job, nil
+}
+
+// GetJob returns the import job with id
+func (s *memoryStore) GetJob(ctx context.Context, id string) (models.ImportJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	j, ok := s.jobs[id]
+	if !ok {
+		return models.ImportJob{}, ErrJobNotFound
+	}
+	return j.job, nil
+}
+
+// ClaimJob marks the oldest queued or abandoned job as running and returns it with its file
+func (s *memoryStore) ClaimJob(ctx context.Context, staleAfter time.Duration) (models.ImportJob, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var claimed *memoryJob
+	for _, j := range s.jobs {
+		stale := j.job.Status == models.ImportRunning && now.Sub(j.heartbeat) > staleAfter
+		if j.job.Status != models.ImportQueued && !stale {
+			continue
+		}
+		if claimed == nil || jobIndex(j.job.ID) < jobIndex(claimed.job.ID) {
+			claimed = j
+		}
+	}
+	if claimed == nil {
+		return models.ImportJob{}, nil, ErrNoJob
+	}
+	claimed.job.Status = models.ImportRunning
+	claimed.job.Processed = 0
+	claimed.job.StartedAt = &now
+	claimed.heartbeat = now
+	return claimed.job, claimed.data, nil
+}
+
+// HeartbeatJob records the progress of a running job and returns its status
+func (s *memoryStore) HeartbeatJob(ctx context.Context, id string, processed int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[id]
+	if !ok {
+		return "", ErrJobNotFound
+	}
+	j.job.Processed = processed
+	j.heartbeat = time.Now()
+	return j.job.Status, nil
+}
+
+// FinishJob stores the outcome of a job and drops its file
+func (s *memoryStore) FinishJob(ctx context.Context, job models.ImportJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[job.ID]
+	if !ok {
+		return ErrJobNotFound
+	}
+	now := time.Now()
+	if j.job.Status != models.ImportCancelled {
+		j.job.Status = job.Status
+	}
+	j.job.Processed = job.Processed
+	j.job.Report = job.Report
+	j.job.Error = job.Error
+	j.job.FinishedAt = &now
+	j.data = nil
+	return nil
+}
+
+// CancelJob cancels a queued or running job
+func (s *memoryStore) CancelJob(ctx context.Context, id string) (models.ImportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[id]
+	if !ok {
+		return models.ImportJob{}, ErrJobNotFound
+	}
+	if j.job.Finished() {
+		return models.ImportJob{}, ErrJobFinished
+	}
+	now := time.Now()
+	j.job.Status = models.ImportCancelled
+	j.job.FinishedAt = &now
+	j.data = nil
+	return j.job, nil
+}
+
+// CreateExportJob queues an export
+func (s *memoryStore) CreateExportJob(ctx context.Context, job models.ExportJob) (models.ExportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastExportID++
+	job.ID = strconv.Itoa(s.lastExportID)
+	job.Status = models.ExportQueued
+	job.CreatedAt = time.Now()
+	s.exports[job.ID] = &memoryExport{job: job}
+	return job, nil
+}
+
+// GetExportJob returns the export job with id
+func (s *memoryStore) GetExportJob(ctx context.Context, id string) (models.ExportJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.exports[id]
+	if !ok {
+		return models.ExportJob{}, ErrExportNotFound
+	}
+	return e.job, nil
+}
+
+// ClaimExportJob marks the oldest queued or abandoned export as running
+func (s *memoryStore) ClaimExportJob(ctx context.Context, staleAfter time.Duration) (models.ExportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var claimed *memoryExport
+	for _, e := range s.exports {
+		stale := e.job.Status == models.ExportRunning && now.Sub(e.heartbeat) > staleAfter
+		if e.job.Status != models.ExportQueued && !stale {
+			continue
+		}
+		if claimed == nil || jobIndex(e.job.ID) < jobIndex(claimed.job.ID) {
+			claimed = e
+		}
+	}
+	if claimed == nil {
+		return models.ExportJob{}, ErrNoJob
+	}
+	claimed.job.Status = models.ExportRunning
+	claimed.job.Processed = 0
+	claimed.job.StartedAt = &now
+	claimed.heartbeat = now
+	return claimed.job, nil
+}
+
+// HeartbeatExportJob records the progress of a running export
+func (s *memoryStore) HeartbeatExportJob(ctx context.Context, id string, processed int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.exports[id]
+	if !ok {
+		return ErrExportNotFound
+	}
+	e.job.Processed = processed
+	e.heartbeat = time.Now()
+	return nil
+}
+
+// FinishExportJob stores the outcome of an export
+func (s *memoryStore) FinishExportJob(ctx context.Context, job models.ExportJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.exports[job.ID]
+	if !ok {
+		return ErrExportNotFound
+	}
+	now := time.Now()
+	e.job.Status = job.Status
+	e.job.Processed = job.Processed
+	e.job.Size = job.Size
+	e.job.Error = job.Error
+	e.job.ExpiresAt = job.ExpiresAt
+	e.job.FinishedAt = &now
+	return nil
+}
+
+// ExpireExportJobs marks succeeded exports expiring before t as expired and returns them
+func (s *memoryStore) ExpireExportJobs(ctx context.Context, t time.Time) ([]models.ExportJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired := []models.ExportJob{}
+	for _, e := range s.exports {
+		if e.job.Status == models.ExportSucceeded && e.job.ExpiresAt != nil && e.job.ExpiresAt.Before(t) {
+			e.job.Status = models.ExportExpired
+			expired = append(expired, e.job)
+		}
+	}
+	return expired, nil
+}
+
+// create inserts a contact, the caller must hold the lock
+func (s *memoryStore) create(contact models.Contact) (models.Contact, error) {
+	if _, ok := s.findByEmail(contact.Email); ok {
+		return models.Contact{}, ErrDuplicateEmail
+	}
+	s.lastID++
+	contact.ID = strconv.Itoa(s.lastID)
+	s.contacts[contact.ID] = contact
+	s.logChange(contact, false)
+	return contact, nil
+}
+
+// update replaces a contact keeping its details and tags when contact has none, the caller must hold the lock
+func (s *memoryStore) update(contact models.Contact) (models.Contact, error) {
+	old, ok := s.contacts[contact.ID]
+	if !ok {
+		return models.Contact{}, ErrNotFound
+	}
+	if contact.Details == nil {
+		contact.Details = old.Details
+	}
+	if contact.Tags == nil {
+		contact.Tags = old.Tags
+	}
+	if existing, ok := s.findByEmail(contact.Email); ok && existing.ID != contact.ID {
+		return models.Contact{}, ErrDuplicateEmail
+	}
+	s.contacts[contact.ID] = contact
+	s.logUpdate(old, contact)
+	return contact, nil
+}
+
+// logChange appends a change of contact to the change log, the caller must hold the lock
+func (s *memoryStore) logChange(contact models.Contact, deleted bool) {
+	s.changes = append(s.changes, models.Change{
+		Token:     int64(len(s.changes) + 1),
+		ContactID: contact.ID,
+		UID:       contact.UID,
+		Deleted:   deleted,
+	})
+}
+
+// logUpdate logs the update of old to contact, a changed uid is also logged as deleting the old uid
+// like the trigger of the postgres store does. The caller must hold the lock
+func (s *memoryStore) logUpdate(old, contact models.Contact) {
+	if old.UID != contact.UID {
+		s.logChange(old, true)
+	}
+	s.logChange(contact, false)
+}
+
+// findByEmail returns the contact using email, the caller must hold the lock
+func (s *memoryStore) findByEmail(email string) (models.Contact, bool) {
+	for _, contact := range s.contacts {
+		if contact.Email == email {
+			return contact, true
+		}
+	}
+	return models.Contact{}, false
+}
+
+// contains reports whether values holds value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// jobIndex orders job ids numerically
+func jobIndex(id string) int {
+	index, _ := strconv.Atoi(id)
+	return index
+}
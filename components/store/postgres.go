@@ -0,0 +1,866 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// sql constants
+const (
+	contactColumns = `id, COALESCE(firstName, ''), COALESCE(lastName, ''), email, COALESCE(phone, ''),
+		COALESCE(organization, ''), COALESCE(note, ''), COALESCE(uid, ''), COALESCE(street, ''),
+		COALESCE(city, ''), COALESCE(region, ''), COALESCE(postalCode, ''), COALESCE(country, ''), details, tags`
+
+	selectContacts   = "SELECT " + contactColumns + " FROM %s%s ORDER BY id;"
+	selectPage       = "SELECT " + contactColumns + " FROM %s WHERE %sid > $%d ORDER BY id LIMIT $%d;"
+	selectContact    = "SELECT " + contactColumns + " FROM %s WHERE id=$1;"
+	selectByUID      = "SELECT " + contactColumns + " FROM %s WHERE uid=$1 ORDER BY id LIMIT 1;"
+	selectForUpdate  = "SELECT " + contactColumns + " FROM %s WHERE id=$1 FOR UPDATE;"
+	selectForMerge   = "SELECT " + contactColumns + " FROM %s WHERE id = ANY($1::int[]) ORDER BY id FOR UPDATE;"
+	deleteContact    = "DELETE FROM %s WHERE id=$1;"
+	deleteForMerge   = "DELETE FROM %s WHERE id = ANY($1::int[]);"
+	insertHistoryRow = "INSERT INTO %s_history (contact_id, action, data) VALUES ($1, $2, $3);"
+
+	insertContact = `INSERT INTO %s (firstName, lastName, email, phone, organization, note, uid, street, city, region, postalCode, country, details, tags)
+					VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+					RETURNING ` + contactColumns + `;`
+
+	// null details and tags keep the stored ones
+	updateContact = `UPDATE %s SET firstName=$1, lastName=$2, email=$3, phone=$4, organization=$5, note=$6,
+					uid=$7, street=$8, city=$9, region=$10, postalCode=$11, country=$12, details=COALESCE($13, details),
+					tags=COALESCE($14, tags)
+					WHERE id=$15
+					RETURNING ` + contactColumns + `;`
+
+	// xmax is only zero for rows the statement inserted, empty optional fields and null details and tags keep the
+	// stored ones
+	upsertContact = `INSERT INTO %s AS c (firstName, lastName, email, phone, organization, note, uid, street, city, region, postalCode, country, details, tags)
+					VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+					ON CONFLICT (email) DO UPDATE
+					SET firstName = EXCLUDED.firstName, lastName = EXCLUDED.lastName, phone = EXCLUDED.phone,
+						organization = COALESCE(NULLIF(EXCLUDED.organization, ''), c.organization),
+						note = COALESCE(NULLIF(EXCLUDED.note, ''), c.note), uid = COALESCE(NULLIF(EXCLUDED.uid, ''), c.uid),
+						street = COALESCE(NULLIF(EXCLUDED.street, ''), c.street), city = COALESCE(NULLIF(EXCLUDED.city, ''), c.city),
+						region = COALESCE(NULLIF(EXCLUDED.region, ''), c.region),
+						postalCode = COALESCE(NULLIF(EXCLUDED.postalCode, ''), c.postalCode),
+						country = COALESCE(NULLIF(EXCLUDED.country, ''), c.country),
+						details = COALESCE(EXCLUDED.details, c.details), tags = COALESCE(EXCLUDED.tags, c.tags)
+					RETURNING ` + contactColumns + `, (xmax = 0);`
+
+	// bulk import statements, %[1]s is the staging table and %[2]s the contacts table
+	createStaging = `CREATE TEMP TABLE %[1]s (
+					row_index INTEGER NOT NULL, id TEXT, firstName TEXT, lastName TEXT, email TEXT, phone TEXT,
+					organization TEXT, note TEXT, uid TEXT, street TEXT, city TEXT, region TEXT, postalCode TEXT,
+					country TEXT, conflict_field TEXT, conflict TEXT
+				) ON COMMIT DROP;`
+	indexStaging = `CREATE INDEX ON %[1]s (email); CREATE INDEX ON %[1]s (id); ANALYZE %[1]s;`
+
+	markRepeatedEmail = `UPDATE %[1]s s SET conflict_field = 'email', conflict = $1
+					WHERE s.conflict IS NULL AND EXISTS (
+						SELECT 1 FROM %[1]s d WHERE d.email = s.email AND d.row_index < s.row_index);`
+	markRepeatedID = `UPDATE %[1]s s SET conflict_field = 'id', conflict = $1
+					WHERE s.conflict IS NULL AND s.id IS NOT NULL AND EXISTS (
+						SELECT 1 FROM %[1]s d WHERE d.id = s.id AND d.row_index < s.row_index);`
+	markMissingID = `UPDATE %[1]s s SET conflict_field = 'id', conflict = $1
+					WHERE s.conflict IS NULL AND s.id IS NOT NULL AND NOT EXISTS (
+						SELECT 1 FROM %[2]s e WHERE e.id::text = s.id);`
+	markTakenEmail = `UPDATE %[1]s s SET conflict_field = 'email', conflict = $1
+					WHERE s.conflict IS NULL AND EXISTS (
+						SELECT 1 FROM %[2]s e WHERE e.email = s.email AND (s.id IS NULL OR e.id::text <> s.id));`
+	selectConflicts = "SELECT row_index, conflict_field, conflict FROM %[1]s WHERE conflict IS NOT NULL ORDER BY row_index;"
+
+	// xmax is only zero for rows the statement inserted
+	mergeByEmail = `WITH merged AS (
+					INSERT INTO %[2]s (firstName, lastName, email, phone, organization, note, uid, street, city, region, postalCode, country)
+					SELECT firstName, lastName, email, phone, organization, note, uid, street, city, region, postalCode, country
+					FROM %[1]s WHERE conflict IS NULL ORDER BY row_index
+					ON CONFLICT (email) DO UPDATE
+					SET firstName = EXCLUDED.firstName, lastName = EXCLUDED.lastName, phone = EXCLUDED.phone,
+						organization = EXCLUDED.organization, note = EXCLUDED.note, uid = EXCLUDED.uid,
+						street = EXCLUDED.street, city = EXCLUDED.city, region = EXCLUDED.region,
+						postalCode = EXCLUDED.postalCode, country = EXCLUDED.country
+					RETURNING (xmax = 0) AS created
+				)
+				SELECT count(*) FILTER (WHERE created), count(*) FILTER (WHERE NOT created) FROM merged;`
+
+	// rows without an id take the next id of the serial, rows with one are known to exist
+	mergeByID = `WITH merged AS (
+					INSERT INTO %[2]s (id, firstName, lastName, email, phone, organization, note, uid, street, city, region, postalCode, country)
+					SELECT COALESCE(id::int, nextval(pg_get_serial_sequence('%[2]s', 'id'))),
+						firstName, lastName, email, phone, organization, note, uid, street, city, region, postalCode, country
+					FROM %[1]s WHERE conflict IS NULL ORDER BY row_index
+					ON CONFLICT (id) DO UPDATE
+					SET firstName = EXCLUDED.firstName, lastName = EXCLUDED.lastName, email = EXCLUDED.email,
+						phone = EXCLUDED.phone, organization = EXCLUDED.organization, note = EXCLUDED.note,
+						uid = EXCLUDED.uid, street = EXCLUDED.street, city = EXCLUDED.city, region = EXCLUDED.region,
+						postalCode = EXCLUDED.postalCode, country = EXCLUDED.country
+					RETURNING (xmax = 0) AS created
+				)
+				SELECT count(*) FILTER (WHERE created), count(*) FILTER (WHERE NOT created) FROM merged;`
+
+	// uniqueViolation postgres error code raised when a unique constraint is violated
+	uniqueViolation = "23505"
+)
+
+// change log sql constants, %[1]s is the contacts table
+const (
+	selectSyncToken = "SELECT COALESCE(max(id), 0) FROM %[1]s_changes;"
+	selectChanges   = `SELECT id, contact_id, uid, deleted FROM (
+					SELECT DISTINCT ON (contact_id, uid) id, contact_id, uid, deleted FROM %[1]s_changes
+					WHERE id > $1 ORDER BY contact_id, uid, id DESC
+				) latest ORDER BY id;`
+)
+
+// import job sql constants, %[1]s is the contacts table
+const (
+	jobColumns = `id, status, filename, content_type, options, processed, report, error, created_at, started_at, finished_at`
+
+	insertJob = `INSERT INTO %[1]s_imports (status, filename, content_type, options, data)
+					VALUES ($1, $2, $3, $4::jsonb, $5)
+					RETURNING ` + jobColumns + `;`
+	selectJob = "SELECT " + jobColumns + " FROM %[1]s_imports WHERE id=$1;"
+
+	// SKIP LOCKED lets workers of every instance claim jobs without waiting on each other
+	claimJob = `UPDATE %[1]s_imports SET status = $1, processed = 0, started_at = now(), heartbeat_at = now()
+					WHERE id = (
+						SELECT id FROM %[1]s_imports
+						WHERE status = $2 OR (status = $1 AND heartbeat_at < now() - make_interval(secs => $3))
+						ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED)
+					RETURNING ` + jobColumns + `, data;`
+	heartbeatJob = "UPDATE %[1]s_imports SET processed = $2, heartbeat_at = now() WHERE id=$1 RETURNING status;"
+	finishJob    = `UPDATE %[1]s_imports SET status = CASE WHEN status = $2 THEN status ELSE $3 END,
+					processed = $4, report = $5::jsonb, error = $6::jsonb, finished_at = now(), data = NULL
+					WHERE id=$1;`
+	cancelJob = `UPDATE %[1]s_imports SET status = $2, finished_at = now(), data = NULL
+					WHERE id=$1 AND status IN ($3, $4)
+					RETURNING ` + jobColumns + `;`
+)
+
+// export job sql constants, %[1]s is the contacts table
+const (
+	exportColumns = `id, status, format, options, processed, size, error, created_at, started_at, finished_at, expires_at`
+
+	insertExport = `INSERT INTO %[1]s_exports (status, format, options) VALUES ($1, $2, $3::jsonb)
+					RETURNING ` + exportColumns + `;`
+	selectExport = "SELECT " + exportColumns + " FROM %[1]s_exports WHERE id=$1;"
+	claimExport  = `UPDATE %[1]s_exports SET status = $1, processed = 0, started_at = now(), heartbeat_at = now()
+					WHERE id = (
+						SELECT id FROM %[1]s_exports
+						WHERE status = $2 OR (status = $1 AND heartbeat_at < now() - make_interval(secs => $3))
+						ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED)
+					RETURNING ` + exportColumns + `;`
+	heartbeatExport = "UPDATE %[1]s_exports SET processed = $2, heartbeat_at = now() WHERE id=$1;"
+	finishExport    = `UPDATE %[1]s_exports SET status = $2, processed = $3, size = $4, error = $5::jsonb,
+					finished_at = now(), expires_at = $6
+					WHERE id=$1;`
+	expireExports = `UPDATE %[1]s_exports SET status = $1 WHERE status = $2 AND expires_at < $3
+					RETURNING ` + exportColumns + `;`
+)
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// postgresStore is the postgres implementation of the Store interface
+type postgresStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewPostgresStore creates a Store keeping contacts in the given postgres table
+func NewPostgresStore(db *sql.DB, table string) Store {
+	return &postgresStore{
+		db:    db,
+		table: table,
+	}
+}
+
+// List returns every contact ordered by id
+func (s *postgresStore) List(ctx context.Context) ([]models.Contact, error) {
+	contacts := []models.Contact{}
+	err := s.Each(ctx, models.ContactFilter{}, func(contact models.Contact) error {
+		contacts = append(contacts, contact)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return contacts, nil
+}
+
+// Each calls fn with every contact ordered by id as the rows arrive from the database,
+// cancelling ctx cancels the query
+func (s *postgresStore) Each(ctx context.Context, filter models.ContactFilter, fn EachFunc) error {
+	where, args := filterClause(filter)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(selectContacts, s.table, where), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		contact, err := scanContact(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(contact); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Page returns up to limit contacts matching filter with an id greater than after, ordered by id. The id index
+// seeks straight to the page so reading a page costs the same wherever it starts
+func (s *postgresStore) Page(ctx context.Context, filter models.ContactFilter, after string, limit int) ([]models.Contact, error) {
+	where, args := filterClause(filter)
+	if where != "" {
+		where = strings.TrimPrefix(where, " WHERE ") + " AND "
+	}
+	if after == "" {
+		after = "0"
+	}
+	var max interface{}
+	if limit > 0 {
+		max = limit
+	}
+	// a null limit is no limit
+	args = append(args, after, max)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(selectPage, s.table, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := []models.Contact{}
+	for rows.Next() {
+		contact, err := scanContact(rows)
+		if err != nil {
+			return nil, err
+		}
+		page = append(page, contact)
+	}
+	return page, rows.Err()
+}
+
+// Get returns the contact with id
+func (s *postgresStore) Get(ctx context.Context, id string) (models.Contact, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(selectContact, s.table), id)
+	return s.handleRow(scanContact(row))
+}
+
+// GetByUID returns the contact with the lowest id using uid
+func (s *postgresStore) GetByUID(ctx context.Context, uid string) (models.Contact, error) {
+	if uid == "" {
+		return models.Contact{}, ErrNotFound
+	}
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(selectByUID, s.table), uid)
+	return s.handleRow(scanContact(row))
+}
+
+// Create inserts a new contact returning it with its id
+func (s *postgresStore) Create(ctx context.Context, contact models.Contact) (models.Contact, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(insertContact, s.table), append(contactValues(contact), detailsValue(contact), tagsValue(contact))...)
+	return s.handleRow(scanContact(row))
+}
+
+// Update replaces the contact with the same id
+func (s *postgresStore) Update(ctx context.Context, contact models.Contact) (models.Contact, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(updateContact, s.table), append(contactValues(contact), detailsValue(contact), tagsValue(contact), contact.ID)...)
+	return s.handleRow(scanContact(row))
+}
+
+// UpdateIf locks the contact with the same id and replaces it when check accepts it
+func (s *postgresStore) UpdateIf(ctx context.Context, contact models.Contact, check CheckFunc) (models.Contact, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Contact{}, err
+	}
+	defer tx.Rollback()
+
+	if err := s.checkLocked(ctx, tx, contact.ID, check); err != nil {
+		return models.Contact{}, err
+	}
+	row := tx.QueryRowContext(ctx, fmt.Sprintf(updateContact, s.table), append(contactValues(contact), detailsValue(contact), tagsValue(contact), contact.ID)...)
+	contact, err = s.handleRow(scanContact(row))
+	if err != nil {
+		return models.Contact{}, err
+	}
+	return contact, tx.Commit()
+}
+
+// UpsertByEmail inserts the contact or updates the contact with the same email keeping the stored optional
+// fields contact leaves empty, reporting whether a new contact was created
+func (s *postgresStore) UpsertByEmail(ctx context.Context, contact models.Contact) (models.Contact, bool, error) {
+	var created bool
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(upsertContact, s.table), append(contactValues(contact), detailsValue(contact), tagsValue(contact))...)
+	contact, err := s.handleRow(scanContact(row, &created))
+	return contact, created, err
+}
+
+// Delete removes the contact with id
+func (s *postgresStore) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(deleteContact, s.table), id)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteIf locks the contact with id and removes it when check accepts it
+func (s *postgresStore) DeleteIf(ctx context.Context, id string, check CheckFunc) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.checkLocked(ctx, tx, id, check); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(deleteContact, s.table), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkLocked locks the contact with id until tx ends and calls check with it
+func (s *postgresStore) checkLocked(ctx context.Context, tx *sql.Tx, id string, check CheckFunc) error {
+	row := tx.QueryRowContext(ctx, fmt.Sprintf(selectForUpdate, s.table), id)
+	contact, err := s.handleRow(scanContact(row))
+	if err != nil {
+		return err
+	}
+	return check(contact)
+}
+
+// Merge locks the contacts in req, combines them with merge and keeps only the result,
+// recording the merge in the history table within the same transaction
+func (s *postgresStore) Merge(ctx context.Context, req models.MergeRequest, merge MergeFunc) (models.Contact, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Contact{}, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(selectForMerge, s.table), pq.Array(req.IDs))
+	if err != nil {
+		return models.Contact{}, err
+	}
+	contacts := []models.Contact{}
+	for rows.Next() {
+		contact, err := scanContact(rows)
+		if err != nil {
+			rows.Close()
+			return models.Contact{}, err
+		}
+		contacts = append(contacts, contact)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return models.Contact{}, err
+	}
+	if len(contacts) != len(req.IDs) {
+		return models.Contact{}, ErrNotFound
+	}
+
+	merged, err := merge(contacts)
+	if err != nil {
+		return models.Contact{}, err
+	}
+	history := newMergeHistory(req, contacts, merged)
+
+	// the duplicates go first so the surviving contact can take over their email
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(deleteForMerge, s.table), pq.Array(history.MergedIDs))
+	if err != nil {
+		return models.Contact{}, err
+	}
+	row := tx.QueryRowContext(ctx, fmt.Sprintf(updateContact, s.table), append(contactValues(merged), detailsValue(merged), tagsValue(merged), merged.ID)...)
+	merged, err = s.handleRow(scanContact(row))
+	if err != nil {
+		return models.Contact{}, err
+	}
+
+	data, err := json.Marshal(history)
+	if err != nil {
+		return models.Contact{}, err
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(insertHistoryRow, s.table), merged.ID, HistoryMerge, data)
+	if err != nil {
+		return models.Contact{}, err
+	}
+	return merged, tx.Commit()
+}
+
+// BulkImport streams every row of next into a staging table with COPY and merges it into the contacts
+// table with a single statement, matching rows by email when byEmail is set or else by id. Rows repeating
+// an earlier email or id, unknown ids and emails of other contacts are reported as conflicts and skipped.
+// Everything runs in one transaction so nothing is stored when next or a statement fails
+func (s *postgresStore) BulkImport(ctx context.Context, byEmail bool, next RowSource) (BulkResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return BulkResult{}, err
+	}
+	defer tx.Rollback()
+
+	staging := strings.ToLower(s.table) + "_staging"
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(createStaging, staging)); err != nil {
+		return BulkResult{}, err
+	}
+	if err := copyRows(ctx, tx, staging, next); err != nil {
+		return BulkResult{}, err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(indexStaging, staging)); err != nil {
+		return BulkResult{}, err
+	}
+
+	marks := []struct {
+		statement string
+		err       error
+	}{
+		{markRepeatedEmail, ErrRepeatedEmail},
+		{markRepeatedID, ErrRepeatedID},
+		{markMissingID, ErrNotFound},
+		{markTakenEmail, ErrDuplicateEmail},
+	}
+	merge := mergeByID
+	if byEmail {
+		// ids are ignored when matching by email
+		marks = marks[:1]
+		merge = mergeByEmail
+	}
+	for _, mark := range marks {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(mark.statement, staging, s.table), mark.err.Error()); err != nil {
+			return BulkResult{}, err
+		}
+	}
+
+	result := BulkResult{Conflicts: []BulkConflict{}}
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(selectConflicts, staging))
+	if err != nil {
+		return BulkResult{}, err
+	}
+	for rows.Next() {
+		conflict := BulkConflict{}
+		if err := rows.Scan(&conflict.Index, &conflict.Field, &conflict.Message); err != nil {
+			rows.Close()
+			return BulkResult{}, err
+		}
+		result.Conflicts = append(result.Conflicts, conflict)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return BulkResult{}, err
+	}
+
+	row := tx.QueryRowContext(ctx, fmt.Sprintf(merge, staging, s.table))
+	if err := row.Scan(&result.Created, &result.Updated); err != nil {
+		return BulkResult{}, err
+	}
+	return result, tx.Commit()
+}
+
+// copyRows streams the rows of next into the staging table with COPY FROM STDIN
+func copyRows(ctx context.Context, tx *sql.Tx, staging string, next RowSource) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(staging, "row_index", "id", "firstname", "lastname", "email", "phone",
+		"organization", "note", "uid", "street", "city", "region", "postalcode", "country"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var id interface{}
+		if row.Contact.ID != "" {
+			id = row.Contact.ID
+		}
+		if _, err := stmt.ExecContext(ctx, append([]interface{}{row.Index, id}, contactValues(row.Contact)...)...); err != nil {
+			return err
+		}
+	}
+	// an Exec without arguments flushes the buffered rows
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
+
+// SyncToken returns the token of the latest change
+func (s *postgresStore) SyncToken(ctx context.Context) (int64, error) {
+	var token int64
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(selectSyncToken, s.table)).Scan(&token)
+	return token, err
+}
+
+// Changes returns the latest change of every contact and uid changed after since, the token
+// is read in the same transaction so it never points past the returned changes
+func (s *postgresStore) Changes(ctx context.Context, since int64) ([]models.Change, int64, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+
+	var token int64
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf(selectSyncToken, s.table)).Scan(&token); err != nil {
+		return nil, 0, err
+	}
+	if since < 0 || since > token {
+		return nil, 0, ErrInvalidSyncToken
+	}
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(selectChanges, s.table), since)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	changes := []models.Change{}
+	for rows.Next() {
+		var change models.Change
+		if err := rows.Scan(&change.Token, &change.ContactID, &change.UID, &change.Deleted); err != nil {
+			return nil, 0, err
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return changes, token, tx.Commit()
+}
+
+// CreateJob queues a job importing data
+func (s *postgresStore) CreateJob(ctx context.Context, job models.ImportJob, data []byte) (models.ImportJob, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(insertJob, s.table),
+		models.ImportQueued, job.Filename, job.ContentType, nullJSON(job.Options), data)
+	return scanJob(row)
+}
+
+// GetJob returns the import job with id
+func (s *postgresStore) GetJob(ctx context.Context, id string) (models.ImportJob, error) {
+	if _, err := strconv.Atoi(id); err != nil {
+		return models.ImportJob{}, ErrJobNotFound
+	}
+	job, err := scanJob(s.db.QueryRowContext(ctx, fmt.Sprintf(selectJob, s.table), id))
+	if err == sql.ErrNoRows {
+		return models.ImportJob{}, ErrJobNotFound
+	}
+	return job, err
+}
+
+// ClaimJob marks the oldest queued or abandoned job as running and returns it with its file
+func (s *postgresStore) ClaimJob(ctx context.Context, staleAfter time.Duration) (models.ImportJob, []byte, error) {
+	var data []byte
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(claimJob, s.table),
+		models.ImportRunning, models.ImportQueued, staleAfter.Seconds())
+	job, err := scanJob(row, &data)
+	if err == sql.ErrNoRows {
+		return models.ImportJob{}, nil, ErrNoJob
+	}
+	return job, data, err
+}
+
+// HeartbeatJob records the progress of a running job and returns its status
+func (s *postgresStore) HeartbeatJob(ctx context.Context, id string, processed int) (string, error) {
+	var status string
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(heartbeatJob, s.table), id, processed).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", ErrJobNotFound
+	}
+	return status, err
+}
+
+// FinishJob stores the outcome of a job and drops its file
+func (s *postgresStore) FinishJob(ctx context.Context, job models.ImportJob) error {
+	report, err := json.Marshal(job.Report)
+	if err != nil {
+		return err
+	}
+	problem, err := json.Marshal(job.Error)
+	if err != nil {
+		return err
+	}
+	return s.execJob(ctx, ErrJobNotFound, fmt.Sprintf(finishJob, s.table), job.ID,
+		models.ImportCancelled, job.Status, job.Processed, nullJSON(report), nullJSON(problem))
+}
+
+// CancelJob cancels a queued or running job
+func (s *postgresStore) CancelJob(ctx context.Context, id string) (models.ImportJob, error) {
+	if _, err := strconv.Atoi(id); err != nil {
+		return models.ImportJob{}, ErrJobNotFound
+	}
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(cancelJob, s.table), id,
+		models.ImportCancelled, models.ImportQueued, models.ImportRunning)
+	job, err := scanJob(row)
+	if err != sql.ErrNoRows {
+		return job, err
+	}
+	if _, err := s.GetJob(ctx, id); err != nil {
+		return models.ImportJob{}, err
+	}
+	return models.ImportJob{}, ErrJobFinished
+}
+
+// CreateExportJob queues an export
+func (s *postgresStore) CreateExportJob(ctx context.Context, job models.ExportJob) (models.ExportJob, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(insertExport, s.table),
+		models.ExportQueued, job.Format, nullJSON(job.Options))
+	return scanExport(row)
+}
+
+// GetExportJob returns the export job with id
+func (s *postgresStore) GetExportJob(ctx context.Context, id string) (models.ExportJob, error) {
+	if _, err := strconv.Atoi(id); err != nil {
+		return models.ExportJob{}, ErrExportNotFound
+	}
+	job, err := scanExport(s.db.QueryRowContext(ctx, fmt.Sprintf(selectExport, s.table), id))
+	if err == sql.ErrNoRows {
+		return models.ExportJob{}, ErrExportNotFound
+	}
+	return job, err
+}
+
+// ClaimExportJob marks the oldest queued or abandoned export as running
+func (s *postgresStore) ClaimExportJob(ctx context.Context, staleAfter time.Duration) (models.ExportJob, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf(claimExport, s.table),
+		models.ExportRunning, models.ExportQueued, staleAfter.Seconds())
+	job, err := scanExport(row)
+	if err == sql.ErrNoRows {
+		return models.ExportJob{}, ErrNoJob
+	}
+	return job, err
+}
+
+// HeartbeatExportJob records the progress of a running export
+func (s *postgresStore) HeartbeatExportJob(ctx context.Context, id string, processed int) error {
+	return s.execJob(ctx, ErrExportNotFound, fmt.Sprintf(heartbeatExport, s.table), id, processed)
+}
+
+// FinishExportJob stores the outcome of an export
+func (s *postgresStore) FinishExportJob(ctx context.Context, job models.ExportJob) error {
+	problem, err := json.Marshal(job.Error)
+	if err != nil {
+		return err
+	}
+	return s.execJob(ctx, ErrExportNotFound, fmt.Sprintf(finishExport, s.table), job.ID,
+		job.Status, job.Processed, job.Size, nullJSON(problem), job.ExpiresAt)
+}
+
+// ExpireExportJobs marks succeeded exports expiring before t as expired and returns them
+func (s *postgresStore) ExpireExportJobs(ctx context.Context, t time.Time) ([]models.ExportJob, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(expireExports, s.table), models.ExportExpired, models.ExportSucceeded, t)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expired := []models.ExportJob{}
+	for rows.Next() {
+		job, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, job)
+	}
+	return expired, rows.Err()
+}
+
+// execJob runs a statement updating a single job, returning notFound when it does not exist
+func (s *postgresStore) execJob(ctx context.Context, notFound error, query string, args ...interface{}) error {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// handleRow maps driver errors of a single row statement to store errors
+func (s *postgresStore) handleRow(contact models.Contact, err error) (models.Contact, error) {
+	switch e := err.(type) {
+	case nil:
+		return contact, nil
+	case *pq.Error:
+		if e.Code == uniqueViolation {
+			return models.Contact{}, ErrDuplicateEmail
+		}
+	}
+	if err == sql.ErrNoRows {
+		return models.Contact{}, ErrNotFound
+	}
+	return models.Contact{}, err
+}
+
+// filterClause returns the WHERE clause selecting the contacts matching filter along with its arguments,
+// it matches the same contacts as models.ContactFilter.Matches
+func filterClause(filter models.ContactFilter) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.Query != "" {
+		args = append(args, "%"+likeEscaper.Replace(filter.Query)+"%")
+		conditions = append(conditions, fmt.Sprintf(
+			"(firstName ILIKE $%[1]d OR lastName ILIKE $%[1]d OR email ILIKE $%[1]d OR organization ILIKE $%[1]d)", len(args)))
+	}
+	for _, column := range []struct {
+		name  string
+		value string
+	}{
+		{"organization", filter.Organization},
+		{"city", filter.City},
+		{"region", filter.Region},
+		{"country", filter.Country},
+	} {
+		if column.value != "" {
+			args = append(args, column.value)
+			conditions = append(conditions, fmt.Sprintf("lower(%s) = lower($%d)", column.name, len(args)))
+		}
+	}
+	// tags are stored lowercase, so the tags index is used
+	if filter.Tag != "" {
+		args = append(args, strings.ToLower(filter.Tag))
+		conditions = append(conditions, fmt.Sprintf("tags @> ARRAY[$%d]::text[]", len(args)))
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// scanContact scans the contact columns of a row followed by any extra destinations
+func scanContact(row scanner, extra ...interface{}) (models.Contact, error) {
+	var contact models.Contact
+	var details []byte
+	var tags pq.StringArray
+	dest := append([]interface{}{
+		&contact.ID, &contact.FirstName, &contact.LastName, &contact.Email, &contact.Phone,
+		&contact.Organization, &contact.Note, &contact.UID, &contact.Street,
+		&contact.City, &contact.Region, &contact.PostalCode, &contact.Country, &details, &tags,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return contact, err
+	}
+	if details != nil {
+		contact.Details = &models.ContactDetails{}
+		if err := json.Unmarshal(details, contact.Details); err != nil {
+			return contact, err
+		}
+	}
+	if len(tags) > 0 {
+		contact.Tags = tags
+	}
+	return contact, nil
+}
+
+// tagsValue returns the tags column of contact, null when the contact has no tags to store
+func tagsValue(contact models.Contact) interface{} {
+	if contact.Tags == nil {
+		return nil
+	}
+	return pq.Array(contact.Tags)
+}
+
+// detailsValue returns the details column of contact, null when the contact has no details
+func detailsValue(contact models.Contact) interface{} {
+	if contact.Details == nil {
+		return nil
+	}
+	data, err := json.Marshal(contact.Details)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// contactValues returns the writable columns of contact in statement order
+func contactValues(contact models.Contact) []interface{} {
+	return []interface{}{
+		contact.FirstName, contact.LastName, contact.Email, contact.Phone,
+		contact.Organization, contact.Note, contact.UID, contact.Street,
+		contact.City, contact.Region, contact.PostalCode, contact.Country,
+	}
+}
+
+// scanJob scans the import job columns of a row followed by any extra destinations
+func scanJob(row scanner, extra ...interface{}) (models.ImportJob, error) {
+	var job models.ImportJob
+	var options, report, problem []byte
+	dest := append([]interface{}{
+		&job.ID, &job.Status, &job.Filename, &job.ContentType, &options, &job.Processed,
+		&report, &problem, &job.CreatedAt, &job.StartedAt, &job.FinishedAt,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return models.ImportJob{}, err
+	}
+	if len(options) > 0 {
+		job.Options = options
+	}
+	if len(report) > 0 {
+		if err := json.Unmarshal(report, &job.Report); err != nil {
+			return models.ImportJob{}, err
+		}
+	}
+	if len(problem) > 0 {
+		if err := json.Unmarshal(problem, &job.Error); err != nil {
+			return models.ImportJob{}, err
+		}
+	}
+	return job, nil
+}
+
+// scanExport scans the export job columns of a row
+func scanExport(row scanner) (models.ExportJob, error) {
+	var job models.ExportJob
+	var options, problem []byte
+	err := row.Scan(&job.ID, &job.Status, &job.Format, &options, &job.Processed, &job.Size, &problem,
+		&job.CreatedAt, &job.StartedAt, &job.FinishedAt, &job.ExpiresAt)
+	if err != nil {
+		return models.ExportJob{}, err
+	}
+	if len(options) > 0 {
+		job.Options = options
+	}
+	if len(problem) > 0 {
+		if err := json.Unmarshal(problem, &job.Error); err != nil {
+			return models.ExportJob{}, err
+		}
+	}
+	return job, nil
+}
+
+// nullJSON passes an encoded json document to a jsonb parameter, empty and null documents are stored as NULL
+func nullJSON(data []byte) interface{} {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	return string(data)
+}
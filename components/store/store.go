@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// store errors shared by every implementation
+var (
+	// ErrNotFound is returned when a contact does not exist
+	ErrNotFound = errors.New("contact not found")
+	// ErrDuplicateEmail is returned when another contact already uses the email
+	ErrDuplicateEmail = errors.New("a contact with this email already exists")
+	// ErrRepeatedEmail is reported by a bulk import for a row reusing the email of an earlier row
+	ErrRepeatedEmail = errors.New("the email is repeated from an earlier row")
+	// ErrRepeatedID is reported by a bulk import for a row reusing the id of an earlier row
+	ErrRepeatedID = errors.New("the id is repeated from an earlier row")
+	// ErrJobNotFound is returned when an import job does not exist
+	ErrJobNotFound = errors.New("import not found")
+	// ErrJobFinished is returned when cancelling an import job that already finished
+	ErrJobFinished = errors.New("the import already finished")
+	// ErrNoJob is returned by ClaimJob and ClaimExportJob when no job is waiting
+	ErrNoJob = errors.New("no job waiting")
+	// ErrExportNotFound is returned when an export job does not exist
+	ErrExportNotFound = errors.New("export not found")
+	// ErrInvalidSyncToken is returned by Changes for a token the change log never handed out
+	ErrInvalidSyncToken = errors.New("invalid sync token")
+)
+
+// history actions
+const (
+	// HistoryMerge recorded when contacts are merged into one
+	HistoryMerge = "merge"
+)
+
+// MergeFunc combines the contacts being merged into the surviving contact
+type MergeFunc func(contacts []models.Contact) (models.Contact, error)
+
+// CheckFunc is called with the stored contact before a conditional write, returning an error aborts the write
+type CheckFunc func(contact models.Contact) error
+
+// EachFunc is called with every contact visited by Each, returning an error stops the iteration
+type EachFunc func(contact models.Contact) error
+
+// BulkRow a contact to bulk import along with its row in the imported file
+type BulkRow struct {
+	Index   int
+	Contact models.Contact
+}
+
+// RowSource returns the next row to bulk import and io.EOF after the last one,
+// any other error aborts the import
+type RowSource func() (BulkRow, error)
+
+// BulkConflict a row a bulk import skipped
+type BulkConflict struct {
+	// Index row in the imported file
+	Index int
+	// Field json name of the conflicting field
+	Field string
+	// Message ...
+	Message string
+}
+
+// BulkResult outcome of a bulk import
+type BulkResult struct {
+	Created   int
+	Updated   int
+	Conflicts []BulkConflict
+}
+
+// Store persists contacts for the app
+type Store interface {
+	List(ctx context.Context) ([]models.Contact, error)
+	// Page returns up to limit contacts matching filter with an id greater than after, ordered by id. An empty
+	// after starts at the first contact and a limit of 0 returns every contact after it
+	Page(ctx context.Context, filter models.ContactFilter, after string, limit int) ([]models.Contact, error)
+	Each(ctx context.Context, filter models.ContactFilter, fn EachFunc) error
+	Get(ctx context.Context, id string) (models.Contact, error)
+	// GetByUID returns the contact with the lowest id using uid
+	GetByUID(ctx context.Context, uid string) (models.Contact, error)
+	Create(ctx context.Context, contact models.Contact) (models.Contact, error)
+	Update(ctx context.Context, contact models.Contact) (models.Contact, error)
+	// UpdateIf replaces the contact with the same id when check accepts the stored contact, nothing can change
+	// the contact between the check and the update
+	UpdateIf(ctx context.Context, contact models.Contact, check CheckFunc) (models.Contact, error)
+	// UpsertByEmail inserts the contact or updates the contact with the same email, reporting whether a new contact
+	// was created. The optional fields contact leaves empty, from organization to country, keep their stored value
+	UpsertByEmail(ctx context.Context, contact models.Contact) (models.Contact, bool, error)
+	Delete(ctx context.Context, id string) error
+	// DeleteIf removes the contact with id when check accepts it, like UpdateIf
+	DeleteIf(ctx context.Context, id string, check CheckFunc) error
+	Merge(ctx context.Context, req models.MergeRequest, merge MergeFunc) (models.Contact, error)
+	BulkImport(ctx context.Context, byEmail bool, next RowSource) (BulkResult, error)
+	ChangeStore
+	JobStore
+	ExportJobStore
+}
+
+// ChangeStore reads the log every create, update and delete of a contact is recorded in,
+// so clients can sync only what changed since they last synced
+type ChangeStore interface {
+	// SyncToken returns the token of the latest change, 0 when nothing was recorded yet
+	SyncToken(ctx context.Context) (int64, error)
+	// Changes returns the latest change of every contact and uid changed after the change with token since,
+	// ordered by token, along with the token of the latest change. ErrInvalidSyncToken is returned when
+	// since is after the latest change
+	Changes(ctx context.Context, since int64) ([]models.Change, int64, error)
+}
+
+// JobStore persists background import jobs along with their uploaded files so they survive restarts
+type JobStore interface {
+	// CreateJob queues a job importing data
+	CreateJob(ctx context.Context, job models.ImportJob, data []byte) (models.ImportJob, error)
+	GetJob(ctx context.Context, id string) (models.ImportJob, error)
+	// ClaimJob marks the oldest queued job as running and returns it with its file. Running jobs without
+	// a heartbeat for staleAfter were abandoned by a stopped worker and are claimed again, ErrNoJob is
+	// returned when there is nothing to do
+	ClaimJob(ctx context.Context, staleAfter time.Duration) (models.ImportJob, []byte, error)
+	// HeartbeatJob records the progress of a running job and returns its status, which is
+	// models.ImportCancelled once the job was cancelled
+	HeartbeatJob(ctx context.Context, id string, processed int) (string, error)
+	// FinishJob stores the final status, report and error of a job and drops its file,
+	// a cancelled job stays cancelled
+	FinishJob(ctx context.Context, job models.ImportJob) error
+	// CancelJob cancels a queued or running job, ErrJobFinished is returned for any other job
+	CancelJob(ctx context.Context, id string) (models.ImportJob, error)
+}
+
+// ExportJobStore persists background export jobs, their files are kept outside of the store
+type ExportJobStore interface {
+	// CreateExportJob queues an export
+	CreateExportJob(ctx context.Context, job models.ExportJob) (models.ExportJob, error)
+	GetExportJob(ctx context.Context, id string) (models.ExportJob, error)
+	// ClaimExportJob marks the oldest queued job as running, like ClaimJob
+	ClaimExportJob(ctx context.Context, staleAfter time.Duration) (models.ExportJob, error)
+	// HeartbeatExportJob records the progress of a running job
+	HeartbeatExportJob(ctx context.Context, id string, processed int) error
+	// FinishExportJob stores the final status, size, error and expiry of a job
+	FinishExportJob(ctx context.Context, job models.ExportJob) error
+	// ExpireExportJobs marks succeeded jobs expiring before t as expired and returns them so their files can be removed
+	ExpireExportJobs(ctx context.Context, t time.Time) ([]models.ExportJob, error)
+}
+
+// mergeHistory data recorded in history when contacts are merged
+type mergeHistory struct {
+	MergedIDs []string          `json:"merged_ids"`
+	Rules     map[string]string `json:"rules,omitempty"`
+	Before    []models.Contact  `json:"before"`
+	After     models.Contact    `json:"after"`
+}
+
+// newMergeHistory describes a merge of contacts into merged for the history
+func newMergeHistory(req models.MergeRequest, contacts []models.Contact, merged models.Contact) *mergeHistory {
+	removed := []string{}
+	for _, contact := range contacts {
+		if contact.ID != merged.ID {
+			removed = append(removed, contact.ID)
+		}
+	}
+	return &mergeHistory{
+		MergedIDs: removed,
+		Rules:     req.Rules,
+		Before:    contacts,
+		After:     merged,
+	}
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/squanchersquanch/contacts/services/config"
+	"github.com/squanchersquanch/contacts/services/postgres"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const configFile = "../../development.yaml"
+
+// storeSuite runs the same tests against every Store implementation
+type storeSuite struct {
+	suite.Suite
+	store Store
+}
+
+func TestMemoryStore(t *testing.T) {
+	suite.Run(t, &storeSuite{store: NewMemoryStore()})
+}
+
+func TestPostgresStore(t *testing.T) {
+	cfg := config.NewConfig(configFile)
+	db := openDB(t, cfg)
+	defer db.Close()
+	suite.Run(t, &storeSuite{store: NewPostgresStore(db, cfg.Service.DB)})
+}
+
+// openDB connects to the configured database, skipping the test when postgres is not running
+func openDB(t *testing.T, cfg *config.Config) (db *sql.DB) {
+	defer func() {
+		if err := recover(); err != nil {
+			t.Skipf("postgres is not available: %v", err)
+		}
+	}()
+	return postgres.NewDataBase(cfg)
+}
+
+func (s *storeSuite) TestPage() {
+	ctx := context.Background()
+	// a unique organization keeps the rows of earlier runs out of the pages
+	org := fmt.Sprintf("page-%d", time.Now().UnixNano())
+	ids := []string{}
+	for _, name := range []string{"ann", "bob", "cat"} {
+		contact, err := s.store.Create(ctx, models.Contact{FirstName: name, Email: name + "@" + org + ".example.com", Organization: org})
+		s.Require().NoError(err)
+		ids = append(ids, contact.ID)
+	}
+	_, err := s.store.Create(ctx, models.Contact{FirstName: "dan", Email: "dan@" + org + ".example.com", Organization: "other"})
+	s.Require().NoError(err)
+	filter := models.ContactFilter{Organization: org}
+
+	page, err := s.store.Page(ctx, filter, "", 2)
+	s.NoError(err)
+	s.Equal(ids[:2], pageIDs(page))
+
+	page, err = s.store.Page(ctx, filter, ids[1], 2)
+	s.NoError(err)
+	s.Equal(ids[2:], pageIDs(page))
+
+	page, err = s.store.Page(ctx, filter, ids[2], 2)
+	s.NoError(err)
+	s.NotNil(page)
+	s.Empty(page)
+
+	page, err = s.store.Page(ctx, filter, ids[0], 0)
+	s.NoError(err)
+	s.Equal(ids[1:], pageIDs(page), "a limit of 0 returns every contact after")
+}
+
+// pageIDs returns the ids of page in order
+func pageIDs(page []models.Contact) []string {
+	ids := make([]string, len(page))
+	for i, contact := range page {
+		ids[i] = contact.ID
+	}
+	return ids
+}
+
+func (s *storeSuite) TestTags() {
+	ctx := context.Background()
+	tag := fmt.Sprintf("tag-%d", time.Now().UnixNano())
+	contact, err := s.store.Create(ctx, models.Contact{FirstName: "ann", Email: tag + "@example.com", Tags: []string{tag, "vip"}})
+	s.Require().NoError(err)
+	s.Equal([]string{tag, "vip"}, contact.Tags)
+
+	contact.Tags = nil
+	contact.LastName = "lee"
+	contact, err = s.store.Update(ctx, contact)
+	s.NoError(err)
+	s.Equal([]string{tag, "vip"}, contact.Tags, "nil tags keep the stored ones")
+
+	s.Equal([]string{contact.ID}, s.matching(models.ContactFilter{Tag: strings.ToUpper(tag)}))
+
+	contact.Tags = []string{}
+	contact, err = s.store.Update(ctx, contact)
+	s.NoError(err)
+	s.Empty(contact.Tags)
+	s.Empty(s.matching(models.ContactFilter{Tag: tag}))
+}
+
+// matching returns the ids of the contacts matching filter in order
+func (s *storeSuite) matching(filter models.ContactFilter) []string {
+	ids := []string{}
+	s.NoError(s.store.Each(context.Background(), filter, func(contact models.Contact) error {
+		ids = append(ids, contact.ID)
+		return nil
+	}))
+	return ids
+}
@@ -0,0 +1,121 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+)
+
+// defaultRegion is used when no default region is configured
+const defaultRegion = "US"
+
+// E.164 allows at most 15 digits including the country code
+const (
+	minPhoneDigits = 8
+	maxPhoneDigits = 15
+)
+
+// phone messaging constants
+var (
+	errPhoneExtension  = errors.New("must not contain an extension")
+	errPhoneCharacters = errors.New("must only contain digits, spaces, dashes, dots, parentheses and a leading +")
+	errPhoneLength     = errors.New("must be a valid phone number")
+)
+
+// region dialing information needed to turn a national number into E.164
+type region struct {
+	// code country calling code
+	code string
+	// trunk national prefix dropped when adding the country code
+	trunk string
+	// digits exact length of a national number, 0 when it varies
+	digits int
+}
+
+// regions known default regions keyed by ISO 3166 code
+var regions = map[string]region{
+	"US": {code: "1", trunk: "1", digits: 10},
+	"CA": {code: "1", trunk: "1", digits: 10},
+	"MX": {code: "52", digits: 10},
+	"BR": {code: "55", trunk: "0"},
+	"AR": {code: "54", trunk: "0"},
+	"GB": {code: "44", trunk: "0"},
+	"IE": {code: "353", trunk: "0"},
+	"FR": {code: "33", trunk: "0", digits: 9},
+	"DE": {code: "49", trunk: "0"},
+	"NL": {code: "31", trunk: "0", digits: 9},
+	"BE": {code: "32", trunk: "0"},
+	"CH": {code: "41", trunk: "0", digits: 9},
+	"AT": {code: "43", trunk: "0"},
+	"ES": {code: "34", digits: 9},
+	"PT": {code: "351", digits: 9},
+	"IT": {code: "39"},
+	"SE": {code: "46", trunk: "0"},
+	"NO": {code: "47", digits: 8},
+	"DK": {code: "45", digits: 8},
+	"FI": {code: "358", trunk: "0"},
+	"PL": {code: "48", digits: 9},
+	"RU": {code: "7", trunk: "8", digits: 10},
+	"IN": {code: "91", trunk: "0", digits: 10},
+	"CN": {code: "86", trunk: "0"},
+	"JP": {code: "81", trunk: "0"},
+	"KR": {code: "82", trunk: "0"},
+	"AU": {code: "61", trunk: "0", digits: 9},
+	"NZ": {code: "64", trunk: "0"},
+	"ZA": {code: "27", trunk: "0", digits: 9},
+	"IL": {code: "972", trunk: "0"},
+}
+
+// extensionMarkers words that introduce a phone extension
+var extensionMarkers = []string{"ext", "x", "#", "extension"}
+
+// NormalizePhone converts a phone number to E.164. Numbers written with a leading + or
+// an international 00 prefix keep their country code, anything else is treated as a
+// national number of the given region
+func NormalizePhone(phone, regionCode string) (string, error) {
+	region, ok := regions[strings.ToUpper(regionCode)]
+	if !ok {
+		region = regions[defaultRegion]
+	}
+
+	phone = strings.TrimSpace(phone)
+	lower := strings.ToLower(phone)
+	for _, marker := range extensionMarkers {
+		if strings.Contains(lower, marker) {
+			return "", errPhoneExtension
+		}
+	}
+
+	international := strings.HasPrefix(phone, "+")
+	digits := make([]byte, 0, len(phone))
+	for i, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = append(digits, byte(r))
+		case r == '+' && i == 0:
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", errPhoneCharacters
+		}
+	}
+	number := string(digits)
+
+	switch {
+	case international:
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	default:
+		if region.trunk != "" && strings.HasPrefix(number, region.trunk) &&
+			(region.digits == 0 || len(number) == region.digits+len(region.trunk)) {
+			number = number[len(region.trunk):]
+		}
+		if region.digits != 0 && len(number) != region.digits {
+			return "", errPhoneLength
+		}
+		number = region.code + number
+	}
+
+	if len(number) < minPhoneDigits || len(number) > maxPhoneDigits || number[0] == '0' {
+		return "", errPhoneLength
+	}
+	return "+" + number, nil
+}
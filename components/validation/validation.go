@@ -0,0 +1,232 @@
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/squanchersquanch/contacts/services/config"
+)
+
+// field length limits
+const (
+	maxNameLength  = 100
+	maxEmailLength = 254
+	maxPhoneLength = 32
+	maxTextLength  = 200
+	maxNoteLength  = 2000
+	maxTagLength   = 50
+	maxTags        = 20
+)
+
+// messaging constants
+const (
+	required      = "is required"
+	nameRequired  = "first_name or last_name is required"
+	tooLong       = "must be at most %d characters"
+	tooMany       = "must have at most %d items"
+	invalidEmail  = "must be a valid email address"
+	invalidRegion = "unknown default region %s"
+)
+
+// Validator checks contacts before they are stored, normalizing their fields in place
+type Validator interface {
+	Validate(contact *models.Contact) []models.FieldError
+}
+
+// validator is the implementation of the Validator interface
+type validator struct {
+	region string
+}
+
+// NewValidator creates a new Validator using the configured default phone region
+func NewValidator(config *config.Config) Validator {
+	region := defaultRegion
+	if config.Validation != nil && config.Validation.DefaultRegion != "" {
+		region = strings.ToUpper(config.Validation.DefaultRegion)
+	}
+	if _, ok := regions[region]; !ok {
+		panic(fmt.Sprintf(invalidRegion, region))
+	}
+	return &validator{
+		region: region,
+	}
+}
+
+// Validate trims the contact, checks required fields, lengths and email syntax and
+// normalizes the phone to E.164. It returns every problem found, or nil when the contact is valid
+func (v *validator) Validate(contact *models.Contact) []models.FieldError {
+	var errs []models.FieldError
+	add := func(field, message string) {
+		errs = append(errs, models.FieldError{Field: field, Message: message})
+	}
+
+	contact.FirstName = strings.TrimSpace(contact.FirstName)
+	contact.LastName = strings.TrimSpace(contact.LastName)
+	contact.Email = strings.TrimSpace(contact.Email)
+	contact.Phone = strings.TrimSpace(contact.Phone)
+
+	if contact.FirstName == "" && contact.LastName == "" {
+		add("first_name", nameRequired)
+	}
+	if utf8.RuneCountInString(contact.FirstName) > maxNameLength {
+		add("first_name", fmt.Sprintf(tooLong, maxNameLength))
+	}
+	if utf8.RuneCountInString(contact.LastName) > maxNameLength {
+		add("last_name", fmt.Sprintf(tooLong, maxNameLength))
+	}
+
+	if problem := checkEmail(contact.Email); problem != "" {
+		add("email", problem)
+	}
+	if contact.Phone != "" {
+		if problem := v.normalizePhone(&contact.Phone); problem != "" {
+			add("phone", problem)
+		}
+	}
+	for _, field := range optionalFields(contact) {
+		checkText(field, add)
+	}
+	if contact.Tags != nil {
+		contact.Tags = checkTags(contact.Tags, add)
+	}
+	if contact.Details != nil {
+		v.validateDetails(contact.Details, add)
+	}
+	return errs
+}
+
+// validateDetails checks the v2 details of a contact, normalizing its phones. Details are only written through
+// the v2 api so their fields are named after the v2 shape, in which the flat fields are the first of each list
+func (v *validator) validateDetails(details *models.ContactDetails, add func(field, message string)) {
+	for _, field := range []optionalField{
+		{"emails[0].type", &details.EmailType, maxNameLength},
+		{"phones[0].type", &details.PhoneType, maxNameLength},
+		{"addresses[0].type", &details.AddressType, maxNameLength},
+	} {
+		checkText(field, add)
+	}
+	for i := range details.Emails {
+		email := &details.Emails[i]
+		name := fmt.Sprintf("emails[%d].", i+1)
+		email.Value = strings.TrimSpace(email.Value)
+		if problem := checkEmail(email.Value); problem != "" {
+			add(name+"value", problem)
+		}
+		checkText(optionalField{name + "type", &email.Type, maxNameLength}, add)
+	}
+	for i := range details.Phones {
+		phone := &details.Phones[i]
+		name := fmt.Sprintf("phones[%d].", i+1)
+		phone.Value = strings.TrimSpace(phone.Value)
+		if phone.Value == "" {
+			add(name+"value", required)
+		} else if problem := v.normalizePhone(&phone.Value); problem != "" {
+			add(name+"value", problem)
+		}
+		checkText(optionalField{name + "type", &phone.Type, maxNameLength}, add)
+	}
+	for i := range details.Addresses {
+		address := &details.Addresses[i]
+		name := fmt.Sprintf("addresses[%d].", i+1)
+		for _, field := range []optionalField{
+			{name + "type", &address.Type, maxNameLength},
+			{name + "street", &address.Street, maxTextLength},
+			{name + "city", &address.City, maxNameLength},
+			{name + "region", &address.Region, maxNameLength},
+			{name + "postal_code", &address.PostalCode, maxPhoneLength},
+			{name + "country", &address.Country, maxNameLength},
+		} {
+			checkText(field, add)
+		}
+	}
+}
+
+// checkTags returns the tags trimmed, lowercased and without repeats, checking their number and length
+func checkTags(tags []string, add func(field, message string)) []string {
+	if len(tags) > maxTags {
+		add("tags", fmt.Sprintf(tooMany, maxTags))
+	}
+	unique := []string{}
+	seen := map[string]bool{}
+	for i, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		name := fmt.Sprintf("tags[%d]", i)
+		switch {
+		case tag == "":
+			add(name, required)
+		case utf8.RuneCountInString(tag) > maxTagLength:
+			add(name, fmt.Sprintf(tooLong, maxTagLength))
+		case !seen[tag]:
+			seen[tag] = true
+			unique = append(unique, tag)
+		}
+	}
+	return unique
+}
+
+// checkEmail returns the problem of a required email or an empty string
+func checkEmail(email string) string {
+	switch {
+	case email == "":
+		return required
+	case utf8.RuneCountInString(email) > maxEmailLength:
+		return fmt.Sprintf(tooLong, maxEmailLength)
+	case !isEmail(email):
+		return invalidEmail
+	}
+	return ""
+}
+
+// normalizePhone normalizes a phone to E.164 in place, returning its problem or an empty string
+func (v *validator) normalizePhone(phone *string) string {
+	if utf8.RuneCountInString(*phone) > maxPhoneLength {
+		return fmt.Sprintf(tooLong, maxPhoneLength)
+	}
+	normalized, err := NormalizePhone(*phone, v.region)
+	if err != nil {
+		return err.Error()
+	}
+	*phone = normalized
+	return ""
+}
+
+// checkText trims a free text field and checks its length
+func checkText(field optionalField, add func(field, message string)) {
+	*field.value = strings.TrimSpace(*field.value)
+	if utf8.RuneCountInString(*field.value) > field.max {
+		add(field.name, fmt.Sprintf(tooLong, field.max))
+	}
+}
+
+// optionalField a free text contact field that is only checked for its length
+type optionalField struct {
+	name  string
+	value *string
+	max   int
+}
+
+// optionalFields returns the free text fields of contact in json order
+func optionalFields(contact *models.Contact) []optionalField {
+	return []optionalField{
+		{"organization", &contact.Organization, maxTextLength},
+		{"note", &contact.Note, maxNoteLength},
+		{"uid", &contact.UID, maxTextLength},
+		{"street", &contact.Street, maxTextLength},
+		{"city", &contact.City, maxNameLength},
+		{"region", &contact.Region, maxNameLength},
+		{"postal_code", &contact.PostalCode, maxPhoneLength},
+		{"country", &contact.Country, maxNameLength},
+	}
+}
+
+// isEmail reports whether email is a bare RFC 5322 addr-spec, display names and comments are rejected
+func isEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	if err != nil {
+		return false
+	}
+	return address.Name == "" && !strings.ContainsAny(email, "<>()")
+}
@@ -0,0 +1,119 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/squanchersquanch/contacts/services/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestValidator(region string) Validator {
+	return NewValidator(&config.Config{Validation: &config.ValidationConfig{DefaultRegion: region}})
+}
+
+func TestValidate(t *testing.T) {
+	contact := models.Contact{FirstName: " tom ", LastName: "dob", Email: "tom.dobs@gmail.com", Phone: "(555) 555-5555"}
+	errs := newTestValidator("US").Validate(&contact)
+	assert.Nil(t, errs)
+	assert.Equal(t, models.Contact{FirstName: "tom", LastName: "dob", Email: "tom.dobs@gmail.com", Phone: "+15555555555"}, contact)
+}
+
+func TestValidateErrors(t *testing.T) {
+	contact := models.Contact{
+		LastName: strings.Repeat("a", maxNameLength+1),
+		Email:    "not-an-email",
+		Phone:    "(555) 555 5555 ext 2",
+		Note:     strings.Repeat("a", maxNoteLength+1),
+	}
+	errs := newTestValidator("US").Validate(&contact)
+	assert.Equal(t, []models.FieldError{
+		{Field: "last_name", Message: "must be at most 100 characters"},
+		{Field: "email", Message: invalidEmail},
+		{Field: "phone", Message: errPhoneExtension.Error()},
+		{Field: "note", Message: "must be at most 2000 characters"},
+	}, errs)
+
+	errs = newTestValidator("US").Validate(&models.Contact{})
+	assert.Equal(t, []models.FieldError{
+		{Field: "first_name", Message: nameRequired},
+		{Field: "email", Message: required},
+	}, errs)
+}
+
+func TestValidateTags(t *testing.T) {
+	contact := models.Contact{FirstName: "tom", Email: "tom@example.com", Tags: []string{" VIP ", "work", "vip"}}
+	assert.Nil(t, newTestValidator("US").Validate(&contact))
+	assert.Equal(t, []string{"vip", "work"}, contact.Tags)
+
+	contact.Tags = []string{"", strings.Repeat("a", maxTagLength+1)}
+	assert.Equal(t, []models.FieldError{
+		{Field: "tags[0]", Message: required},
+		{Field: "tags[1]", Message: "must be at most 50 characters"},
+	}, newTestValidator("US").Validate(&contact))
+
+	contact.Tags = make([]string, maxTags+1)
+	for i := range contact.Tags {
+		contact.Tags[i] = strings.Repeat("a", i+1)
+	}
+	assert.Equal(t, []models.FieldError{{Field: "tags", Message: "must have at most 20 items"}}, newTestValidator("US").Validate(&contact))
+}
+
+func TestValidateDetails(t *testing.T) {
+	contact := models.ContactV2{
+		FirstName: "tom",
+		Emails:    []models.Email{{Value: "tom@example.com", Type: "work"}, {Value: " tom@home.example.com "}, {Value: "home"}},
+		Phones:    []models.Phone{{Value: "(555) 555-5555"}, {Value: "555 555 1234", Type: "mobile"}, {}},
+		Addresses: []models.Address{{City: "Springfield"}, {Country: strings.Repeat("a", maxNameLength+1)}},
+	}.Contact()
+	errs := newTestValidator("US").Validate(&contact)
+	assert.Equal(t, []models.FieldError{
+		{Field: "emails[2].value", Message: invalidEmail},
+		{Field: "phones[2].value", Message: required},
+		{Field: "addresses[1].country", Message: "must be at most 100 characters"},
+	}, errs)
+	assert.Equal(t, "+15555555555", contact.Phone)
+	assert.Equal(t, []models.Phone{{Value: "+15555551234", Type: "mobile"}, {}}, contact.Details.Phones)
+	assert.Equal(t, "tom@home.example.com", contact.Details.Emails[0].Value)
+}
+
+func TestIsEmail(t *testing.T) {
+	assert.True(t, isEmail("tom.dobs@gmail.com"))
+	assert.True(t, isEmail(`"tom dobs"@example.org`))
+	assert.False(t, isEmail("Tom <tom.dobs@gmail.com>"))
+	assert.False(t, isEmail("tom.dobs@gmail.com (Tom)"))
+	assert.False(t, isEmail("tom.dobs@"))
+	assert.False(t, isEmail("not-an-email"))
+}
+
+func TestNormalizePhone(t *testing.T) {
+	cases := []struct {
+		phone, region, expected string
+		err                     error
+	}{
+		{"555-555-5555", "US", "+15555555555", nil},
+		{"1 (555) 555 5555", "US", "+15555555555", nil},
+		{"+44 20 7946 0958", "US", "+442079460958", nil},
+		{"0044 20 7946 0958", "US", "+442079460958", nil},
+		{"020 7946 0958", "GB", "+442079460958", nil},
+		{"06 12 34 56 78", "FR", "+33612345678", nil},
+		{"555 5555", "US", "", errPhoneLength},
+		{"555-CALL-NOW", "US", "", errPhoneCharacters},
+		{"555-555-5555 x12", "US", "", errPhoneExtension},
+	}
+	for _, c := range cases {
+		phone, err := NormalizePhone(c.phone, c.region)
+		assert.Equal(t, c.err, err, c.phone)
+		assert.Equal(t, c.expected, phone, c.phone)
+	}
+}
+
+func TestNewValidatorUnknownRegion(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("The code did not panic")
+		}
+	}()
+	newTestValidator("ZZ")
+}
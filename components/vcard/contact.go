@@ -0,0 +1,211 @@
+package vcard
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// encoding constants
+const (
+	// maxLineLength content lines longer than this many octets are folded
+	maxLineLength = 75
+	crlf          = "\r\n"
+)
+
+// UIDPrefix followed by the id is the UID of contacts that were not imported with one
+const UIDPrefix = "urn:contacts:"
+
+// ToContact maps the properties of card to a contact, the contact has no id
+func ToContact(card *Card) models.Contact {
+	contact := models.Contact{}
+	if n := card.Get(propN); n != nil {
+		parts := structured(n.Value)
+		contact.LastName = component(parts, 0)
+		contact.FirstName = component(parts, 1)
+	}
+	if fn := card.Get(propFN); fn != nil && contact.FirstName == "" && contact.LastName == "" {
+		name := strings.Fields(unescape(fn.Value))
+		if len(name) > 0 {
+			contact.LastName = name[len(name)-1]
+			contact.FirstName = strings.Join(name[:len(name)-1], " ")
+		}
+	}
+	if email := card.Get(propEmail); email != nil {
+		contact.Email = unescape(email.Value)
+	}
+	if tel := card.Get(propTel); tel != nil {
+		contact.Phone = telephone(tel.Value)
+	}
+	if adr := card.Get(propAdr); adr != nil {
+		parts := structured(adr.Value)
+		contact.Street = component(parts, 2)
+		contact.City = component(parts, 3)
+		contact.Region = component(parts, 4)
+		contact.PostalCode = component(parts, 5)
+		contact.Country = component(parts, 6)
+	}
+	if org := card.Get(propOrg); org != nil {
+		contact.Organization = component(structured(org.Value), 0)
+	}
+	if note := card.Get(propNote); note != nil {
+		contact.Note = unescape(note.Value)
+	}
+	if uid := card.Get(propUID); uid != nil {
+		contact.UID = unescape(uid.Value)
+	}
+	return contact
+}
+
+// Encode writes contacts as vCards of the given version, 3.0 or 4.0
+func Encode(w io.Writer, contacts []models.Contact, version string) error {
+	if version != Version30 && version != Version40 {
+		return fmt.Errorf("unsupported vCard version %s", version)
+	}
+	bw := bufio.NewWriter(w)
+	for _, contact := range contacts {
+		for _, l := range contactLines(contact, version) {
+			if _, err := bw.WriteString(fold(l)); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// UID returns the UID written to the card of contact
+func UID(contact models.Contact) string {
+	if contact.UID == "" {
+		return UIDPrefix + contact.ID
+	}
+	return contact.UID
+}
+
+// contactLines returns the unfolded content lines of the card for contact
+func contactLines(contact models.Contact, version string) []string {
+	uid := UID(contact)
+	fn := strings.TrimSpace(contact.FirstName + " " + contact.LastName)
+	if fn == "" {
+		fn = contact.Email
+	}
+
+	lines := []string{
+		propBegin + ":" + valueVCard,
+		propVersion + ":" + version,
+		propUID + ":" + escape(uid),
+		propN + ":" + escape(contact.LastName) + ";" + escape(contact.FirstName) + ";;;",
+		propFN + ":" + escape(fn),
+	}
+	if contact.Organization != "" {
+		lines = append(lines, propOrg+":"+escape(contact.Organization))
+	}
+	if contact.Email != "" {
+		if version == Version30 {
+			lines = append(lines, propEmail+";"+paramType+"=INTERNET:"+escape(contact.Email))
+		} else {
+			lines = append(lines, propEmail+":"+escape(contact.Email))
+		}
+	}
+	if contact.Phone != "" {
+		if version == Version30 {
+			lines = append(lines, propTel+";"+paramType+"=VOICE:"+escape(contact.Phone))
+		} else {
+			lines = append(lines, propTel+";"+paramValue+"=uri:tel:"+contact.Phone)
+		}
+	}
+	if contact.Street != "" || contact.City != "" || contact.Region != "" || contact.PostalCode != "" || contact.Country != "" {
+		lines = append(lines, propAdr+":;;"+strings.Join([]string{
+			escape(contact.Street), escape(contact.City), escape(contact.Region),
+			escape(contact.PostalCode), escape(contact.Country),
+		}, ";"))
+	}
+	if contact.Note != "" {
+		lines = append(lines, propNote+":"+escape(contact.Note))
+	}
+	return append(lines, propEnd+":"+valueVCard)
+}
+
+// fold splits a content line into lines of at most 75 octets without breaking
+// UTF-8 sequences, continuation lines start with a space
+func fold(l string) string {
+	var b strings.Builder
+	limit := maxLineLength
+	for len(l) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(l[cut]) {
+			cut--
+		}
+		b.WriteString(l[:cut])
+		b.WriteString(crlf + " ")
+		l = l[cut:]
+		// the leading space counts towards the length of continuation lines
+		limit = maxLineLength - 1
+	}
+	b.WriteString(l)
+	b.WriteString(crlf)
+	return b.String()
+}
+
+// escape escapes a text value
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\r\n", `\n`, "\n", `\n`, ",", `\,`, ";", `\;`).Replace(value)
+}
+
+// unescape reverses escape for a single text value
+func unescape(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// structured splits a structured value such as N or ADR on unescaped semicolons and unescapes each component
+func structured(value string) []string {
+	parts := []string{}
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ';':
+			parts = append(parts, unescape(value[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, unescape(value[start:]))
+}
+
+// component returns the i-th component of parts or an empty string
+func component(parts []string, i int) string {
+	if i < len(parts) {
+		return parts[i]
+	}
+	return ""
+}
+
+// telephone returns the number of a TEL value given as text or as a tel uri
+func telephone(value string) string {
+	value = unescape(value)
+	if strings.HasPrefix(strings.ToLower(value), "tel:") {
+		value = value[len("tel:"):]
+		if semi := strings.Index(value, ";"); semi >= 0 {
+			value = value[:semi]
+		}
+	}
+	return value
+}
@@ -0,0 +1,39 @@
+package vcard
+
+import (
+	"strings"
+
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// EncodeMeCard returns contact as a MECARD, the compact format most phone cameras read from QR codes
+func EncodeMeCard(contact models.Contact) string {
+	var b strings.Builder
+	b.WriteString("MECARD:")
+	field := func(name string, values ...string) {
+		escaped := make([]string, len(values))
+		empty := true
+		for i, v := range values {
+			escaped[i] = escapeMeCard(v)
+			empty = empty && v == ""
+		}
+		if !empty {
+			// components of N and ADR are separated by unescaped commas
+			b.WriteString(name + ":" + strings.TrimRight(strings.Join(escaped, ","), ",") + ";")
+		}
+	}
+
+	field("N", contact.LastName, contact.FirstName)
+	field("ORG", contact.Organization)
+	field("TEL", contact.Phone)
+	field("EMAIL", contact.Email)
+	field("ADR", "", "", contact.Street, contact.City, contact.Region, contact.PostalCode, contact.Country)
+	field("NOTE", contact.Note)
+	b.WriteString(";")
+	return b.String()
+}
+
+// escapeMeCard escapes the reserved characters of a MECARD value, line breaks are not allowed
+func escapeMeCard(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ":", `\:`, ",", `\,`, `"`, `\"`, "\r\n", " ", "\n", " ").Replace(value)
+}
@@ -0,0 +1,365 @@
+package vcard
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// supported vCard versions
+const (
+	Version21 = "2.1"
+	Version30 = "3.0"
+	Version40 = "4.0"
+)
+
+// property names
+const (
+	propBegin   = "BEGIN"
+	propEnd     = "END"
+	propVersion = "VERSION"
+	propN       = "N"
+	propFN      = "FN"
+	propEmail   = "EMAIL"
+	propTel     = "TEL"
+	propAdr     = "ADR"
+	propOrg     = "ORG"
+	propNote    = "NOTE"
+	propUID     = "UID"
+
+	valueVCard = "VCARD"
+)
+
+// parameter names and values
+const (
+	paramType     = "TYPE"
+	paramPref     = "PREF"
+	paramEncoding = "ENCODING"
+	paramCharset  = "CHARSET"
+	paramValue    = "VALUE"
+
+	encodingQuotedPrintable = "QUOTED-PRINTABLE"
+)
+
+// Property a single content line of a card
+type Property struct {
+	// Group optional group prefix of the property name
+	Group string
+	// Name upper cased property name
+	Name string
+	// Params upper cased parameter names mapped to their values
+	Params map[string][]string
+	// Value decoded raw value, still escaped for text properties
+	Value string
+}
+
+// Card a single vCard
+type Card struct {
+	// Index position of the card in the file counting from 0
+	Index int
+	// Version vCard version declared by the card
+	Version string
+	// Properties every property of the card except BEGIN, END and VERSION
+	Properties []*Property
+}
+
+// Get returns the preferred property named name or nil
+func (c *Card) Get(name string) *Property {
+	var found *Property
+	for _, p := range c.Properties {
+		if p.Name != name {
+			continue
+		}
+		if p.preferred() {
+			return p
+		}
+		if found == nil {
+			found = p
+		}
+	}
+	return found
+}
+
+// Text returns the value of a text property with its escapes removed
+func (p *Property) Text() string {
+	return unescape(p.Value)
+}
+
+// preferred reports whether the property is marked as preferred in any vCard version
+func (p *Property) preferred() bool {
+	if _, ok := p.Params[paramPref]; ok {
+		return true
+	}
+	for _, t := range p.Params[paramType] {
+		if strings.EqualFold(t, "pref") {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseError reports a card that could not be parsed
+type ParseError struct {
+	// Index position of the card in the file counting from 0
+	Index int
+	// Line line of the file the problem was found on counting from 1
+	Line int
+	// Message describes why the card was rejected
+	Message string
+}
+
+// Error implements the error interface
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("card %d line %d: %s", e.Index, e.Line, e.Message)
+}
+
+// line a logical content line after unfolding along with the physical line it starts on
+type line struct {
+	number int
+	text   string
+}
+
+// Decode reads every card in r. Cards that can not be parsed are skipped and reported by index
+// in errs while the remaining cards are still returned, err is only set when r fails
+func Decode(r io.Reader) (cards []*Card, errs []*ParseError, err error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var card *Card
+	var broken *ParseError
+	index := 0
+	for _, l := range lines {
+		if strings.TrimSpace(l.text) == "" {
+			continue
+		}
+		p, perr := parseLine(l.text)
+		isBegin := perr == nil && p.Name == propBegin && strings.EqualFold(p.Value, valueVCard)
+		isEnd := perr == nil && p.Name == propEnd && strings.EqualFold(p.Value, valueVCard)
+
+		switch {
+		case isBegin:
+			if card != nil || broken != nil {
+				errs = append(errs, cardError(broken, index, l.number, "missing END:VCARD"))
+				index++
+			}
+			card, broken = &Card{Index: index}, nil
+		case card == nil && broken == nil:
+			// content outside of a card is ignored
+		case isEnd:
+			if broken != nil {
+				errs = append(errs, broken)
+			} else if card.Version == "" {
+				errs = append(errs, &ParseError{Index: index, Line: l.number, Message: "missing VERSION"})
+			} else {
+				cards = append(cards, card)
+			}
+			card, broken = nil, nil
+			index++
+		case broken != nil:
+			// skip the rest of a broken card
+		case perr != nil:
+			broken = &ParseError{Index: index, Line: l.number, Message: perr.Error()}
+			card = nil
+		case p.Name == propVersion:
+			if p.Value != Version21 && p.Value != Version30 && p.Value != Version40 {
+				broken = &ParseError{Index: index, Line: l.number, Message: "unsupported version " + p.Value}
+				card = nil
+				break
+			}
+			card.Version = p.Value
+		default:
+			card.Properties = append(card.Properties, p)
+		}
+	}
+	if card != nil || broken != nil {
+		last := 0
+		if len(lines) > 0 {
+			last = lines[len(lines)-1].number
+		}
+		errs = append(errs, cardError(broken, index, last, "missing END:VCARD"))
+	}
+	return cards, errs, nil
+}
+
+// cardError returns broken when the card already failed or a new error otherwise
+func cardError(broken *ParseError, index, number int, message string) *ParseError {
+	if broken != nil {
+		return broken
+	}
+	return &ParseError{Index: index, Line: number, Message: message}
+}
+
+// unfold joins folded lines and quoted-printable soft line breaks into logical lines
+func unfold(r io.Reader) ([]line, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	lines := []line{}
+	number := 0
+	softBreak := false
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if number == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		last := len(lines) - 1
+
+		switch {
+		case softBreak && last >= 0:
+			lines[last].text = lines[last].text[:len(lines[last].text)-1] + strings.TrimLeft(text, " \t")
+		case (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) && last >= 0:
+			lines[last].text += text[1:]
+		default:
+			lines = append(lines, line{number: number, text: text})
+		}
+
+		last = len(lines) - 1
+		softBreak = strings.HasSuffix(lines[last].text, "=") && isQuotedPrintable(lines[last].text)
+	}
+	return lines, scanner.Err()
+}
+
+// isQuotedPrintable reports whether a raw content line declares quoted-printable encoding
+func isQuotedPrintable(text string) bool {
+	colon := valueStart(text)
+	if colon < 0 {
+		return false
+	}
+	return strings.Contains(strings.ToUpper(text[:colon]), encodingQuotedPrintable)
+}
+
+// valueStart returns the index of the colon separating name and parameters from the value
+func valueStart(text string) int {
+	quoted := false
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseLine parses a logical content line: [group.]name *(;param) : value
+func parseLine(text string) (*Property, error) {
+	colon := valueStart(text)
+	if colon < 0 {
+		return nil, fmt.Errorf("malformed line %q", truncate(text))
+	}
+	head, value := text[:colon], text[colon+1:]
+
+	parts := splitUnquoted(head, ';')
+	name := strings.ToUpper(strings.TrimSpace(parts[0]))
+	p := &Property{Name: name, Params: map[string][]string{}}
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		p.Group, p.Name = name[:dot], name[dot+1:]
+	}
+	if p.Name == "" {
+		return nil, fmt.Errorf("missing property name in %q", truncate(text))
+	}
+
+	for _, param := range parts[1:] {
+		key, values := param, ""
+		if eq := strings.Index(param, "="); eq >= 0 {
+			key, values = param[:eq], param[eq+1:]
+		} else {
+			// vCard 2.1 allows bare parameter values such as TEL;WORK;VOICE
+			key, values = paramType, param
+			if strings.EqualFold(param, encodingQuotedPrintable) || strings.EqualFold(param, "BASE64") {
+				key = paramEncoding
+			}
+		}
+		key = strings.ToUpper(strings.TrimSpace(key))
+		for _, v := range splitUnquoted(values, ',') {
+			p.Params[key] = append(p.Params[key], strings.Trim(v, `"`))
+		}
+	}
+
+	for _, encoding := range p.Params[paramEncoding] {
+		if strings.EqualFold(encoding, encodingQuotedPrintable) {
+			decoded, err := decodeQuotedPrintable(value)
+			if err != nil {
+				return nil, err
+			}
+			value = decoded
+			for _, charset := range p.Params[paramCharset] {
+				if strings.EqualFold(charset, "ISO-8859-1") || strings.EqualFold(charset, "WINDOWS-1252") {
+					value = latin1ToUTF8(value)
+				}
+			}
+		}
+	}
+	if !utf8.ValidString(value) {
+		value = latin1ToUTF8(value)
+	}
+	p.Value = value
+	return p, nil
+}
+
+// splitUnquoted splits s on sep ignoring separators inside double quotes
+func splitUnquoted(s string, sep byte) []string {
+	parts := []string{}
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// decodeQuotedPrintable decodes =XX escapes, soft line breaks are already removed by unfold
+func decodeQuotedPrintable(s string) (string, error) {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] != '=' {
+			buf.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("truncated quoted-printable escape")
+		}
+		b, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted-printable escape %q", s[i:i+3])
+		}
+		buf.Write(b)
+		i += 2
+	}
+	return buf.String(), nil
+}
+
+// latin1ToUTF8 converts ISO-8859-1 bytes to a UTF-8 string
+func latin1ToUTF8(s string) string {
+	runes := make([]rune, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		runes = append(runes, rune(s[i]))
+	}
+	return string(runes)
+}
+
+// truncate shortens text for error messages
+func truncate(text string) string {
+	if len(text) > 40 {
+		return text[:40] + "..."
+	}
+	return text
+}
@@ -0,0 +1,109 @@
+package vcard
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/stretchr/testify/assert"
+)
+
+const testCards = "BEGIN:VCARD\r\n" +
+	"VERSION:3.0\r\n" +
+	"UID:urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b1\r\n" +
+	"N:Bob;Roger;;;\r\n" +
+	"FN:Roger Bob\r\n" +
+	"ORG:Acme\\, Inc.;Sales\r\n" +
+	"EMAIL;TYPE=INTERNET:roger@home.com\r\n" +
+	"EMAIL;TYPE=INTERNET,pref:roger.bob@gmail.com\r\n" +
+	"TEL;TYPE=CELL:(940) 867-5309\r\n" +
+	"item1.ADR;TYPE=HOME:;;1 Main St;Springfield;IL;62701;USA\r\n" +
+	"NOTE:met at the conference\\nfollow up in\r\n" +
+	"  june\r\n" +
+	"END:VCARD\r\n" +
+	"BEGIN:VCARD\n" +
+	"VERSION:2.1\n" +
+	"N;CHARSET=ISO-8859-1;ENCODING=QUOTED-PRINTABLE:M=FCller;J=\n" +
+	"=FCrgen\n" +
+	"EMAIL;INTERNET:juergen@example.de\n" +
+	"END:VCARD\n" +
+	"BEGIN:VCARD\n" +
+	"VERSION:4.0\n" +
+	"this line has no colon\n" +
+	"END:VCARD\n" +
+	"BEGIN:VCARD\n" +
+	"VERSION:4.0\n" +
+	"FN:Tom Dob\n" +
+	"TEL;VALUE=uri:tel:+1-555-555-5555;ext=12\n" +
+	"EMAIL:tom.dobs@gmail.com\n" +
+	"END:VCARD\n" +
+	"BEGIN:VCARD\n" +
+	"FN:No End\n"
+
+func TestDecode(t *testing.T) {
+	cards, errs, err := Decode(strings.NewReader(testCards))
+	assert.NoError(t, err)
+	assert.Len(t, cards, 3)
+	assert.Len(t, errs, 2)
+
+	assert.Equal(t, 2, errs[0].Index)
+	assert.Equal(t, 22, errs[0].Line)
+	assert.Equal(t, 4, errs[1].Index)
+	assert.Contains(t, errs[1].Message, "END:VCARD")
+
+	assert.Equal(t, models.Contact{
+		FirstName:    "Roger",
+		LastName:     "Bob",
+		Email:        "roger.bob@gmail.com",
+		Phone:        "(940) 867-5309",
+		Organization: "Acme, Inc.",
+		Note:         "met at the conference\nfollow up in june",
+		UID:          "urn:uuid:4fbe8971-0bc3-424c-9c26-36c3e1eff6b1",
+		Street:       "1 Main St",
+		City:         "Springfield",
+		Region:       "IL",
+		PostalCode:   "62701",
+		Country:      "USA",
+	}, ToContact(cards[0]))
+
+	assert.Equal(t, models.Contact{FirstName: "Jürgen", LastName: "Müller", Email: "juergen@example.de"}, ToContact(cards[1]))
+	assert.Equal(t, 3, cards[2].Index)
+	assert.Equal(t, models.Contact{FirstName: "Tom", LastName: "Dob", Email: "tom.dobs@gmail.com", Phone: "+1-555-555-5555"}, ToContact(cards[2]))
+}
+
+func TestEncode(t *testing.T) {
+	contacts := []models.Contact{
+		{ID: "1", FirstName: "Roger", LastName: "Bob", Email: "roger.bob@gmail.com", Phone: "+19408675309", City: "Springfield", Note: strings.Repeat("ü; ", 40)},
+		{ID: "2", Email: "anon@example.com", UID: "urn:uuid:1"},
+	}
+
+	for _, version := range []string{Version30, Version40} {
+		buf := new(bytes.Buffer)
+		assert.NoError(t, Encode(buf, contacts, version))
+		for _, l := range strings.Split(buf.String(), crlf) {
+			assert.True(t, len(l) <= maxLineLength, "line too long: %q", l)
+		}
+
+		cards, errs, err := Decode(buf)
+		assert.NoError(t, err)
+		assert.Empty(t, errs)
+		assert.Len(t, cards, 2)
+		assert.Equal(t, version, cards[0].Version)
+
+		roundTrip := ToContact(cards[0])
+		assert.Equal(t, UIDPrefix+"1", roundTrip.UID)
+		roundTrip.ID, roundTrip.UID = "1", ""
+		contacts[0].Note = strings.TrimSpace(contacts[0].Note)
+		assert.Equal(t, contacts[0], roundTrip)
+		assert.Equal(t, "urn:uuid:1", ToContact(cards[1]).UID)
+	}
+
+	assert.Error(t, Encode(new(bytes.Buffer), contacts, Version21))
+}
+
+func TestEncodeMeCard(t *testing.T) {
+	contact := models.Contact{FirstName: "Tom", LastName: "Dob", Email: "tom.dobs@gmail.com", Phone: "+15555555555", City: "Springfield", Note: "likes; semicolons"}
+	assert.Equal(t, `MECARD:N:Dob,Tom;TEL:+15555555555;EMAIL:tom.dobs@gmail.com;ADR:,,,Springfield;NOTE:likes\; semicolons;;`, EncodeMeCard(contact))
+	assert.Equal(t, "MECARD:EMAIL:anon@example.com;;", EncodeMeCard(models.Contact{Email: "anon@example.com"}))
+}
@@ -0,0 +1,213 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxColumns columns of the widest sheet Excel supports
+const maxColumns = 16384
+
+// maxPartSize largest uncompressed part read from a workbook, guards against zip bombs
+const maxPartSize = 64 << 20
+
+// relationships of a workbook part
+type relationships struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// workbook sheets listed in xl/workbook.xml
+type workbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		// RelID is the r:id attribute, matched by local name
+		RelID string `xml:"id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// richText text of a shared or inline string, either plain or in runs
+type richText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+// String joins the text of every run
+func (t richText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.T)
+	}
+	return b.String()
+}
+
+// worksheet cells of a sheet part
+type worksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R  string    `xml:"r,attr"`
+			T  string    `xml:"t,attr"`
+			V  string    `xml:"v"`
+			IS *richText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// Read returns the rows of the sheet named sheet, or of the first sheet when sheet is empty.
+// Every value is returned as text, whole numbers without an exponent, and empty rows are left out
+func Read(r io.ReaderAt, size int64, sheet string) ([][]string, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not an xlsx workbook: %s", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range z.File {
+		files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+
+	book := workbook{}
+	if err := decodePart(files, "xl/workbook.xml", &book); err != nil {
+		return nil, err
+	}
+	rels := relationships{}
+	if err := decodePart(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	if len(book.Sheets) == 0 {
+		return nil, fmt.Errorf("the workbook has no sheets")
+	}
+
+	relID := ""
+	names := make([]string, len(book.Sheets))
+	for i, s := range book.Sheets {
+		names[i] = s.Name
+		if relID == "" && (sheet == "" || strings.EqualFold(s.Name, sheet)) {
+			relID = s.RelID
+		}
+	}
+	if relID == "" {
+		return nil, fmt.Errorf("sheet %s not found, the workbook has %s", sheet, strings.Join(names, ", "))
+	}
+	target := ""
+	for _, rel := range rels.Items {
+		if rel.ID == relID {
+			target = rel.Target
+		}
+	}
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = path.Join("xl", target)
+	}
+
+	shared := struct {
+		Items []richText `xml:"si"`
+	}{}
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodePart(files, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	ws := worksheet{}
+	if err := decodePart(files, target, &ws); err != nil {
+		return nil, err
+	}
+
+	rows := [][]string{}
+	for _, row := range ws.Rows {
+		record := []string{}
+		for _, cell := range row.Cells {
+			column := len(record)
+			if cell.R != "" {
+				if column, err = columnIndex(cell.R); err != nil {
+					return nil, fmt.Errorf("row %d: %s", row.R, err)
+				}
+			}
+			value := cell.V
+			switch cell.T {
+			case "s":
+				index, err := strconv.Atoi(cell.V)
+				if err != nil || index < 0 || index >= len(shared.Items) {
+					return nil, fmt.Errorf("cell %s: invalid shared string %s", cell.R, cell.V)
+				}
+				value = shared.Items[index].String()
+			case "inlineStr":
+				if cell.IS != nil {
+					value = cell.IS.String()
+				}
+			case "b":
+				value = strings.ToUpper(strconv.FormatBool(cell.V == "1"))
+			case "", "n":
+				value = number(cell.V)
+			}
+			for len(record) < column {
+				record = append(record, "")
+			}
+			if column < len(record) {
+				record[column] = value
+			} else {
+				record = append(record, value)
+			}
+		}
+		if strings.Join(record, "") != "" {
+			rows = append(rows, record)
+		}
+	}
+	return rows, nil
+}
+
+// decodePart unmarshals the xml part named name
+func decodePart(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("not an xlsx workbook: %s is missing", name)
+	}
+	if f.UncompressedSize64 > maxPartSize {
+		return fmt.Errorf("%s is too large", name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := xml.NewDecoder(io.LimitReader(r, maxPartSize)).Decode(v); err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	return nil
+}
+
+// columnIndex returns the zero based column of an A1 style cell name
+func columnIndex(name string) (int, error) {
+	column := 0
+	i := 0
+	for ; i < len(name) && name[i] >= 'A' && name[i] <= 'Z' && column <= maxColumns; i++ {
+		column = column*26 + int(name[i]-'A') + 1
+	}
+	if i == 0 || column > maxColumns {
+		return 0, fmt.Errorf("invalid cell %s", name)
+	}
+	return column - 1, nil
+}
+
+// number formats a numeric cell, whole numbers such as phone numbers lose their exponent
+func number(v string) string {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || !strings.ContainsAny(v, "eE") {
+		return v
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
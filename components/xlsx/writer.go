@@ -0,0 +1,207 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Type how the values of a column are stored
+type Type int
+
+// column types
+const (
+	// Text values are stored as strings so leading zeros and long digit runs survive
+	Text Type = iota
+	// Number values are stored as numbers when they parse as one, otherwise as text
+	Number
+)
+
+// style ids of the styles part
+const (
+	styleHeader = 1
+	styleNumber = 2
+)
+
+// sheet limits
+const (
+	// maxSheetName longest sheet name Excel accepts
+	maxSheetName = 31
+	// minWidth narrowest column in characters when the width is sized to the header
+	minWidth = 12
+)
+
+// Column describes a column of the sheet
+type Column struct {
+	// Header text of the header row
+	Header string
+	// Type of the values below the header
+	Type Type
+	// Width in characters, zero sizes the column to its header with a minimum of 12
+	Width int
+}
+
+// Writer writes a workbook of a single sheet, rows are streamed into the zip as they are written
+type Writer struct {
+	zip     *zip.Writer
+	sheet   *bufio.Writer
+	columns []Column
+	rows    int
+}
+
+// NewWriter starts a workbook with a sheet named name whose first row is the styled and frozen header
+func NewWriter(w io.Writer, name string, columns []Column) (*Writer, error) {
+	if name == "" || len(name) > maxSheetName || strings.ContainsAny(name, `[]:*?/\`) {
+		return nil, fmt.Errorf("invalid sheet name %q", name)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("a sheet needs at least one column")
+	}
+
+	z := zip.NewWriter(w)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypesXML},
+		{"_rels/.rels", rootRelsXML},
+		{"xl/workbook.xml", fmt.Sprintf(workbookXML, escape(name))},
+		{"xl/_rels/workbook.xml.rels", workbookRelsXML},
+		{"xl/styles.xml", stylesXML},
+	}
+	for _, part := range parts {
+		f, err := z.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	writer := &Writer{zip: z, sheet: bufio.NewWriter(f), columns: columns}
+	writer.sheet.WriteString(xml.Header)
+	writer.sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	writer.sheet.WriteString(`<sheetViews><sheetView workbookViewId="0">` +
+		`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	writer.sheet.WriteString(`<cols>`)
+	for i, column := range columns {
+		width := column.Width
+		if width == 0 {
+			width = max(len(column.Header)+4, minWidth)
+		}
+		fmt.Fprintf(writer.sheet, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, width)
+	}
+	writer.sheet.WriteString(`</cols><sheetData>`)
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Header
+	}
+	writer.writeRow(header, true)
+	return writer, nil
+}
+
+// Write appends a row of values in column order
+func (w *Writer) Write(record []string) error {
+	w.writeRow(record, false)
+	return w.sheet.Flush()
+}
+
+// writeRow writes the cells of a row, empty values are left out
+func (w *Writer) writeRow(record []string, header bool) {
+	w.rows++
+	fmt.Fprintf(w.sheet, `<row r="%d">`, w.rows)
+	for i, value := range record {
+		if value == "" || i >= len(w.columns) {
+			continue
+		}
+		ref := CellName(i, w.rows)
+		switch {
+		case header:
+			fmt.Fprintf(w.sheet, `<c r="%s" s="%d" t="inlineStr"><is><t>%s</t></is></c>`, ref, styleHeader, escape(value))
+		case w.columns[i].Type == Number && isNumber(value):
+			fmt.Fprintf(w.sheet, `<c r="%s" s="%d"><v>%s</v></c>`, ref, styleNumber, value)
+		default:
+			fmt.Fprintf(w.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(value))
+		}
+	}
+	w.sheet.WriteString(`</row>`)
+}
+
+// Close ends the sheet with a filter over every written row and finishes the zip
+func (w *Writer) Close() error {
+	fmt.Fprintf(w.sheet, `</sheetData><autoFilter ref="A1:%s"/></worksheet>`, CellName(len(w.columns)-1, w.rows))
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+// CellName returns the A1 style name of the zero based column and one based row
+func CellName(column, row int) string {
+	name := ""
+	for column++; column > 0; column = (column - 1) / 26 {
+		name = string(rune('A'+(column-1)%26)) + name
+	}
+	return name + strconv.Itoa(row)
+}
+
+// isNumber reports whether value is stored as a number without losing anything,
+// values with leading zeros or more digits than a float holds stay text
+func isNumber(value string) bool {
+	if len(value) > 15 || (len(value) > 1 && value[0] == '0' && value[1] != '.') {
+		return false
+	}
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
+
+// escape escapes text for an xml element or attribute
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// parts of the workbook that do not depend on the data
+const (
+	contentTypesXML = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`
+
+	rootRelsXML = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+
+	workbookXML = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`
+
+	workbookRelsXML = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`
+
+	stylesXML = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>` +
+		`<fill><patternFill patternType="solid"><fgColor rgb="FFD9E1F2"/><bgColor indexed="64"/></patternFill></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/>` +
+		`<xf numFmtId="1" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+		`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+		`</styleSheet>`
+)
@@ -0,0 +1,103 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// workbookOf zips parts into a workbook
+func workbookOf(t *testing.T, parts map[string]string) *bytes.Reader {
+	buf := new(bytes.Buffer)
+	z := zip.NewWriter(buf)
+	for name, content := range parts {
+		f, err := z.Create(name)
+		assert.NoError(t, err)
+		f.Write([]byte(content))
+	}
+	assert.NoError(t, z.Close())
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestWriteRead(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, err := NewWriter(buf, "Contacts", []Column{{Header: "ID", Type: Number}, {Header: "Name"}, {Header: "Phone"}})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write([]string{"1", "Tom <Dob> & co", "0170 555"}))
+	assert.NoError(t, w.Write([]string{"", "  padded", "9408675309"}))
+	assert.NoError(t, w.Close())
+
+	rows, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"ID", "Name", "Phone"},
+		{"1", "Tom <Dob> & co", "0170 555"},
+		{"", "  padded", "9408675309"},
+	}, rows)
+
+	z, _ := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	sheet := ""
+	for _, f := range z.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			r, _ := f.Open()
+			b := new(bytes.Buffer)
+			b.ReadFrom(r)
+			sheet = b.String()
+		}
+	}
+	assert.Contains(t, sheet, `<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`)
+	assert.Contains(t, sheet, `<c r="A2" s="2"><v>1</v></c>`)
+	assert.Contains(t, sheet, `<autoFilter ref="A1:C3"/>`)
+
+	_, err = NewWriter(buf, "a/b", []Column{{Header: "ID"}})
+	assert.Error(t, err)
+}
+
+func TestRead(t *testing.T) {
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+			<sheets><sheet name="Notes" sheetId="1" r:id="rId1"/><sheet name="People" sheetId="2" r:id="rId2"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="/xl/worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml":     `<sst><si><t>First Name</t></si><si><r><t>Ro</t></r><r><t>ger</t></r></si><si><t>Phone</t></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData><row r="1"><c r="A1" t="inlineStr"><is><t>notes</t></is></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet><sheetData>
+			<row r="1"><c r="B1" t="str"><v>exported 2019</v></c></row>
+			<row r="2"></row>
+			<row r="3"><c r="A3" t="s"><v>0</v></c><c r="C3" t="s"><v>2</v></c><c r="D3" t="b"><v>1</v></c></row>
+			<row r="4"><c r="A4" t="s"><v>1</v></c><c r="C4"><v>9.408675309E9</v></c></row>
+			</sheetData></worksheet>`,
+	}
+	book := workbookOf(t, parts)
+
+	rows, err := Read(book, book.Size(), "people")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"", "exported 2019"},
+		{"First Name", "", "Phone", "TRUE"},
+		{"Roger", "", "9408675309"},
+	}, rows)
+
+	rows, err = Read(book, book.Size(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"notes"}}, rows)
+
+	_, err = Read(book, book.Size(), "Missing")
+	assert.EqualError(t, err, "sheet Missing not found, the workbook has Notes, People")
+
+	_, err = Read(bytes.NewReader([]byte("not a zip")), 9, "")
+	assert.Error(t, err)
+}
+
+func TestCellName(t *testing.T) {
+	assert.Equal(t, "A1", CellName(0, 1))
+	assert.Equal(t, "Z2", CellName(25, 2))
+	assert.Equal(t, "AA3", CellName(26, 3))
+	assert.Equal(t, "AZ4", CellName(51, 4))
+
+	column, err := columnIndex("AZ4")
+	assert.NoError(t, err)
+	assert.Equal(t, 51, column)
+}
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
 
+	"github.com/squanchersquanch/contacts/components/connectors"
+	"github.com/squanchersquanch/contacts/components/ldap"
+	"github.com/squanchersquanch/contacts/components/rpc"
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/validation"
 	"github.com/squanchersquanch/contacts/services/config"
 	"github.com/squanchersquanch/contacts/services/postgres"
 	"github.com/squanchersquanch/contacts/services/router"
@@ -20,9 +27,35 @@ func main() {
 
 	// load database
 	db := postgres.NewDataBase(config)
+	contacts := store.NewPostgresStore(db, config.Service.DB)
 
 	//  create a new http client
-	router := router.NewRouter(db, config)
+	connector := connectors.NewConnector(contacts, config)
+	router := router.NewRouter(connector, contacts, config)
+
+	// start the background import and export workers
+	connector.Start(context.Background())
+
+	// start the read-only LDAP directory when a port is configured
+	if config.LDAP != nil && config.LDAP.Port > 0 {
+		directory := ldap.NewServer(contacts, ldap.Options{
+			BaseDN:    config.LDAP.BaseDN,
+			BindDN:    config.LDAP.BindDN,
+			Password:  config.LDAP.Password,
+			SizeLimit: config.LDAP.SizeLimit,
+		})
+		go func() {
+			log.Fatal(directory.ListenAndServe(fmt.Sprintf(":%d", config.LDAP.Port)))
+		}()
+	}
+
+	// start the gRPC ContactService when a port is configured
+	if config.GRPC != nil && config.GRPC.Port > 0 {
+		service := rpc.NewServer(contacts, validation.NewValidator(config))
+		go func() {
+			log.Fatal(service.ListenAndServe(fmt.Sprintf(":%d", config.GRPC.Port)))
+		}()
+	}
 
 	log.Fatal(http.ListenAndServe(":3000", router))
 }
@@ -0,0 +1,13 @@
+package models
+
+// Change the latest change of a contact read from the change log
+type Change struct {
+	// Token position of the change in the log, tokens only grow
+	Token int64
+	// ContactID ...
+	ContactID string
+	// UID uid of the contact after the change, or before it for a deletion
+	UID string
+	// Deleted true when the contact was deleted or stopped using UID
+	Deleted bool
+}
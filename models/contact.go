@@ -18,10 +18,65 @@ type Contact struct {
 	Email string `json:"email"`
 	// Phone ...
 	Phone string `json:"phone"`
+	// Organization company or organization the contact belongs to
+	Organization string `json:"organization,omitempty"`
+	// Note free form note
+	Note string `json:"note,omitempty"`
+	// UID globally unique identifier of the contact, kept from imported vCards
+	UID string `json:"uid,omitempty"`
+	// Street street address including the house number
+	Street string `json:"street,omitempty"`
+	// City ...
+	City string `json:"city,omitempty"`
+	// Region state or province
+	Region string `json:"region,omitempty"`
+	// PostalCode ...
+	PostalCode string `json:"postal_code,omitempty"`
+	// Country ...
+	Country string `json:"country,omitempty"`
+	// Tags labels grouping contacts, lowercase and unique once validated. Nil keeps the stored tags when the
+	// contact is updated, an empty list removes them
+	Tags []string `json:"tags,omitempty"`
+	// Details extra emails, phones and addresses written through the v2 api, nil keeps the stored details
+	// when the contact is updated
+	Details *ContactDetails `json:"-"`
 }
 
-// HTTPErrorResponse response given when an error occurs from a http request
-type HTTPErrorResponse struct {
-	// Error ...
-	Error string `json:"error,omitempty"`
+// ContactFields json names of the contact fields in the order they are listed
+var ContactFields = []string{
+	"id", "first_name", "last_name", "email", "phone", "organization", "note",
+	"uid", "street", "city", "region", "postal_code", "country",
+}
+
+// Field returns the field of the contact with the json name or nil when there is no such field
+func (c *Contact) Field(name string) *string {
+	switch name {
+	case "id":
+		return &c.ID
+	case "first_name":
+		return &c.FirstName
+	case "last_name":
+		return &c.LastName
+	case "email":
+		return &c.Email
+	case "phone":
+		return &c.Phone
+	case "organization":
+		return &c.Organization
+	case "note":
+		return &c.Note
+	case "uid":
+		return &c.UID
+	case "street":
+		return &c.Street
+	case "city":
+		return &c.City
+	case "region":
+		return &c.Region
+	case "postal_code":
+		return &c.PostalCode
+	case "country":
+		return &c.Country
+	}
+	return nil
 }
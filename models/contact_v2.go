@@ -0,0 +1,141 @@
+package models
+
+// ContactV2 the contact shape of the v2 api, listing every email, phone and address of a contact. The first of
+// each is the one of the flat v1 shape
+type ContactV2 struct {
+	// ID ...
+	ID string `json:"id"`
+	// FirstName ...
+	FirstName string `json:"first_name"`
+	// LastName ...
+	LastName string `json:"last_name"`
+	// Organization company or organization the contact belongs to
+	Organization string `json:"organization,omitempty"`
+	// Note free form note
+	Note string `json:"note,omitempty"`
+	// UID globally unique identifier of the contact, kept from imported vCards
+	UID string `json:"uid,omitempty"`
+	// Emails at least one is required, the first one is unique among contacts
+	Emails []Email `json:"emails"`
+	// Phones ...
+	Phones []Phone `json:"phones"`
+	// Addresses ...
+	Addresses []Address `json:"addresses"`
+	// Tags labels grouping contacts, left out they keep their value on update
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Email an email address of a contact
+type Email struct {
+	// Value ...
+	Value string `json:"value"`
+	// Type free form kind of address such as work or home
+	Type string `json:"type,omitempty"`
+}
+
+// Phone a phone number of a contact
+type Phone struct {
+	// Value ...
+	Value string `json:"value"`
+	// Type free form kind of number such as mobile or work
+	Type string `json:"type,omitempty"`
+}
+
+// Address a postal address of a contact
+type Address struct {
+	// Type free form kind of address such as work or home
+	Type string `json:"type,omitempty"`
+	// Street street address including the house number
+	Street string `json:"street,omitempty"`
+	// City ...
+	City string `json:"city,omitempty"`
+	// Region state or province
+	Region string `json:"region,omitempty"`
+	// PostalCode ...
+	PostalCode string `json:"postal_code,omitempty"`
+	// Country ...
+	Country string `json:"country,omitempty"`
+}
+
+// ContactDetails what the v2 shape holds beyond the flat fields of a contact: the types of the first email,
+// phone and address and every other one
+type ContactDetails struct {
+	// EmailType type of the email of the contact
+	EmailType string `json:"email_type,omitempty"`
+	// PhoneType type of the phone of the contact
+	PhoneType string `json:"phone_type,omitempty"`
+	// AddressType type of the address of the contact
+	AddressType string `json:"address_type,omitempty"`
+	// Emails every email after the first
+	Emails []Email `json:"emails,omitempty"`
+	// Phones every phone after the first
+	Phones []Phone `json:"phones,omitempty"`
+	// Addresses every address after the first
+	Addresses []Address `json:"addresses,omitempty"`
+}
+
+// V2 returns the contact in the v2 shape
+func (c Contact) V2() ContactV2 {
+	d := c.Details
+	if d == nil {
+		d = &ContactDetails{}
+	}
+	v2 := ContactV2{
+		ID:           c.ID,
+		FirstName:    c.FirstName,
+		LastName:     c.LastName,
+		Organization: c.Organization,
+		Note:         c.Note,
+		UID:          c.UID,
+		Emails:       []Email{},
+		Phones:       []Phone{},
+		Addresses:    []Address{},
+		Tags:         c.Tags,
+	}
+	if c.Email != "" {
+		v2.Emails = append(v2.Emails, Email{Value: c.Email, Type: d.EmailType})
+	}
+	if c.Phone != "" {
+		v2.Phones = append(v2.Phones, Phone{Value: c.Phone, Type: d.PhoneType})
+	}
+	address := Address{Type: d.AddressType, Street: c.Street, City: c.City, Region: c.Region, PostalCode: c.PostalCode, Country: c.Country}
+	if address != (Address{Type: d.AddressType}) {
+		v2.Addresses = append(v2.Addresses, address)
+	}
+	v2.Emails = append(v2.Emails, d.Emails...)
+	v2.Phones = append(v2.Phones, d.Phones...)
+	v2.Addresses = append(v2.Addresses, d.Addresses...)
+	return v2
+}
+
+// Contact returns the contact in the flat v1 shape, the first email, phone and address fill the flat fields and
+// the rest is kept in the details
+func (c ContactV2) Contact() Contact {
+	contact := Contact{
+		ID:           c.ID,
+		FirstName:    c.FirstName,
+		LastName:     c.LastName,
+		Organization: c.Organization,
+		Note:         c.Note,
+		UID:          c.UID,
+		Tags:         c.Tags,
+		Details:      &ContactDetails{},
+	}
+	if len(c.Emails) > 0 {
+		contact.Email = c.Emails[0].Value
+		contact.Details.EmailType = c.Emails[0].Type
+		contact.Details.Emails = append([]Email{}, c.Emails[1:]...)
+	}
+	if len(c.Phones) > 0 {
+		contact.Phone = c.Phones[0].Value
+		contact.Details.PhoneType = c.Phones[0].Type
+		contact.Details.Phones = append([]Phone{}, c.Phones[1:]...)
+	}
+	if len(c.Addresses) > 0 {
+		a := c.Addresses[0]
+		contact.Street, contact.City, contact.Region, contact.PostalCode, contact.Country = a.Street, a.City, a.Region, a.PostalCode, a.Country
+		contact.Details.AddressType = a.Type
+		contact.Details.Addresses = append([]Address{}, c.Addresses[1:]...)
+	}
+	return contact
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// DuplicateMatch a scored pair of contacts that likely describe the same person
+type DuplicateMatch struct {
+	// A id of the first contact in the pair
+	A string `json:"a"`
+	// B id of the second contact in the pair
+	B string `json:"b"`
+	// Score likelihood between 0 and 1 that both contacts are the same person
+	Score float64 `json:"score"`
+	// Reasons signals that matched, any of email, phone or name
+	Reasons []string `json:"reasons"`
+}
+
+// DuplicateCluster a group of contacts linked together by duplicate matches
+type DuplicateCluster struct {
+	// Score highest match score within the cluster
+	Score float64 `json:"score"`
+	// Contacts ...
+	Contacts []Contact `json:"contacts"`
+	// Matches ...
+	Matches []DuplicateMatch `json:"matches"`
+}
+
+// MergeRequest data model describing which contacts to merge and how
+type MergeRequest struct {
+	// IDs contacts to merge, at least two are required
+	IDs []string `json:"ids"`
+	// TargetID contact that survives the merge, defaults to the first id
+	TargetID string `json:"target_id"`
+	// Rules maps a contact field (first_name, last_name, email, phone, organization, note, street, city,
+	// region, postal_code, country) to the id of the contact its value is taken from or to a pick rule.
+	// Emails, phones and addresses not picked are kept as extra ones of the merged contact
+	Rules map[string]string `json:"rules"`
+}
+
+// HistoryEntry a recorded change made to a contact
+type HistoryEntry struct {
+	// ID ...
+	ID string `json:"id"`
+	// ContactID ...
+	ContactID string `json:"contact_id"`
+	// Action ...
+	Action string `json:"action"`
+	// Data action specific details of the change
+	Data interface{} `json:"data"`
+	// CreatedAt ...
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// export job statuses
+const (
+	// ExportQueued the job waits for a worker
+	ExportQueued = "queued"
+	// ExportRunning a worker is writing the file
+	ExportRunning = "running"
+	// ExportSucceeded the file can be downloaded until the job expires
+	ExportSucceeded = "succeeded"
+	// ExportFailed the export stopped, see the error
+	ExportFailed = "failed"
+	// ExportExpired the file was removed
+	ExportExpired = "expired"
+)
+
+// ExportJob a file of contacts written in the background
+type ExportJob struct {
+	// ID ...
+	ID string `json:"id"`
+	// Status ExportQueued, ExportRunning, ExportSucceeded, ExportFailed or ExportExpired
+	Status string `json:"status"`
+	// Format csv, vcf, xlsx, json or ndjson
+	Format string `json:"format"`
+	// Options how the file is written and which contacts it holds
+	Options json.RawMessage `json:"options,omitempty"`
+	// Processed contacts written so far
+	Processed int `json:"processed"`
+	// Size of the written file in bytes
+	Size int64 `json:"size,omitempty"`
+	// Error why a failed export stopped
+	Error *Problem `json:"error,omitempty"`
+	// DownloadURL time limited link to the file of a succeeded export, a new link is made every time the job is read
+	DownloadURL string `json:"download_url,omitempty"`
+	// DownloadExpiresAt time the download url stops working
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+	// CreatedAt ...
+	CreatedAt time.Time `json:"created_at"`
+	// StartedAt ...
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// FinishedAt ...
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// ExpiresAt time the file is removed
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import "strings"
+
+// ContactFilter selects a subset of contacts, empty fields match every contact
+type ContactFilter struct {
+	// Query text found in the first name, last name, email or organization, ignoring case
+	Query string `json:"q,omitempty"`
+	// Organization ...
+	Organization string `json:"organization,omitempty"`
+	// City ...
+	City string `json:"city,omitempty"`
+	// Region ...
+	Region string `json:"region,omitempty"`
+	// Country ...
+	Country string `json:"country,omitempty"`
+	// Tag one of the tags of the contact
+	Tag string `json:"tag,omitempty"`
+}
+
+// Matches reports whether the contact is selected by the filter, the organization,
+// city, region and country must equal the filter ignoring case and the tag must be one of its tags
+func (f ContactFilter) Matches(c Contact) bool {
+	if f.Query != "" {
+		query := strings.ToLower(f.Query)
+		found := false
+		for _, value := range []string{c.FirstName, c.LastName, c.Email, c.Organization} {
+			if strings.Contains(strings.ToLower(value), query) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return equalFold(f.Organization, c.Organization) && equalFold(f.City, c.City) &&
+		equalFold(f.Region, c.Region) && equalFold(f.Country, c.Country) && hasTag(f.Tag, c.Tags)
+}
+
+// hasTag reports whether tags hold the filter tag ignoring case, an empty filter tag matches anything
+func hasTag(filter string, tags []string) bool {
+	if filter == "" {
+		return true
+	}
+	for _, tag := range tags {
+		if strings.EqualFold(filter, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalFold reports whether value equals the filter value ignoring case, an empty filter value matches anything
+func equalFold(filter, value string) bool {
+	return filter == "" || strings.EqualFold(filter, value)
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ImportReport summary of an import listing why every rejected row was skipped
+type ImportReport struct {
+	// Total rows found in the file
+	Total int `json:"total"`
+	// Created ...
+	Created int `json:"created"`
+	// Updated ...
+	Updated int `json:"updated"`
+	// Rejected rows that were skipped
+	Rejected int `json:"rejected"`
+	// Errors field errors of rejected rows named rows[i].field, rows are counted from 0 excluding any header
+	Errors []FieldError `json:"errors"`
+	// rows row of every error, kept to sort the errors by row
+	rows []int
+}
+
+// NewImportReport creates an empty import report
+func NewImportReport() *ImportReport {
+	return &ImportReport{Errors: []FieldError{}}
+}
+
+// Accept counts a row that was imported
+func (r *ImportReport) Accept(created bool) {
+	if created {
+		r.Created++
+		return
+	}
+	r.Updated++
+}
+
+// Reject counts a skipped row along with the errors explaining why
+func (r *ImportReport) Reject(row int, errs ...FieldError) {
+	r.Rejected++
+	for _, err := range errs {
+		r.Errors = append(r.Errors, FieldError{
+			Field:   fmt.Sprintf("rows[%d].%s", row, err.Field),
+			Message: err.Message,
+		})
+		r.rows = append(r.rows, row)
+	}
+}
+
+// SortErrors orders the errors by row, the errors of a row keep their order. Rows rejected while reading a
+// file are reported before the rows the store rejects so the errors are sorted once the import is done
+func (r *ImportReport) SortErrors() {
+	if len(r.rows) == len(r.Errors) {
+		sort.Stable(reportErrors{r})
+	}
+}
+
+// reportErrors sorts the errors of a report by row
+type reportErrors struct {
+	report *ImportReport
+}
+
+// Len implements sort.Interface
+func (e reportErrors) Len() int {
+	return len(e.report.Errors)
+}
+
+// Less implements sort.Interface
+func (e reportErrors) Less(i, j int) bool {
+	return e.report.rows[i] < e.report.rows[j]
+}
+
+// Swap implements sort.Interface
+func (e reportErrors) Swap(i, j int) {
+	e.report.Errors[i], e.report.Errors[j] = e.report.Errors[j], e.report.Errors[i]
+	e.report.rows[i], e.report.rows[j] = e.report.rows[j], e.report.rows[i]
+}
+
+// import job statuses
+const (
+	// ImportQueued the job waits for a worker
+	ImportQueued = "queued"
+	// ImportRunning a worker is importing the file
+	ImportRunning = "running"
+	// ImportSucceeded the file was imported, see the report for rejected rows
+	ImportSucceeded = "succeeded"
+	// ImportFailed the import stopped, see the error
+	ImportFailed = "failed"
+	// ImportCancelled the job was cancelled before it finished
+	ImportCancelled = "cancelled"
+)
+
+// ImportJob an uploaded file imported in the background
+type ImportJob struct {
+	// ID ...
+	ID string `json:"id"`
+	// Status ImportQueued, ImportRunning, ImportSucceeded, ImportFailed or ImportCancelled
+	Status string `json:"status"`
+	// Filename name of the uploaded file
+	Filename string `json:"filename"`
+	// ContentType declared content type of the uploaded file
+	ContentType string `json:"content_type,omitempty"`
+	// Options how the file is read and matched to existing contacts
+	Options json.RawMessage `json:"options,omitempty"`
+	// Processed rows read so far
+	Processed int `json:"processed"`
+	// Report outcome of a finished import
+	Report *ImportReport `json:"report,omitempty"`
+	// Error why a failed import stopped
+	Error *Problem `json:"error,omitempty"`
+	// CreatedAt ...
+	CreatedAt time.Time `json:"created_at"`
+	// StartedAt ...
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// FinishedAt ...
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job reached a final status
+func (j ImportJob) Finished() bool {
+	return j.Status == ImportSucceeded || j.Status == ImportFailed || j.Status == ImportCancelled
+}
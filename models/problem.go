@@ -0,0 +1,70 @@
+package models
+
+// stable problem codes clients can switch on, these never change once released
+const (
+	// CodeNotFound the requested resource does not exist
+	CodeNotFound = "not_found"
+	// CodeInvalidID the id provided is not a valid contact id
+	CodeInvalidID = "invalid_id"
+	// CodeInvalidBody the request body could not be decoded
+	CodeInvalidBody = "invalid_body"
+	// CodeInvalidParameter a query parameter has an invalid value
+	CodeInvalidParameter = "invalid_parameter"
+	// CodeValidationFailed the contact has field errors, see errors
+	CodeValidationFailed = "validation_failed"
+	// CodeDuplicateEmail another contact already uses the email
+	CodeDuplicateEmail = "duplicate_email"
+	// CodeInvalidMerge the merge request can not be applied
+	CodeInvalidMerge = "invalid_merge"
+	// CodeInvalidFile the uploaded file is missing or can not be read
+	CodeInvalidFile = "invalid_file"
+	// CodeUnsupportedFileType the uploaded file is not a supported type
+	CodeUnsupportedFileType = "unsupported_file_type"
+	// CodeImportRejected some imported rows were rejected, see errors
+	CodeImportRejected = "import_rejected"
+	// CodeImportFinished the import already finished and can not be cancelled
+	CodeImportFinished = "import_finished"
+	// CodeInvalidSignature the download link was not signed by the server
+	CodeInvalidSignature = "invalid_signature"
+	// CodeExportExpired the download link or the exported file expired
+	CodeExportExpired = "export_expired"
+	// CodeInternal an unexpected error occurred on the server
+	CodeInternal = "internal_error"
+)
+
+// ProblemTypePrefix prefix of every problem type, followed by the problem code
+const ProblemTypePrefix = "urn:contacts:problem:"
+
+// Problem an RFC 7807 problem details document returned when a request fails
+type Problem struct {
+	// Type uri identifying the kind of problem
+	Type string `json:"type"`
+	// Title short human readable summary of the kind of problem
+	Title string `json:"title"`
+	// Status http status code
+	Status int `json:"status"`
+	// Code stable machine readable problem code
+	Code string `json:"code"`
+	// Detail human readable explanation specific to this occurrence
+	Detail string `json:"detail,omitempty"`
+	// Instance id of the request the problem occurred in
+	Instance string `json:"instance,omitempty"`
+	// Errors field level problems found when validating a request
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// Error implements the error interface so problems can be returned as errors
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Code + ": " + p.Detail
+	}
+	return p.Code
+}
+
+// FieldError a problem found with a single field of a request
+type FieldError struct {
+	// Field json name of the invalid field
+	Field string `json:"field"`
+	// Message ...
+	Message string `json:"message"`
+}
@@ -3,13 +3,24 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 // Config is the top level app configuration
 type Config struct {
-	Service *PostgresConfig `yaml:"postgres"`
+	Service    *PostgresConfig   `yaml:"postgres"`
+	Validation *ValidationConfig `yaml:"validation"`
+	Imports    *ImportsConfig    `yaml:"imports"`
+	Exports    *ExportsConfig    `yaml:"exports"`
+	LDAP       *LDAPConfig       `yaml:"ldap"`
+	GRPC       *GRPCConfig       `yaml:"grpc"`
+	CardDAV    *CardDAVConfig    `yaml:"carddav"`
+	SCIM       *SCIMConfig       `yaml:"scim"`
+	GraphQL    *GraphQLConfig    `yaml:"graphql"`
+	OpenAPI    *OpenAPIConfig    `yaml:"openapi"`
+	Versions   *VersionsConfig   `yaml:"versions"`
 }
 
 // NewConfig gets the app config from config file
@@ -31,6 +42,89 @@ type PostgresConfig struct {
 	DB       string `yaml:"db"`
 }
 
+// ValidationConfig contains options for validating and normalizing contacts
+type ValidationConfig struct {
+	// DefaultRegion ISO 3166 region used to normalize phones written without a country code
+	DefaultRegion string `yaml:"default_region"`
+}
+
+// ImportsConfig contains options for background imports
+type ImportsConfig struct {
+	// Workers number of imports processed at the same time, defaults to 2
+	Workers int `yaml:"workers"`
+}
+
+// ExportsConfig contains options for background exports
+type ExportsConfig struct {
+	// Dir directory export files are written to, defaults to contacts-exports in the temp directory. A file is only
+	// downloaded from the instance that wrote it unless every instance shares the directory
+	Dir string `yaml:"dir"`
+	// Workers number of exports written at the same time, defaults to 1
+	Workers int `yaml:"workers"`
+	// TTL time export files are kept, defaults to 24h
+	TTL time.Duration `yaml:"ttl"`
+	// LinkTTL time a download link works, defaults to 15m
+	LinkTTL time.Duration `yaml:"link_ttl"`
+	// Secret key signing download links, required and shared by every instance so any of them accepts a link
+	Secret string `yaml:"secret"`
+}
+
+// LDAPConfig contains options for the read-only LDAP directory
+type LDAPConfig struct {
+	// Port the directory listens on, it is not started when the port is 0
+	Port int `yaml:"port"`
+	// BaseDN entry the contacts are listed below, defaults to ou=contacts
+	BaseDN string `yaml:"base_dn"`
+	// BindDN and Password clients bind with to search, anyone may search when BindDN is empty
+	BindDN   string `yaml:"bind_dn"`
+	Password string `yaml:"password"`
+	// SizeLimit most entries a search returns, defaults to 500
+	SizeLimit int `yaml:"size_limit"`
+}
+
+// GRPCConfig contains options for the gRPC ContactService
+type GRPCConfig struct {
+	// Port the service listens on, it is not started when the port is 0
+	Port int `yaml:"port"`
+}
+
+// CardDAVConfig contains options for the CardDAV server
+type CardDAVConfig struct {
+	// Username and Password clients authenticate with, the server is not mounted when Password is empty
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// SCIMConfig contains options for the SCIM provisioning endpoint
+type SCIMConfig struct {
+	// Token bearer token identity providers authenticate with, the endpoint is not mounted when empty
+	Token string `yaml:"token"`
+}
+
+// GraphQLConfig contains options for the GraphQL endpoint
+type GraphQLConfig struct {
+	// MaxDepth deepest nesting of fields a query may select, defaults to 15
+	MaxDepth int `yaml:"max_depth"`
+	// MaxComplexity highest complexity a query may have, defaults to 5000
+	MaxComplexity int `yaml:"max_complexity"`
+	// Playground serves a page running queries, meant for development only
+	Playground bool `yaml:"playground"`
+}
+
+// OpenAPIConfig contains options for checking requests against the OpenAPI document
+type OpenAPIConfig struct {
+	// Validation off, log to only log invalid requests or enforce to reject them, defaults to off
+	Validation string `yaml:"validation"`
+}
+
+// VersionsConfig contains the dates of deprecated api versions, written as 2006-01-02
+type VersionsConfig struct {
+	// V1Deprecated date the v1 contact routes were deprecated in favor of v2
+	V1Deprecated string `yaml:"v1_deprecated"`
+	// V1Sunset date the v1 contact routes stop responding
+	V1Sunset string `yaml:"v1_sunset"`
+}
+
 func load(config interface{}, fname string) error {
 	data, err := ioutil.ReadFile(fname)
 	if err != nil {
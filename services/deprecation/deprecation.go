@@ -0,0 +1,68 @@
+package deprecation
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// headers sent on the responses of deprecated routes
+const (
+	// DeprecationHeader when the route was deprecated, RFC 9745
+	DeprecationHeader = "Deprecation"
+	// SunsetHeader when the route stops responding, RFC 8594
+	SunsetHeader = "Sunset"
+	// LinkHeader links the route replacing the deprecated one
+	LinkHeader = "Link"
+)
+
+// Policy dates of a deprecated api version
+type Policy struct {
+	// Deprecated time the version was deprecated, without one Deprecation is sent as true like clients
+	// understood before RFC 9745
+	Deprecated time.Time
+	// Sunset time the version stops responding, Sunset is not sent without one
+	Sunset time.Time
+}
+
+// Deprecation marks every response of a deprecated route with the Deprecation and Sunset headers of policy and
+// links successor, the path of the route replacing it. Variables of successor like {id} take the route variable
+// or query of the same name, the path is cut before a variable the request has no value for
+func Deprecation(inner http.Handler, successor string, policy Policy) http.Handler {
+	deprecation := "true"
+	if !policy.Deprecated.IsZero() {
+		deprecation = "@" + strconv.FormatInt(policy.Deprecated.Unix(), 10)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(DeprecationHeader, deprecation)
+		if !policy.Sunset.IsZero() {
+			w.Header().Set(SunsetHeader, policy.Sunset.UTC().Format(http.TimeFormat))
+		}
+		w.Header().Add(LinkHeader, "<"+successorPath(successor, r)+`>; rel="successor-version"`)
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// successorPath fills the variables of successor with the values of r
+func successorPath(successor string, r *http.Request) string {
+	segments := strings.Split(successor, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		name := strings.Trim(segment, "{}")
+		value := mux.Vars(r)[name]
+		if value == "" {
+			value = r.URL.Query().Get(name)
+		}
+		if value == "" {
+			return strings.Join(segments[:i], "/")
+		}
+		segments[i] = url.PathEscape(value)
+	}
+	return strings.Join(segments, "/")
+}
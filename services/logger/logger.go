@@ -4,6 +4,8 @@ import (
 	"log"
 	"net/http"
 	"time"
+
+	"github.com/squanchersquanch/contacts/services/requestid"
 )
 
 // Logger sugared logger for http handler
@@ -14,7 +16,8 @@ func Logger(inner http.Handler, name string) http.Handler {
 		inner.ServeHTTP(w, r)
 
 		log.Printf(
-			"%s\t%s\t%s\t%s",
+			"%s\t%s\t%s\t%s\t%s",
+			requestid.FromContext(r.Context()),
 			r.Method,
 			r.RequestURI,
 			name,
@@ -0,0 +1,70 @@
+package openapi
+
+import (
+	"embed"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// paths served
+const (
+	// SpecPath path the document is served on
+	SpecPath = "/openapi.json"
+	// DocsPath path the api reference page is served on
+	DocsPath = "/docs"
+	// AssetsPath prefix the scripts and styles of the reference page are served below
+	AssetsPath = DocsPath + "/assets/"
+)
+
+// assets Swagger UI, vendored so the reference page loads nothing from other hosts
+//
+//go:embed assets/swagger-ui-bundle.js assets/swagger-ui.css
+var assets embed.FS
+
+// NewHandler creates an http.Handler serving the OpenAPI document spec on SpecPath and a Swagger UI page
+// rendering it on DocsPath, with the Swagger UI files below AssetsPath
+func NewHandler(spec *Spec) http.Handler {
+	data, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(SpecPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Write(data)
+	})
+	mux.HandleFunc(DocsPath, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, docsPage)
+	})
+	files := http.StripPrefix(DocsPath, http.FileServer(http.FS(assets)))
+	mux.Handle(AssetsPath, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// the files only change with a new build
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		files.ServeHTTP(w, req)
+	}))
+	return mux
+}
+
+// docsPage renders the document with Swagger UI
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>contacts-api reference</title>
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <link rel="stylesheet" href="` + AssetsPath + `swagger-ui.css">
+  <style>body { margin: 0; padding: 0; }</style>
+</head>
+<body>
+  <div id="docs"></div>
+  <script src="` + AssetsPath + `swagger-ui-bundle.js"></script>
+  <script>
+    SwaggerUIBundle({ url: "` + SpecPath + `", dom_id: "#docs", validatorUrl: null, deepLinking: true });
+  </script>
+</body>
+</html>
+`
@@ -0,0 +1,196 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/squanchersquanch/contacts/components/connectors"
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/squanchersquanch/contacts/services/config"
+	r "github.com/squanchersquanch/contacts/services/routes"
+	"github.com/stretchr/testify/assert"
+)
+
+// routeList returns the routes the router registers
+func routeList() []r.Route {
+	return r.NewRoutes(connectors.NewConnector(store.NewMemoryStore(), config.NewConfig("../../development.yaml"))).RouteList()
+}
+
+func TestDocument(t *testing.T) {
+	routes := routeList()
+	spec, err := Document(routes)
+	assert.NoError(t, err, "every route needs an entry in the operations table")
+
+	for _, route := range routes {
+		if route.Pattern == "" {
+			continue
+		}
+		path := pathVariable.ReplaceAllString(route.Pattern, "{$1}")
+		op := spec.Paths[path][strings.ToLower(route.Method)]
+		if assert.NotNil(t, op, route.Name) {
+			assert.Equal(t, route.Name, op.OperationID)
+			assert.NotEmpty(t, op.Summary, route.Name)
+			assert.NotEmpty(t, op.Responses["default"].Content[problemMediaType], route.Name)
+		}
+	}
+
+	get := spec.Paths["/api/v1/imports/{id}"]["get"]
+	assert.Equal(t, Parameter{Name: "id", In: "path", Description: "Id of the import", Required: true, Schema: &Schema{Type: "string"}}, get.Parameters[0])
+	assert.Equal(t, "#/components/schemas/ImportJob", get.Responses["200"].Content[jsonMediaType].Schema.Ref)
+	assert.NotEmpty(t, spec.Paths["/api/entry"]["post"].Responses["201"].Headers["Location"])
+	assert.True(t, spec.Paths["/api/entry"]["get"].Deprecated)
+	assert.False(t, spec.Paths["/api/v2/contacts"]["get"].Deprecated)
+	assert.Equal(t, "#/components/schemas/Email", spec.Components.Schemas["ContactV2"].Properties["emails"].Items.Ref)
+
+	_, err = Document(append(routes, r.Route{Name: "ListTags", Method: "GET", Pattern: "/api/v1/tags"}))
+	assert.EqualError(t, err, "openapi: route ListTags GET /api/v1/tags is not documented")
+
+	_, err = Document(routes[1:])
+	assert.EqualError(t, err, "openapi: operation "+routes[0].Name+" has no route")
+
+	renamed := append([]r.Route{}, routes...)
+	for i := range renamed {
+		if renamed[i].Name == "GetImport" {
+			renamed[i].Pattern = "/api/v1/imports/{job:[0-9]+}"
+		}
+	}
+	_, err = Document(renamed)
+	assert.EqualError(t, err, "openapi: route GetImport does not document its path variable job")
+}
+
+func TestSchema(t *testing.T) {
+	schemas := map[string]*Schema{}
+	g := newGenerator(schemas)
+
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Ref: "#/components/schemas/DuplicateCluster"}}, g.schema([]models.DuplicateCluster{}))
+	assert.Equal(t, &Schema{Type: "string"}, schemas["Contact"].Properties["postal_code"])
+	assert.Equal(t, &Schema{Type: "number"}, schemas["DuplicateMatch"].Properties["score"])
+
+	g.schema(models.ExportJob{})
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, schemas["ExportJob"].Properties["started_at"])
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/Problem"}, schemas["ExportJob"].Properties["error"])
+	assert.Equal(t, &Schema{}, schemas["ExportJob"].Properties["options"])
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Ref: "#/components/schemas/FieldError"}}, schemas["Problem"].Properties["errors"])
+
+	g.schema(models.MergeRequest{})
+	assert.Equal(t, &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}}, schemas["MergeRequest"].Properties["rules"])
+}
+
+func TestHandler(t *testing.T) {
+	document, _ := Document(routeList())
+	h := NewHandler(document)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", SpecPath, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	spec := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &spec))
+	assert.Equal(t, Version, spec["openapi"])
+	assert.Contains(t, spec["paths"], "/api/v1/contacts/{id}/qr.png")
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", DocsPath, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `url: "/openapi.json"`)
+
+	// the page only loads the vendored Swagger UI, never a script or style of another host
+	page := rr.Body.String()
+	assert.NotContains(t, page, "//")
+	refs := regexp.MustCompile(`(?:src|href)="([^"]*)"`).FindAllStringSubmatch(page, -1)
+	assert.Len(t, refs, 2)
+	for _, ref := range refs {
+		assert.True(t, strings.HasPrefix(ref[1], AssetsPath), ref[1])
+
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", ref[1], nil))
+		assert.Equal(t, http.StatusOK, rr.Code, ref[1])
+		assert.NotEmpty(t, rr.Body.Bytes())
+	}
+	assert.Contains(t, page, `validatorUrl: null`)
+}
+
+func TestValidate(t *testing.T) {
+	routes := routeList()
+	document, _ := Document(routes)
+	route := func(name string) r.Route {
+		for _, route := range routes {
+			if route.Name == name {
+				return route
+			}
+		}
+		t.Fatalf("no route %s", name)
+		return r.Route{}
+	}
+	handled := false
+	inner := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handled = true
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Write(body)
+	})
+	do := func(h http.Handler, method, target, body string) (*httptest.ResponseRecorder, models.Problem) {
+		handled = false
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		problem := models.Problem{}
+		if rr.Header().Get("Content-Type") == problemMediaType {
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &problem))
+		}
+		return rr, problem
+	}
+
+	qr := Validate(inner, document, route("ContactQRCode"), ValidationEnforce)
+	rr, _ := do(qr, "GET", "/api/v1/contacts/1/qr.png?format=MECARD&size=128&ecc=H", "")
+	assert.True(t, handled)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr, problem := do(qr, "GET", "/api/v1/contacts/1/qr.png?format=pdf&size=4096&ecc=H", "")
+	assert.False(t, handled)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, models.CodeInvalidParameter, problem.Code)
+	assert.Equal(t, []models.FieldError{
+		{Field: "format", Message: "must be one of vcard, mecard"},
+		{Field: "size", Message: "must be at most 2048"},
+	}, problem.Errors)
+
+	_, problem = do(Validate(inner, document, route("DownloadExport"), ValidationEnforce), "GET", "/api/v1/exports/1/download?expires=soon", "")
+	assert.Equal(t, []models.FieldError{
+		{Field: "expires", Message: "must be an integer"},
+		{Field: "signature", Message: "is required"},
+	}, problem.Errors)
+
+	merge := Validate(inner, document, route("MergeContacts"), ValidationEnforce)
+	rr, _ = do(merge, "POST", "/api/v1/contacts/merge", `{"ids": ["1", "2"], "rules": {"email": "2"}, "extra": 1}`)
+	assert.True(t, handled)
+	assert.Equal(t, `{"ids": ["1", "2"], "rules": {"email": "2"}, "extra": 1}`, rr.Body.String(), "the body is put back")
+
+	rr, problem = do(merge, "POST", "/api/v1/contacts/merge", `{"ids": ["1", 2], "target_id": 1, "rules": {"email": true}}`)
+	assert.False(t, handled)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, models.CodeInvalidBody, problem.Code)
+	assert.Equal(t, []models.FieldError{
+		{Field: "ids[1]", Message: "must be a string"},
+		{Field: "rules.email", Message: "must be a string"},
+		{Field: "target_id", Message: "must be a string"},
+	}, problem.Errors)
+
+	_, problem = do(merge, "POST", "/api/v1/contacts/merge", `[`)
+	assert.Equal(t, models.CodeInvalidBody, problem.Code)
+	assert.Empty(t, problem.Errors)
+
+	rr, _ = do(Validate(inner, document, route("MergeContacts"), ValidationLog), "POST", "/api/v1/contacts/merge", `{"ids": 1}`)
+	assert.True(t, handled, "invalid requests are only logged")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr, _ = do(Validate(inner, document, route("MergeContacts"), ValidationOff), "POST", "/api/v1/contacts/merge", `{"ids": 1}`)
+	assert.True(t, handled)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,380 @@
+package openapi
+
+import (
+	"net/http"
+
+	a "github.com/squanchersquanch/contacts/components/actions"
+	"github.com/squanchersquanch/contacts/components/csvfile"
+	"github.com/squanchersquanch/contacts/models"
+)
+
+// operations documents every route by route name, Document fails for routes missing here
+var operations = map[string]operation{
+	"CreateContact": {
+		summary:     "Create a contact",
+		description: "The contact is validated: a first or last name and a valid email are required and phones are normalized to E.164.",
+		body:        &content{mediaType: jsonMediaType, model: models.Contact{}},
+		responses: map[int]content{
+			http.StatusCreated:             contactResponse("The created contact", location("Url of the contact")),
+			http.StatusConflict:            problem("Another contact uses the email"),
+			http.StatusUnprocessableEntity: problem("The contact is invalid, errors lists the fields"),
+		},
+	},
+	"GetContact": {
+		summary:     "List every contact or get one by id",
+		description: "Without an id every contact is listed as an array, with an id the contact is returned as an object.",
+		parameters:  []Parameter{query("id", "Id of the contact to get", &Schema{Type: "string"})},
+		responses: map[int]content{
+			http.StatusOK: {description: "The contacts or the contact with the id", mediaType: jsonMediaType, schema: &Schema{OneOf: []*Schema{
+				{Type: "array", Items: &Schema{Ref: "#/components/schemas/Contact"}},
+				{Ref: "#/components/schemas/Contact"},
+			}}},
+			http.StatusNotFound: problem("No contact has the id"),
+		},
+	},
+	"UpdateContact": {
+		summary:     "Update a contact",
+		description: "Every field of the contact with the id of the body is replaced, the contact is validated like a created one.",
+		body:        &content{mediaType: jsonMediaType, model: models.Contact{}},
+		responses: map[int]content{
+			http.StatusOK:                  contactResponse("The updated contact", nil),
+			http.StatusNotFound:            problem("No contact has the id"),
+			http.StatusConflict:            problem("Another contact uses the email"),
+			http.StatusUnprocessableEntity: problem("The contact is invalid, errors lists the fields"),
+		},
+	},
+	"CreateContactV1": {
+		summary:     "Create a contact",
+		description: "The contact is validated: a first or last name and a valid email are required and phones are normalized to E.164.",
+		body:        &content{mediaType: jsonMediaType, model: models.Contact{}},
+		responses: map[int]content{
+			http.StatusCreated:             contactResponse("The created contact", location("Url of the contact")),
+			http.StatusConflict:            problem("Another contact uses the email"),
+			http.StatusUnprocessableEntity: problem("The contact is invalid, errors lists the fields"),
+		},
+	},
+	"ListContactsV1": {
+		summary: "List every contact",
+		responses: map[int]content{
+			http.StatusOK: {description: "Every contact", mediaType: jsonMediaType, model: []models.Contact{}},
+		},
+	},
+	"GetContactV1": {
+		summary:    "Get a contact",
+		parameters: []Parameter{pathParameter("id", "Id of the contact")},
+		responses: map[int]content{
+			http.StatusOK:       contactResponse("The contact", nil),
+			http.StatusNotFound: problem("No contact has the id"),
+		},
+	},
+	"UpdateContactV1": {
+		summary:     "Update a contact",
+		description: "The fields of the body replace those of the contact and the optional fields it omits keep their value, the id of the path replaces any id of the body and the contact is validated like a created one.",
+		parameters:  []Parameter{pathParameter("id", "Id of the contact")},
+		body:        &content{mediaType: jsonMediaType, model: models.Contact{}},
+		responses: map[int]content{
+			http.StatusOK:                  contactResponse("The updated contact", nil),
+			http.StatusNotFound:            problem("No contact has the id"),
+			http.StatusConflict:            problem("Another contact uses the email"),
+			http.StatusUnprocessableEntity: problem("The contact is invalid, errors lists the fields"),
+		},
+	},
+	"DeleteContactV1": {
+		summary:    "Delete a contact",
+		parameters: []Parameter{pathParameter("id", "Id of the contact")},
+		responses: map[int]content{
+			http.StatusNoContent: {description: "The contact was deleted"},
+			http.StatusNotFound:  problem("No contact has the id"),
+		},
+	},
+	"UpsertContactByEmail": {
+		summary:     "Create or update the contact with an email",
+		description: "The email of the path replaces any email of the body, optional fields left empty keep the value of an existing contact.",
+		parameters:  []Parameter{pathParameter("email", "Email of the contact")},
+		body:        &content{mediaType: jsonMediaType, model: models.Contact{}},
+		responses: map[int]content{
+			http.StatusOK:                  contactResponse("The updated contact", nil),
+			http.StatusCreated:             contactResponse("The created contact", location("Url of the contact")),
+			http.StatusUnprocessableEntity: problem("The contact is invalid, errors lists the fields"),
+		},
+	},
+	"DeleteContact": {
+		summary:    "Delete a contact",
+		parameters: []Parameter{required(query("id", "Id of the contact", &Schema{Type: "string"}))},
+		responses: map[int]content{
+			http.StatusNoContent: {description: "The contact was deleted"},
+			http.StatusNotFound:  problem("No contact has the id"),
+		},
+	},
+	"ExportContacts": {
+		summary:     "Export contacts",
+		description: "The contacts matching the filter are streamed as the file of the format.",
+		parameters:  exportParameters,
+		responses: map[int]content{
+			http.StatusOK: {description: "The exported file, sent as an attachment", mediaType: "application/octet-stream", schema: binary()},
+		},
+	},
+	"ExportContactVCard": {
+		summary:    "Download a contact as a vCard",
+		parameters: []Parameter{pathParameter("id", "Id of the contact"), versionParameter},
+		responses: map[int]content{
+			http.StatusOK:       {description: "The vCard of the contact", mediaType: "text/vcard", schema: &Schema{Type: "string"}},
+			http.StatusNotFound: problem("No contact has the id"),
+		},
+	},
+	"ContactQRCode": {
+		summary: "Render a qr code of a contact",
+		parameters: []Parameter{
+			pathParameter("id", "Id of the contact"),
+			query("format", "What the code holds, a vCard 3.0 or a shorter MECARD", enum(a.QRFormatVCard, a.QRFormatMeCard)),
+			query("size", "Image width in pixels", &Schema{Type: "integer", Minimum: number(64), Maximum: number(2048), Default: 256}),
+			query("ecc", "Error correction level", enum("L", "M", "Q", "H")),
+		},
+		responses: map[int]content{
+			http.StatusOK:       {description: "The png image of the code", mediaType: "image/png", schema: binary()},
+			http.StatusNotFound: problem("No contact has the id"),
+		},
+	},
+	"ImportContacts": {
+		summary:     "Import contacts from a file",
+		description: "csv, vCard, LDIF, json, ndjson and xlsx files are detected from their content, name and declared type.",
+		parameters:  importParameters,
+		body:        fileBody(),
+		responses: map[int]content{
+			http.StatusOK:                    {description: "Every row was read, rejected rows are reported", mediaType: jsonMediaType, model: models.ImportReport{}},
+			http.StatusUnsupportedMediaType:  problem("The file is not of a supported type"),
+			http.StatusUnprocessableEntity:   problem("Every row was rejected, errors lists why"),
+			http.StatusRequestEntityTooLarge: problem("The file is too large"),
+		},
+	},
+	"SubmitImport": {
+		summary:     "Import contacts from a file in the background",
+		description: "Takes the same file and parameters as ImportContacts, files up to 100 MB are accepted.",
+		parameters:  importParameters,
+		body:        fileBody(),
+		responses: map[int]content{
+			http.StatusAccepted:              importResponse("The queued import", location("Url of the import")),
+			http.StatusUnsupportedMediaType:  problem("The file is not of a supported type"),
+			http.StatusRequestEntityTooLarge: problem("The file is larger than 100 MB"),
+		},
+	},
+	"GetImport": {
+		summary:    "Get the status of a background import",
+		parameters: []Parameter{pathParameter("id", "Id of the import")},
+		responses: map[int]content{
+			http.StatusOK:       importResponse("The import", nil),
+			http.StatusNotFound: problem("No import has the id"),
+		},
+	},
+	"CancelImport": {
+		summary:    "Cancel a background import",
+		parameters: []Parameter{pathParameter("id", "Id of the import")},
+		responses: map[int]content{
+			http.StatusOK:       importResponse("The cancelled import", nil),
+			http.StatusNotFound: problem("No import has the id"),
+			http.StatusConflict: problem("The import already finished"),
+		},
+	},
+	"SubmitExport": {
+		summary:     "Export contacts in the background",
+		description: "Takes the same parameters as ExportContacts.",
+		parameters:  exportParameters,
+		responses: map[int]content{
+			http.StatusAccepted: exportResponse("The queued export", location("Url of the export")),
+		},
+	},
+	"GetExport": {
+		summary:     "Get the status of a background export",
+		description: "A succeeded export holds a new time limited download url every time it is read.",
+		parameters:  []Parameter{pathParameter("id", "Id of the export")},
+		responses: map[int]content{
+			http.StatusOK:       exportResponse("The export", nil),
+			http.StatusNotFound: problem("No export has the id"),
+		},
+	},
+	"DownloadExport": {
+		summary: "Download the file of a background export",
+		parameters: []Parameter{
+			pathParameter("id", "Id of the export"),
+			required(query("expires", "Expiry of the link, from the download url", &Schema{Type: "integer"})),
+			required(query("signature", "Signature of the link, from the download url", &Schema{Type: "string"})),
+		},
+		responses: map[int]content{
+			http.StatusOK:        {description: "The exported file, sent as an attachment", mediaType: "application/octet-stream", schema: binary()},
+			http.StatusForbidden: problem("The link was not signed by the server"),
+			http.StatusGone:      problem("The link or the file expired"),
+		},
+	},
+	"FindDuplicates": {
+		summary: "Find likely duplicate contacts",
+		parameters: []Parameter{
+			query("threshold", "Lowest score of a pair of duplicates", &Schema{Type: "number", Minimum: number(0), Maximum: number(1), Default: 0.75}),
+		},
+		responses: map[int]content{
+			http.StatusOK: {description: "Clusters of likely duplicates", mediaType: jsonMediaType, model: []models.DuplicateCluster{}},
+		},
+	},
+	"MergeContacts": {
+		summary:     "Merge contacts",
+		description: "The contacts are merged into target_id and the others are deleted, rules pick the contact each field is taken from.",
+		body:        &content{mediaType: jsonMediaType, model: models.MergeRequest{}},
+		responses: map[int]content{
+			http.StatusOK:       contactResponse("The merged contact", nil),
+			http.StatusNotFound: problem("No contact has one of the ids"),
+		},
+	},
+	"CreateContactV2": {
+		summary:     "Create a contact",
+		description: "The contact is validated like in v1, the first email, phone and address are the ones of the v1 shape.",
+		body:        &content{mediaType: jsonMediaType, model: models.ContactV2{}},
+		responses: map[int]content{
+			http.StatusCreated:             contactV2Response("The created contact", location("Url of the contact")),
+			http.StatusConflict:            problem("Another contact uses the first email"),
+			http.StatusUnprocessableEntity: problem("The contact is invalid, errors lists the fields"),
+		},
+	},
+	"ListContactsV2": {
+		summary:     "List contacts",
+		description: "Contacts are ordered by id. Without a limit every contact is listed, with one a Link header points to the next page while there is one.",
+		parameters: []Parameter{
+			query("limit", "Most contacts in the page", &Schema{Type: "integer", Minimum: number(1), Maximum: number(1000)}),
+			query("after", "Id of the last contact of the previous page", &Schema{Type: "string"}),
+		},
+		responses: map[int]content{
+			http.StatusOK: {
+				description: "The contacts of the page",
+				mediaType:   jsonMediaType,
+				model:       []models.ContactV2{},
+				headers:     map[string]Header{"Link": {Description: "Url of the next page, rel next", Schema: &Schema{Type: "string"}}},
+			},
+		},
+	},
+	"GetContactV2": {
+		summary:    "Get a contact",
+		parameters: []Parameter{pathParameter("id", "Id of the contact")},
+		responses: map[int]content{
+			http.StatusOK:       contactV2Response("The contact", nil),
+			http.StatusNotFound: problem("No contact has the id"),
+		},
+	},
+	"UpdateContactV2": {
+		summary:     "Update a contact",
+		description: "Every field of the contact is replaced, every email, phone and address included.",
+		parameters:  []Parameter{pathParameter("id", "Id of the contact")},
+		body:        &content{mediaType: jsonMediaType, model: models.ContactV2{}},
+		responses: map[int]content{
+			http.StatusOK:                  contactV2Response("The updated contact", nil),
+			http.StatusNotFound:            problem("No contact has the id"),
+			http.StatusConflict:            problem("Another contact uses the first email"),
+			http.StatusUnprocessableEntity: problem("The contact is invalid, errors lists the fields"),
+		},
+	},
+	"DeleteContactV2": {
+		summary:    "Delete a contact",
+		parameters: []Parameter{pathParameter("id", "Id of the contact")},
+		responses: map[int]content{
+			http.StatusNoContent: {description: "The contact was deleted"},
+			http.StatusNotFound:  problem("No contact has the id"),
+		},
+	},
+}
+
+// csvParameters tune the layout of csv and xlsx files
+var csvParameters = []Parameter{
+	query("profile", "Column layout, custom reads the mapping", enum(csvfile.ProfileDefault, csvfile.ProfileOutlook, csvfile.ProfileGoogle, csvfile.ProfileCustom)),
+	query("mapping", "Json object of headers to contact fields for the custom profile", &Schema{Type: "string"}),
+	query("delimiter", "A single character or comma, semicolon, tab or pipe", &Schema{Type: "string"}),
+	query("quote", "A single character", &Schema{Type: "string"}),
+	query("charset", "Character set of the file", enum(
+		"utf-8", "utf8", "utf-16", "utf16", "utf-16le", "utf16le", "utf-16be", "utf16be",
+		"windows-1252", "cp1252", "latin1", "iso-8859-1",
+	)),
+}
+
+// versionParameter picks the vCard version
+var versionParameter = query("version", "vCard version", enum("3.0", "4.0"))
+
+// exportParameters pick the format, layout and contacts of an export
+var exportParameters = append([]Parameter{
+	query("format", "Format of the file", enum(a.FormatCSV, a.FormatVCard, a.FormatLDIF, a.FormatXLSX, a.FormatJSON, a.FormatNDJSON)),
+	versionParameter,
+	query("base_dn", "Entry the LDIF entries are named below", &Schema{Type: "string"}),
+	query("bom", "Writes a byte order mark for the utf charsets", &Schema{Type: "boolean"}),
+	query("q", "Text found in the first name, last name, email or organization", &Schema{Type: "string"}),
+	query("organization", "Organization of the contacts, ignoring case", &Schema{Type: "string"}),
+	query("city", "City of the contacts, ignoring case", &Schema{Type: "string"}),
+	query("region", "Region of the contacts, ignoring case", &Schema{Type: "string"}),
+	query("country", "Country of the contacts, ignoring case", &Schema{Type: "string"}),
+}, csvParameters...)
+
+// importParameters tune how a file is read and matched to existing contacts
+var importParameters = append([]Parameter{
+	query("match", "Field rows are matched to existing contacts by", enum(a.MatchByID, a.MatchByEmail)),
+	query("sheet", "Sheet of an xlsx workbook, the first one by default", &Schema{Type: "string"}),
+}, csvParameters...)
+
+// query returns an optional query parameter
+func query(name, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// pathParameter returns a path parameter
+func pathParameter(name, description string) Parameter {
+	return Parameter{Name: name, In: "path", Description: description, Required: true, Schema: &Schema{Type: "string"}}
+}
+
+// required marks a parameter as required
+func required(p Parameter) Parameter {
+	p.Required = true
+	return p
+}
+
+// enum returns the schema of a string taking one of the values
+func enum(values ...string) *Schema {
+	return &Schema{Type: "string", Enum: values}
+}
+
+// binary returns the schema of a file
+func binary() *Schema {
+	return &Schema{Type: "string", Format: "binary"}
+}
+
+// number returns a pointer to n for schema bounds
+func number(n float64) *float64 {
+	return &n
+}
+
+// location returns the Location header of created resources
+func location(description string) map[string]Header {
+	return map[string]Header{"Location": {Description: description, Schema: &Schema{Type: "string"}}}
+}
+
+// fileBody returns the multipart body uploading a file
+func fileBody() *content {
+	return &content{mediaType: multipartMediaType, schema: &Schema{Type: "object", Properties: map[string]*Schema{"file": binary()}}}
+}
+
+// problem returns a problem response
+func problem(description string) content {
+	return content{description: description, mediaType: problemMediaType, model: models.Problem{}}
+}
+
+// contactResponse returns a response holding a contact
+func contactResponse(description string, headers map[string]Header) content {
+	return content{description: description, mediaType: jsonMediaType, model: models.Contact{}, headers: headers}
+}
+
+// contactV2Response returns a response holding a contact in the v2 shape
+func contactV2Response(description string, headers map[string]Header) content {
+	return content{description: description, mediaType: jsonMediaType, model: models.ContactV2{}, headers: headers}
+}
+
+// importResponse returns a response holding an import job
+func importResponse(description string, headers map[string]Header) content {
+	return content{description: description, mediaType: jsonMediaType, model: models.ImportJob{}, headers: headers}
+}
+
+// exportResponse returns a response holding an export job
+func exportResponse(description string, headers map[string]Header) content {
+	return content{description: description, mediaType: jsonMediaType, model: models.ExportJob{}, headers: headers}
+}
@@ -0,0 +1,105 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema a JSON Schema as used by OpenAPI 3.1
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+}
+
+// schema types
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// generator generates the schemas of go values from their json encoding, named structs are added to the
+// component schemas once and referenced
+type generator struct {
+	schemas map[string]*Schema
+}
+
+// newGenerator creates a generator adding to the component schemas
+func newGenerator(schemas map[string]*Schema) *generator {
+	return &generator{schemas: schemas}
+}
+
+// schema returns the schema of the value of v
+func (g *generator) schema(v interface{}) *Schema {
+	return g.typeSchema(reflect.TypeOf(v))
+}
+
+// typeSchema returns the schema of values of t
+func (g *generator) typeSchema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawType:
+		// raw json holds any value
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// the name is taken before the fields are generated so recursive types end
+			g.schemas[t.Name()] = &Schema{}
+			*g.schemas[t.Name()] = *g.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	// interfaces hold any value
+	return &Schema{}
+}
+
+// object returns the schema of the json object of a struct
+func (g *generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if f.PkgPath != "" || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = g.typeSchema(f.Type)
+	}
+	return s
+}
@@ -0,0 +1,211 @@
+package openapi
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/squanchersquanch/contacts/models"
+	r "github.com/squanchersquanch/contacts/services/routes"
+)
+
+// Version version of the OpenAPI specification documents are written in
+const Version = "3.1.0"
+
+// media types of documented bodies
+const (
+	jsonMediaType      = "application/json"
+	problemMediaType   = "application/problem+json"
+	multipartMediaType = "multipart/form-data"
+)
+
+// Spec an OpenAPI document
+type Spec struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info describes the api
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem the operations of a path by lower case method
+type PathItem map[string]*Operation
+
+// Components schemas referenced by the operations
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// Operation a single route
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+	Deprecated  bool                `json:"deprecated,omitempty"`
+}
+
+// Parameter a path or query parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody the body an operation reads
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response a response of an operation
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header a response header
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// MediaType the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// operation documents the route with the same name, the name is the operation id. Body and response models
+// are go values whose schemas are generated from their types
+type operation struct {
+	summary     string
+	description string
+	parameters  []Parameter
+	body        *content
+	responses   map[int]content
+}
+
+// content a documented body, model is a go value or schema a fixed schema
+type content struct {
+	description string
+	mediaType   string
+	model       interface{}
+	schema      *Schema
+	headers     map[string]Header
+}
+
+// pathVariable matches the variables of a route pattern, including any regular expression
+var pathVariable = regexp.MustCompile(`\{([^{}:]+)(:[^{}]*)?\}`)
+
+// Document returns the OpenAPI document of routes. Routes without an entry in the operations table or whose
+// path variables are not documented are still listed and reported in the error, as are entries without a route
+func Document(routes []r.Route) (*Spec, error) {
+	spec := &Spec{
+		OpenAPI: Version,
+		Info: Info{
+			Title:       "contacts-api",
+			Version:     "1.0.0",
+			Description: "Stores, validates, imports and exports contacts. Failed requests respond with an RFC 7807 problem.",
+		},
+		Paths:      map[string]PathItem{},
+		Components: Components{Schemas: map[string]*Schema{}},
+	}
+	g := newGenerator(spec.Components.Schemas)
+
+	problems := []string{}
+	documented := map[string]bool{}
+	for _, route := range routes {
+		// the catch all route answering unknown paths has no pattern
+		if route.Pattern == "" {
+			continue
+		}
+		path := pathVariable.ReplaceAllString(route.Pattern, "{$1}")
+		op, ok := operations[route.Name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("route %s %s %s is not documented", route.Name, route.Method, path))
+			op = operation{responses: map[int]content{}}
+		}
+		documented[route.Name] = true
+
+		for _, match := range pathVariable.FindAllStringSubmatch(route.Pattern, -1) {
+			if !hasParameter(op.parameters, match[1], "path") && ok {
+				problems = append(problems, fmt.Sprintf("route %s does not document its path variable %s", route.Name, match[1]))
+			}
+		}
+		item, ok := spec.Paths[path]
+		if !ok {
+			item = PathItem{}
+			spec.Paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = op.build(route.Name, g)
+		item[strings.ToLower(route.Method)].Deprecated = route.Successor != ""
+	}
+	for name := range operations {
+		if !documented[name] {
+			problems = append(problems, fmt.Sprintf("operation %s has no route", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return spec, fmt.Errorf("openapi: %s", strings.Join(problems, ", "))
+	}
+	return spec, nil
+}
+
+// hasParameter reports whether the parameter is documented
+func hasParameter(params []Parameter, name, in string) bool {
+	for _, p := range params {
+		if p.Name == name && p.In == in {
+			return true
+		}
+	}
+	return false
+}
+
+// build returns the Operation, every operation can fail with a problem
+func (op operation) build(id string, g *generator) *Operation {
+	o := &Operation{
+		OperationID: id,
+		Summary:     op.summary,
+		Description: op.description,
+		Parameters:  op.parameters,
+		Responses:   map[string]Response{},
+	}
+	if op.body != nil {
+		o.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{op.body.mediaType: {Schema: op.body.build(g)}}}
+	}
+	for status, c := range op.responses {
+		res := Response{Description: c.description, Headers: c.headers}
+		if c.mediaType != "" {
+			res.Content = map[string]MediaType{c.mediaType: {Schema: c.build(g)}}
+		}
+		o.Responses[strconv.Itoa(status)] = res
+	}
+	o.Responses["default"] = Response{
+		Description: "The request failed, code tells why",
+		Content:     map[string]MediaType{problemMediaType: {Schema: g.schema(models.Problem{})}},
+	}
+	return o
+}
+
+// build returns the schema of the content
+func (c content) build(g *generator) *Schema {
+	if c.schema != nil {
+		return c.schema
+	}
+	return g.schema(c.model)
+}
@@ -0,0 +1,320 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/squanchersquanch/contacts/services/requestid"
+	r "github.com/squanchersquanch/contacts/services/routes"
+)
+
+// validation modes
+const (
+	// ValidationOff requests are not validated
+	ValidationOff = "off"
+	// ValidationLog invalid requests are logged and still handled, meant for rolling validation out
+	ValidationLog = "log"
+	// ValidationEnforce invalid requests are answered with a 400 problem
+	ValidationEnforce = "enforce"
+)
+
+// maxBodySize largest json body validated, the handlers read no more
+const maxBodySize = 1048576
+
+// Validate wraps the handler of route, checking the query parameters and json body of every request against the
+// operation documented for the route in spec. Only mode ValidationEnforce rejects invalid requests, any other
+// mode than ValidationLog or a route without an operation returns inner unchanged
+func Validate(inner http.Handler, spec *Spec, route r.Route, mode string) http.Handler {
+	if mode != ValidationLog && mode != ValidationEnforce || spec == nil {
+		return inner
+	}
+	op := spec.Paths[pathVariable.ReplaceAllString(route.Pattern, "{$1}")][strings.ToLower(route.Method)]
+	if op == nil {
+		return inner
+	}
+	v := &validator{schemas: spec.Components.Schemas}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		problem := v.request(req, op)
+		if problem == nil {
+			inner.ServeHTTP(w, req)
+			return
+		}
+		problem.Instance = w.Header().Get(requestid.Header)
+		if mode == ValidationLog {
+			log.Printf("openapi validation: %s %s%s (instance=%s)", route.Name, problem, describe(problem.Errors), problem.Instance)
+			inner.ServeHTTP(w, req)
+			return
+		}
+		log.Printf("http error: %s (code=%d, instance=%s)", problem, problem.Status, problem.Instance)
+		w.Header().Set("Content-Type", problemMediaType)
+		w.WriteHeader(problem.Status)
+		json.NewEncoder(w).Encode(problem)
+	})
+}
+
+// validator checks values against schemas, resolving references to the component schemas
+type validator struct {
+	schemas map[string]*Schema
+}
+
+// request returns the problem of an invalid request or nil. A validated json body is put back so the handler
+// reads it again
+func (v *validator) request(req *http.Request, op *Operation) *models.Problem {
+	errs := []models.FieldError{}
+	query := req.URL.Query()
+	for _, p := range op.Parameters {
+		if p.In != "query" {
+			continue
+		}
+		values, ok := query[p.Name]
+		if !ok {
+			if p.Required {
+				errs = append(errs, models.FieldError{Field: p.Name, Message: "is required"})
+			}
+			continue
+		}
+		v.parameter(p.Name, v.resolve(p.Schema), values[0], &errs)
+	}
+	if len(errs) > 0 {
+		return newProblem(models.CodeInvalidParameter, "one or more query parameters are invalid", errs)
+	}
+
+	if op.RequestBody == nil || req.Body == nil {
+		return nil
+	}
+	media, ok := op.RequestBody.Content[jsonMediaType]
+	if !ok {
+		return nil
+	}
+	// bodies of other types are left to the handler to reject
+	if t, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); t != "" && t != jsonMediaType {
+		return nil
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(req.Body, maxBodySize))
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	var body interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return newProblem(models.CodeInvalidBody, "the body is not valid json", nil)
+	}
+	v.value("", media.Schema, body, &errs)
+	if len(errs) > 0 {
+		return newProblem(models.CodeInvalidBody, "the body does not match the schema of the operation", errs)
+	}
+	return nil
+}
+
+// parameter checks the value of a query parameter
+func (v *validator) parameter(name string, s *Schema, value string, errs *[]models.FieldError) {
+	var n float64
+	var err error
+	switch s.Type {
+	case "integer":
+		var i int64
+		i, err = strconv.ParseInt(value, 10, 64)
+		n = float64(i)
+	case "number":
+		n, err = strconv.ParseFloat(value, 64)
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			*errs = append(*errs, models.FieldError{Field: name, Message: "must be true or false"})
+		}
+		return
+	default:
+		v.str(name, s, value, errs)
+		return
+	}
+	if err != nil {
+		*errs = append(*errs, models.FieldError{Field: name, Message: "must be " + article(s.Type)})
+		return
+	}
+	v.bounds(name, s, n, errs)
+}
+
+// value checks a decoded json value, path is the json path of the value
+func (v *validator) value(path string, s *Schema, value interface{}, errs *[]models.FieldError) {
+	s = v.resolve(s)
+	// handlers decode null as the zero value of any type so it is always accepted
+	if value == nil {
+		return
+	}
+	if len(s.OneOf) > 0 {
+		for _, one := range s.OneOf {
+			if v.matches(one, value) {
+				return
+			}
+		}
+		*errs = append(*errs, models.FieldError{Field: field(path), Message: "does not match any of the allowed schemas"})
+		return
+	}
+
+	switch s.Type {
+	case "":
+		// schemas without a type hold any value
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			*errs = append(*errs, models.FieldError{Field: field(path), Message: "must be a string"})
+			return
+		}
+		v.str(field(path), s, str, errs)
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if ok && s.Type == "integer" {
+			_, err := n.Int64()
+			ok = err == nil
+		}
+		if !ok {
+			*errs = append(*errs, models.FieldError{Field: field(path), Message: "must be " + article(s.Type)})
+			return
+		}
+		f, _ := n.Float64()
+		v.bounds(field(path), s, f, errs)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			*errs = append(*errs, models.FieldError{Field: field(path), Message: "must be true or false"})
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			*errs = append(*errs, models.FieldError{Field: field(path), Message: "must be an array"})
+			return
+		}
+		for i, item := range items {
+			v.value(fmt.Sprintf("%s[%d]", path, i), s.Items, item, errs)
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			*errs = append(*errs, models.FieldError{Field: field(path), Message: "must be an object"})
+			return
+		}
+		names := []string{}
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			// unknown properties are ignored by the handlers
+			property, schema := object[name], s.Properties[name]
+			if schema == nil {
+				schema = s.AdditionalProperties
+			}
+			if schema != nil {
+				v.value(join(path, name), schema, property, errs)
+			}
+		}
+	}
+}
+
+// matches reports whether the value is valid against the schema
+func (v *validator) matches(s *Schema, value interface{}) bool {
+	errs := []models.FieldError{}
+	v.value("", s, value, &errs)
+	return len(errs) == 0
+}
+
+// str checks the enum and format of a string, enums ignore case like the handlers
+func (v *validator) str(name string, s *Schema, value string, errs *[]models.FieldError) {
+	if len(s.Enum) > 0 {
+		for _, e := range s.Enum {
+			if strings.EqualFold(e, value) {
+				return
+			}
+		}
+		*errs = append(*errs, models.FieldError{Field: name, Message: "must be one of " + strings.Join(s.Enum, ", ")})
+		return
+	}
+	if s.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			*errs = append(*errs, models.FieldError{Field: name, Message: "must be an RFC 3339 date-time"})
+		}
+	}
+}
+
+// bounds checks the minimum and maximum of a number
+func (v *validator) bounds(name string, s *Schema, n float64, errs *[]models.FieldError) {
+	if s.Minimum != nil && n < *s.Minimum {
+		*errs = append(*errs, models.FieldError{Field: name, Message: "must be at least " + strconv.FormatFloat(*s.Minimum, 'f', -1, 64)})
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		*errs = append(*errs, models.FieldError{Field: name, Message: "must be at most " + strconv.FormatFloat(*s.Maximum, 'f', -1, 64)})
+	}
+}
+
+// resolve returns the component schema a schema references, a missing component holds any value
+func (v *validator) resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = v.schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	if s == nil {
+		return &Schema{}
+	}
+	return s
+}
+
+// newProblem creates the problem of an invalid request
+func newProblem(code, detail string, errs []models.FieldError) *models.Problem {
+	return &models.Problem{
+		Type:   models.ProblemTypePrefix + code,
+		Title:  http.StatusText(http.StatusBadRequest),
+		Status: http.StatusBadRequest,
+		Code:   code,
+		Detail: detail,
+		Errors: errs,
+	}
+}
+
+// describe lists field errors for the log
+func describe(errs []models.FieldError) string {
+	list := []string{}
+	for _, e := range errs {
+		list = append(list, e.Field+" "+e.Message)
+	}
+	if len(list) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(list, ", ") + "]"
+}
+
+// field returns the field name of a json path, the body itself is named body
+func field(path string) string {
+	if path == "" {
+		return "body"
+	}
+	return path
+}
+
+// join returns the json path of a property
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// article returns a type name with its indefinite article
+func article(typ string) string {
+	if typ == "integer" {
+		return "an integer"
+	}
+	return "a " + typ
+}
@@ -17,6 +17,7 @@ const (
 )
 
 // NewDataBase creates a DataBase interface for with appropriated configuration info
+// and creates any missing tables
 func NewDataBase(cfg *config.Config) *sql.DB {
 	s := cfg.Service
 	psqlInfo := fmt.Sprintf(psqlInfoFormatString,
@@ -30,5 +31,9 @@ func NewDataBase(cfg *config.Config) *sql.DB {
 		panic(err)
 	}
 	log.Println("Successfully connected!")
+	err = migrate(db, s.DB)
+	if err != nil {
+		panic(err)
+	}
 	return db
 }
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// schema statements are run in order on start up, %[1]s is replaced by the configured table
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS %[1]s (
+		id SERIAL PRIMARY KEY,
+		firstName TEXT,
+		lastName TEXT,
+		email TEXT UNIQUE NOT NULL,
+		phone TEXT
+	);`,
+	`CREATE TABLE IF NOT EXISTS %[1]s_history (
+		id SERIAL PRIMARY KEY,
+		contact_id INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		data JSONB,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`,
+	`CREATE INDEX IF NOT EXISTS %[1]s_history_contact_id_idx ON %[1]s_history (contact_id);`,
+	`ALTER TABLE %[1]s
+		ADD COLUMN IF NOT EXISTS organization TEXT,
+		ADD COLUMN IF NOT EXISTS note TEXT,
+		ADD COLUMN IF NOT EXISTS uid TEXT,
+		ADD COLUMN IF NOT EXISTS street TEXT,
+		ADD COLUMN IF NOT EXISTS city TEXT,
+		ADD COLUMN IF NOT EXISTS region TEXT,
+		ADD COLUMN IF NOT EXISTS postalCode TEXT,
+		ADD COLUMN IF NOT EXISTS country TEXT;`,
+	`CREATE TABLE IF NOT EXISTS %[1]s_imports (
+		id SERIAL PRIMARY KEY,
+		status TEXT NOT NULL,
+		filename TEXT NOT NULL DEFAULT '',
+		content_type TEXT NOT NULL DEFAULT '',
+		options JSONB,
+		data BYTEA,
+		processed INTEGER NOT NULL DEFAULT 0,
+		report JSONB,
+		error JSONB,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		started_at TIMESTAMPTZ,
+		heartbeat_at TIMESTAMPTZ,
+		finished_at TIMESTAMPTZ
+	);`,
+	`CREATE INDEX IF NOT EXISTS %[1]s_imports_status_idx ON %[1]s_imports (status, id);`,
+	`CREATE TABLE IF NOT EXISTS %[1]s_exports (
+		id SERIAL PRIMARY KEY,
+		status TEXT NOT NULL,
+		format TEXT NOT NULL,
+		options JSONB,
+		processed INTEGER NOT NULL DEFAULT 0,
+		size BIGINT NOT NULL DEFAULT 0,
+		error JSONB,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		started_at TIMESTAMPTZ,
+		heartbeat_at TIMESTAMPTZ,
+		finished_at TIMESTAMPTZ,
+		expires_at TIMESTAMPTZ
+	);`,
+	`CREATE INDEX IF NOT EXISTS %[1]s_exports_status_idx ON %[1]s_exports (status, id);`,
+	`CREATE INDEX IF NOT EXISTS %[1]s_uid_idx ON %[1]s (uid);`,
+	`CREATE TABLE IF NOT EXISTS %[1]s_changes (
+		id BIGSERIAL PRIMARY KEY,
+		contact_id INTEGER NOT NULL,
+		uid TEXT NOT NULL DEFAULT '',
+		deleted BOOLEAN NOT NULL DEFAULT false,
+		changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`,
+	// every statement writing contacts, bulk imports and merges included, is logged by the trigger
+	`CREATE OR REPLACE FUNCTION %[1]s_log_change() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			INSERT INTO %[1]s_changes (contact_id, uid, deleted) VALUES (OLD.id, COALESCE(OLD.uid, ''), true);
+			RETURN NULL;
+		END IF;
+		IF TG_OP = 'UPDATE' AND OLD.uid IS DISTINCT FROM NEW.uid THEN
+			INSERT INTO %[1]s_changes (contact_id, uid, deleted) VALUES (OLD.id, COALESCE(OLD.uid, ''), true);
+		END IF;
+		INSERT INTO %[1]s_changes (contact_id, uid) VALUES (NEW.id, COALESCE(NEW.uid, ''));
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;`,
+	`DROP TRIGGER IF EXISTS %[1]s_log_change ON %[1]s;`,
+	`CREATE TRIGGER %[1]s_log_change AFTER INSERT OR UPDATE OR DELETE ON %[1]s
+		FOR EACH ROW EXECUTE PROCEDURE %[1]s_log_change();`,
+	// emails, phones and addresses of the v2 api beyond the flat columns
+	`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS details JSONB;`,
+	// labels grouping contacts, stored lowercase
+	`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS tags TEXT[];`,
+	`CREATE INDEX IF NOT EXISTS %[1]s_tags_idx ON %[1]s USING GIN (tags);`,
+}
+
+// migrate creates the tables the app depends on when they do not exist yet
+func migrate(db *sql.DB, table string) error {
+	for _, statement := range schema {
+		if _, err := db.Exec(fmt.Sprintf(statement, table)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
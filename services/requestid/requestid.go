@@ -0,0 +1,61 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header is the http header carrying the request id
+const Header = "X-Request-ID"
+
+// maxLength longest request id accepted from a client
+const maxLength = 128
+
+// contextKey type of the key the request id is stored under in a request context
+type contextKey struct{}
+
+// RequestID assigns every request an id, reusing a valid id sent by the client. The id is
+// echoed in the response header and stored in the request context
+func RequestID(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = newID()
+		}
+		w.Header().Set(Header, id)
+		inner.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, id)))
+	})
+}
+
+// FromContext returns the request id stored in ctx or an empty string
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// valid reports whether a client id may be reused, only letters, digits, dots, dashes and underscores are
+// accepted so the id is safe to log and to send back
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newID generates a random 128 bit hex encoded id
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
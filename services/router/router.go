@@ -1,34 +1,135 @@
 package router
 
 import (
-	"database/sql"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/squanchersquanch/contacts/components/carddav"
 	"github.com/squanchersquanch/contacts/components/connectors"
+	"github.com/squanchersquanch/contacts/components/graphql"
+	"github.com/squanchersquanch/contacts/components/scim"
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/validation"
 
 	"github.com/gorilla/mux"
 	"github.com/squanchersquanch/contacts/services/config"
+	"github.com/squanchersquanch/contacts/services/deprecation"
 	"github.com/squanchersquanch/contacts/services/logger"
+	"github.com/squanchersquanch/contacts/services/openapi"
+	"github.com/squanchersquanch/contacts/services/requestid"
 	r "github.com/squanchersquanch/contacts/services/routes"
 )
 
-// NewRouter creates a new router with connecters and routes wrapped with logging
-func NewRouter(db *sql.DB, config *config.Config) *mux.Router {
-	c := connectors.NewConnector(db, config)
+// NewRouter creates a new router with connecters and routes wrapped with logging and request ids, the routes of each
+// api version are served by a subrouter below its prefix and the unversioned /api/entry aliases by the router itself,
+// the CardDAV server is mounted below carddav.Root when carddav.password is set, the SCIM endpoint below scim.Root
+// when scim.token is set, GraphQL on graphql.Path and
+// the OpenAPI document of the routes on openapi.SpecPath. Requests to the routes are checked against the document
+// as configured and responses of deprecated routes carry the Deprecation and Sunset headers. The routes call c,
+// whose import and export workers are started by the caller
+func NewRouter(c connectors.Connector, store store.Store, config *config.Config) *mux.Router {
 	router := mux.NewRouter().StrictSlash(true)
+
+	if config.CardDAV != nil && config.CardDAV.Password != "" {
+		var dav http.Handler
+		dav = carddav.NewHandler(store, validation.NewValidator(config), config.CardDAV.Username, config.CardDAV.Password)
+		dav = logger.Logger(dav, "CardDAV")
+		dav = requestid.RequestID(dav)
+		router.Path(carddav.WellKnown).Name("CardDAVDiscovery").Handler(dav)
+		router.PathPrefix(strings.TrimSuffix(carddav.Root, "/")).Name("CardDAV").Handler(dav)
+	}
+
+	if config.SCIM != nil && config.SCIM.Token != "" {
+		var provisioning http.Handler
+		provisioning = scim.NewHandler(store, validation.NewValidator(config), config.SCIM.Token)
+		provisioning = logger.Logger(provisioning, "SCIM")
+		provisioning = requestid.RequestID(provisioning)
+		router.PathPrefix(scim.Root).Name("SCIM").Handler(provisioning)
+	}
+
+	opts := graphql.Options{}
+	if config.GraphQL != nil {
+		opts = graphql.Options{
+			MaxDepth:      config.GraphQL.MaxDepth,
+			MaxComplexity: config.GraphQL.MaxComplexity,
+			Playground:    config.GraphQL.Playground,
+		}
+	}
+	var api http.Handler
+	api = graphql.NewHandler(store, validation.NewValidator(config), opts)
+	api = logger.Logger(api, "GraphQL")
+	api = requestid.RequestID(api)
+	router.Path(graphql.Path).Name("GraphQL").Handler(api)
+
 	routes := r.NewRoutes(c)
+	document, err := openapi.Document(routes.RouteList())
+	if err != nil {
+		log.Printf("openapi error: %s", err)
+	}
+	var spec http.Handler
+	spec = openapi.NewHandler(document)
+	spec = logger.Logger(spec, "OpenAPI")
+	spec = requestid.RequestID(spec)
+	router.Methods("GET").Path(openapi.SpecPath).Name("OpenAPI").Handler(spec)
+	router.Methods("GET").Path(openapi.DocsPath).Name("OpenAPIDocs").Handler(spec)
+	router.Methods("GET").PathPrefix(openapi.AssetsPath).Name("OpenAPIAssets").Handler(spec)
+
+	mode := openapi.ValidationOff
+	if config.OpenAPI != nil {
+		mode = config.OpenAPI.Validation
+	}
+	policy := deprecationPolicy(config)
+	versions := map[string]*mux.Router{
+		r.V1: router.PathPrefix(r.Prefix(r.V1)).Subrouter(),
+		r.V2: router.PathPrefix(r.Prefix(r.V2)).Subrouter(),
+	}
 	for _, route := range routes.RouteList() {
 		var handler http.Handler
 
 		handler = route.HandlerFunc
+		handler = openapi.Validate(handler, document, route, mode)
+		if route.Successor != "" {
+			handler = deprecation.Deprecation(handler, route.Successor, policy)
+		}
 		handler = logger.Logger(handler, route.Name)
+		handler = requestid.RequestID(handler)
 
-		router.
+		parent, pattern := router, route.Pattern
+		if version, ok := versions[route.Version]; ok && strings.HasPrefix(pattern, r.Prefix(route.Version)+"/") {
+			parent, pattern = version, strings.TrimPrefix(pattern, r.Prefix(route.Version))
+		}
+		parent.
 			Methods(route.Method).
-			Path(route.Pattern).
+			Path(pattern).
 			Name(route.Name).
 			Handler(handler)
 	}
 
 	return router
 }
+
+// deprecationPolicy returns the configured dates of the deprecated v1 routes, invalid dates panic
+func deprecationPolicy(config *config.Config) deprecation.Policy {
+	policy := deprecation.Policy{}
+	if config.Versions == nil {
+		return policy
+	}
+	policy.Deprecated = parseDate("versions.v1_deprecated", config.Versions.V1Deprecated)
+	policy.Sunset = parseDate("versions.v1_sunset", config.Versions.V1Sunset)
+	return policy
+}
+
+// parseDate parses a configured date, an empty date is the zero time
+func parseDate(key, date string) time.Time {
+	if date == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		panic(fmt.Sprintf("invalid %s %s, expected a date like 2006-01-02", key, date))
+	}
+	return t
+}
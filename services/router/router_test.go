@@ -0,0 +1,894 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/squanchersquanch/contacts/components/connectors"
+	"github.com/squanchersquanch/contacts/components/csvfile"
+	"github.com/squanchersquanch/contacts/components/exports"
+	"github.com/squanchersquanch/contacts/components/store"
+	"github.com/squanchersquanch/contacts/components/xlsx"
+	"github.com/squanchersquanch/contacts/models"
+	"github.com/squanchersquanch/contacts/services/config"
+	"github.com/squanchersquanch/contacts/services/requestid"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	configFile = "../../development.yaml"
+
+	newContact = `{"first_name": "tom", "last_name": "dob", "email": "tom.dobs@gmail.com", "phone": "5555555555"}`
+)
+
+// contractSuite checks the response contract of every route against an in memory store
+type contractSuite struct {
+	suite.Suite
+	router     *mux.Router
+	connectors []connectors.Connector
+}
+
+func TestContractSuite(t *testing.T) {
+	suite.Run(t, &contractSuite{})
+}
+
+func (s *contractSuite) SetupTest() {
+	s.router = s.newRouter(store.NewMemoryStore(), config.NewConfig(configFile))
+}
+
+func (s *contractSuite) TearDownTest() {
+	for _, c := range s.connectors {
+		c.Close()
+	}
+	s.connectors = nil
+}
+
+// newRouter creates a router over contacts whose import and export workers stop after the test
+func (s *contractSuite) newRouter(contacts store.Store, cfg *config.Config) *mux.Router {
+	c := connectors.NewConnector(contacts, cfg)
+	c.Start(context.Background())
+	s.connectors = append(s.connectors, c)
+	return NewRouter(c, contacts, cfg)
+}
+
+// do serves a request checking that exactly one response body was written
+func (s *contractSuite) do(method, target string, body io.Reader, contentType ...string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, target, body)
+	s.NoError(err)
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType[0])
+	}
+
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	s.NotEmpty(rr.Header().Get(requestid.Header))
+
+	if rr.Body.Len() > 0 && rr.Header().Get("Content-Disposition") == "" {
+		decoder := json.NewDecoder(bytes.NewReader(rr.Body.Bytes()))
+		var document interface{}
+		s.NoError(decoder.Decode(&document))
+		s.False(decoder.More(), "more than one document written")
+	}
+	return rr
+}
+
+// create stores a contact returning it with its id
+func (s *contractSuite) create(body string) models.Contact {
+	rr := s.do("POST", "/api/entry", bytes.NewBufferString(body))
+	s.Equal(http.StatusCreated, rr.Code)
+
+	contact := models.Contact{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &contact))
+	return contact
+}
+
+// problem decodes a problem response checking its status and code
+func (s *contractSuite) problem(rr *httptest.ResponseRecorder, status int, code string) models.Problem {
+	s.Equal(status, rr.Code)
+	s.Equal("application/problem+json", rr.Header().Get("Content-Type"))
+
+	problem := models.Problem{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &problem))
+	s.Equal(code, problem.Code)
+	s.Equal(status, problem.Status)
+	s.Equal(rr.Header().Get(requestid.Header), problem.Instance)
+	return problem
+}
+
+func (s *contractSuite) TestListEmpty() {
+	rr := s.do("GET", "/api/entry", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Equal("application/json", rr.Header().Get("Content-Type"))
+	s.JSONEq(`[]`, rr.Body.String())
+}
+
+func (s *contractSuite) TestRequestID() {
+	for id, reused := range map[string]bool{
+		"client-id_1.2":           true,
+		"bad id\nforged log line": false,
+		"<script>":                false,
+		strings.Repeat("a", 129):  false,
+	} {
+		req := httptest.NewRequest("GET", "/api/entry", nil)
+		req.Header.Set(requestid.Header, id)
+		rr := httptest.NewRecorder()
+		s.router.ServeHTTP(rr, req)
+		s.Equal(reused, rr.Header().Get(requestid.Header) == id, id)
+		s.Regexp(`^[A-Za-z0-9._-]+$`, rr.Header().Get(requestid.Header))
+	}
+}
+
+func (s *contractSuite) TestCreate() {
+	rr := s.do("POST", "/api/entry", bytes.NewBufferString(newContact))
+	s.Equal(http.StatusCreated, rr.Code)
+	s.Equal("/api/v1/contacts/1", rr.Header().Get("Location"))
+	s.JSONEq(`{"id": "1", "first_name": "tom", "last_name": "dob", "email": "tom.dobs@gmail.com", "phone": "+15555555555"}`, rr.Body.String())
+
+	rr = s.do("GET", "/api/entry", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	contacts := []models.Contact{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &contacts))
+	s.Len(contacts, 1)
+}
+
+func (s *contractSuite) TestCreateInvalid() {
+	rr := s.do("POST", "/api/entry", bytes.NewBufferString(`{"email": "not-an-email"}`))
+	problem := s.problem(rr, http.StatusUnprocessableEntity, models.CodeValidationFailed)
+	s.Len(problem.Errors, 2)
+
+	rr = s.do("POST", "/api/entry", bytes.NewBufferString(`not json`))
+	s.problem(rr, http.StatusBadRequest, models.CodeInvalidBody)
+}
+
+func (s *contractSuite) TestCreateDuplicate() {
+	s.create(newContact)
+	rr := s.do("POST", "/api/entry", bytes.NewBufferString(newContact))
+	s.problem(rr, http.StatusConflict, models.CodeDuplicateEmail)
+}
+
+func (s *contractSuite) TestGet() {
+	contact := s.create(newContact)
+	rr := s.do("GET", "/api/entry?id="+contact.ID, nil)
+	s.Equal(http.StatusOK, rr.Code)
+
+	found := models.Contact{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &found))
+	s.Equal(contact, found)
+}
+
+func (s *contractSuite) TestGetMissing() {
+	s.problem(s.do("GET", "/api/entry?id=99", nil), http.StatusNotFound, models.CodeNotFound)
+	s.problem(s.do("GET", "/api/entry?id=abc", nil), http.StatusBadRequest, models.CodeInvalidID)
+	s.problem(s.do("GET", "/api/entry?id=2147483648", nil), http.StatusBadRequest, models.CodeInvalidID)
+}
+
+func (s *contractSuite) TestUpdate() {
+	contact := s.create(newContact)
+	body := fmt.Sprintf(`{"id": "%s", "first_name": "tommy", "email": "tom.dobs@gmail.com"}`, contact.ID)
+	rr := s.do("PUT", "/api/entry", bytes.NewBufferString(body))
+	s.Equal(http.StatusOK, rr.Code)
+	s.JSONEq(fmt.Sprintf(`{"id": "%s", "first_name": "tommy", "last_name": "", "email": "tom.dobs@gmail.com", "phone": ""}`, contact.ID), rr.Body.String())
+
+	rr = s.do("PUT", "/api/entry", bytes.NewBufferString(`{"id": "99", "first_name": "tommy", "email": "tom.dobs@gmail.com"}`))
+	s.problem(rr, http.StatusNotFound, models.CodeNotFound)
+}
+
+func (s *contractSuite) TestUpsertByEmail() {
+	rr := s.do("PUT", "/api/v1/contacts/by-email/tom.dobs@gmail.com", bytes.NewBufferString(`{"first_name": "tom"}`))
+	s.Equal(http.StatusCreated, rr.Code)
+	s.NotEmpty(rr.Header().Get("Location"))
+
+	rr = s.do("PUT", "/api/v1/contacts/by-email/tom.dobs@gmail.com", bytes.NewBufferString(`{"first_name": "thomas"}`))
+	s.Equal(http.StatusOK, rr.Code)
+	s.Contains(rr.Body.String(), "thomas")
+}
+
+func (s *contractSuite) TestDelete() {
+	contact := s.create(newContact)
+	rr := s.do("DELETE", "/api/entry?id="+contact.ID, nil)
+	s.Equal(http.StatusNoContent, rr.Code)
+	s.Empty(rr.Body.String())
+
+	s.problem(s.do("DELETE", "/api/entry?id="+contact.ID, nil), http.StatusNotFound, models.CodeNotFound)
+	s.problem(s.do("DELETE", "/api/entry", nil), http.StatusBadRequest, models.CodeInvalidID)
+}
+
+func (s *contractSuite) TestFindDuplicates() {
+	rr := s.do("GET", "/api/v1/contacts/duplicates", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.JSONEq(`[]`, rr.Body.String())
+
+	s.problem(s.do("GET", "/api/v1/contacts/duplicates?threshold=2", nil), http.StatusBadRequest, models.CodeInvalidParameter)
+}
+
+func (s *contractSuite) TestMerge() {
+	first := s.create(newContact)
+	second := s.create(`{"first_name": "Tom", "last_name": "Dob", "email": "TOM.DOBS@gmail.com"}`)
+
+	body := fmt.Sprintf(`{"ids": ["%s", "%s"], "rules": {"email": "%s"}}`, first.ID, second.ID, second.ID)
+	rr := s.do("POST", "/api/v1/contacts/merge", bytes.NewBufferString(body))
+	s.Equal(http.StatusOK, rr.Code)
+
+	merged := models.Contact{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &merged))
+	s.Equal(first.ID, merged.ID)
+	s.Equal(second.Email, merged.Email)
+
+	s.problem(s.do("GET", "/api/entry?id="+second.ID, nil), http.StatusNotFound, models.CodeNotFound)
+	s.problem(s.do("POST", "/api/v1/contacts/merge", bytes.NewBufferString(body)), http.StatusNotFound, models.CodeNotFound)
+}
+
+func (s *contractSuite) TestImport() {
+	body, contentType := s.csvUpload("ID,FirstName,LastName,Email,Phone\n,roger,bob,roger.bob@gmail.com,9408675309\n,,,not-an-email,\n")
+	rr := s.do("POST", "/api/entry/import", body, contentType)
+	s.Equal(http.StatusOK, rr.Code)
+
+	report := models.ImportReport{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &report))
+	s.Equal(2, report.Total)
+	s.Equal(1, report.Created)
+	s.Equal(1, report.Rejected)
+	s.Equal("rows[1].first_name", report.Errors[0].Field)
+
+	body, contentType = s.csvUpload("ID,FirstName,LastName,Email,Phone\n,roger,bob,roger.bob@gmail.com,9408675309\n")
+	rr = s.do("POST", "/api/entry/import", body, contentType)
+	s.problem(rr, http.StatusUnprocessableEntity, models.CodeImportRejected)
+}
+
+func (s *contractSuite) TestImportConflicts() {
+	existing := s.create(newContact)
+	s.create(`{"first_name": "bob", "email": "bob@example.com"}`)
+	data := "ID,FirstName,Email\r\n" +
+		",ann,ann@example.com\r\n" +
+		",anne,ann@example.com\r\n" +
+		",bobby,bob@example.com\r\n" +
+		"99,bo,bo@example.com\r\n" +
+		existing.ID + ",tommy,tom.dobs@gmail.com\r\n" +
+		existing.ID + ",thomas,thomas@example.com\r\n" +
+		",carl,not-an-email\r\n"
+	body, contentType := s.csvUpload(data)
+	rr := s.do("POST", "/api/entry/import", body, contentType)
+	s.Equal(http.StatusOK, rr.Code)
+
+	report := models.ImportReport{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &report))
+	s.Equal(7, report.Total)
+	s.Equal(1, report.Created)
+	s.Equal(1, report.Updated)
+	// the invalid row is rejected before the store runs but is listed in row order
+	s.Equal([]models.FieldError{
+		{Field: "rows[1].email", Message: store.ErrRepeatedEmail.Error()},
+		{Field: "rows[2].email", Message: store.ErrDuplicateEmail.Error()},
+		{Field: "rows[3].id", Message: store.ErrNotFound.Error()},
+		{Field: "rows[5].id", Message: store.ErrRepeatedID.Error()},
+		{Field: "rows[6].email", Message: "must be a valid email address"},
+	}, report.Errors)
+}
+
+func (s *contractSuite) TestImportJob() {
+	body, contentType := s.csvUpload("FirstName,Email\n,not-an-email\nroger,roger.bob@gmail.com\n")
+	rr := s.do("POST", "/api/v1/imports?match=email", body, contentType)
+	s.Equal(http.StatusAccepted, rr.Code)
+	job := models.ImportJob{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &job))
+	s.Equal(models.ImportQueued, job.Status)
+	s.Equal("contacts.csv", job.Filename)
+	s.Equal("/api/v1/imports/"+job.ID, rr.Header().Get("Location"))
+
+	for i := 0; i < 200 && !job.Finished(); i++ {
+		time.Sleep(5 * time.Millisecond)
+		rr = s.do("GET", "/api/v1/imports/"+job.ID, nil)
+		s.Equal(http.StatusOK, rr.Code)
+		s.NoError(json.Unmarshal(rr.Body.Bytes(), &job))
+	}
+	s.Equal(models.ImportSucceeded, job.Status)
+	s.Equal(2, job.Processed)
+	s.Equal(1, job.Report.Created)
+	s.Equal("rows[0].first_name", job.Report.Errors[0].Field)
+	s.NotNil(job.FinishedAt)
+	s.Contains(s.do("GET", "/api/entry", nil).Body.String(), "roger.bob@gmail.com")
+
+	s.problem(s.do("DELETE", "/api/v1/imports/"+job.ID, nil), http.StatusConflict, models.CodeImportFinished)
+	s.problem(s.do("GET", "/api/v1/imports/404", nil), http.StatusNotFound, models.CodeNotFound)
+	s.problem(s.do("DELETE", "/api/v1/imports/abc", nil), http.StatusBadRequest, models.CodeInvalidID)
+
+	body, contentType = s.upload("contacts.csv", "text/csv", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	s.problem(s.do("POST", "/api/v1/imports", body, contentType), http.StatusUnsupportedMediaType, models.CodeUnsupportedFileType)
+	body, contentType = s.csvUpload("FirstName\n")
+	s.problem(s.do("POST", "/api/v1/imports?match=name", body, contentType), http.StatusBadRequest, models.CodeInvalidParameter)
+}
+
+func (s *contractSuite) TestExportJob() {
+	s.create(`{"first_name": "tom", "email": "tom@example.com", "country": "US"}`)
+	s.create(`{"first_name": "ann", "email": "ann@example.com", "country": "DE"}`)
+
+	rr := s.do("POST", "/api/v1/exports?format=ndjson&country=us", nil)
+	s.Equal(http.StatusAccepted, rr.Code)
+	job := models.ExportJob{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &job))
+	s.Equal(models.ExportQueued, job.Status)
+	s.Equal("/api/v1/exports/"+job.ID, rr.Header().Get("Location"))
+
+	for i := 0; i < 200 && job.Status != models.ExportSucceeded; i++ {
+		time.Sleep(5 * time.Millisecond)
+		rr = s.do("GET", "/api/v1/exports/"+job.ID, nil)
+		s.Equal(http.StatusOK, rr.Code)
+		s.NoError(json.Unmarshal(rr.Body.Bytes(), &job))
+	}
+	s.Equal(models.ExportSucceeded, job.Status)
+	s.Equal(1, job.Processed)
+	s.True(job.DownloadExpiresAt.Before(time.Now().Add(16 * time.Minute)))
+
+	rr = s.do("GET", job.DownloadURL, nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Equal("application/x-ndjson", rr.Header().Get("Content-Type"))
+	s.Contains(rr.Body.String(), "tom@example.com")
+	s.NotContains(rr.Body.String(), "ann@example.com")
+
+	s.problem(s.do("GET", job.DownloadURL+"0", nil), http.StatusForbidden, models.CodeInvalidSignature)
+	expires := time.Now().Add(-time.Minute).Unix()
+	expired := fmt.Sprintf("/api/v1/exports/%s/download?expires=%d&signature=%s",
+		job.ID, expires, exports.Sign([]byte(config.NewConfig(configFile).Exports.Secret), job.ID, expires))
+	s.problem(s.do("GET", expired, nil), http.StatusGone, models.CodeExportExpired)
+
+	s.problem(s.do("POST", "/api/v1/exports?format=pdf", nil), http.StatusBadRequest, models.CodeInvalidParameter)
+	s.problem(s.do("GET", "/api/v1/exports/404", nil), http.StatusNotFound, models.CodeNotFound)
+}
+
+func (s *contractSuite) TestExportFilter() {
+	s.create(`{"first_name": "tom", "email": "tom@example.com", "organization": "Acme"}`)
+	s.create(`{"first_name": "ann", "email": "ann@example.com", "organization": "Initech"}`)
+
+	rr := s.do("GET", "/api/entry/export?format=json&q=ACM", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Contains(rr.Body.String(), "tom@example.com")
+	s.NotContains(rr.Body.String(), "ann@example.com")
+
+	rr = s.do("GET", "/api/entry/export?format=json&organization=initech&q=example", nil)
+	s.NotContains(rr.Body.String(), "tom@example.com")
+	s.Contains(rr.Body.String(), "ann@example.com")
+}
+
+func (s *contractSuite) TestExport() {
+	s.create(newContact)
+	rr := s.do("GET", "/api/entry/export", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Equal("text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+	s.Contains(rr.Body.String(), "tom.dobs@gmail.com")
+}
+
+func (s *contractSuite) TestImportSniffing() {
+	body, contentType := s.upload("contacts.csv", "application/vnd.ms-excel", "FirstName,Email\r\nroger,roger.bob@gmail.com\r\n")
+	s.Equal(http.StatusOK, s.do("POST", "/api/entry/import", body, contentType).Code)
+
+	body, contentType = s.upload("upload", "application/octet-stream", "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Tom Dob\r\nN:Dob;Tom;;;\r\nEMAIL:tom.dobs@gmail.com\r\nEND:VCARD\r\n")
+	s.Equal(http.StatusOK, s.do("POST", "/api/entry/import", body, contentType).Code)
+
+	body, contentType = s.upload("contacts.json", "application/octet-stream", `[{"first_name": "ann", "email": "ann@example.com"}, {"email": "nope"}]`)
+	rr := s.do("POST", "/api/entry/import", body, contentType)
+	s.Equal(http.StatusOK, rr.Code)
+	report := models.ImportReport{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &report))
+	s.Equal(2, report.Total)
+	s.Equal(1, report.Rejected)
+
+	body, contentType = s.upload("contacts.json", "application/json", `[{"first_name": }]`)
+	s.problem(s.do("POST", "/api/entry/import", body, contentType), http.StatusBadRequest, models.CodeInvalidFile)
+	body, contentType = s.upload("contacts.csv", "text/csv", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	s.problem(s.do("POST", "/api/entry/import", body, contentType), http.StatusUnsupportedMediaType, models.CodeUnsupportedFileType)
+	body, contentType = s.upload("contacts.html", "text/html", "<html></html>")
+	s.problem(s.do("POST", "/api/entry/import", body, contentType), http.StatusUnsupportedMediaType, models.CodeUnsupportedFileType)
+}
+
+func (s *contractSuite) TestXLSX() {
+	s.create(newContact)
+	rr := s.do("GET", "/api/entry/export?format=xlsx&profile=outlook", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Equal("application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", rr.Header().Get("Content-Type"))
+	s.Equal("attachment; filename=contacts.xlsx", rr.Header().Get("Content-Disposition"))
+
+	book := rr.Body.Bytes()
+	rows, err := xlsx.Read(bytes.NewReader(book), int64(len(book)), "Contacts")
+	s.NoError(err)
+	s.Equal([]string{"First Name", "Last Name", "E-mail Address"}, rows[0][:3])
+	s.Equal([]string{"tom", "dob", "tom.dobs@gmail.com"}, rows[1][:3])
+
+	// a title row above the header is skipped and rows are matched by email
+	buf := new(bytes.Buffer)
+	w, err := xlsx.NewWriter(buf, "People", []xlsx.Column{{Header: "Contacts of 2019"}, {}, {}})
+	s.NoError(err)
+	w.Write([]string{"FirstName", "Email", "Phone"})
+	w.Write([]string{"tommy", "tom.dobs@gmail.com", "9408675309"})
+	w.Write([]string{"ann", "not-an-email", ""})
+	s.NoError(w.Close())
+
+	body, contentType := s.upload("people.xlsx", "application/octet-stream", buf.String())
+	rr = s.do("POST", "/api/entry/import?match=email&sheet=people", body, contentType)
+	s.Equal(http.StatusOK, rr.Code)
+	report := models.ImportReport{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &report))
+	s.Equal(2, report.Total)
+	s.Equal(1, report.Updated)
+	s.Equal("rows[1].email", report.Errors[0].Field)
+
+	body, contentType = s.upload("people.xlsx", "application/octet-stream", buf.String())
+	s.problem(s.do("POST", "/api/entry/import?sheet=missing", body, contentType), http.StatusBadRequest, models.CodeInvalidFile)
+}
+
+func (s *contractSuite) TestJSON() {
+	s.create(newContact)
+	s.create(`{"first_name": "ann", "email": "ann@example.com", "organization": "Acme"}`)
+
+	rr := s.do("GET", "/api/entry/export?format=json", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Equal("attachment; filename=contacts.json", rr.Header().Get("Content-Disposition"))
+	contacts := []models.ContactV2{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &contacts))
+	s.Len(contacts, 2)
+	s.Equal("Acme", contacts[1].Organization)
+
+	rr = s.do("GET", "/api/entry/export?format=ndjson", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Equal("application/x-ndjson", rr.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	s.Len(lines, 2)
+	s.Contains(lines[0], `"emails":[{"value":"tom.dobs@gmail.com"}]`)
+
+	data := `{"first_name": "tommy", "email": "tom.dobs@gmail.com"}` + "\n\n" + `{"first_name": ` + "\n" + `{"first_name": "bo", "email": "bo@example.com"}` + "\n"
+	body, contentType := s.upload("contacts.ndjson", "application/octet-stream", data)
+	rr = s.do("POST", "/api/entry/import?match=email", body, contentType)
+	s.Equal(http.StatusOK, rr.Code)
+	report := models.ImportReport{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &report))
+	s.Equal(3, report.Total)
+	s.Equal(1, report.Created)
+	s.Equal(1, report.Updated)
+	s.Equal("rows[2].line", report.Errors[0].Field)
+}
+
+func (s *contractSuite) TestJSONRoundTrip() {
+	rr := s.do("POST", "/api/v2/contacts", strings.NewReader(`{"first_name": "tom", "tags": ["friends"],
+		"emails": [{"value": "tom@example.com", "type": "work"}, {"value": "tom@home.example.com", "type": "home"}],
+		"phones": [{"value": "+15555555555"}, {"value": "+15555551234", "type": "mobile"}],
+		"addresses": [{"city": "Springfield"}, {"type": "work", "street": "1 Main St"}]}`))
+	s.Equal(http.StatusCreated, rr.Code)
+	created := s.do("GET", "/api/v2/contacts/1", nil).Body.String()
+
+	// every email, phone and address survives an export and import of either format
+	for _, format := range []string{"json", "ndjson"} {
+		export := s.do("GET", "/api/entry/export?format="+format, nil).Body.String()
+		s.Equal(http.StatusOK, s.do("PUT", "/api/v2/contacts/1", strings.NewReader(`{"first_name": "tom", "emails": [{"value": "tom@example.com"}]}`)).Code)
+		body, contentType := s.upload("contacts."+format, "application/octet-stream", export)
+		rr = s.do("POST", "/api/entry/import?match=email", body, contentType)
+		s.Equal(http.StatusOK, rr.Code, rr.Body.String())
+		s.JSONEq(created, s.do("GET", "/api/v2/contacts/1", nil).Body.String(), format)
+	}
+}
+
+// failingStore fails every iteration after the first contact
+type failingStore struct {
+	store.Store
+}
+
+func (f failingStore) Each(ctx context.Context, filter models.ContactFilter, fn store.EachFunc) error {
+	return f.Store.Each(ctx, filter, func(contact models.Contact) error {
+		if err := fn(contact); err != nil {
+			return err
+		}
+		return errors.New("connection reset")
+	})
+}
+
+func (s *contractSuite) TestStreamingExport() {
+	for i := 0; i < 150; i++ {
+		s.create(fmt.Sprintf(`{"first_name": "tom", "email": "tom%d@gmail.com"}`, i))
+	}
+	rr := s.do("GET", "/api/entry/export", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.True(rr.Flushed)
+	s.Equal(151, strings.Count(rr.Body.String(), "\r\n"))
+
+	// a request cancelled before the first contact is answered with a problem
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/api/entry/export?format=ndjson", nil).WithContext(ctx)
+	rr = httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	s.Equal(http.StatusInternalServerError, rr.Code)
+	s.Equal("application/problem+json", rr.Header().Get("Content-Type"))
+
+	// a failure after the response started aborts it rather than ending the file early
+	contacts := store.NewMemoryStore()
+	contacts.Create(context.Background(), models.Contact{FirstName: "tom", Email: "tom@gmail.com"})
+	router := s.newRouter(failingStore{contacts}, config.NewConfig(configFile))
+	s.PanicsWithValue(http.ErrAbortHandler, func() {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/entry/export", nil))
+	})
+}
+
+func (s *contractSuite) TestImportOutlook() {
+	data := "First Name;Last Name;E-mail Address;Mobile Phone;Company\r\nJ\xfcrgen;M\xfcller;juergen@example.com;9408675309;\"Acme; Inc\"\r\n"
+	body, contentType := s.csvUpload(data)
+	rr := s.do("POST", "/api/entry/import?profile=outlook&delimiter=semicolon&charset=windows-1252", body, contentType)
+	s.Equal(http.StatusOK, rr.Code)
+
+	rr = s.do("GET", "/api/entry?id=1", nil)
+	s.Contains(rr.Body.String(), `"first_name":"Jürgen"`)
+	s.Contains(rr.Body.String(), `"organization":"Acme; Inc"`)
+
+	body, contentType = s.csvUpload("Nothing,Known\r\na,b\r\n")
+	s.problem(s.do("POST", "/api/entry/import?profile=google", body, contentType), http.StatusBadRequest, models.CodeInvalidFile)
+	body, contentType = s.csvUpload(data)
+	s.problem(s.do("POST", "/api/entry/import?charset=ebcdic", body, contentType), http.StatusBadRequest, models.CodeInvalidParameter)
+}
+
+func (s *contractSuite) TestExportMapping() {
+	s.create(newContact)
+	mapping := url.QueryEscape(`{"Vorname":"first_name","E-Mail":"email"}`)
+	rr := s.do("GET", "/api/entry/export?mapping="+mapping+"&delimiter=tab&charset=utf-16&bom=true", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Equal("text/csv; charset=utf-16", rr.Header().Get("Content-Type"))
+
+	reader, err := csvfile.NewReader(rr.Body, csvfile.Dialect{Delimiter: '\t', Quote: '"', Charset: csvfile.UTF16})
+	s.NoError(err)
+	header, _ := reader.Read()
+	s.Equal([]string{"Vorname", "E-Mail"}, header)
+	record, _ := reader.Read()
+	s.Equal([]string{"tom", "tom.dobs@gmail.com"}, record)
+
+	s.problem(s.do("GET", "/api/entry/export?profile=custom", nil), http.StatusBadRequest, models.CodeInvalidParameter)
+	s.problem(s.do("GET", "/api/entry/export?delimiter=%22", nil), http.StatusBadRequest, models.CodeInvalidParameter)
+}
+
+func (s *contractSuite) TestImportVCard() {
+	cards := "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Bob;Roger;;;\r\nEMAIL:roger.bob@gmail.com\r\nORG:Acme\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\r\nVERSION:9.9\r\nEND:VCARD\r\n"
+	body, contentType := s.upload("contacts.vcf", "text/vcard", cards)
+	rr := s.do("POST", "/api/entry/import", body, contentType)
+	s.Equal(http.StatusOK, rr.Code)
+
+	report := models.ImportReport{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &report))
+	s.Equal(2, report.Total)
+	s.Equal(1, report.Created)
+	s.Equal("rows[1].card", report.Errors[0].Field)
+
+	rr = s.do("GET", "/api/entry?id=1", nil)
+	s.Contains(rr.Body.String(), `"organization":"Acme"`)
+}
+
+func (s *contractSuite) TestExportVCard() {
+	s.create(newContact)
+	rr := s.do("GET", "/api/entry/export?format=vcf&version=4.0", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Equal("text/vcard; charset=utf-8", rr.Header().Get("Content-Type"))
+	s.Contains(rr.Body.String(), "VERSION:4.0\r\n")
+	s.Contains(rr.Body.String(), "EMAIL:tom.dobs@gmail.com\r\n")
+
+	s.problem(s.do("GET", "/api/entry/export?format=xml", nil), http.StatusBadRequest, models.CodeInvalidParameter)
+	s.problem(s.do("GET", "/api/entry/export?format=vcf&version=2.1", nil), http.StatusBadRequest, models.CodeInvalidParameter)
+}
+
+func (s *contractSuite) TestLDIF() {
+	entries := "version: 1\n\n" +
+		"dn: mail=juergen@example.com,ou=people,dc=example,dc=com\nobjectClass: inetOrgPerson\n" +
+		"givenName:: SsO8cmdlbg==\nsn: Mueller\nmail: juergen@example.com\no: Acme\n\n" +
+		"dn: cn=gone\nchangetype: delete\n"
+	body, contentType := s.upload("directory.ldif", "application/octet-stream", entries)
+	rr := s.do("POST", "/api/entry/import", body, contentType)
+	s.Equal(http.StatusOK, rr.Code)
+
+	report := models.ImportReport{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &report))
+	s.Equal(2, report.Total)
+	s.Equal(1, report.Created)
+	s.Equal("rows[1].entry", report.Errors[0].Field)
+
+	rr = s.do("GET", "/api/entry/export?format=ldif&base_dn=ou=contacts,dc=example,dc=com", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Equal("text/x-ldif; charset=utf-8", rr.Header().Get("Content-Type"))
+	s.Equal("attachment; filename=contacts.ldif", rr.Header().Get("Content-Disposition"))
+	s.Contains(rr.Body.String(), "version: 1\n\ndn: mail=juergen@example.com,ou=contacts,dc=example,dc=com\n")
+	s.Contains(rr.Body.String(), "givenName:: SsO8cmdlbg==\nsn: Mueller\n")
+}
+
+// dav serves a CardDAV request authenticated with the configured credentials, its xml responses are not
+// checked by do
+func (s *contractSuite) dav(method, target, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	s.NoError(err)
+	dav := config.NewConfig(configFile).CardDAV
+	req.SetBasicAuth(dav.Username, dav.Password)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	s.NotEmpty(rr.Header().Get(requestid.Header))
+	return rr
+}
+
+func (s *contractSuite) TestCardDAV() {
+	rr := s.dav("GET", "/.well-known/carddav", "")
+	s.Equal(http.StatusMovedPermanently, rr.Code)
+	s.Equal("/carddav/", rr.Header().Get("Location"))
+
+	contact := s.create(newContact)
+	rr = s.dav("PROPFIND", "/carddav/addressbooks/contacts/", `<propfind xmlns="DAV:"><prop><getetag/></prop></propfind>`)
+	s.Equal(http.StatusMultiStatus, rr.Code)
+	s.Contains(rr.Body.String(), "<href>/carddav/addressbooks/contacts/urn:contacts:"+contact.ID+".vcf</href>")
+
+	card := "BEGIN:VCARD\r\nVERSION:3.0\r\nUID:ann-1\r\nN:Lee;Ann;;;\r\nEMAIL:ann@example.com\r\nEND:VCARD\r\n"
+	s.Equal(http.StatusCreated, s.dav("PUT", "/carddav/addressbooks/contacts/ann-1.vcf", card).Code)
+	rr = s.do("GET", "/api/entry?id=2", nil)
+	s.Contains(rr.Body.String(), `"uid":"ann-1"`)
+
+	req, err := http.NewRequest("PROPFIND", "/carddav/addressbooks/contacts/", nil)
+	s.NoError(err)
+	rr = httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	s.Equal(http.StatusUnauthorized, rr.Code)
+	s.Contains(rr.Header().Get("WWW-Authenticate"), "Basic")
+}
+
+// scim serves a SCIM request authenticated with the configured token
+func (s *contractSuite) scim(method, target, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	s.NoError(err)
+	req.Header.Set("Authorization", "Bearer "+config.NewConfig(configFile).SCIM.Token)
+	rr := httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	s.NotEmpty(rr.Header().Get(requestid.Header))
+	s.Equal("application/scim+json", rr.Header().Get("Content-Type"))
+	return rr
+}
+
+func (s *contractSuite) TestSCIM() {
+	rr := s.scim("POST", "/scim/v2/Users", `{"userName": "ann@example.com", "name": {"givenName": "Ann", "familyName": "Lee"}}`)
+	s.Equal(http.StatusCreated, rr.Code)
+	rr = s.do("GET", "/api/entry?id=1", nil)
+	s.Contains(rr.Body.String(), `"email":"ann@example.com"`)
+
+	s.create(newContact)
+	rr = s.scim("GET", `/scim/v2/Users?filter=userName+sw+"tom"`, "")
+	s.Equal(http.StatusOK, rr.Code)
+	s.Contains(rr.Body.String(), `"totalResults":1`)
+	s.Contains(rr.Body.String(), `"userName":"tom.dobs@gmail.com"`)
+
+	req, err := http.NewRequest("GET", "/scim/v2/Users", nil)
+	s.NoError(err)
+	rr = httptest.NewRecorder()
+	s.router.ServeHTTP(rr, req)
+	s.Equal(http.StatusUnauthorized, rr.Code)
+}
+
+func (s *contractSuite) TestGraphQL() {
+	s.create(newContact)
+	rr := s.do("POST", "/graphql", strings.NewReader(`{"query": "mutation { createContact(input: {firstName: \"Ann\", email: \"ann@example.com\", organization: \"Acme\"}) { id } }"}`), "application/json")
+	s.Equal(http.StatusOK, rr.Code)
+	s.Equal(`{"data":{"createContact":{"id":"2"}}}`, strings.TrimSpace(rr.Body.String()))
+
+	rr = s.do("GET", "/graphql?query="+url.QueryEscape(`{ contacts { totalCount nodes { email organization { name } } } }`), nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Contains(rr.Body.String(), `"totalCount":2`)
+	s.Contains(rr.Body.String(), `{"email":"ann@example.com","organization":{"name":"Acme"}}`)
+
+	rr = s.do("GET", "/graphql?query="+url.QueryEscape(`{ contacts { nodes { tags } } }`), nil)
+	s.Equal(http.StatusBadRequest, rr.Code, "tags are objects")
+
+	s.do("PUT", "/api/entry", strings.NewReader(`{"id": "2", "first_name": "Ann", "email": "ann@example.com", "tags": ["VIP"]}`))
+	rr = s.do("GET", "/graphql?query="+url.QueryEscape(`{ tag(name: "vip") { contacts { nodes { email tags { name } } } } }`), nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Equal(`{"data":{"tag":{"contacts":{"nodes":[{"email":"ann@example.com","tags":[{"name":"vip"}]}]}}}}`, strings.TrimSpace(rr.Body.String()))
+}
+
+func (s *contractSuite) TestOpenAPI() {
+	rr := s.do("GET", "/openapi.json", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	spec := struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &spec))
+	s.Contains(spec.Paths["/api/v1/contacts/by-email/{email}"], "put")
+	s.Contains(spec.Paths["/api/entry"], "delete")
+
+	// a script is not json, so it is not requested with do
+	rr = httptest.NewRecorder()
+	s.router.ServeHTTP(rr, httptest.NewRequest("GET", "/docs/assets/swagger-ui-bundle.js", nil))
+	s.Equal(http.StatusOK, rr.Code, "the reference page scripts are served by the app")
+}
+
+func (s *contractSuite) TestRequestValidation() {
+	// the development config only logs invalid requests
+	s.problem(s.do("DELETE", "/api/entry", nil), http.StatusBadRequest, models.CodeInvalidID)
+
+	cfg := config.NewConfig(configFile)
+	cfg.OpenAPI = &config.OpenAPIConfig{Validation: "enforce"}
+	s.router = s.newRouter(store.NewMemoryStore(), cfg)
+
+	problem := s.problem(s.do("DELETE", "/api/entry", nil), http.StatusBadRequest, models.CodeInvalidParameter)
+	s.Equal([]models.FieldError{{Field: "id", Message: "is required"}}, problem.Errors)
+	problem = s.problem(s.do("GET", "/api/v1/contacts/99/qr.png?size=big", nil), http.StatusBadRequest, models.CodeInvalidParameter)
+	s.Equal([]models.FieldError{{Field: "size", Message: "must be an integer"}}, problem.Errors)
+
+	problem = s.problem(s.do("POST", "/api/entry", strings.NewReader(`{"first_name": "tom", "email": ["tom@example.com"]}`), "application/json"), http.StatusBadRequest, models.CodeInvalidBody)
+	s.Equal([]models.FieldError{{Field: "email", Message: "must be a string"}}, problem.Errors)
+
+	s.create(newContact)
+}
+
+func (s *contractSuite) TestContactsV2() {
+	rr := s.do("POST", "/api/v2/contacts", strings.NewReader(`{"first_name": "tom", "last_name": "dob",
+		"emails": [{"value": "tom@example.com", "type": "work"}, {"value": "tom@home.example.com", "type": "home"}],
+		"phones": [{"value": "(555) 555-5555"}, {"value": "555 555 1234", "type": "mobile"}],
+		"addresses": [{"city": "Springfield"}, {"type": "work", "street": "1 Main St"}]}`))
+	s.Equal(http.StatusCreated, rr.Code)
+	s.Equal("/api/v2/contacts/1", rr.Header().Get("Location"))
+	s.Empty(rr.Header().Get("Deprecation"))
+	contact := models.ContactV2{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &contact))
+	s.Equal([]models.Phone{{Value: "+15555555555"}, {Value: "+15555551234", Type: "mobile"}}, contact.Phones)
+
+	// v1 reads the first email, phone and address and keeps the others and the fields it omits when it updates
+	// the contact
+	rr = s.do("GET", "/api/entry?id=1", nil)
+	s.Equal(`{"id":"1","first_name":"tom","last_name":"dob","email":"tom@example.com","phone":"+15555555555","city":"Springfield"}`, strings.TrimSpace(rr.Body.String()))
+	rr = s.do("PUT", "/api/entry", strings.NewReader(`{"id": "1", "first_name": "tom", "email": "tom@example.org"}`))
+	s.Equal(http.StatusOK, rr.Code)
+
+	rr = s.do("GET", "/api/v2/contacts/1", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	contact = models.ContactV2{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &contact))
+	s.Equal([]models.Email{{Value: "tom@example.org", Type: "work"}, {Value: "tom@home.example.com", Type: "home"}}, contact.Emails)
+	s.Equal([]models.Phone{{Value: "+15555551234", Type: "mobile"}}, contact.Phones)
+	s.Equal([]models.Address{{City: "Springfield"}, {Type: "work", Street: "1 Main St"}}, contact.Addresses)
+
+	rr = s.do("PUT", "/api/v2/contacts/1", strings.NewReader(`{"first_name": "tom", "emails": [{"value": "tom@example.org"}]}`))
+	s.Equal(http.StatusOK, rr.Code)
+	rr = s.do("GET", "/api/v2/contacts", nil)
+	list := []models.ContactV2{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &list))
+	s.Equal([]models.ContactV2{{ID: "1", FirstName: "tom", Emails: []models.Email{{Value: "tom@example.org"}}, Phones: []models.Phone{}, Addresses: []models.Address{}}}, list)
+
+	problem := s.problem(s.do("POST", "/api/v2/contacts", strings.NewReader(`{"first_name": "ann", "emails": [{"value": "ann"}, {"value": "ann@"}]}`)), http.StatusUnprocessableEntity, models.CodeValidationFailed)
+	s.Equal([]models.FieldError{{Field: "emails[0].value", Message: "must be a valid email address"}, {Field: "emails[1].value", Message: "must be a valid email address"}}, problem.Errors)
+	s.problem(s.do("GET", "/api/v2/contacts/abc", nil), http.StatusBadRequest, models.CodeInvalidID)
+
+	s.Equal(http.StatusCreated, s.do("POST", "/api/v2/contacts", strings.NewReader(`{"first_name": "ann", "emails": [{"value": "ann@example.com"}]}`)).Code)
+	rr = s.do("GET", "/api/v2/contacts?limit=1", nil)
+	s.Equal(`</api/v2/contacts?limit=1&after=1>; rel="next"`, rr.Header().Get("Link"))
+	rr = s.do("GET", "/api/v2/contacts?limit=1&after=1", nil)
+	list = []models.ContactV2{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &list))
+	s.Equal("ann", list[0].FirstName)
+	s.Empty(rr.Header().Get("Link"), "the last page has no next link")
+	s.problem(s.do("GET", "/api/v2/contacts?limit=0", nil), http.StatusBadRequest, models.CodeInvalidParameter)
+	s.problem(s.do("GET", "/api/v2/contacts?after=abc", nil), http.StatusBadRequest, models.CodeInvalidID)
+	s.problem(s.do("GET", "/api/v2/contacts?after=9999999999", nil), http.StatusBadRequest, models.CodeInvalidID)
+
+	s.Equal(http.StatusNoContent, s.do("DELETE", "/api/v2/contacts/1", nil).Code)
+	s.problem(s.do("GET", "/api/entry?id=1", nil), http.StatusNotFound, models.CodeNotFound)
+}
+
+func (s *contractSuite) TestV1KeepsOmittedFields() {
+	v2 := `{"first_name": "tom", "organization": "Acme", "note": "met at the fair", "uid": "tom-1",
+		"emails": [{"value": "tom@example.com"}, {"value": "tom@home.example.com"}],
+		"addresses": [{"street": "1 Main St", "city": "Springfield", "region": "IL", "postal_code": "62701", "country": "US"},
+			{"type": "work", "city": "Chicago"}]}`
+	s.Equal(http.StatusCreated, s.do("POST", "/api/v2/contacts", strings.NewReader(v2)).Code)
+	created := s.do("GET", "/api/v2/contacts/1", nil).Body.String()
+
+	// a v1 client sends only the fields it knows, first_name, last_name, email and phone
+	rr := s.do("PUT", "/api/v1/contacts/1", strings.NewReader(`{"first_name": "tom", "last_name": "", "email": "tom@example.com", "phone": ""}`))
+	s.Equal(http.StatusOK, rr.Code)
+	s.JSONEq(created, s.do("GET", "/api/v2/contacts/1", nil).Body.String())
+	rr = s.do("PUT", "/api/v1/contacts/by-email/tom@example.com", strings.NewReader(`{"first_name": "tom"}`))
+	s.Equal(http.StatusOK, rr.Code)
+	s.JSONEq(created, s.do("GET", "/api/v2/contacts/1", nil).Body.String())
+
+	// fields the body sends are still replaced
+	rr = s.do("PUT", "/api/v1/contacts/1", strings.NewReader(`{"first_name": "tom", "email": "tom@example.com", "organization": ""}`))
+	s.Equal(http.StatusOK, rr.Code)
+	s.NotContains(rr.Body.String(), "Acme")
+	s.Contains(rr.Body.String(), `"uid":"tom-1"`)
+}
+
+func (s *contractSuite) TestDeprecation() {
+	rr := s.do("GET", "/api/entry", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Equal("@1792368000", rr.Header().Get("Deprecation"))
+	s.Equal("Tue, 19 Oct 2027 00:00:00 GMT", rr.Header().Get("Sunset"))
+	s.Equal(`</api/v2/contacts>; rel="successor-version"`, rr.Header().Get("Link"))
+
+	rr = s.do("GET", "/api/v1/contacts/duplicates", nil)
+	s.Empty(rr.Header().Get("Deprecation"), "routes without a successor are not deprecated")
+
+	contact := s.create(newContact)
+	rr = s.do("GET", "/api/v1/contacts/"+contact.ID, nil)
+	s.Equal("@1792368000", rr.Header().Get("Deprecation"))
+	s.Equal(`</api/v2/contacts/1>; rel="successor-version"`, rr.Header().Get("Link"))
+	rr = s.do("GET", "/api/entry?id="+contact.ID, nil)
+	s.Equal(`</api/v2/contacts/1>; rel="successor-version"`, rr.Header().Get("Link"), "the alias links the same contact")
+	rr = s.do("GET", "/api/v1/contacts", nil)
+	s.Equal(`</api/v2/contacts>; rel="successor-version"`, rr.Header().Get("Link"))
+}
+
+func (s *contractSuite) TestContactsV1() {
+	rr := s.do("POST", "/api/v1/contacts", strings.NewReader(newContact))
+	s.Equal(http.StatusCreated, rr.Code)
+	s.Equal("/api/v1/contacts/1", rr.Header().Get("Location"))
+
+	rr = s.do("PUT", "/api/v1/contacts/1", strings.NewReader(`{"id": "7", "first_name": "tommy", "email": "tom.dobs@gmail.com"}`))
+	s.Equal(http.StatusOK, rr.Code)
+	s.Contains(rr.Body.String(), `"id":"1"`, "the id of the path wins over the body")
+
+	rr = s.do("GET", "/api/v1/contacts/1", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Contains(rr.Body.String(), `"first_name":"tommy"`)
+	rr = s.do("GET", "/api/v1/contacts", nil)
+	contacts := []models.Contact{}
+	s.NoError(json.Unmarshal(rr.Body.Bytes(), &contacts))
+	s.Len(contacts, 1)
+	s.Equal(http.StatusOK, s.do("GET", "/api/v1/contacts/duplicates", nil).Code, "named routes win over the contact id")
+	s.problem(s.do("GET", "/api/v1/contacts/abc", nil), http.StatusBadRequest, models.CodeInvalidID)
+
+	s.Equal(http.StatusNoContent, s.do("DELETE", "/api/v1/contacts/1", nil).Code)
+	s.problem(s.do("GET", "/api/v1/contacts/1", nil), http.StatusNotFound, models.CodeNotFound)
+	s.problem(s.do("GET", "/api/entry?id=1", nil), http.StatusNotFound, models.CodeNotFound)
+}
+
+func (s *contractSuite) TestContactVCard() {
+	contact := s.create(newContact)
+	rr := s.do("GET", "/api/v1/contacts/"+contact.ID+".vcf", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Equal("attachment; filename=contact-1.vcf", rr.Header().Get("Content-Disposition"))
+	s.Contains(rr.Body.String(), "FN:tom dob\r\n")
+
+	s.problem(s.do("GET", "/api/v1/contacts/99.vcf", nil), http.StatusNotFound, models.CodeNotFound)
+	s.problem(s.do("GET", "/api/v1/contacts/abc.vcf", nil), http.StatusBadRequest, models.CodeInvalidID)
+}
+
+func (s *contractSuite) TestContactQRCode() {
+	contact := s.create(newContact)
+	rr := s.do("GET", "/api/v1/contacts/"+contact.ID+"/qr.png?format=mecard&size=128&ecc=H", nil)
+	s.Equal(http.StatusOK, rr.Code)
+	s.Equal("image/png", rr.Header().Get("Content-Type"))
+	img, err := png.Decode(rr.Body)
+	s.NoError(err)
+	s.True(img.Bounds().Dx() <= 128)
+
+	s.problem(s.do("GET", "/api/v1/contacts/"+contact.ID+"/qr.png?size=10", nil), http.StatusBadRequest, models.CodeInvalidParameter)
+	s.problem(s.do("GET", "/api/v1/contacts/"+contact.ID+"/qr.png?ecc=Z", nil), http.StatusBadRequest, models.CodeInvalidParameter)
+	s.problem(s.do("GET", "/api/v1/contacts/99/qr.png", nil), http.StatusNotFound, models.CodeNotFound)
+}
+
+// csvUpload builds a multipart body uploading data as a csv file
+func (s *contractSuite) csvUpload(data string) (io.Reader, string) {
+	return s.upload("contacts.csv", "text/csv", data)
+}
+
+// upload builds a multipart body uploading data as a file
+func (s *contractSuite) upload(filename, contentType, data string) (io.Reader, string) {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	mh := make(textproto.MIMEHeader)
+	mh.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filename))
+	mh.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(mh)
+	s.NoError(err)
+	part.Write([]byte(data))
+	s.NoError(writer.Close())
+	return body, writer.FormDataContentType()
+}
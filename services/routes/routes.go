@@ -11,12 +11,30 @@ type Routes interface {
 	RouteList() []Route
 }
 
+// api versions routes are grouped by
+const (
+	// V1 the flat contact shape, the unversioned /api/entry routes included
+	V1 = "v1"
+	// V2 the contact shape listing every email, phone and address
+	V2 = "v2"
+)
+
+// Prefix returns the path prefix of the routes of version
+func Prefix(version string) string {
+	return "/api/" + version
+}
+
 // Route is a single route or endpoint
 type Route struct {
 	Name        string
 	Method      string
 	Pattern     string
 	HandlerFunc http.HandlerFunc
+	// Version api version the route belongs to, empty for routes outside of any version
+	Version string
+	// Successor path of the route replacing a deprecated route, empty while the route is current. Its variables
+	// are filled from the variables or queries of the deprecated request
+	Successor string
 }
 
 // routes is an implementation of the Routes interface
@@ -33,50 +51,245 @@ func NewRoutes(
 	}
 }
 
-// RouteList returns an array of Routes
+// RouteList returns an array of Routes, the v1 and v2 groups share the store so both read and write
+// the same contacts
 func (r *routes) RouteList() []Route {
+	return append(append(r.v1(), r.v2()...), Route{
+		"NotFound",
+		"",
+		"",
+		r.connector.NotFound,
+		"",
+		"",
+	})
+}
+
+// v1 returns the routes of the flat contact shape, the contact routes are deprecated by the matching v2 routes.
+// The /api/entry routes are aliases of the /api/v1/contacts routes kept for older clients
+func (r *routes) v1() []Route {
 	return []Route{
+		Route{
+			"CreateContactV1",
+			"POST",
+			"/api/v1/contacts",
+			r.connector.CreateContact,
+			V1,
+			"/api/v2/contacts",
+		},
+		Route{
+			"ListContactsV1",
+			"GET",
+			"/api/v1/contacts",
+			r.connector.ListContacts,
+			V1,
+			"/api/v2/contacts",
+		},
 		Route{
 			"CreateContact",
 			"POST",
 			"/api/entry",
 			r.connector.CreateContact,
+			V1,
+			"/api/v2/contacts",
 		},
 		Route{
 			"GetContact",
 			"GET",
 			"/api/entry",
 			r.connector.GetContacts,
+			V1,
+			"/api/v2/contacts/{id}",
 		},
 		Route{
 			"UpdateContact",
 			"PUT",
 			"/api/entry",
 			r.connector.UpdateContact,
+			V1,
+			"/api/v2/contacts/{id}",
+		},
+		Route{
+			"UpsertContactByEmail",
+			"PUT",
+			"/api/v1/contacts/by-email/{email}",
+			r.connector.UpsertContactByEmail,
+			V1,
+			"",
 		},
 		Route{
 			"DeleteContact",
 			"DELETE",
 			"/api/entry",
 			r.connector.DeleteContact,
+			V1,
+			"/api/v2/contacts/{id}",
 		},
 		Route{
 			"ExportContacts",
 			"GET",
 			"/api/entry/export",
 			r.connector.ExportContacts,
+			V1,
+			"",
+		},
+		Route{
+			"ExportContactVCard",
+			"GET",
+			"/api/v1/contacts/{id}.vcf",
+			r.connector.ExportContactVCard,
+			V1,
+			"",
+		},
+		Route{
+			"ContactQRCode",
+			"GET",
+			"/api/v1/contacts/{id}/qr.png",
+			r.connector.ContactQRCode,
+			V1,
+			"",
 		},
 		Route{
 			"ImportContacts",
 			"POST",
 			"/api/entry/import",
 			r.connector.ImportContacts,
+			V1,
+			"",
+		},
+		Route{
+			"SubmitImport",
+			"POST",
+			"/api/v1/imports",
+			r.connector.SubmitImport,
+			V1,
+			"",
 		},
 		Route{
-			"NotFound",
+			"GetImport",
+			"GET",
+			"/api/v1/imports/{id}",
+			r.connector.GetImport,
+			V1,
 			"",
+		},
+		Route{
+			"CancelImport",
+			"DELETE",
+			"/api/v1/imports/{id}",
+			r.connector.CancelImport,
+			V1,
+			"",
+		},
+		Route{
+			"SubmitExport",
+			"POST",
+			"/api/v1/exports",
+			r.connector.SubmitExport,
+			V1,
+			"",
+		},
+		Route{
+			"GetExport",
+			"GET",
+			"/api/v1/exports/{id}",
+			r.connector.GetExport,
+			V1,
+			"",
+		},
+		Route{
+			"DownloadExport",
+			"GET",
+			"/api/v1/exports/{id}/download",
+			r.connector.DownloadExport,
+			V1,
+			"",
+		},
+		Route{
+			"FindDuplicates",
+			"GET",
+			"/api/v1/contacts/duplicates",
+			r.connector.FindDuplicates,
+			V1,
+			"",
+		},
+		Route{
+			"MergeContacts",
+			"POST",
+			"/api/v1/contacts/merge",
+			r.connector.MergeContacts,
+			V1,
+			"",
+		},
+		// {id} matches any segment so the contact routes come after the other /api/v1/contacts routes
+		Route{
+			"GetContactV1",
+			"GET",
+			"/api/v1/contacts/{id}",
+			r.connector.GetContacts,
+			V1,
+			"/api/v2/contacts/{id}",
+		},
+		Route{
+			"UpdateContactV1",
+			"PUT",
+			"/api/v1/contacts/{id}",
+			r.connector.UpdateContact,
+			V1,
+			"/api/v2/contacts/{id}",
+		},
+		Route{
+			"DeleteContactV1",
+			"DELETE",
+			"/api/v1/contacts/{id}",
+			r.connector.DeleteContact,
+			V1,
+			"/api/v2/contacts/{id}",
+		},
+	}
+}
+
+// v2 returns the routes of the contact shape listing every email, phone and address
+func (r *routes) v2() []Route {
+	return []Route{
+		Route{
+			"CreateContactV2",
+			"POST",
+			"/api/v2/contacts",
+			r.connector.CreateContactV2,
+			V2,
+			"",
+		},
+		Route{
+			"ListContactsV2",
+			"GET",
+			"/api/v2/contacts",
+			r.connector.ListContactsV2,
+			V2,
+			"",
+		},
+		Route{
+			"GetContactV2",
+			"GET",
+			"/api/v2/contacts/{id}",
+			r.connector.GetContactV2,
+			V2,
+			"",
+		},
+		Route{
+			"UpdateContactV2",
+			"PUT",
+			"/api/v2/contacts/{id}",
+			r.connector.UpdateContactV2,
+			V2,
+			"",
+		},
+		Route{
+			"DeleteContactV2",
+			"DELETE",
+			"/api/v2/contacts/{id}",
+			r.connector.DeleteContactV2,
+			V2,
 			"",
-			r.connector.NotFound,
 		},
 	}
 }